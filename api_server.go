@@ -0,0 +1,516 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"spotidownloader/backend"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment variables that start the API server together with the app
+const (
+	apiAddrEnv  = "SPOTIDOWNLOADER_API_ADDR"
+	apiTokenEnv = "SPOTIDOWNLOADER_API_TOKEN"
+)
+
+// Largest request body the API server accepts
+const apiMaxBodySize = 10 << 20
+
+// APIServerStatus describes the embedded HTTP API server
+type APIServerStatus struct {
+	Running bool   `json:"running"`
+	Address string `json:"address,omitempty"`
+}
+
+// apiServer is the embedded HTTP/JSON API exposing the App operations to scripts and other machines
+type apiServer struct {
+	mu       sync.Mutex
+	server   *http.Server
+	listener net.Listener
+	cancel   context.CancelFunc // Ends open event streams
+}
+
+// StartAPIServer starts the HTTP API on addr (e.g. "0.0.0.0:8765"). Every request must send "Authorization: Bearer <token>".
+func (a *App) StartAPIServer(addr, token string) (APIServerStatus, error) {
+	if addr == "" {
+		return APIServerStatus{}, fmt.Errorf("listen address is required")
+	}
+	if token == "" {
+		return APIServerStatus{}, fmt.Errorf("API token is required")
+	}
+
+	a.api.mu.Lock()
+	defer a.api.mu.Unlock()
+
+	if a.api.server != nil {
+		return APIServerStatus{}, fmt.Errorf("API server is already running on %s", a.api.listener.Addr())
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return APIServerStatus{}, fmt.Errorf("failed to listen on %s: %v", addr, err)
+	}
+
+	baseCtx, cancel := context.WithCancel(context.Background())
+	server := &http.Server{
+		Handler:           requireBearerToken(token, a.apiRoutes()),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return baseCtx },
+	}
+	a.api.server = server
+	a.api.listener = listener
+	a.api.cancel = cancel
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("[API] Server stopped: %v\n", err)
+		}
+	}()
+
+	fmt.Printf("[API] Listening on %s\n", listener.Addr())
+	return APIServerStatus{Running: true, Address: listener.Addr().String()}, nil
+}
+
+// StopAPIServer stops the HTTP API, closing open event streams
+func (a *App) StopAPIServer() error {
+	a.api.mu.Lock()
+	defer a.api.mu.Unlock()
+
+	if a.api.server == nil {
+		return nil
+	}
+
+	// Event streams never finish on their own
+	a.api.cancel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := a.api.server.Shutdown(ctx)
+	if err != nil {
+		err = a.api.server.Close()
+	}
+	a.api.server = nil
+	a.api.listener = nil
+	a.api.cancel = nil
+	return err
+}
+
+// GetAPIServerStatus reports whether the HTTP API is running and where
+func (a *App) GetAPIServerStatus() APIServerStatus {
+	a.api.mu.Lock()
+	defer a.api.mu.Unlock()
+
+	if a.api.server == nil {
+		return APIServerStatus{}
+	}
+	return APIServerStatus{Running: true, Address: a.api.listener.Addr().String()}
+}
+
+// startAPIServerFromEnv starts the API server when SPOTIDOWNLOADER_API_ADDR and SPOTIDOWNLOADER_API_TOKEN are set
+func (a *App) startAPIServerFromEnv() {
+	addr := os.Getenv(apiAddrEnv)
+	if addr == "" {
+		return
+	}
+	if _, err := a.StartAPIServer(addr, os.Getenv(apiTokenEnv)); err != nil {
+		fmt.Printf("Warning: Failed to start API server: %v\n", err)
+	}
+}
+
+func (a *App) apiRoutes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/health", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIJSON(w, http.StatusOK, map[string]string{"status": "ok", "time": time.Now().Format(time.RFC3339)})
+	})
+
+	mux.HandleFunc("POST /api/metadata", func(w http.ResponseWriter, r *http.Request) {
+		var req SpotifyMetadataRequest
+		if !decodeAPIRequest(w, r, &req) {
+			return
+		}
+		data, err := a.GetSpotifyMetadata(req)
+		if err != nil {
+			writeAPIError(w, http.StatusBadGateway, err)
+			return
+		}
+		// Already JSON
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(data))
+	})
+
+	mux.HandleFunc("POST /api/search", func(w http.ResponseWriter, r *http.Request) {
+		var req SpotifySearchRequest
+		if !decodeAPIRequest(w, r, &req) {
+			return
+		}
+		resp, err := a.SearchSpotify(req)
+		respondAPI(w, resp, err)
+	})
+
+	mux.HandleFunc("POST /api/search/type", func(w http.ResponseWriter, r *http.Request) {
+		var req SpotifySearchByTypeRequest
+		if !decodeAPIRequest(w, r, &req) {
+			return
+		}
+		resp, err := a.SearchSpotifyByType(req)
+		respondAPI(w, resp, err)
+	})
+
+	mux.HandleFunc("POST /api/downloads", func(w http.ResponseWriter, r *http.Request) {
+		var reqs []DownloadRequest
+		if !decodeAPIRequest(w, r, &reqs) {
+			return
+		}
+
+		// Scripts usually don't have a session token; fetch one for the whole batch
+		var sessionToken string
+		for i := range reqs {
+			if reqs[i].SessionToken != "" {
+				continue
+			}
+			if sessionToken == "" {
+				token, err := backend.FetchSessionToken()
+				if err != nil {
+					writeAPIError(w, http.StatusBadGateway, fmt.Errorf("failed to fetch session token: %v", err))
+					return
+				}
+				sessionToken = token
+			}
+			reqs[i].SessionToken = sessionToken
+		}
+
+		resp, err := a.QueueDownloads(reqs)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeAPIJSON(w, http.StatusAccepted, resp)
+	})
+
+	mux.HandleFunc("GET /api/queue", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIJSON(w, http.StatusOK, a.GetDownloadQueue())
+	})
+
+	mux.HandleFunc("GET /api/queue/events", a.serveQueueEvents)
+
+	mux.HandleFunc("POST /api/queue/items/{id}/{action}", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		var err error
+		switch r.PathValue("action") {
+		case "pause":
+			err = a.PauseDownloadItem(id)
+		case "resume":
+			err = a.ResumeDownloadItem(id)
+		case "cancel":
+			err = a.CancelDownloadItem(id)
+		default:
+			writeAPIError(w, http.StatusNotFound, fmt.Errorf("unknown action: %s", r.PathValue("action")))
+			return
+		}
+		if err != nil {
+			writeAPIError(w, http.StatusNotFound, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("POST /api/queue/clear", func(w http.ResponseWriter, r *http.Request) {
+		a.ClearCompletedDownloads()
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("GET /api/sync/subscriptions", func(w http.ResponseWriter, r *http.Request) {
+		subs, err := a.GetSyncSubscriptions()
+		respondAPI(w, subs, err)
+	})
+
+	mux.HandleFunc("POST /api/sync/subscriptions", func(w http.ResponseWriter, r *http.Request) {
+		var sub backend.SyncSubscription
+		if !decodeAPIRequest(w, r, &sub) {
+			return
+		}
+		created, err := a.AddSyncSubscription(sub)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeAPIJSON(w, http.StatusCreated, created)
+	})
+
+	mux.HandleFunc("DELETE /api/sync/subscriptions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if err := a.RemoveSyncSubscription(r.PathValue("id")); err != nil {
+			writeAPIError(w, http.StatusNotFound, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("POST /api/sync/subscriptions/{id}/sync", func(w http.ResponseWriter, r *http.Request) {
+		result, err := a.SyncSubscription(r.PathValue("id"))
+		respondAPI(w, result, err)
+	})
+
+	mux.HandleFunc("POST /api/sync", func(w http.ResponseWriter, r *http.Request) {
+		results, err := a.SyncAllSubscriptions()
+		respondAPI(w, results, err)
+	})
+
+	mux.HandleFunc("POST /api/sync/subscriptions/{id}/playlist", func(w http.ResponseWriter, r *http.Request) {
+		files, err := a.WriteSyncPlaylistFiles(r.PathValue("id"))
+		respondAPI(w, files, err)
+	})
+
+	mux.HandleFunc("POST /api/playlists/files", func(w http.ResponseWriter, r *http.Request) {
+		var req PlaylistFilesRequest
+		if !decodeAPIRequest(w, r, &req) {
+			return
+		}
+		files, err := a.WritePlaylistFiles(req)
+		respondAPI(w, files, err)
+	})
+
+	mux.HandleFunc("GET /api/library/roots", func(w http.ResponseWriter, r *http.Request) {
+		roots, err := a.GetLibraryRoots()
+		respondAPI(w, roots, err)
+	})
+
+	mux.HandleFunc("PUT /api/library/roots", func(w http.ResponseWriter, r *http.Request) {
+		var roots []string
+		if !decodeAPIRequest(w, r, &roots) {
+			return
+		}
+		if err := a.SetLibraryRoots(roots); err != nil {
+			writeAPIError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("POST /api/library/scan", func(w http.ResponseWriter, r *http.Request) {
+		if err := a.ScanLibrary(); err != nil {
+			writeAPIError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("POST /api/library/files", func(w http.ResponseWriter, r *http.Request) {
+		var query backend.LibraryQuery
+		if !decodeAPIRequest(w, r, &query) {
+			return
+		}
+		files, err := a.FindLibraryFiles(query)
+		respondAPI(w, files, err)
+	})
+
+	mux.HandleFunc("POST /api/library/duplicates", func(w http.ResponseWriter, r *http.Request) {
+		var opts backend.DuplicateOptions
+		if !decodeAPIRequest(w, r, &opts) {
+			return
+		}
+		groups, err := a.FindDuplicates(opts)
+		respondAPI(w, groups, err)
+	})
+
+	mux.HandleFunc("POST /api/library/duplicates/cleanup", func(w http.ResponseWriter, r *http.Request) {
+		var req backend.DuplicateCleanupRequest
+		if !decodeAPIRequest(w, r, &req) {
+			return
+		}
+		ops, err := a.CleanupDuplicates(req)
+		respondAPI(w, ops, err)
+	})
+
+	mux.HandleFunc("POST /api/lyrics", func(w http.ResponseWriter, r *http.Request) {
+		var req LyricsDownloadRequest
+		if !decodeAPIRequest(w, r, &req) {
+			return
+		}
+		resp, err := a.DownloadLyrics(req)
+		respondAPI(w, resp, err)
+	})
+
+	mux.HandleFunc("POST /api/cover", func(w http.ResponseWriter, r *http.Request) {
+		var req CoverDownloadRequest
+		if !decodeAPIRequest(w, r, &req) {
+			return
+		}
+		resp, err := a.DownloadCover(req)
+		respondAPI(w, resp, err)
+	})
+
+	mux.HandleFunc("POST /api/convert", func(w http.ResponseWriter, r *http.Request) {
+		var req ConvertAudioRequest
+		if !decodeAPIRequest(w, r, &req) {
+			return
+		}
+		resp, err := a.ConvertAudio(req)
+		respondAPI(w, resp, err)
+	})
+
+	mux.HandleFunc("POST /api/analyze", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			FilePath string `json:"file_path"`
+		}
+		if !decodeAPIRequest(w, r, &req) {
+			return
+		}
+		data, err := a.AnalyzeTrack(req.FilePath)
+		if err != nil {
+			writeAPIError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(data))
+	})
+
+	mux.HandleFunc("POST /api/tags/read", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			FilePath string `json:"file_path"`
+		}
+		if !decodeAPIRequest(w, r, &req) {
+			return
+		}
+		tags, err := a.ReadAllTags(req.FilePath)
+		respondAPI(w, tags, err)
+	})
+
+	mux.HandleFunc("POST /api/tags/write", func(w http.ResponseWriter, r *http.Request) {
+		var req backend.TagWriteRequest
+		if !decodeAPIRequest(w, r, &req) {
+			return
+		}
+		results, err := a.WriteTags(req)
+		respondAPI(w, results, err)
+	})
+
+	mux.HandleFunc("POST /api/library/retag", func(w http.ResponseWriter, r *http.Request) {
+		var req backend.RetagRequest
+		if !decodeAPIRequest(w, r, &req) {
+			return
+		}
+		results, err := a.RetagFiles(req)
+		respondAPI(w, results, err)
+	})
+
+	mux.HandleFunc("POST /api/loudness", func(w http.ResponseWriter, r *http.Request) {
+		var req backend.LoudnessScanRequest
+		if !decodeAPIRequest(w, r, &req) {
+			return
+		}
+		results, err := a.ScanLoudness(req)
+		respondAPI(w, results, err)
+	})
+
+	return mux
+}
+
+// serveQueueEvents streams the download queue as Server-Sent Events.
+// The first "queue" event carries the full DownloadQueueInfo; after that every change is sent as a "download" event.
+func (a *App) serveQueueEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	// Subscribe before taking the snapshot so no change falls in between
+	events, unsubscribe := backend.SubscribeDownloadEvents()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	if err := writeSSE(w, "queue", a.GetDownloadQueue()); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := writeSSE(w, "download", event); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
+
+// requireBearerToken rejects requests that don't carry the API token
+func requireBearerToken(token string, next http.Handler) http.Handler {
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(strings.TrimSpace(r.Header.Get("Authorization")))
+		if subtle.ConstantTimeCompare(got, expected) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="spotidownloader"`)
+			writeAPIError(w, http.StatusUnauthorized, fmt.Errorf("invalid or missing API token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decodeAPIRequest decodes a JSON request body, writing a 400 response and returning false on failure
+func decodeAPIRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, apiMaxBodySize)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+// respondAPI writes v as JSON, or the error as a 422 if the operation failed
+func respondAPI(w http.ResponseWriter, v interface{}, err error) {
+	if err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, v)
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Printf("[API] Failed to encode response: %v\n", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeAPIJSON(w, status, map[string]string{"error": err.Error()})
+}
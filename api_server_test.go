@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireBearerToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"valid", "Bearer secret", http.StatusOK},
+		{"surrounding whitespace", "  Bearer secret ", http.StatusOK},
+		{"missing", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer secrets", http.StatusUnauthorized},
+		{"token prefix", "Bearer secre", http.StatusUnauthorized},
+		{"no scheme", "secret", http.StatusUnauthorized},
+		{"basic scheme", "Basic secret", http.StatusUnauthorized},
+		{"lowercase scheme", "bearer secret", http.StatusUnauthorized},
+	}
+
+	handler := requireBearerToken("secret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/health", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("Authorization %q: status %d, want %d", tt.header, rec.Code, tt.want)
+			}
+			if tt.want != http.StatusUnauthorized {
+				return
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); got == "" {
+				t.Error("401 without a WWW-Authenticate header")
+			}
+			var body map[string]string
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body["error"] == "" {
+				t.Errorf("401 body is not a JSON error: %v", err)
+			}
+		})
+	}
+}
+
+func TestStartAPIServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		addr    string
+		token   string
+		wantErr bool
+	}{
+		{"missing address", "", "secret", true},
+		{"missing token", "127.0.0.1:0", "", true},
+		{"valid", "127.0.0.1:0", "secret", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &App{}
+			status, err := a.StartAPIServer(tt.addr, tt.token)
+			defer a.StopAPIServer()
+			if tt.wantErr {
+				if err == nil || status.Running {
+					t.Errorf("StartAPIServer(%q, %q) = %+v, want an error", tt.addr, tt.token, status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Keep-alive connections would hold up StopAPIServer
+			client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+			for header, want := range map[string]int{"": http.StatusUnauthorized, "Bearer " + tt.token: http.StatusOK} {
+				req, _ := http.NewRequest(http.MethodGet, "http://"+status.Address+"/api/health", nil)
+				if header != "" {
+					req.Header.Set("Authorization", header)
+				}
+				resp, err := client.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != want {
+					t.Errorf("Authorization %q: status %d, want %d", header, resp.StatusCode, want)
+				}
+			}
+
+			if _, err := a.StartAPIServer(tt.addr, tt.token); err == nil {
+				t.Error("started a second server while one was running")
+			}
+			if err := a.StopAPIServer(); err != nil {
+				t.Fatal(err)
+			}
+			if a.GetAPIServerStatus().Running {
+				t.Error("server still running after StopAPIServer")
+			}
+		})
+	}
+}
@@ -10,11 +10,18 @@ import (
 	"spotidownloader/backend"
 	"strings"
 	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
+// Wails event carrying backend.DownloadEvent values to the frontend
+const downloadEventName = "download:event"
+
 // App struct
 type App struct {
-	ctx context.Context
+	ctx                context.Context
+	stopDownloadEvents func()
+	api                apiServer
 }
 
 // NewApp creates a new App application struct
@@ -26,6 +33,47 @@ func NewApp() *App {
 // so we can call the runtime methods
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
+
+	// Push download queue changes to the frontend instead of having it poll
+	events, stop := backend.SubscribeDownloadEvents()
+	a.stopDownloadEvents = stop
+	go func() {
+		for event := range events {
+			runtime.EventsEmit(ctx, downloadEventName, event)
+		}
+	}()
+
+	// Restore the download queue left over from the previous run
+	if err := backend.LoadDownloadQueue(); err != nil {
+		fmt.Printf("Warning: Failed to restore download queue: %v\n", err)
+	}
+
+	backend.StartPlaylistSync(a.enqueueSyncTracks)
+
+	// Keep the library database current when files change outside the app
+	if err := backend.StartLibraryWatcher(); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	a.startAPIServerFromEnv()
+}
+
+// shutdown is called when the app is closing
+func (a *App) shutdown(ctx context.Context) {
+	backend.StopPlaylistSync()
+	if err := a.StopAPIServer(); err != nil {
+		fmt.Printf("Warning: Failed to stop API server: %v\n", err)
+	}
+	if a.stopDownloadEvents != nil {
+		a.stopDownloadEvents()
+	}
+	if err := backend.CloseDownloadQueue(); err != nil {
+		fmt.Printf("Warning: Failed to close download queue journal: %v\n", err)
+	}
+	backend.StopLibraryWatcher()
+	if err := backend.CloseLibraryDB(); err != nil {
+		fmt.Printf("Warning: Failed to close library database: %v\n", err)
+	}
 }
 
 // SpotifyMetadataRequest represents the request structure for fetching Spotify metadata
@@ -38,28 +86,42 @@ type SpotifyMetadataRequest struct {
 
 // DownloadRequest represents the request structure for downloading tracks
 type DownloadRequest struct {
-	ISRC                 string `json:"isrc"`
-	TrackID              string `json:"track_id,omitempty"`
-	SessionToken         string `json:"session_token"`
-	TrackName            string `json:"track_name,omitempty"`
-	ArtistName           string `json:"artist_name,omitempty"`
-	AlbumName            string `json:"album_name,omitempty"`
-	AlbumArtist          string `json:"album_artist,omitempty"`
-	ReleaseDate          string `json:"release_date,omitempty"`
-	CoverURL             string `json:"cover_url,omitempty"`
-	AlbumTrackNumber     int    `json:"album_track_number,omitempty"`
-	DiscNumber           int    `json:"disc_number,omitempty"`
-	TotalTracks          int    `json:"total_tracks,omitempty"` // Total tracks in album from Spotify
-	OutputDir            string `json:"output_dir,omitempty"`
-	AudioFormat          string `json:"audio_format,omitempty"`
-	FilenameFormat       string `json:"filename_format,omitempty"`
-	TrackNumber          bool   `json:"track_number,omitempty"`
-	Position             int    `json:"position,omitempty"`                // Position in playlist/album (1-based)
-	UseAlbumTrackNumber  bool   `json:"use_album_track_number,omitempty"`  // Use album track number instead of playlist position
-	SpotifyID            string `json:"spotify_id,omitempty"`              // Spotify track ID
-	EmbedLyrics          bool   `json:"embed_lyrics,omitempty"`            // Whether to embed lyrics into the audio file
-	EmbedMaxQualityCover bool   `json:"embed_max_quality_cover,omitempty"` // Whether to embed max quality cover art
-	ItemID               string `json:"item_id,omitempty"`                 // Optional queue item ID for tracking
+	ISRC                 string   `json:"isrc"`
+	TrackID              string   `json:"track_id,omitempty"`
+	SessionToken         string   `json:"session_token"`
+	TrackName            string   `json:"track_name,omitempty"`
+	ArtistName           string   `json:"artist_name,omitempty"`
+	Artists              []string `json:"artists,omitempty"`      // Individual track artists, tagged as separate values
+	JoinArtists          bool     `json:"join_artists,omitempty"` // Tag only artist_name, for players without multi-value tag support
+	AlbumName            string   `json:"album_name,omitempty"`
+	AlbumArtist          string   `json:"album_artist,omitempty"`
+	ReleaseDate          string   `json:"release_date,omitempty"`
+	AlbumType            string   `json:"album_type,omitempty"`
+	CoverURL             string   `json:"cover_url,omitempty"`
+	AlbumTrackNumber     int      `json:"album_track_number,omitempty"`
+	DiscNumber           int      `json:"disc_number,omitempty"`
+	TotalTracks          int      `json:"total_tracks,omitempty"` // Total tracks in album from Spotify
+	TotalDiscs           int      `json:"total_discs,omitempty"`
+	AlbumID              string   `json:"album_id,omitempty"` // Spotify album ID
+	Label                string   `json:"label,omitempty"`
+	Copyright            string   `json:"copyright,omitempty"`
+	Genres               []string `json:"genres,omitempty"`
+	DurationMS           int      `json:"duration_ms,omitempty"`
+	OutputDir            string   `json:"output_dir,omitempty"`
+	AudioFormat          string   `json:"audio_format,omitempty"`
+	FolderTemplate       string   `json:"folder_template,omitempty"` // Sub-folders below output_dir, e.g. {artist}/{album}
+	PlaylistName         string   `json:"playlist_name,omitempty"`   // Value of {playlist} in the folder template
+	FilenameFormat       string   `json:"filename_format,omitempty"`
+	Filesystem           string   `json:"filesystem,omitempty"` // windows, fat or posix; decides which names are valid
+	TrackNumber          bool     `json:"track_number,omitempty"`
+	Position             int      `json:"position,omitempty"`                // Position in playlist/album (1-based)
+	UseAlbumTrackNumber  bool     `json:"use_album_track_number,omitempty"`  // Use album track number instead of playlist position
+	SpotifyID            string   `json:"spotify_id,omitempty"`              // Spotify track ID
+	EmbedLyrics          bool     `json:"embed_lyrics,omitempty"`            // Whether to embed lyrics into the audio file
+	EmbedMaxQualityCover bool     `json:"embed_max_quality_cover,omitempty"` // Whether to embed max quality cover art
+	ItemID               string   `json:"item_id,omitempty"`                 // Optional queue item ID for tracking
+	ProviderOrder        []string `json:"provider_order,omitempty"`          // Download providers to try, in order
+	FormatPolicy         string   `json:"format_policy,omitempty"`           // flac-only, prefer-flac or mp3-only (derived from audio_format when empty)
 }
 
 // DownloadResponse represents the response structure for download operations
@@ -70,6 +132,12 @@ type DownloadResponse struct {
 	Error         string `json:"error,omitempty"`
 	AlreadyExists bool   `json:"already_exists,omitempty"`
 	ItemID        string `json:"item_id,omitempty"` // Queue item ID for tracking
+	Format        string `json:"format,omitempty"`  // Audio format actually received (flac or mp3)
+}
+
+// formatFromPath returns the audio format of a downloaded file based on its extension
+func formatFromPath(path string) string {
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
 }
 
 // Spotify OAuth helpers
@@ -187,6 +255,11 @@ func (a *App) SearchSpotifyByType(req SpotifySearchByTypeRequest) ([]backend.Sea
 
 // DownloadTrack downloads a track using spotidownloader API
 func (a *App) DownloadTrack(req DownloadRequest) (DownloadResponse, error) {
+	return a.downloadTrack(context.Background(), req)
+}
+
+// downloadTrack downloads a single track; cancelling ctx aborts the transfer
+func (a *App) downloadTrack(ctx context.Context, req DownloadRequest) (DownloadResponse, error) {
 	if req.TrackID == "" && req.ISRC == "" {
 		return DownloadResponse{
 			Success: false,
@@ -212,11 +285,58 @@ func (a *App) DownloadTrack(req DownloadRequest) (DownloadResponse, error) {
 		req.AudioFormat = "mp3"
 	}
 
+	formatPolicy, err := backend.ResolveFormatPolicy(req.FormatPolicy, req.AudioFormat)
+	if err != nil {
+		return DownloadResponse{
+			Success: false,
+			Error:   err.Error(),
+		}, err
+	}
+	req.FormatPolicy = formatPolicy
+	// Keep the audio format consistent with the policy for the existing-file checks
+	if formatPolicy == backend.FormatPolicyMp3Only {
+		req.AudioFormat = "mp3"
+	} else {
+		req.AudioFormat = "flac"
+	}
+
 	// Set default filename format if not provided
 	if req.FilenameFormat == "" {
-		req.FilenameFormat = "title-artist"
+		req.FilenameFormat = backend.DefaultFilenameFormat
 	}
 
+	filesystem, err := backend.ResolveFilesystem(req.Filesystem)
+	if err != nil {
+		return DownloadResponse{
+			Success: false,
+			Error:   err.Error(),
+		}, err
+	}
+
+	// The folder template is resolved here rather than stored in OutputDir so a resumed request renders it once
+	pathTemplate := backend.PathTemplate{Folder: req.FolderTemplate, Filename: req.FilenameFormat, TrackNumber: req.TrackNumber, Filesystem: filesystem}
+	pathData := backend.PathTemplateData{
+		Title:       req.TrackName,
+		Artist:      req.ArtistName,
+		Album:       req.AlbumName,
+		AlbumArtist: req.AlbumArtist,
+		ReleaseDate: req.ReleaseDate,
+		AlbumType:   req.AlbumType,
+		ISRC:        req.ISRC,
+		SpotifyID:   req.SpotifyID,
+		Playlist:    req.PlaylistName,
+		Track:       req.Position,
+		Disc:        req.DiscNumber,
+		Position:    req.Position,
+	}
+	if pathData.SpotifyID == "" && req.TrackID != req.ISRC {
+		pathData.SpotifyID = req.TrackID
+	}
+	if req.UseAlbumTrackNumber && req.AlbumTrackNumber > 0 {
+		pathData.Track = req.AlbumTrackNumber
+	}
+	outputDir := pathTemplate.Dir(req.OutputDir, pathData)
+
 	// ItemID should always be provided by frontend (created via AddToDownloadQueue)
 	// If not provided, generate one for backwards compatibility
 	itemID := req.ItemID
@@ -226,10 +346,16 @@ func (a *App) DownloadTrack(req DownloadRequest) (DownloadResponse, error) {
 		backend.AddToQueue(itemID, req.TrackName, req.ArtistName, req.AlbumName, req.ISRC)
 	}
 
+	// Journal the request so the item can be resumed after a crash (session tokens are short-lived, don't keep them)
+	journaledReq := req
+	journaledReq.SessionToken = ""
+	journaledReq.ItemID = itemID
+	if err := backend.AttachQueueRequest(itemID, journaledReq); err != nil {
+		fmt.Printf("Warning: Failed to journal download request: %v\n", err)
+	}
+
 	// Mark item as downloading immediately
-	backend.SetDownloading(true)
 	backend.StartDownloadItem(itemID)
-	defer backend.SetDownloading(false)
 
 	// Early check: Check if file with same ISRC already exists
 	if req.ISRC != "" {
@@ -242,6 +368,7 @@ func (a *App) DownloadTrack(req DownloadRequest) (DownloadResponse, error) {
 				File:          existingFile,
 				AlreadyExists: true,
 				ItemID:        itemID,
+				Format:        formatFromPath(existingFile),
 			}, nil
 		}
 	}
@@ -252,11 +379,9 @@ func (a *App) DownloadTrack(req DownloadRequest) (DownloadResponse, error) {
 		if req.AudioFormat == "flac" {
 			fileExt = ".flac"
 		}
-		expectedFilename := backend.BuildFilename(req.TrackName, req.ArtistName, req.AlbumName, req.AlbumArtist, req.ReleaseDate, req.DiscNumber, req.FilenameFormat, req.TrackNumber, req.Position, req.UseAlbumTrackNumber)
-		expectedFilename = backend.SanitizeFilename(expectedFilename) + fileExt
-		expectedPath := filepath.Join(req.OutputDir, expectedFilename)
+		expectedPath, err := pathTemplate.FilePath(req.OutputDir, pathData, fileExt)
 
-		if fileInfo, err := os.Stat(expectedPath); err == nil && fileInfo.Size() > 0 {
+		if err == nil && backend.TrackFileExists(expectedPath, req.ISRC) {
 			backend.SkipDownloadItem(itemID, expectedPath)
 			return DownloadResponse{
 				Success:       true,
@@ -264,6 +389,7 @@ func (a *App) DownloadTrack(req DownloadRequest) (DownloadResponse, error) {
 				File:          expectedPath,
 				AlreadyExists: true,
 				ItemID:        itemID,
+				Format:        formatFromPath(expectedPath),
 			}, nil
 		}
 	}
@@ -274,7 +400,17 @@ func (a *App) DownloadTrack(req DownloadRequest) (DownloadResponse, error) {
 		trackID = req.ISRC
 	}
 
-	downloader := backend.NewSpotiDownloader(req.SessionToken)
+	downloader := backend.NewSpotiDownloader(req.SessionToken).WithContext(ctx).WithItemID(itemID).WithProviderOrder(req.ProviderOrder).WithFormatPolicy(req.FormatPolicy).WithPathData(pathData).WithBaseDir(req.OutputDir).WithFilesystem(filesystem).WithArtists(req.Artists).WithJoinedArtists(req.JoinArtists).
+		WithExtendedTags(backend.ExtendedTags{
+			SpotifyTrackID: req.SpotifyID,
+			SpotifyAlbumID: req.AlbumID,
+			ReleaseType:    req.AlbumType,
+			Label:          req.Label,
+			Copyright:      req.Copyright,
+			TotalDiscs:     req.TotalDiscs,
+			Genres:         req.Genres,
+			DurationMS:     req.DurationMS,
+		})
 
 	// Determine actual track number to use
 	// Priority: AlbumTrackNumber > Position
@@ -288,7 +424,7 @@ func (a *App) DownloadTrack(req DownloadRequest) (DownloadResponse, error) {
 	filename, err := downloader.DownloadByISRC(
 		trackID,
 		req.ISRC,
-		req.OutputDir,
+		outputDir,
 		req.AudioFormat,
 		req.FilenameFormat,
 		req.TrackNumber,
@@ -395,9 +531,276 @@ func (a *App) DownloadTrack(req DownloadRequest) (DownloadResponse, error) {
 		File:          filename,
 		AlreadyExists: alreadyExists,
 		ItemID:        itemID,
+		Format:        formatFromPath(filename),
 	}, nil
 }
 
+// QueueDownloadsResponse represents the response from queueing a batch of downloads
+type QueueDownloadsResponse struct {
+	BatchID string   `json:"batch_id"`
+	ItemIDs []string `json:"item_ids"`
+}
+
+// QueueDownloads hands a batch of downloads to the backend scheduler and returns immediately.
+// Progress is reported per item through the download queue.
+func (a *App) QueueDownloads(reqs []DownloadRequest) (QueueDownloadsResponse, error) {
+	if len(reqs) == 0 {
+		return QueueDownloadsResponse{}, fmt.Errorf("no downloads to queue")
+	}
+
+	batchID := fmt.Sprintf("batch-%d", time.Now().UnixNano())
+	jobs := make([]backend.DownloadJob, 0, len(reqs))
+	itemIDs := make([]string, 0, len(reqs))
+
+	for i := range reqs {
+		req := reqs[i]
+		if req.ItemID == "" {
+			req.ItemID = fmt.Sprintf("%s-%d", req.ISRC, time.Now().UnixNano())
+		}
+		if !backend.RequeueDownloadItem(req.ItemID) {
+			backend.AddToQueue(req.ItemID, req.TrackName, req.ArtistName, req.AlbumName, req.ISRC)
+		}
+		itemIDs = append(itemIDs, req.ItemID)
+
+		jobs = append(jobs, backend.DownloadJob{
+			ItemID:  req.ItemID,
+			BatchID: batchID,
+			Run: func(ctx context.Context) error {
+				_, err := a.downloadTrack(ctx, req)
+				return err
+			},
+		})
+	}
+
+	backend.GetDownloadScheduler().Submit(jobs...)
+
+	return QueueDownloadsResponse{
+		BatchID: batchID,
+		ItemIDs: itemIDs,
+	}, nil
+}
+
+// enqueueSyncTracks queues the new tracks found by a playlist sync
+func (a *App) enqueueSyncTracks(sub backend.SyncSubscription, tracks []backend.AlbumTrackMetadata, positions []int) error {
+	sessionToken, err := backend.FetchSessionToken()
+	if err != nil {
+		return fmt.Errorf("failed to fetch session token: %v", err)
+	}
+
+	// Album folders number tracks by album, as they do for interactive downloads
+	useAlbumTrackNumber := strings.Contains(sub.FolderTemplate, "{album}")
+
+	reqs := make([]DownloadRequest, 0, len(tracks))
+	for i, track := range tracks {
+		reqs = append(reqs, DownloadRequest{
+			ISRC:                track.ISRC,
+			TrackID:             track.SpotifyID,
+			SessionToken:        sessionToken,
+			TrackName:           track.Name,
+			ArtistName:          track.Artists,
+			Artists:             track.ArtistNames(),
+			AlbumName:           track.AlbumName,
+			AlbumArtist:         track.AlbumArtist,
+			ReleaseDate:         track.ReleaseDate,
+			CoverURL:            track.Images,
+			AlbumTrackNumber:    track.TrackNumber,
+			DiscNumber:          track.DiscNumber,
+			TotalTracks:         track.TotalTracks,
+			TotalDiscs:          track.TotalDiscs,
+			AlbumID:             track.AlbumID,
+			AlbumType:           track.AlbumType,
+			Label:               track.Label,
+			Copyright:           track.Copyright,
+			Genres:              track.Genres,
+			DurationMS:          track.DurationMS,
+			OutputDir:           sub.OutputDir,
+			AudioFormat:         sub.AudioFormat,
+			FilenameFormat:      sub.FilenameFormat,
+			TrackNumber:         sub.TrackNumber,
+			FolderTemplate:      sub.FolderTemplate,
+			Filesystem:          sub.Filesystem,
+			JoinArtists:         sub.JoinArtists,
+			Position:            positions[i],
+			UseAlbumTrackNumber: useAlbumTrackNumber,
+			SpotifyID:           track.SpotifyID,
+		})
+	}
+
+	queued, err := a.QueueDownloads(reqs)
+	if err != nil {
+		return err
+	}
+	if len(sub.PlaylistFormats) > 0 {
+		go a.writeSyncPlaylistWhenDone(sub.ID, queued.ItemIDs)
+	}
+	return nil
+}
+
+// writeSyncPlaylistWhenDone regenerates a subscription's playlist files once all of its queued tracks have finished
+func (a *App) writeSyncPlaylistWhenDone(subID string, itemIDs []string) {
+	events, unsubscribe := backend.SubscribeDownloadEvents()
+	defer unsubscribe()
+
+	pending := make(map[string]bool, len(itemIDs))
+	for _, id := range itemIDs {
+		pending[id] = true
+	}
+
+	// refresh drops items that finished or left the queue; also covers events dropped by a slow subscriber
+	refresh := func() {
+		inQueue := make(map[string]bool, len(pending))
+		for _, item := range backend.GetDownloadQueue().Queue {
+			if !pending[item.ID] {
+				continue
+			}
+			inQueue[item.ID] = true
+			if item.Status == backend.StatusCompleted || item.Status == backend.StatusFailed || item.Status == backend.StatusSkipped {
+				delete(pending, item.ID)
+			}
+		}
+		for id := range pending {
+			if !inQueue[id] {
+				delete(pending, id)
+			}
+		}
+	}
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	refresh()
+	for len(pending) > 0 {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			switch event.Type {
+			case backend.EventItemCompleted, backend.EventItemFailed, backend.EventItemSkipped, backend.EventItemRemoved:
+				delete(pending, event.ItemID)
+			case backend.EventQueueReset:
+				refresh()
+			}
+		case <-ticker.C:
+			refresh()
+		}
+	}
+
+	if _, err := backend.WriteSyncPlaylistFiles(subID); err != nil {
+		fmt.Printf("[Sync] Failed to write playlist files for %s: %v\n", subID, err)
+	}
+}
+
+// PlaylistFilesRequest describes the playlist files to write for downloaded tracks.
+// Tracks come from Tracks, Playlist or UserPlaylist, in that order; FilePaths[i] is the file of the i-th track.
+type PlaylistFilesRequest struct {
+	Name         string                           `json:"name,omitempty"` // Defaults to the playlist's name
+	OutputDir    string                           `json:"output_dir"`
+	Formats      []string                         `json:"formats,omitempty"` // m3u8 (default), pls, xspf
+	Tracks       []backend.AlbumTrackMetadata     `json:"tracks,omitempty"`
+	Playlist     *backend.PlaylistResponsePayload `json:"playlist,omitempty"`
+	UserPlaylist *backend.PlaylistWithTracks      `json:"user_playlist,omitempty"`
+	FilePaths    []string                         `json:"file_paths"` // Empty for tracks that weren't downloaded
+}
+
+// WritePlaylistFiles writes playlist files that keep the playlist order of downloaded tracks
+func (a *App) WritePlaylistFiles(req PlaylistFilesRequest) ([]string, error) {
+	name := req.Name
+	tracks := req.Tracks
+	if len(tracks) == 0 && req.Playlist != nil {
+		tracks = req.Playlist.TrackList
+		if name == "" {
+			name = req.Playlist.PlaylistInfo.Owner.Name
+		}
+	}
+	if len(tracks) == 0 && req.UserPlaylist != nil {
+		tracks = req.UserPlaylist.Tracks
+		if name == "" {
+			name = req.UserPlaylist.Playlist.Name
+		}
+	}
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("no tracks to write")
+	}
+
+	entries := backend.PlaylistFileTracks(tracks, req.FilePaths)
+	return backend.WritePlaylistFiles(name, req.OutputDir, entries, req.Formats)
+}
+
+// WriteSyncPlaylistFiles regenerates the playlist files of a sync subscription
+func (a *App) WriteSyncPlaylistFiles(id string) ([]string, error) {
+	return backend.WriteSyncPlaylistFiles(id)
+}
+
+// GetSyncSubscriptions returns the playlists, albums and artists mirrored to local folders
+func (a *App) GetSyncSubscriptions() ([]backend.SyncSubscription, error) {
+	return backend.GetSyncSubscriptions()
+}
+
+// AddSyncSubscription subscribes a Spotify URL to a local folder
+func (a *App) AddSyncSubscription(sub backend.SyncSubscription) (backend.SyncSubscription, error) {
+	return backend.AddSyncSubscription(sub)
+}
+
+// RemoveSyncSubscription unsubscribes without touching downloaded files
+func (a *App) RemoveSyncSubscription(id string) error {
+	return backend.RemoveSyncSubscription(id)
+}
+
+// SyncSubscription syncs one subscription now and queues its new tracks
+func (a *App) SyncSubscription(id string) (backend.SyncResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	return backend.SyncSubscriptionNow(ctx, id)
+}
+
+// SyncAllSubscriptions syncs every subscription now
+func (a *App) SyncAllSubscriptions() ([]backend.SyncResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+	return backend.SyncAllSubscriptions(ctx)
+}
+
+// SetDownloadWorkers sets how many tracks the scheduler downloads at once
+func (a *App) SetDownloadWorkers(workers int) {
+	backend.GetDownloadScheduler().SetWorkers(workers)
+}
+
+// SetHostConcurrency sets how many transfers may run against the same host at once (0 = unlimited)
+func (a *App) SetHostConcurrency(limit int) {
+	backend.SetHostConcurrency(limit)
+}
+
+// PauseDownloadItem pauses a scheduled download
+func (a *App) PauseDownloadItem(itemID string) error {
+	return backend.GetDownloadScheduler().PauseItem(itemID)
+}
+
+// ResumeDownloadItem resumes a paused download
+func (a *App) ResumeDownloadItem(itemID string) error {
+	return backend.GetDownloadScheduler().ResumeItem(itemID)
+}
+
+// CancelDownloadItem cancels a scheduled download
+func (a *App) CancelDownloadItem(itemID string) error {
+	return backend.GetDownloadScheduler().CancelItem(itemID)
+}
+
+// PauseDownloadBatch pauses every download in a batch
+func (a *App) PauseDownloadBatch(batchID string) {
+	backend.GetDownloadScheduler().PauseBatch(batchID)
+}
+
+// ResumeDownloadBatch resumes every paused download in a batch
+func (a *App) ResumeDownloadBatch(batchID string) {
+	backend.GetDownloadScheduler().ResumeBatch(batchID)
+}
+
+// CancelDownloadBatch cancels every download in a batch
+func (a *App) CancelDownloadBatch(batchID string) {
+	backend.GetDownloadScheduler().CancelBatch(batchID)
+}
+
 // OpenFolder opens a folder in the file explorer
 func (a *App) OpenFolder(path string) error {
 	if path == "" {
@@ -441,6 +844,29 @@ func (a *App) AnalyzeTrack(filePath string) (string, error) {
 	return string(jsonData), nil
 }
 
+// ScanLoudness measures EBU R128 loudness per track and album, optionally writing ReplayGain tags
+func (a *App) ScanLoudness(req backend.LoudnessScanRequest) ([]backend.LoudnessResult, error) {
+	return backend.ScanLoudness(req)
+}
+
+// ReadAllTags returns every tag of an audio file under its native name
+func (a *App) ReadAllTags(filePath string) (*backend.FileTags, error) {
+	if filePath == "" {
+		return nil, fmt.Errorf("file path is required")
+	}
+	return backend.ReadAllTags(filePath)
+}
+
+// WriteTags applies tag edits to many files at once; with DryRun it only reports the changes
+func (a *App) WriteTags(req backend.TagWriteRequest) ([]backend.TagWriteResult, error) {
+	return backend.WriteTags(req)
+}
+
+// RetagFiles refreshes file tags from Spotify metadata; with DryRun it only reports the changes
+func (a *App) RetagFiles(req backend.RetagRequest) ([]backend.RetagResult, error) {
+	return backend.RetagFiles(context.Background(), req)
+}
+
 // GetDefaults returns the default configuration
 func (a *App) GetDefaults() map[string]string {
 	return map[string]string{
@@ -480,6 +906,29 @@ func (a *App) FetchSessionTokenWithParams(timeout int, retry int) (TokenResponse
 	}, nil
 }
 
+// CheckFlacAvailabilityRequest represents a FLAC pre-flight check for a list of tracks
+type CheckFlacAvailabilityRequest struct {
+	SessionToken string   `json:"session_token"`
+	TrackIDs     []string `json:"track_ids"`
+}
+
+// CheckFlacAvailability checks which tracks can be downloaded as FLAC before a batch is queued
+func (a *App) CheckFlacAvailability(req CheckFlacAvailabilityRequest) ([]backend.FlacAvailability, error) {
+	if req.SessionToken == "" {
+		return nil, fmt.Errorf("session token is required")
+	}
+	if len(req.TrackIDs) == 0 {
+		return []backend.FlacAvailability{}, nil
+	}
+
+	return backend.NewSpotiDownloader(req.SessionToken).CheckFlacAvailability(req.TrackIDs), nil
+}
+
+// GetDownloadProviders returns the names of the download providers that can be used in the provider order
+func (a *App) GetDownloadProviders() []string {
+	return backend.DownloadProviderNames()
+}
+
 // GetDownloadQueue returns the complete download queue state
 func (a *App) GetDownloadQueue() backend.DownloadQueueInfo {
 	return backend.GetDownloadQueue()
@@ -492,6 +941,28 @@ func (a *App) AddToDownloadQueue(isrc, trackName, artistName, albumName string)
 	return itemID
 }
 
+// ResumeQueue returns the download requests for items restored from the previous run that still need downloading.
+// The caller must fill in a fresh session token before passing them back to DownloadTrack.
+func (a *App) ResumeQueue() []DownloadRequest {
+	var requests []DownloadRequest
+	for _, pending := range backend.ResumeQueue() {
+		if len(pending.Request) == 0 {
+			// Items queued without a request (never started) cannot be resumed
+			backend.FailDownloadItem(pending.Item.ID, "Cannot resume: download request was not saved")
+			continue
+		}
+
+		var req DownloadRequest
+		if err := json.Unmarshal(pending.Request, &req); err != nil {
+			backend.FailDownloadItem(pending.Item.ID, fmt.Sprintf("Cannot resume: %v", err))
+			continue
+		}
+		req.ItemID = pending.Item.ID
+		requests = append(requests, req)
+	}
+	return requests
+}
+
 // ClearCompletedDownloads clears completed, failed, and skipped items from the queue
 func (a *App) ClearCompletedDownloads() {
 	backend.ClearDownloadQueue()
@@ -522,6 +993,9 @@ type LyricsDownloadRequest struct {
 	AlbumArtist         string `json:"album_artist"`
 	ReleaseDate         string `json:"release_date"`
 	OutputDir           string `json:"output_dir"`
+	FolderTemplate      string `json:"folder_template,omitempty"`
+	PlaylistName        string `json:"playlist_name,omitempty"`
+	Filesystem          string `json:"filesystem,omitempty"`
 	FilenameFormat      string `json:"filename_format"`
 	TrackNumber         bool   `json:"track_number"`
 	Position            int    `json:"position"`
@@ -547,6 +1021,9 @@ func (a *App) DownloadLyrics(req LyricsDownloadRequest) (backend.LyricsDownloadR
 		AlbumArtist:         req.AlbumArtist,
 		ReleaseDate:         req.ReleaseDate,
 		OutputDir:           req.OutputDir,
+		FolderTemplate:      req.FolderTemplate,
+		PlaylistName:        req.PlaylistName,
+		Filesystem:          req.Filesystem,
 		FilenameFormat:      req.FilenameFormat,
 		TrackNumber:         req.TrackNumber,
 		Position:            req.Position,
@@ -574,6 +1051,9 @@ type CoverDownloadRequest struct {
 	AlbumArtist    string `json:"album_artist"`
 	ReleaseDate    string `json:"release_date"`
 	OutputDir      string `json:"output_dir"`
+	FolderTemplate string `json:"folder_template,omitempty"`
+	PlaylistName   string `json:"playlist_name,omitempty"`
+	Filesystem     string `json:"filesystem,omitempty"`
 	FilenameFormat string `json:"filename_format"`
 	TrackNumber    bool   `json:"track_number"`
 	Position       int    `json:"position"`
@@ -598,6 +1078,9 @@ func (a *App) DownloadCover(req CoverDownloadRequest) (backend.CoverDownloadResp
 		AlbumArtist:    req.AlbumArtist,
 		ReleaseDate:    req.ReleaseDate,
 		OutputDir:      req.OutputDir,
+		FolderTemplate: req.FolderTemplate,
+		PlaylistName:   req.PlaylistName,
+		Filesystem:     req.Filesystem,
 		FilenameFormat: req.FilenameFormat,
 		TrackNumber:    req.TrackNumber,
 		Position:       req.Position,
@@ -800,3 +1283,33 @@ func (a *App) CheckFilesExistence(outputDir string, audioFormat string, tracks [
 
 	return backend.CheckFilesExistParallel(outputDir, audioFormat, backendTracks)
 }
+
+// GetLibraryRoots returns the folders configured as the music library
+func (a *App) GetLibraryRoots() ([]string, error) {
+	return backend.GetLibraryRoots()
+}
+
+// SetLibraryRoots replaces the folders configured as the music library
+func (a *App) SetLibraryRoots(roots []string) error {
+	return backend.SetLibraryRoots(roots)
+}
+
+// ScanLibrary updates the library database for the configured library folders
+func (a *App) ScanLibrary() error {
+	return backend.ScanLibrary(nil)
+}
+
+// FindLibraryFiles looks up files by ISRC or Spotify ID across library folders and formats
+func (a *App) FindLibraryFiles(query backend.LibraryQuery) ([]backend.LibraryFile, error) {
+	return backend.FindLibraryFiles(query)
+}
+
+// FindDuplicates groups library files holding the same recording
+func (a *App) FindDuplicates(opts backend.DuplicateOptions) ([]backend.DuplicateGroup, error) {
+	return backend.FindDuplicates(opts)
+}
+
+// CleanupDuplicates deletes, quarantines or hard links duplicates; with DryRun it only reports the plan
+func (a *App) CleanupDuplicates(req backend.DuplicateCleanupRequest) ([]backend.DuplicateOperation, error) {
+	return backend.CleanupDuplicates(req)
+}
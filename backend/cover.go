@@ -6,7 +6,6 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
 	"time"
 )
@@ -26,12 +25,29 @@ type CoverDownloadRequest struct {
 	AlbumArtist    string `json:"album_artist"`
 	ReleaseDate    string `json:"release_date"`
 	OutputDir      string `json:"output_dir"`
+	FolderTemplate string `json:"folder_template,omitempty"` // Sub-folders below OutputDir, e.g. {artist}/{album}
+	PlaylistName   string `json:"playlist_name,omitempty"`
+	Filesystem     string `json:"filesystem,omitempty"` // windows, fat or posix; windows when empty
 	FilenameFormat string `json:"filename_format"`
 	TrackNumber    bool   `json:"track_number"`
 	Position       int    `json:"position"`
 	DiscNumber     int    `json:"disc_number"`
 }
 
+func (r CoverDownloadRequest) pathData() PathTemplateData {
+	return PathTemplateData{
+		Title:       r.TrackName,
+		Artist:      r.ArtistName,
+		Album:       r.AlbumName,
+		AlbumArtist: r.AlbumArtist,
+		ReleaseDate: r.ReleaseDate,
+		Playlist:    r.PlaylistName,
+		Track:       r.Position,
+		Disc:        r.DiscNumber,
+		Position:    r.Position,
+	}
+}
+
 // CoverDownloadResponse represents the response from cover download
 type CoverDownloadResponse struct {
 	Success       bool   `json:"success"`
@@ -53,64 +69,10 @@ func NewCoverClient() *CoverClient {
 	}
 }
 
-// buildCoverFilename builds the cover filename based on settings (same as track filename)
-func buildCoverFilename(trackName, artistName, albumName, albumArtist, releaseDate, filenameFormat string, includeTrackNumber bool, position, discNumber int) string {
-	safeTitle := SanitizeFilename(trackName)
-	safeArtist := SanitizeFilename(artistName)
-	safeAlbum := SanitizeFilename(albumName)
-	safeAlbumArtist := SanitizeFilename(albumArtist)
-
-	// Extract year from release date (format: YYYY-MM-DD or YYYY)
-	year := ""
-	if len(releaseDate) >= 4 {
-		year = releaseDate[:4]
-	}
-
-	var filename string
-
-	// Check if format is a template (contains {})
-	if strings.Contains(filenameFormat, "{") {
-		filename = filenameFormat
-		filename = strings.ReplaceAll(filename, "{title}", safeTitle)
-		filename = strings.ReplaceAll(filename, "{artist}", safeArtist)
-		filename = strings.ReplaceAll(filename, "{album}", safeAlbum)
-		filename = strings.ReplaceAll(filename, "{album_artist}", safeAlbumArtist)
-		filename = strings.ReplaceAll(filename, "{year}", year)
-
-		// Handle disc number
-		if discNumber > 0 {
-			filename = strings.ReplaceAll(filename, "{disc}", fmt.Sprintf("%d", discNumber))
-		} else {
-			filename = strings.ReplaceAll(filename, "{disc}", "")
-		}
-
-		// Handle track number - if position is 0, remove {track} and surrounding separators
-		if position > 0 {
-			filename = strings.ReplaceAll(filename, "{track}", fmt.Sprintf("%02d", position))
-		} else {
-			// Remove {track} with common separators
-			filename = regexp.MustCompile(`\{track\}\.\s*`).ReplaceAllString(filename, "")
-			filename = regexp.MustCompile(`\{track\}\s*-\s*`).ReplaceAllString(filename, "")
-			filename = regexp.MustCompile(`\{track\}\s*`).ReplaceAllString(filename, "")
-		}
-	} else {
-		// Legacy format support
-		switch filenameFormat {
-		case "artist-title":
-			filename = fmt.Sprintf("%s - %s", safeArtist, safeTitle)
-		case "title":
-			filename = safeTitle
-		default: // "title-artist"
-			filename = fmt.Sprintf("%s - %s", safeTitle, safeArtist)
-		}
-
-		// Add track number prefix if enabled (legacy behavior)
-		if includeTrackNumber && position > 0 {
-			filename = fmt.Sprintf("%02d. %s", position, filename)
-		}
-	}
-
-	return filename + ".jpg"
+// buildCoverPath returns where the cover file goes, named like the track file
+func buildCoverPath(outputDir string, req CoverDownloadRequest) (string, error) {
+	template := PathTemplate{Folder: req.FolderTemplate, Filename: req.FilenameFormat, TrackNumber: req.TrackNumber, Filesystem: req.Filesystem}
+	return template.FilePath(outputDir, req.pathData(), ".jpg")
 }
 
 // getMaxResolutionURL converts a Spotify cover URL to max resolution
@@ -145,21 +107,20 @@ func (c *CoverClient) DownloadCover(req CoverDownloadRequest) (*CoverDownloadRes
 	} else {
 		outputDir = NormalizePath(outputDir)
 	}
-
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
+	filePath, err := buildCoverPath(outputDir, req)
+	if err != nil {
 		return &CoverDownloadResponse{
 			Success: false,
-			Error:   fmt.Sprintf("failed to create output directory: %v", err),
+			Error:   err.Error(),
 		}, err
 	}
 
-	// Generate filename using same format as track
-	filenameFormat := req.FilenameFormat
-	if filenameFormat == "" {
-		filenameFormat = "title-artist" // default
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return &CoverDownloadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("failed to create output directory: %v", err),
+		}, err
 	}
-	filename := buildCoverFilename(req.TrackName, req.ArtistName, req.AlbumName, req.AlbumArtist, req.ReleaseDate, filenameFormat, req.TrackNumber, req.Position, req.DiscNumber)
-	filePath := filepath.Join(outputDir, filename)
 
 	// Check if file already exists
 	if fileInfo, err := os.Stat(filePath); err == nil && fileInfo.Size() > 0 {
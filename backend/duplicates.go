@@ -0,0 +1,384 @@
+package backend
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Durations within this many milliseconds count as the same recording when matching by tags
+const duplicateDurationToleranceMS = 2000
+
+// Duplicate cleanup actions
+const (
+	DuplicateActionDelete     = "delete"     // Remove the duplicate
+	DuplicateActionQuarantine = "quarantine" // Move the duplicate to the quarantine folder
+	DuplicateActionHardlink   = "hardlink"   // Replace the duplicate with a hard link to the keeper
+)
+
+// DuplicateOptions selects how duplicates are found
+type DuplicateOptions struct {
+	Roots     []string `json:"roots,omitempty"` // Defaults to the configured library roots
+	MatchTags bool     `json:"match_tags"`      // Also match files by normalized title, artist and duration
+}
+
+// DuplicateGroup is a set of files holding the same recording
+type DuplicateGroup struct {
+	Key        string        `json:"key"`    // "isrc:<ISRC>" or "tags:<artist> - <title>"
+	Keeper     LibraryFile   `json:"keeper"` // Best copy: lossless over lossy codecs, then highest bitrate
+	Duplicates []LibraryFile `json:"duplicates"`
+}
+
+// DuplicateCleanupRequest applies an action to the duplicates found with Options
+type DuplicateCleanupRequest struct {
+	Options       DuplicateOptions `json:"options"`
+	Action        string           `json:"action"`
+	Keys          []string         `json:"keys,omitempty"`           // Only these groups; all groups when empty
+	QuarantineDir string           `json:"quarantine_dir,omitempty"` // Defaults to ~/.spotidownloader/quarantine
+	DryRun        bool             `json:"dry_run"`                  // Only report what would happen
+}
+
+// DuplicateOperation is what happened, or would happen in a dry run, to one duplicate
+type DuplicateOperation struct {
+	Key    string `json:"key"`
+	Path   string `json:"path"`
+	Keeper string `json:"keeper"`
+	Action string `json:"action"`
+	Target string `json:"target,omitempty"` // New location for quarantine and hardlink
+	Error  string `json:"error,omitempty"`
+}
+
+// FindDuplicates groups library files holding the same recording and picks the copy to keep in each group
+func FindDuplicates(opts DuplicateOptions) ([]DuplicateGroup, error) {
+	db, err := globalLibrary.open()
+	if err != nil {
+		return nil, err
+	}
+	rootsClause, args, err := libraryRootsClause(db, opts.Roots)
+	if err != nil {
+		return nil, err
+	}
+	files, err := queryLibraryFiles(db, rootsClause, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []DuplicateGroup
+	grouped := make(map[string]bool)
+
+	byISRC := make(map[string][]LibraryFile)
+	for _, file := range files {
+		if file.ISRC != "" {
+			byISRC[file.ISRC] = append(byISRC[file.ISRC], file)
+		}
+	}
+	for isrc, matches := range byISRC {
+		if len(matches) < 2 {
+			continue
+		}
+		groups = append(groups, newDuplicateGroup("isrc:"+isrc, matches))
+		for _, file := range matches {
+			grouped[file.Path] = true
+		}
+	}
+
+	if opts.MatchTags {
+		byTags := make(map[string][]LibraryFile)
+		for _, file := range files {
+			if grouped[file.Path] || file.DurationMS == 0 {
+				continue
+			}
+			title := normalizeDuplicateText(file.Title)
+			artist := normalizeDuplicateText(file.Artist)
+			if title == "" || artist == "" {
+				continue
+			}
+			key := "tags:" + artist + " - " + title
+			byTags[key] = append(byTags[key], file)
+		}
+		for key, matches := range byTags {
+			for _, cluster := range clusterByDuration(matches) {
+				if len(cluster) > 1 {
+					groups = append(groups, newDuplicateGroup(key, cluster))
+				}
+			}
+		}
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Key != groups[j].Key {
+			return groups[i].Key < groups[j].Key
+		}
+		return groups[i].Keeper.Path < groups[j].Keeper.Path
+	})
+	return groups, nil
+}
+
+// newDuplicateGroup ranks the files and makes the best one the keeper
+func newDuplicateGroup(key string, files []LibraryFile) DuplicateGroup {
+	sort.Slice(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if duplicateCodecRank(a.Codec) != duplicateCodecRank(b.Codec) {
+			return duplicateCodecRank(a.Codec) > duplicateCodecRank(b.Codec)
+		}
+		if a.Bitrate != b.Bitrate {
+			return a.Bitrate > b.Bitrate
+		}
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+		return a.Path < b.Path
+	})
+	return DuplicateGroup{Key: key, Keeper: files[0], Duplicates: files[1:]}
+}
+
+// duplicateCodecRank orders the codecs read from the audio stream: lossless, then lossy, then files that couldn't be read
+func duplicateCodecRank(codec string) int {
+	switch codec {
+	case "flac", "alac":
+		return 2
+	case "":
+		return 0
+	default:
+		return 1
+	}
+}
+
+// clusterByDuration splits files into runs whose durations are within the tolerance of their neighbours
+func clusterByDuration(files []LibraryFile) [][]LibraryFile {
+	sort.Slice(files, func(i, j int) bool { return files[i].DurationMS < files[j].DurationMS })
+
+	var clusters [][]LibraryFile
+	start := 0
+	for i := 1; i <= len(files); i++ {
+		if i == len(files) || files[i].DurationMS-files[i-1].DurationMS > duplicateDurationToleranceMS {
+			clusters = append(clusters, files[start:i])
+			start = i
+		}
+	}
+	return clusters
+}
+
+var featuringPattern = regexp.MustCompile(`(?i)[(\[]?\s*\b(feat|ft|featuring)\b\.?.*$`)
+
+// normalizeDuplicateText lowercases s, drops "feat." credits and reduces it to letters and digits
+func normalizeDuplicateText(s string) string {
+	s = featuringPattern.ReplaceAllString(s, "")
+
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(r)
+			space = false
+		} else {
+			space = true
+		}
+	}
+	return b.String()
+}
+
+// CleanupDuplicates deletes, quarantines or hard links the duplicates of each group, keeping the keeper
+func CleanupDuplicates(req DuplicateCleanupRequest) ([]DuplicateOperation, error) {
+	switch req.Action {
+	case DuplicateActionDelete, DuplicateActionQuarantine, DuplicateActionHardlink:
+	default:
+		return nil, fmt.Errorf("unknown duplicate action: %s", req.Action)
+	}
+
+	groups, err := FindDuplicates(req.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	quarantineDir := req.QuarantineDir
+	var roots []string
+	if req.Action == DuplicateActionQuarantine {
+		if quarantineDir == "" {
+			dir, err := getSpotiDownloaderDir()
+			if err != nil {
+				return nil, err
+			}
+			quarantineDir = filepath.Join(dir, "quarantine")
+		}
+		quarantineDir = NormalizePath(quarantineDir)
+
+		// Quarantined files keep their path relative to the library root they came from
+		configured := req.Options.Roots
+		if len(configured) == 0 {
+			if configured, err = GetLibraryRoots(); err != nil {
+				return nil, err
+			}
+		}
+		for _, root := range configured {
+			roots = append(roots, libraryRoot(root))
+		}
+	}
+
+	keys := make(map[string]bool, len(req.Keys))
+	for _, key := range req.Keys {
+		keys[key] = true
+	}
+
+	ops := []DuplicateOperation{}
+	for _, group := range groups {
+		if len(keys) > 0 && !keys[group.Key] {
+			continue
+		}
+		// The index may be out of date; never touch the duplicates unless the keeper is still there
+		keeperErr := verifyKeeper(group.Keeper)
+		for _, dup := range group.Duplicates {
+			op := DuplicateOperation{
+				Key:    group.Key,
+				Path:   dup.Path,
+				Keeper: group.Keeper.Path,
+				Action: req.Action,
+			}
+			if keeperErr != nil {
+				op.Error = keeperErr.Error()
+				ops = append(ops, op)
+				continue
+			}
+			switch req.Action {
+			case DuplicateActionQuarantine:
+				op.Target = uniqueQuarantinePath(quarantineDir, roots, dup.Path)
+			case DuplicateActionHardlink:
+				if sameFile(dup.Path, group.Keeper.Path) {
+					continue // Already linked
+				}
+				// The link takes the keeper's extension so the file name matches its contents,
+				// unless a file with that name already exists
+				op.Target = strings.TrimSuffix(dup.Path, filepath.Ext(dup.Path)) + filepath.Ext(group.Keeper.Path)
+				if op.Target != dup.Path && fileExists(op.Target) {
+					op.Target = dup.Path
+				}
+			}
+
+			if !req.DryRun {
+				if err := applyDuplicateOperation(op); err != nil {
+					op.Error = err.Error()
+				}
+			}
+			ops = append(ops, op)
+		}
+	}
+
+	if !req.DryRun {
+		fmt.Printf("[Duplicates] Applied %s to %d files\n", req.Action, len(ops))
+	}
+	return ops, nil
+}
+
+func applyDuplicateOperation(op DuplicateOperation) error {
+	db, err := globalLibrary.open()
+	if err != nil {
+		return err
+	}
+
+	switch op.Action {
+	case DuplicateActionDelete:
+		if err := os.Remove(op.Path); err != nil {
+			return err
+		}
+
+	case DuplicateActionQuarantine:
+		if err := os.MkdirAll(filepath.Dir(op.Target), 0755); err != nil {
+			return fmt.Errorf("failed to create quarantine folder: %v", err)
+		}
+		if err := moveFile(op.Path, op.Target); err != nil {
+			return err
+		}
+
+	case DuplicateActionHardlink:
+		// Link next to the target first so the duplicate is only replaced once the link exists
+		tmpPath := op.Target + ".link"
+		if err := os.Link(op.Keeper, tmpPath); err != nil {
+			return fmt.Errorf("failed to create hard link: %v", err)
+		}
+		if err := os.Rename(tmpPath, op.Target); err != nil {
+			os.Remove(tmpPath)
+			return err
+		}
+		if op.Target != op.Path {
+			if err := os.Remove(op.Path); err != nil {
+				return err
+			}
+		}
+		if err := removeLibraryPath(db, op.Path); err != nil {
+			return err
+		}
+		return IndexLibraryFile(op.Target, "")
+	}
+
+	return removeLibraryPath(db, op.Path)
+}
+
+// verifyKeeper checks that the keeper is still the file the library indexed (same size and modification time)
+func verifyKeeper(keeper LibraryFile) error {
+	info, err := os.Stat(keeper.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("keeper %s no longer exists", keeper.Path)
+		}
+		return fmt.Errorf("failed to check keeper: %v", err)
+	}
+	if info.IsDir() || info.Size() != keeper.Size || info.ModTime().Unix() != keeper.ModTime {
+		return fmt.Errorf("keeper %s changed since it was indexed, scan the library again", keeper.Path)
+	}
+	return nil
+}
+
+// sameFile reports whether both paths are links to the same file
+func sameFile(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
+
+// uniqueQuarantinePath returns where path goes in the quarantine folder dir: the same path relative to the
+// innermost root holding it, without overwriting an earlier quarantined file
+func uniqueQuarantinePath(dir string, roots []string, path string) string {
+	var from string
+	for _, root := range roots {
+		if isInDir(path, root) && len(root) > len(from) {
+			from = root
+		}
+	}
+	return UniquePath(layoutPath(path, from, dir))
+}
+
+// moveFile renames src to dst, copying when they're on different file systems
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := out.ReadFrom(in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	in.Close()
+	return os.Remove(src)
+}
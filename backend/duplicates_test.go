@@ -0,0 +1,250 @@
+package backend
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDuplicateCodecRank(t *testing.T) {
+	tests := []struct {
+		codec string
+		want  int
+	}{
+		{"flac", 2},
+		{"alac", 2},
+		{"aac", 1},
+		{"mp3", 1},
+		{"opus", 1},
+		{"", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.codec, func(t *testing.T) {
+			if got := duplicateCodecRank(tt.codec); got != tt.want {
+				t.Errorf("duplicateCodecRank(%q) = %d, want %d", tt.codec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewDuplicateGroup(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []LibraryFile
+		want  []string // Keeper first, then the duplicates in order
+	}{
+		{
+			"lossless over higher bitrate",
+			[]LibraryFile{
+				{Path: "a.mp3", Codec: "mp3", Bitrate: 320},
+				{Path: "b.flac", Codec: "flac", Bitrate: 900},
+				{Path: "c.m4a", Codec: "aac", Bitrate: 256},
+			},
+			[]string{"b.flac", "a.mp3", "c.m4a"},
+		},
+		{
+			"ALAC in M4A counts as lossless",
+			[]LibraryFile{
+				{Path: "a.mp3", Codec: "mp3", Bitrate: 320},
+				{Path: "b.m4a", Codec: "alac", Bitrate: 300},
+			},
+			[]string{"b.m4a", "a.mp3"},
+		},
+		{
+			"unreadable codec ranked last",
+			[]LibraryFile{
+				{Path: "a.flac", Bitrate: 1000},
+				{Path: "b.mp3", Codec: "mp3", Bitrate: 128},
+			},
+			[]string{"b.mp3", "a.flac"},
+		},
+		{
+			"same codec by bitrate",
+			[]LibraryFile{
+				{Path: "a.mp3", Codec: "mp3", Bitrate: 192},
+				{Path: "b.mp3", Codec: "mp3", Bitrate: 320},
+			},
+			[]string{"b.mp3", "a.mp3"},
+		},
+		{
+			"same bitrate by size",
+			[]LibraryFile{
+				{Path: "a.flac", Codec: "flac", Bitrate: 900, Size: 10},
+				{Path: "b.flac", Codec: "flac", Bitrate: 900, Size: 20},
+			},
+			[]string{"b.flac", "a.flac"},
+		},
+		{
+			"ties by path",
+			[]LibraryFile{
+				{Path: "b.mp3", Codec: "mp3", Bitrate: 320, Size: 10},
+				{Path: "a.mp3", Codec: "mp3", Bitrate: 320, Size: 10},
+			},
+			[]string{"a.mp3", "b.mp3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group := newDuplicateGroup("isrc:AAA", tt.files)
+			got := []string{group.Keeper.Path}
+			for _, file := range group.Duplicates {
+				got = append(got, file.Path)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ranked %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeDuplicateText(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Song Title", "song title"},
+		{"Song  Title!", "song title"},
+		{"Song (feat. Someone)", "song"},
+		{"Song [ft. Someone]", "song"},
+		{"Song featuring Someone", "song"},
+		{"Feather", "feather"},
+		{"Café – Live", "café live"},
+		{"...", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := normalizeDuplicateText(tt.in); got != tt.want {
+				t.Errorf("normalizeDuplicateText(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClusterByDuration(t *testing.T) {
+	tests := []struct {
+		name      string
+		durations []int
+		want      [][]int
+	}{
+		{"one cluster", []int{180000, 181000, 179500}, [][]int{{179500, 180000, 181000}}},
+		{"chained within tolerance", []int{180000, 182000, 184000}, [][]int{{180000, 182000, 184000}}},
+		{"split", []int{180000, 240000, 181000}, [][]int{{180000, 181000}, {240000}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var files []LibraryFile
+			for _, durationMS := range tt.durations {
+				files = append(files, LibraryFile{DurationMS: durationMS})
+			}
+			var got [][]int
+			for _, cluster := range clusterByDuration(files) {
+				var durations []int
+				for _, file := range cluster {
+					durations = append(durations, file.DurationMS)
+				}
+				got = append(got, durations)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("clusterByDuration(%v) = %v, want %v", tt.durations, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUniqueQuarantinePath(t *testing.T) {
+	dir := t.TempDir()
+	quarantine := filepath.Join(dir, "quarantine")
+	music := filepath.Join(dir, "music")
+	downloads := filepath.Join(music, "Downloads")
+	roots := []string{music, downloads}
+
+	// An earlier quarantined copy of the same file
+	taken := filepath.Join(quarantine, "Artist", "taken.mp3")
+	if err := os.MkdirAll(filepath.Dir(taken), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(taken, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"keeps layout below root", "music/Artist/Album/a.mp3", "quarantine/Artist/Album/a.mp3"},
+		{"innermost root", "music/Downloads/Artist/a.mp3", "quarantine/Artist/a.mp3"},
+		{"outside every root", "elsewhere/Artist/a.mp3", "quarantine/a.mp3"},
+		{"already quarantined", "music/Artist/taken.mp3", "quarantine/Artist/taken (2).mp3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := uniqueQuarantinePath(quarantine, roots, filepath.Join(dir, filepath.FromSlash(tt.path)))
+			if want := filepath.Join(dir, filepath.FromSlash(tt.want)); got != want {
+				t.Errorf("uniqueQuarantinePath(%q) = %q, want %q", tt.path, got, want)
+			}
+		})
+	}
+}
+
+// buildTestMP4Tracks returns an M4A whose tracks have the given handler and sample entry types; an empty entry leaves out stsd
+func buildTestMP4Tracks(tracks ...[2]string) []byte {
+	var traks []byte
+	for _, track := range tracks {
+		hdlr := make([]byte, 24)
+		copy(hdlr[8:12], track[0])
+		var stbl []byte
+		if track[1] != "" {
+			stsd := make([]byte, 16)
+			binary.BigEndian.PutUint32(stsd[4:8], 1)
+			binary.BigEndian.PutUint32(stsd[8:12], 8)
+			copy(stsd[12:16], track[1])
+			stbl = mp4BoxBytes("stsd", stsd)
+		}
+		mdia := append(mp4BoxBytes("hdlr", hdlr), mp4BoxBytes("minf", mp4BoxBytes("stbl", stbl))...)
+		traks = append(traks, mp4BoxBytes("trak", mp4BoxBytes("mdia", mdia))...)
+	}
+	ftyp := mp4BoxBytes("ftyp", []byte("M4A \x00\x00\x00\x00M4A isom"))
+	return append(ftyp, mp4BoxBytes("moov", append(mp4BoxBytes("mvhd", make([]byte, 100)), traks...))...)
+}
+
+func TestReadAudioCodec(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		data    []byte
+		want    string
+		wantErr bool
+	}{
+		{"flac", "a.flac", nil, "flac", false},
+		{"mp3", "a.mp3", nil, "mp3", false},
+		{"aac", "a.m4a", buildTestMP4Tracks([2]string{"soun", "mp4a"}), "aac", false},
+		{"alac", "a.m4a", buildTestMP4Tracks([2]string{"soun", "alac"}), "alac", false},
+		{"flac in mp4", "a.m4a", buildTestMP4Tracks([2]string{"soun", "fLaC"}), "flac", false},
+		{"other entry", "a.m4a", buildTestMP4Tracks([2]string{"soun", "Opus"}), "opus", false},
+		{"audio after video", "a.m4a", buildTestMP4Tracks([2]string{"vide", "avc1"}, [2]string{"soun", "alac"}), "alac", false},
+		{"no audio track", "a.m4a", buildTestMP4Tracks([2]string{"vide", "avc1"}), "", true},
+		{"no sample entry", "a.m4a", buildTestMP4Tracks([2]string{"soun", ""}), "", true},
+		{"unsupported", "a.wav", nil, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readAudioCodec(path)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("readAudioCodec(%q) = %q, %v; want %q, error %v", tt.name, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -32,6 +32,8 @@ type AudioMetadata struct {
 	TrackNumber int    `json:"track_number"`
 	DiscNumber  int    `json:"disc_number"`
 	Year        string `json:"year"`
+
+	SpotifyTrackID string `json:"spotify_track_id,omitempty"` // From the SPOTIFY_TRACK_ID tag
 }
 
 // RenamePreview represents a preview of file rename operation
@@ -169,7 +171,12 @@ func readFlacMetadata(filePath string) (*AudioMetadata, error) {
 				case "TITLE":
 					metadata.Title = value
 				case "ARTIST":
-					metadata.Artist = value
+					// Multi-value tags repeat ARTIST once per artist
+					if metadata.Artist != "" {
+						metadata.Artist += ", " + value
+					} else {
+						metadata.Artist = value
+					}
 				case "ALBUM":
 					metadata.Album = value
 				case "ALBUMARTIST":
@@ -184,6 +191,8 @@ func readFlacMetadata(filePath string) (*AudioMetadata, error) {
 					}
 				case "DATE", "YEAR":
 					metadata.Year = value
+				case tagSpotifyTrackID:
+					metadata.SpotifyTrackID = value
 				}
 			}
 		}
@@ -202,7 +211,7 @@ func readMp3Metadata(filePath string) (*AudioMetadata, error) {
 
 	metadata := &AudioMetadata{
 		Title:  tag.Title(),
-		Artist: tag.Artist(),
+		Artist: strings.ReplaceAll(tag.Artist(), "\x00", ", "), // ID3v2.4 separates multiple artists with nulls
 		Album:  tag.Album(),
 		Year:   tag.Year(),
 	}
@@ -234,6 +243,8 @@ func readMp3Metadata(filePath string) (*AudioMetadata, error) {
 		}
 	}
 
+	metadata.SpotifyTrackID = mp3UserText(tag, tagSpotifyTrackID)
+
 	return metadata, nil
 }
 
@@ -324,12 +335,27 @@ func readMetadataWithFFprobe(filePath string) (*AudioMetadata, error) {
 	return metadata, nil
 }
 
-// readM4aMetadata reads metadata from an M4A file using ffprobe
+// readM4aMetadata reads metadata from an M4A file's iTunes items, falling back to ffprobe
 func readM4aMetadata(filePath string) (*AudioMetadata, error) {
-	metadata, err := readMetadataWithFFprobe(filePath)
+	tags, err := readMP4Tags(filePath)
 	if err != nil {
-		return &AudioMetadata{}, nil
+		metadata, err := readMetadataWithFFprobe(filePath)
+		if err != nil {
+			return &AudioMetadata{}, nil
+		}
+		return metadata, nil
+	}
+
+	metadata := &AudioMetadata{
+		Title:       tags.text(mp4KeyTitle),
+		Artist:      tags.text(mp4KeyArtist),
+		Album:       tags.text(mp4KeyAlbum),
+		AlbumArtist: tags.text(mp4KeyAlbumArtist),
+		Year:        tags.text(mp4KeyDate),
 	}
+	metadata.SpotifyTrackID = tags.text(mp4FreeformKey(tagSpotifyTrackID))
+	metadata.TrackNumber, _ = tags.pair(mp4KeyTrack)
+	metadata.DiscNumber, _ = tags.pair(mp4KeyDisc)
 	return metadata, nil
 }
 
@@ -339,63 +365,28 @@ func GenerateFilename(metadata *AudioMetadata, format string, ext string) string
 		return ""
 	}
 
-	result := format
-
-	// Extract year (first 4 characters only)
-	year := metadata.Year
-	if len(year) >= 4 {
-		year = year[:4]
-	}
-
-	// Replace placeholders
-	result = strings.ReplaceAll(result, "{title}", sanitizeFilename(metadata.Title))
-	result = strings.ReplaceAll(result, "{artist}", sanitizeFilename(metadata.Artist))
-	result = strings.ReplaceAll(result, "{album}", sanitizeFilename(metadata.Album))
-	result = strings.ReplaceAll(result, "{album_artist}", sanitizeFilename(metadata.AlbumArtist))
-	result = strings.ReplaceAll(result, "{year}", sanitizeFilename(year))
-
-	// Track number with padding
-	if metadata.TrackNumber > 0 {
-		result = strings.ReplaceAll(result, "{track}", fmt.Sprintf("%02d", metadata.TrackNumber))
-	} else {
-		result = strings.ReplaceAll(result, "{track}", "")
-	}
-
-	// Disc number
-	if metadata.DiscNumber > 0 {
-		result = strings.ReplaceAll(result, "{disc}", fmt.Sprintf("%d", metadata.DiscNumber))
-	} else {
-		result = strings.ReplaceAll(result, "{disc}", "")
-	}
-
-	// Clean up multiple spaces and trim
-	result = strings.TrimSpace(result)
-	result = strings.Join(strings.Fields(result), " ")
-
-	// Remove leading/trailing separators
-	result = strings.Trim(result, " -._")
-
+	result := RenderTemplate(format, PathTemplateData{
+		Title:       metadata.Title,
+		Artist:      metadata.Artist,
+		Album:       metadata.Album,
+		AlbumArtist: metadata.AlbumArtist,
+		ReleaseDate: metadata.Year,
+		Track:       metadata.TrackNumber,
+		Disc:        metadata.DiscNumber,
+	})
 	if result == "" {
 		return ""
 	}
 
-	return result + ext
-}
-
-// sanitizeFilename removes invalid characters from filename
-func sanitizeFilename(name string) string {
-	// Remove characters that are invalid in filenames
-	invalid := []string{"<", ">", ":", "\"", "/", "\\", "|", "?", "*"}
-	result := name
-	for _, char := range invalid {
-		result = strings.ReplaceAll(result, char, "")
-	}
-	return strings.TrimSpace(result)
+	// Without a folder the name always fits
+	name, _ := FitFilename("", result, ext, FilesystemWindows)
+	return name
 }
 
 // PreviewRename generates a preview of rename operations
 func PreviewRename(files []string, format string) []RenamePreview {
 	var previews []RenamePreview
+	planned := make(map[string]bool)
 
 	for _, filePath := range files {
 		preview := RenamePreview{
@@ -421,8 +412,8 @@ func PreviewRename(files []string, format string) []RenamePreview {
 			continue
 		}
 
-		preview.NewName = newName
-		preview.NewPath = filepath.Join(filepath.Dir(filePath), newName)
+		preview.NewPath = renameTarget(filePath, newName, planned)
+		preview.NewName = filepath.Base(preview.NewPath)
 
 		previews = append(previews, preview)
 	}
@@ -430,6 +421,24 @@ func PreviewRename(files []string, format string) []RenamePreview {
 	return previews
 }
 
+// renameTarget returns the path filePath is renamed to, numbering the name when another file
+// already has it or an earlier file of the batch, recorded in planned, is renamed to it
+func renameTarget(filePath, newName string, planned map[string]bool) string {
+	newPath := uniquePath(filepath.Join(filepath.Dir(filePath), newName), func(candidate string) bool {
+		// Compared case-insensitively, since names differing only in case collide on Windows and macOS
+		if planned[strings.ToLower(candidate)] {
+			return true
+		}
+		if candidate == filePath || sameFile(candidate, filePath) {
+			return false // Renaming the file onto itself, e.g. a change of case
+		}
+		_, err := os.Lstat(candidate)
+		return err == nil
+	})
+	planned[strings.ToLower(newPath)] = true
+	return newPath
+}
+
 // GetFileSizes returns file sizes for a list of file paths
 func GetFileSizes(files []string) map[string]int64 {
 	result := make(map[string]int64)
@@ -445,6 +454,7 @@ func GetFileSizes(files []string) map[string]int64 {
 // RenameFiles renames files based on their metadata
 func RenameFiles(files []string, format string) []RenameResult {
 	var results []RenameResult
+	planned := make(map[string]bool)
 
 	for _, filePath := range files {
 		result := RenameResult{
@@ -469,19 +479,9 @@ func RenameFiles(files []string, format string) []RenameResult {
 			continue
 		}
 
-		newPath := filepath.Join(filepath.Dir(filePath), newName)
+		newPath := renameTarget(filePath, newName, planned)
 		result.NewPath = newPath
 
-		// Check if new path already exists (and is different from old path)
-		if newPath != filePath {
-			if _, err := os.Stat(newPath); err == nil {
-				result.Error = "File already exists"
-				result.Success = false
-				results = append(results, result)
-				continue
-			}
-		}
-
 		// Rename the file
 		if err := os.Rename(filePath, newPath); err != nil {
 			result.Error = err.Error()
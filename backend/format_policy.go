@@ -0,0 +1,85 @@
+package backend
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Format policies decide which audio format a download may end up in
+const (
+	FormatPolicyFlacOnly   = "flac-only"   // Fail instead of downgrading to MP3
+	FormatPolicyPreferFlac = "prefer-flac" // Use FLAC when available, otherwise MP3
+	FormatPolicyMp3Only    = "mp3-only"    // Always download MP3
+)
+
+// Concurrent requests used by CheckFlacAvailability
+const flacCheckConcurrency = 5
+
+// FlacAvailability is the result of a FLAC pre-flight check for one track
+type FlacAvailability struct {
+	TrackID   string `json:"track_id"`
+	Available bool   `json:"available"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ResolveFormatPolicy validates policy, deriving it from audioFormat when empty
+func ResolveFormatPolicy(policy, audioFormat string) (string, error) {
+	switch policy {
+	case FormatPolicyFlacOnly, FormatPolicyPreferFlac, FormatPolicyMp3Only:
+		return policy, nil
+	case "":
+		if audioFormat == "flac" {
+			return FormatPolicyPreferFlac, nil
+		}
+		return FormatPolicyMp3Only, nil
+	default:
+		return "", fmt.Errorf("unknown format policy: %s", policy)
+	}
+}
+
+// formatsForPolicy returns the acceptable formats for a policy, most preferred first
+func formatsForPolicy(policy string) []string {
+	switch policy {
+	case FormatPolicyFlacOnly:
+		return []string{"flac"}
+	case FormatPolicyPreferFlac:
+		return []string{"flac", "mp3"}
+	default:
+		return []string{"mp3"}
+	}
+}
+
+// CheckFlacAvailability checks FLAC availability for every track concurrently.
+// Results are returned in the same order as trackIDs; a failed check is reported per track.
+func (s *SpotiDownloader) CheckFlacAvailability(trackIDs []string) []FlacAvailability {
+	results := make([]FlacAvailability, len(trackIDs))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, flacCheckConcurrency)
+	for i, trackID := range trackIDs {
+		results[i].TrackID = trackID
+		if trackID == "" {
+			results[i].Error = "track ID is required"
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, trackID string) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			// Each check gets its own copy so token refreshes don't race
+			available, err := s.WithContext(s.context()).IsFlacAvailable(trackID)
+			if err != nil {
+				results[i].Error = err.Error()
+				return
+			}
+			results[i].Available = available
+		}(i, trackID)
+	}
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,58 @@
+package backend
+
+import "testing"
+
+func TestResolveFormatPolicy(t *testing.T) {
+	tests := []struct {
+		policy      string
+		audioFormat string
+		want        string
+		wantErr     bool
+	}{
+		{"", "flac", FormatPolicyPreferFlac, false},
+		{"", "mp3", FormatPolicyMp3Only, false},
+		{"", "", FormatPolicyMp3Only, false},
+		{FormatPolicyFlacOnly, "mp3", FormatPolicyFlacOnly, false},
+		{FormatPolicyMp3Only, "flac", FormatPolicyMp3Only, false},
+		{"lossless", "flac", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ResolveFormatPolicy(tt.policy, tt.audioFormat)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ResolveFormatPolicy(%q, %q) = %q, %v; want %q", tt.policy, tt.audioFormat, got, err, tt.want)
+		}
+	}
+}
+
+func TestSelectCandidate(t *testing.T) {
+	flac := Candidate{Provider: "a", URL: "https://a.example/track.flac", Format: "flac"}
+	mp3 := Candidate{Provider: "a", URL: "https://a.example/track.mp3", Format: "mp3"}
+	noURL := Candidate{Provider: "b", Format: "flac"}
+
+	tests := []struct {
+		name       string
+		candidates []Candidate
+		policy     string
+		want       Candidate
+		wantOK     bool
+	}{
+		{"prefer flac", []Candidate{mp3, flac}, FormatPolicyPreferFlac, flac, true},
+		{"prefer flac falls back", []Candidate{mp3}, FormatPolicyPreferFlac, mp3, true},
+		{"flac only", []Candidate{mp3, flac}, FormatPolicyFlacOnly, flac, true},
+		{"flac only without flac", []Candidate{mp3}, FormatPolicyFlacOnly, Candidate{}, false},
+		{"mp3 only", []Candidate{flac, mp3}, FormatPolicyMp3Only, mp3, true},
+		{"mp3 only without mp3", []Candidate{flac}, FormatPolicyMp3Only, Candidate{}, false},
+		{"candidate without URL skipped", []Candidate{noURL, mp3}, FormatPolicyPreferFlac, mp3, true},
+		{"no candidates", nil, FormatPolicyPreferFlac, Candidate{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := selectCandidate(tt.candidates, tt.policy)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("selectCandidate() = %+v, %v; want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
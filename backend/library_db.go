@@ -0,0 +1,806 @@
+package backend
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	pathfilepath "path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// Library roots are checked for changed files again when their last scan is older than this
+const libraryRescanInterval = 15 * time.Minute
+
+// Files read during a scan are written in transactions of this many, so other queries aren't blocked for the whole walk
+const libraryScanBatch = 200
+
+// Audio file extensions tracked by the library database, without the dot
+var libraryFormats = []string{"mp3", "flac", "m4a"}
+
+const librarySchema = `
+CREATE TABLE IF NOT EXISTS files (
+	path       TEXT PRIMARY KEY,
+	isrc       TEXT NOT NULL DEFAULT '',
+	spotify_id TEXT NOT NULL DEFAULT '',
+	format     TEXT NOT NULL,
+	size       INTEGER NOT NULL,
+	mtime      INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS files_isrc ON files(isrc);
+CREATE INDEX IF NOT EXISTS files_spotify_id ON files(spotify_id);
+CREATE TABLE IF NOT EXISTS roots (
+	path       TEXT PRIMARY KEY,
+	last_scan  INTEGER NOT NULL DEFAULT 0,
+	configured INTEGER NOT NULL DEFAULT 0
+);
+`
+
+// libraryMigrations upgrade older databases; PRAGMA user_version holds how many have been applied
+var libraryMigrations = []string{
+	// Tags and audio properties used by the duplicate finder. Resetting mtime and last_scan makes the next scan read them.
+	`ALTER TABLE files ADD COLUMN title TEXT NOT NULL DEFAULT '';
+	ALTER TABLE files ADD COLUMN artist TEXT NOT NULL DEFAULT '';
+	ALTER TABLE files ADD COLUMN duration_ms INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE files ADD COLUMN bitrate INTEGER NOT NULL DEFAULT 0;
+	UPDATE files SET mtime = 0;
+	UPDATE roots SET last_scan = 0;`,
+	// Codec of the audio stream, so the duplicate finder doesn't have to go by the extension (M4A holds AAC or ALAC)
+	`ALTER TABLE files ADD COLUMN codec TEXT NOT NULL DEFAULT '';
+	UPDATE files SET mtime = 0;
+	UPDATE roots SET last_scan = 0;`,
+}
+
+// LibraryFile is an audio file known to the library database
+type LibraryFile struct {
+	Path       string `json:"path"`
+	ISRC       string `json:"isrc,omitempty"`
+	SpotifyID  string `json:"spotify_id,omitempty"`
+	Format     string `json:"format"`
+	Size       int64  `json:"size"`
+	ModTime    int64  `json:"mod_time"` // Unix timestamp
+	Title      string `json:"title,omitempty"`
+	Artist     string `json:"artist,omitempty"`
+	DurationMS int    `json:"duration_ms,omitempty"`
+	Bitrate    int    `json:"bitrate,omitempty"` // Average kbps
+	Codec      string `json:"codec,omitempty"`   // flac, alac, aac or mp3
+}
+
+// LibraryQuery selects files from the library database. Empty fields don't filter.
+type LibraryQuery struct {
+	Roots      []string `json:"roots,omitempty"` // Defaults to the configured library roots
+	Formats    []string `json:"formats,omitempty"`
+	ISRCs      []string `json:"isrcs,omitempty"`
+	SpotifyIDs []string `json:"spotify_ids,omitempty"`
+}
+
+type libraryDB struct {
+	mu      sync.Mutex
+	db      *sql.DB
+	openErr error
+	closed  bool            // Set by CloseLibraryDB so late background work can't reopen the database
+	dirty   map[string]bool // Roots to rescan on next use
+
+	scanMu sync.Mutex // Serializes scans so a root isn't walked twice at once
+}
+
+var globalLibrary = &libraryDB{dirty: make(map[string]bool)}
+
+// open returns the library database, opening it on first use
+func (l *libraryDB) open() (*sql.DB, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.db != nil || l.openErr != nil {
+		return l.db, l.openErr
+	}
+	if l.closed {
+		return nil, fmt.Errorf("library database is closed")
+	}
+
+	db, err := openLibraryDB()
+	if err != nil {
+		fmt.Printf("[Library] Database unavailable, falling back to folder scans: %v\n", err)
+		l.openErr = err
+		return nil, err
+	}
+	l.db = db
+	return db, nil
+}
+
+func openLibraryDB() (*sql.DB, error) {
+	dir, err := getSpotiDownloaderDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create .spotidownloader directory: %v", err)
+	}
+
+	dsn := "file:" + pathfilepath.ToSlash(pathfilepath.Join(dir, "library.db")) +
+		"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open library database: %v", err)
+	}
+	// SQLite allows one writer; a single connection avoids busy errors between our own goroutines
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(librarySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create library database: %v", err)
+	}
+	if err := migrateLibraryDB(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to upgrade library database: %v", err)
+	}
+	return db, nil
+}
+
+func migrateLibraryDB(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(libraryMigrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(libraryMigrations[version]); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CloseLibraryDB closes the library database
+func CloseLibraryDB() error {
+	l := globalLibrary
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closed = true
+	if l.db == nil {
+		return nil
+	}
+	err := l.db.Close()
+	l.db = nil
+	return err
+}
+
+// libraryRoot cleans a root so the same folder always maps to the same row
+func libraryRoot(dir string) string {
+	return pathfilepath.Clean(NormalizePath(dir))
+}
+
+// libraryPrefixRange returns the range of paths inside root, for "path >= lo AND path < hi" queries
+func libraryPrefixRange(root string) (string, string) {
+	sep := string(pathfilepath.Separator)
+	prefix := root
+	if !strings.HasSuffix(prefix, sep) {
+		prefix += sep
+	}
+	return prefix, prefix[:len(prefix)-1] + string(pathfilepath.Separator+1)
+}
+
+// libraryFormatsFor returns the formats an audio format setting matches; empty matches every format
+func libraryFormatsFor(audioFormat string) []string {
+	switch audioFormat {
+	case "flac", "mp3", "m4a":
+		return []string{audioFormat}
+	default:
+		return libraryFormats
+	}
+}
+
+// libraryFileFormat returns the library format of path, or "" for files the library doesn't track
+func libraryFileFormat(path string) string {
+	ext := strings.TrimPrefix(strings.ToLower(pathfilepath.Ext(path)), ".")
+	for _, format := range libraryFormats {
+		if ext == format {
+			return format
+		}
+	}
+	return ""
+}
+
+// placeholders returns "?, ?, ..." for n values
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// ensureScanned brings root up to date when it was never scanned, is stale or was marked dirty.
+// scanMu is only taken when a scan is needed, so lookups in current roots don't wait for other roots' scans.
+func (l *libraryDB) ensureScanned(db *sql.DB, root string) error {
+	needed, err := l.needsScan(db, root)
+	if err != nil || !needed {
+		return err
+	}
+
+	l.scanMu.Lock()
+	defer l.scanMu.Unlock()
+
+	// Another goroutine may have scanned root while we waited
+	if needed, err = l.needsScan(db, root); err != nil || !needed {
+		return err
+	}
+	return l.scanLocked(db, root)
+}
+
+// needsScan reports whether root was never scanned, is stale or was marked dirty
+func (l *libraryDB) needsScan(db *sql.DB, root string) (bool, error) {
+	l.mu.Lock()
+	dirty := l.dirty[root]
+	l.mu.Unlock()
+
+	var lastScan int64
+	err := db.QueryRow("SELECT last_scan FROM roots WHERE path = ?", root).Scan(&lastScan)
+	if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+	// Watched folders are kept current by the watcher once they've been scanned
+	if lastScan > 0 && globalLibraryWatcher.covers(root) {
+		return false, nil
+	}
+	return dirty || time.Since(time.Unix(lastScan, 0)) >= libraryRescanInterval, nil
+}
+
+// scanLocked scans root and records when it was scanned. Callers hold scanMu.
+func (l *libraryDB) scanLocked(db *sql.DB, root string) error {
+	l.mu.Lock()
+	delete(l.dirty, root)
+	l.mu.Unlock()
+
+	if err := scanLibraryDir(db, root); err != nil {
+		return err
+	}
+	_, err := db.Exec(`INSERT INTO roots (path, last_scan) VALUES (?, ?)
+		ON CONFLICT(path) DO UPDATE SET last_scan = excluded.last_scan`, root, time.Now().Unix())
+	return err
+}
+
+type libraryStamp struct {
+	size  int64
+	mtime int64
+}
+
+// scanLibraryDir walks root and updates the database with files that were added, changed or removed.
+// Files whose size and modification time are unchanged aren't opened again.
+func scanLibraryDir(db *sql.DB, root string) error {
+	lo, hi := libraryPrefixRange(root)
+
+	known := make(map[string]libraryStamp)
+	rows, err := db.Query("SELECT path, size, mtime FROM files WHERE path >= ? AND path < ?", lo, hi)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var path string
+		var stamp libraryStamp
+		if err := rows.Scan(&path, &stamp.size, &stamp.mtime); err != nil {
+			rows.Close()
+			return err
+		}
+		known[path] = stamp
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Files are read outside of any transaction and written in batches
+	var pending []LibraryFile
+	var pendingMtimes []int64
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		for i, file := range pending {
+			if err := upsertLibraryFile(tx, file, pendingMtimes[i]); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		pending = pending[:0]
+		pendingMtimes = pendingMtimes[:0]
+		return tx.Commit()
+	}
+
+	seen := make(map[string]bool, len(known))
+	var updated int
+	if _, statErr := os.Stat(root); statErr == nil {
+		err := pathfilepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return nil
+			}
+			format := libraryFileFormat(path)
+			if format == "" {
+				return nil
+			}
+
+			seen[path] = true
+			stamp := libraryStamp{size: info.Size(), mtime: info.ModTime().UnixNano()}
+			if existing, ok := known[path]; ok && existing == stamp {
+				return nil
+			}
+
+			// Unreadable files are stored without tags so they aren't parsed again until they change
+			pending = append(pending, readLibraryFile(path, format, info))
+			pendingMtimes = append(pendingMtimes, stamp.mtime)
+			updated++
+			if len(pending) >= libraryScanBatch {
+				return flush()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	var removedPaths []string
+	for path := range known {
+		if !seen[path] {
+			removedPaths = append(removedPaths, path)
+		}
+	}
+	removed := len(removedPaths)
+	for len(removedPaths) > 0 {
+		n := min(len(removedPaths), libraryScanBatch)
+		args := make([]interface{}, n)
+		for i, path := range removedPaths[:n] {
+			args[i] = path
+		}
+		if _, err := db.Exec("DELETE FROM files WHERE path IN ("+placeholders(n)+")", args...); err != nil {
+			return err
+		}
+		removedPaths = removedPaths[n:]
+	}
+
+	if updated > 0 || removed > 0 {
+		fmt.Printf("[Library] Scanned %s: %d updated, %d removed\n", root, updated, removed)
+	}
+	return nil
+}
+
+// libraryExecer is implemented by both *sql.DB and *sql.Tx
+type libraryExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// upsertLibraryFile stores a file. An empty Spotify ID keeps the stored one as long as the ISRC didn't change.
+func upsertLibraryFile(exec libraryExecer, file LibraryFile, mtime int64) error {
+	_, err := exec.Exec(`INSERT INTO files (path, isrc, spotify_id, format, size, mtime, title, artist, duration_ms, bitrate, codec)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(path) DO UPDATE SET
+			spotify_id = CASE
+				WHEN excluded.spotify_id <> '' THEN excluded.spotify_id
+				WHEN files.isrc = excluded.isrc THEN files.spotify_id
+				ELSE '' END,
+			isrc = excluded.isrc,
+			format = excluded.format,
+			size = excluded.size,
+			mtime = excluded.mtime,
+			title = excluded.title,
+			artist = excluded.artist,
+			duration_ms = excluded.duration_ms,
+			bitrate = excluded.bitrate,
+			codec = excluded.codec`,
+		file.Path, strings.ToUpper(file.ISRC), file.SpotifyID, file.Format, file.Size, mtime,
+		file.Title, file.Artist, file.DurationMS, file.Bitrate, file.Codec)
+	return err
+}
+
+// readLibraryFile reads the tags and audio properties the library stores for a file.
+// Fields that can't be read are left empty.
+func readLibraryFile(path, format string, info os.FileInfo) LibraryFile {
+	file := LibraryFile{
+		Path:   path,
+		Format: format,
+		Size:   info.Size(),
+	}
+	file.ISRC, _ = ReadISRCFromFile(path)
+	if metadata, err := ReadAudioMetadata(path); err == nil {
+		file.Title = metadata.Title
+		file.Artist = metadata.Artist
+		file.SpotifyID = metadata.SpotifyTrackID
+	}
+	if durationMS, audioBytes, err := readAudioDuration(path); err == nil && durationMS > 0 {
+		file.DurationMS = durationMS
+		file.Bitrate = int(audioBytes * 8 / int64(durationMS)) // bits per ms = kbps
+	}
+	file.Codec, _ = readAudioCodec(path)
+	return file
+}
+
+// IndexLibraryFile adds or refreshes a single file in the library database, e.g. right after downloading it
+func IndexLibraryFile(path string, spotifyID string) error {
+	format := libraryFileFormat(path)
+	if format == "" {
+		return nil
+	}
+	db, err := globalLibrary.open()
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	file := readLibraryFile(path, format, info)
+	if spotifyID != "" {
+		file.SpotifyID = spotifyID
+	}
+	return upsertLibraryFile(db, file, info.ModTime().UnixNano())
+}
+
+// MarkISRCIndexDirty makes the next lookup in outputDir check the folder for changed files.
+// Folders covered by the library watcher are already current and aren't rescanned.
+func MarkISRCIndexDirty(outputDir string, audioFormat string) {
+	root := libraryRoot(outputDir)
+	if globalLibraryWatcher.covers(root) {
+		return
+	}
+
+	globalLibrary.mu.Lock()
+	defer globalLibrary.mu.Unlock()
+	globalLibrary.dirty[root] = true
+}
+
+// removeLibraryPath removes a file, or every file inside a folder, from the database
+func removeLibraryPath(db *sql.DB, path string) error {
+	lo, hi := libraryPrefixRange(path)
+	_, err := db.Exec("DELETE FROM files WHERE path = ? OR (path >= ? AND path < ?)", path, lo, hi)
+	return err
+}
+
+// findISRCFiles returns ISRC (upper case) -> file path for the given ISRCs found in dir or in any
+// configured library root. Only files of audioFormat count (empty = all formats).
+func findISRCFiles(dir string, isrcs []string, audioFormat string) map[string]string {
+	found := make(map[string]string)
+	if len(isrcs) == 0 {
+		return found
+	}
+
+	db, err := globalLibrary.open()
+	if err != nil {
+		return filterISRCIndex(buildISRCIndex(dir, audioFormat), isrcs)
+	}
+
+	roots, err := isrcLookupRoots(db, dir)
+	if err != nil {
+		fmt.Printf("[Library] %v\n", err)
+		return filterISRCIndex(buildISRCIndex(dir, audioFormat), isrcs)
+	}
+	if len(roots) == 0 {
+		return found
+	}
+	rootsClause, rootArgs, err := libraryRootsClause(db, roots)
+	if err != nil {
+		fmt.Printf("[Library] %v\n", err)
+		return filterISRCIndex(buildISRCIndex(dir, audioFormat), isrcs)
+	}
+
+	formats := libraryFormatsFor(audioFormat)
+	stmt, err := db.Prepare(`SELECT path FROM files
+		WHERE isrc = ? AND format IN (` + placeholders(len(formats)) + `) AND ` + rootsClause + `
+		ORDER BY path LIMIT 1`)
+	if err != nil {
+		fmt.Printf("[Library] Query failed: %v\n", err)
+		return filterISRCIndex(buildISRCIndex(dir, audioFormat), isrcs)
+	}
+	defer stmt.Close()
+
+	for _, isrc := range isrcs {
+		isrc = strings.ToUpper(isrc)
+		if isrc == "" {
+			continue
+		}
+		if _, done := found[isrc]; done {
+			continue
+		}
+
+		args := []interface{}{isrc}
+		for _, format := range formats {
+			args = append(args, format)
+		}
+		args = append(args, rootArgs...)
+
+		var path string
+		switch err := stmt.QueryRow(args...).Scan(&path); err {
+		case nil:
+			found[isrc] = path
+		case sql.ErrNoRows:
+		default:
+			fmt.Printf("[Library] Query failed: %v\n", err)
+		}
+	}
+	return found
+}
+
+// isrcLookupRoots returns the configured library roots plus the root that covers dir.
+// A folder inside a root the database already tracks (e.g. an album folder inside the download folder)
+// is looked up through that root instead of being scanned as a root of its own.
+func isrcLookupRoots(db *sql.DB, dir string) ([]string, error) {
+	roots, err := GetLibraryRoots()
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return roots, nil
+	}
+
+	covering := libraryRoot(dir)
+	rows, err := db.Query("SELECT path FROM roots")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var root string
+		if err := rows.Scan(&root); err != nil {
+			return nil, err
+		}
+		// Prefer the outermost tracked folder
+		if isInDir(covering, root) && len(root) < len(covering) {
+			covering = root
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, root := range roots {
+		if isInDir(covering, root) {
+			return roots, nil
+		}
+	}
+	return append(roots, covering), nil
+}
+
+// filterISRCIndex keeps the entries of index for the given ISRCs
+func filterISRCIndex(index map[string]string, isrcs []string) map[string]string {
+	found := make(map[string]string)
+	for _, isrc := range isrcs {
+		isrc = strings.ToUpper(isrc)
+		if path, exists := index[isrc]; exists {
+			found[isrc] = path
+		}
+	}
+	return found
+}
+
+// getOrBuildISRCIndex returns ISRC -> file path for the files of the given format (empty = all) in outputDir
+func getOrBuildISRCIndex(outputDir string, audioFormat string) map[string]string {
+	if outputDir == "" {
+		return make(map[string]string)
+	}
+	root := libraryRoot(outputDir)
+
+	db, err := globalLibrary.open()
+	if err != nil {
+		return buildISRCIndex(root, audioFormat)
+	}
+	if err := globalLibrary.ensureScanned(db, root); err != nil {
+		fmt.Printf("[Library] Failed to scan %s: %v\n", root, err)
+		return buildISRCIndex(root, audioFormat)
+	}
+
+	formats := libraryFormatsFor(audioFormat)
+	lo, hi := libraryPrefixRange(root)
+	args := []interface{}{lo, hi}
+	for _, format := range formats {
+		args = append(args, format)
+	}
+
+	rows, err := db.Query(`SELECT isrc, path FROM files
+		WHERE isrc <> '' AND path >= ? AND path < ? AND format IN (`+placeholders(len(formats))+`)
+		ORDER BY path`, args...)
+	if err != nil {
+		fmt.Printf("[Library] Query failed: %v\n", err)
+		return buildISRCIndex(root, audioFormat)
+	}
+	defer rows.Close()
+
+	index := make(map[string]string)
+	for rows.Next() {
+		var isrc, path string
+		if err := rows.Scan(&isrc, &path); err != nil {
+			continue
+		}
+		index[isrc] = path
+	}
+	return index
+}
+
+// GetLibraryRoots returns the folders configured as the music library
+func GetLibraryRoots() ([]string, error) {
+	db, err := globalLibrary.open()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT path FROM roots WHERE configured = 1 ORDER BY path")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roots := []string{}
+	for rows.Next() {
+		var root string
+		if err := rows.Scan(&root); err != nil {
+			return nil, err
+		}
+		roots = append(roots, root)
+	}
+	return roots, rows.Err()
+}
+
+// SetLibraryRoots replaces the folders configured as the music library
+func SetLibraryRoots(roots []string) error {
+	db, err := globalLibrary.open()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE roots SET configured = 0"); err != nil {
+		return err
+	}
+	for _, root := range roots {
+		if strings.TrimSpace(root) == "" {
+			continue
+		}
+		if _, err := tx.Exec(`INSERT INTO roots (path, configured) VALUES (?, 1)
+			ON CONFLICT(path) DO UPDATE SET configured = 1`, libraryRoot(root)); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	go globalLibraryWatcher.refresh()
+	return nil
+}
+
+// ScanLibrary brings the given roots (default: the configured library roots) up to date
+func ScanLibrary(roots []string) error {
+	db, err := globalLibrary.open()
+	if err != nil {
+		return err
+	}
+	if len(roots) == 0 {
+		if roots, err = GetLibraryRoots(); err != nil {
+			return err
+		}
+	}
+
+	globalLibrary.scanMu.Lock()
+	defer globalLibrary.scanMu.Unlock()
+
+	for _, root := range roots {
+		root = libraryRoot(root)
+		if err := globalLibrary.scanLocked(db, root); err != nil {
+			return fmt.Errorf("failed to scan %s: %v", root, err)
+		}
+	}
+	return nil
+}
+
+// FindLibraryFiles returns the files matching query across all of its roots, ordered by path
+func FindLibraryFiles(query LibraryQuery) ([]LibraryFile, error) {
+	db, err := globalLibrary.open()
+	if err != nil {
+		return nil, err
+	}
+
+	rootsClause, args, err := libraryRootsClause(db, query.Roots)
+	if err != nil {
+		return nil, err
+	}
+	where := []string{rootsClause}
+
+	if len(query.Formats) > 0 {
+		where = append(where, "format IN ("+placeholders(len(query.Formats))+")")
+		for _, format := range query.Formats {
+			args = append(args, strings.ToLower(format))
+		}
+	}
+
+	// ISRCs and Spotify IDs both identify tracks, so a file matching either is returned
+	var idConds []string
+	if len(query.ISRCs) > 0 {
+		idConds = append(idConds, "isrc IN ("+placeholders(len(query.ISRCs))+")")
+		for _, isrc := range query.ISRCs {
+			args = append(args, strings.ToUpper(isrc))
+		}
+	}
+	if len(query.SpotifyIDs) > 0 {
+		idConds = append(idConds, "spotify_id IN ("+placeholders(len(query.SpotifyIDs))+")")
+		for _, id := range query.SpotifyIDs {
+			args = append(args, id)
+		}
+	}
+	if len(idConds) > 0 {
+		where = append(where, "("+strings.Join(idConds, " OR ")+")")
+	}
+
+	return queryLibraryFiles(db, strings.Join(where, " AND "), args...)
+}
+
+// libraryRootsClause scans roots (default: the configured library roots) when needed
+// and returns a WHERE condition matching the files inside any of them
+func libraryRootsClause(db *sql.DB, roots []string) (string, []interface{}, error) {
+	if len(roots) == 0 {
+		var err error
+		if roots, err = GetLibraryRoots(); err != nil {
+			return "", nil, err
+		}
+	}
+	if len(roots) == 0 {
+		return "", nil, fmt.Errorf("no library folders configured")
+	}
+
+	var conds []string
+	var args []interface{}
+	for _, root := range roots {
+		root = libraryRoot(root)
+		if err := globalLibrary.ensureScanned(db, root); err != nil {
+			return "", nil, fmt.Errorf("failed to scan %s: %v", root, err)
+		}
+		lo, hi := libraryPrefixRange(root)
+		conds = append(conds, "(path >= ? AND path < ?)")
+		args = append(args, lo, hi)
+	}
+	return "(" + strings.Join(conds, " OR ") + ")", args, nil
+}
+
+// queryLibraryFiles returns the files matching the WHERE clause, ordered by path
+func queryLibraryFiles(db *sql.DB, where string, args ...interface{}) ([]LibraryFile, error) {
+	rows, err := db.Query(`SELECT path, isrc, spotify_id, format, size, mtime, title, artist, duration_ms, bitrate, codec
+		FROM files WHERE `+where+` ORDER BY path`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []LibraryFile{}
+	for rows.Next() {
+		var file LibraryFile
+		var mtime int64
+		if err := rows.Scan(&file.Path, &file.ISRC, &file.SpotifyID, &file.Format, &file.Size, &mtime,
+			&file.Title, &file.Artist, &file.DurationMS, &file.Bitrate, &file.Codec); err != nil {
+			return nil, err
+		}
+		file.ModTime = time.Unix(0, mtime).Unix()
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
@@ -0,0 +1,200 @@
+package backend
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// openTestLibraryDB opens an empty database with the original schema and no migrations applied
+func openTestLibraryDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", "file:"+filepath.ToSlash(filepath.Join(t.TempDir(), "library.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(librarySchema); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestLibraryPrefixRange(t *testing.T) {
+	root := filepath.FromSlash("/music")
+
+	tests := []struct {
+		name string
+		root string
+		path string
+		want bool
+	}{
+		{"file", root, "/music/a.mp3", true},
+		{"nested", root, "/music/Artist/Album/a.mp3", true},
+		{"root itself", root, "/music", false},
+		{"sibling with common prefix", root, "/music2/a.mp3", false},
+		{"sibling sorted before separator", root, "/music-old/a.mp3", false},
+		{"sibling sorted after separator", root, "/music0/a.mp3", false},
+		{"parent", root, "/a.mp3", false},
+		{"trailing separator", root + string(filepath.Separator), "/music/a.mp3", true},
+		{"filesystem root", string(filepath.Separator), "/a.mp3", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lo, hi := libraryPrefixRange(tt.root)
+			path := filepath.FromSlash(tt.path)
+			if got := path >= lo && path < hi; got != tt.want {
+				t.Errorf("libraryPrefixRange(%q) = [%q, %q), contains %q = %v, want %v", tt.root, lo, hi, path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveLibraryPath(t *testing.T) {
+	files := []string{"/music/a.mp3", "/music/Artist/a.mp3", "/music/Artist/Album/b.flac", "/music/Artist2/c.mp3", "/music/Artist.mp3"}
+
+	tests := []struct {
+		name   string
+		remove string
+		want   []string
+	}{
+		{"file", "/music/a.mp3", []string{"/music/Artist.mp3", "/music/Artist/Album/b.flac", "/music/Artist/a.mp3", "/music/Artist2/c.mp3"}},
+		{"folder", "/music/Artist", []string{"/music/Artist.mp3", "/music/Artist2/c.mp3", "/music/a.mp3"}},
+		{"missing", "/other", []string{"/music/Artist.mp3", "/music/Artist/Album/b.flac", "/music/Artist/a.mp3", "/music/Artist2/c.mp3", "/music/a.mp3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestLibraryDB(t)
+			if err := migrateLibraryDB(db); err != nil {
+				t.Fatal(err)
+			}
+			for _, path := range files {
+				path = filepath.FromSlash(path)
+				if err := upsertLibraryFile(db, LibraryFile{Path: path, Format: libraryFileFormat(path)}, 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := removeLibraryPath(db, filepath.FromSlash(tt.remove)); err != nil {
+				t.Fatal(err)
+			}
+			left, err := queryLibraryFiles(db, "1 = 1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, file := range left {
+				got = append(got, filepath.ToSlash(file.Path))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("after removing %q: %q, want %q", tt.remove, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrateLibraryDB(t *testing.T) {
+	for from := 0; from <= len(libraryMigrations); from++ {
+		t.Run(fmt.Sprintf("from version %d", from), func(t *testing.T) {
+			db := openTestLibraryDB(t)
+			for _, migration := range libraryMigrations[:from] {
+				if _, err := db.Exec(migration); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", from)); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.Exec(`INSERT INTO files (path, isrc, format, size, mtime) VALUES ('/music/a.flac', 'AAA', 'flac', 10, 123);
+				INSERT INTO roots (path, last_scan) VALUES ('/music', 456);`); err != nil {
+				t.Fatal(err)
+			}
+
+			// Running it twice must be harmless
+			for i := 0; i < 2; i++ {
+				if err := migrateLibraryDB(db); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var version int
+			if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+				t.Fatal(err)
+			}
+			if version != len(libraryMigrations) {
+				t.Errorf("user_version = %d, want %d", version, len(libraryMigrations))
+			}
+
+			// Every column the current code reads is there, and existing rows are kept
+			files, err := queryLibraryFiles(db, "isrc = ?", "AAA")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 1 || files[0].Size != 10 {
+				t.Fatalf("files after migration = %+v, want the original row", files)
+			}
+
+			// Any migration resets the scan state so the new columns get filled in
+			var mtime, lastScan int64
+			if err := db.QueryRow("SELECT mtime FROM files").Scan(&mtime); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.QueryRow("SELECT last_scan FROM roots").Scan(&lastScan); err != nil {
+				t.Fatal(err)
+			}
+			migrated := from < len(libraryMigrations)
+			if (mtime == 0) != migrated || (lastScan == 0) != migrated {
+				t.Errorf("mtime = %d, last_scan = %d after migrating from %d", mtime, lastScan, from)
+			}
+		})
+	}
+}
+
+func TestGetOrBuildISRCIndex(t *testing.T) {
+	useTestLibrary(t)
+	dir := t.TempDir()
+	writeTestMP3(t, filepath.Join(dir, "music", "Artist", "a.mp3"), "aaa")
+	writeTestMP3(t, filepath.Join(dir, "music", "b.mp3"), "BBB")
+	writeTestMP3(t, filepath.Join(dir, "music2", "c.mp3"), "CCC")
+	writeTestMP3(t, filepath.Join(dir, "music-old", "d.mp3"), "DDD")
+
+	// Scanning the siblings first puts their files in the database next to the ones in music
+	for _, sibling := range []string{"music2", "music-old"} {
+		getOrBuildISRCIndex(filepath.Join(dir, sibling), "")
+	}
+
+	tests := []struct {
+		name        string
+		dir         string
+		audioFormat string
+		want        map[string]string
+	}{
+		{"all formats", "music", "", map[string]string{"AAA": "music/Artist/a.mp3", "BBB": "music/b.mp3"}},
+		{"matching format", "music", "mp3", map[string]string{"AAA": "music/Artist/a.mp3", "BBB": "music/b.mp3"}},
+		{"other format", "music", "flac", map[string]string{}},
+		{"sub-folder", "music/Artist", "", map[string]string{"AAA": "music/Artist/a.mp3"}},
+		{"no folder", "", "", map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputDir := ""
+			if tt.dir != "" {
+				outputDir = filepath.Join(dir, filepath.FromSlash(tt.dir))
+			}
+			got := make(map[string]string)
+			for isrc, path := range getOrBuildISRCIndex(outputDir, tt.audioFormat) {
+				rel, _ := filepath.Rel(dir, path)
+				got[isrc] = filepath.ToSlash(rel)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getOrBuildISRCIndex(%q, %q) = %v, want %v", tt.dir, tt.audioFormat, got, tt.want)
+			}
+		})
+	}
+}
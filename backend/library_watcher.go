@@ -0,0 +1,290 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Delay before a created or written file is indexed, so a file is read once it's done being written
+var libraryWatchDebounce = 2 * time.Second
+
+type libraryWatcher struct {
+	mu      sync.Mutex
+	watcher *fsnotify.Watcher
+	roots   []string // Watched roots that have been scanned
+	pending map[string]*time.Timer
+	done    chan struct{}
+	indexWG sync.WaitGroup // Debounced index calls that have started running
+
+	refreshMu sync.Mutex
+}
+
+var globalLibraryWatcher = &libraryWatcher{}
+
+// StartLibraryWatcher watches the configured library folders and keeps the library database
+// current as files are created, renamed or removed outside the app
+func StartLibraryWatcher() error {
+	w := globalLibraryWatcher
+	w.mu.Lock()
+	if w.watcher != nil {
+		w.mu.Unlock()
+		return nil
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		w.mu.Unlock()
+		return fmt.Errorf("failed to start library watcher: %v", err)
+	}
+	w.watcher = watcher
+	w.pending = make(map[string]*time.Timer)
+	w.done = make(chan struct{})
+	go w.run(watcher, w.done)
+	w.mu.Unlock()
+
+	go w.refresh()
+	return nil
+}
+
+// StopLibraryWatcher stops watching the library folders. Pending index calls are dropped and
+// ones already running are waited for, so none of them reopens the database after CloseLibraryDB.
+func StopLibraryWatcher() {
+	w := globalLibraryWatcher
+	w.mu.Lock()
+	if w.watcher == nil {
+		w.mu.Unlock()
+		return
+	}
+	close(w.done)
+	w.watcher.Close()
+	for _, timer := range w.pending {
+		timer.Stop()
+	}
+	w.watcher = nil
+	w.roots = nil
+	w.pending = nil
+	w.mu.Unlock()
+
+	w.indexWG.Wait()
+}
+
+// covers reports whether dir is inside a watched library root
+func (w *libraryWatcher) covers(dir string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, root := range w.roots {
+		if isInDir(dir, root) {
+			return true
+		}
+	}
+	return false
+}
+
+// refresh watches the configured library roots, dropping roots that are no longer configured,
+// and scans them to catch up on changes made while they weren't watched
+func (w *libraryWatcher) refresh() {
+	w.refreshMu.Lock()
+	defer w.refreshMu.Unlock()
+
+	w.mu.Lock()
+	watcher := w.watcher
+	w.mu.Unlock()
+	if watcher == nil {
+		return
+	}
+
+	roots, err := GetLibraryRoots()
+	if err != nil {
+		fmt.Printf("[Library] Failed to load library folders: %v\n", err)
+		return
+	}
+	db, err := globalLibrary.open()
+	if err != nil {
+		return
+	}
+
+	for _, path := range watcher.WatchList() {
+		configured := false
+		for _, root := range roots {
+			if isInDir(path, root) {
+				configured = true
+				break
+			}
+		}
+		if !configured {
+			watcher.Remove(path)
+		}
+	}
+
+	watched := make([]string, 0, len(roots))
+	for _, root := range roots {
+		if err := addWatchTree(watcher, root); err != nil {
+			fmt.Printf("[Library] Failed to watch %s: %v\n", root, err)
+			continue
+		}
+
+		globalLibrary.scanMu.Lock()
+		err := globalLibrary.scanLocked(db, root)
+		globalLibrary.scanMu.Unlock()
+		if err != nil {
+			fmt.Printf("[Library] Failed to scan %s: %v\n", root, err)
+			continue
+		}
+		watched = append(watched, root)
+	}
+
+	w.mu.Lock()
+	if w.watcher == watcher {
+		w.roots = watched
+	}
+	w.mu.Unlock()
+}
+
+// addWatchTree watches dir and every folder below it; fsnotify doesn't watch recursively
+func addWatchTree(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if err := watcher.Add(path); err != nil {
+			fmt.Printf("[Library] Failed to watch %s: %v\n", path, err)
+		}
+		return nil
+	})
+}
+
+func (w *libraryWatcher) run(watcher *fsnotify.Watcher, done chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			w.handle(watcher, event)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				fmt.Println("[Library] Watcher missed events, rescanning library folders")
+				go w.refresh()
+				continue
+			}
+			fmt.Printf("[Library] Watcher error: %v\n", err)
+		}
+	}
+}
+
+func (w *libraryWatcher) handle(watcher *fsnotify.Watcher, event fsnotify.Event) {
+	path := event.Name
+
+	switch {
+	case event.Has(fsnotify.Create):
+		info, err := os.Stat(path)
+		if err != nil {
+			return
+		}
+		if info.IsDir() {
+			// A folder moved into the library arrives as a single event, so its contents are scanned here
+			addWatchTree(watcher, path)
+			go w.scanDir(path)
+			return
+		}
+		w.schedule(path)
+
+	case event.Has(fsnotify.Write):
+		w.schedule(path)
+
+	case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+		// A rename reports the old path; the new path arrives as a create event
+		w.cancel(path)
+		for _, watched := range watcher.WatchList() {
+			if isInDir(watched, path) {
+				watcher.Remove(watched)
+			}
+		}
+		db, err := globalLibrary.open()
+		if err != nil {
+			return
+		}
+		if err := removeLibraryPath(db, path); err != nil {
+			fmt.Printf("[Library] Failed to remove %s: %v\n", path, err)
+		}
+	}
+}
+
+// schedule indexes path once it has stopped changing
+func (w *libraryWatcher) schedule(path string) {
+	if libraryFileFormat(path) == "" {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.pending == nil {
+		return
+	}
+	// A timer that already fired is replaced; its callback sees it's no longer pending and does nothing
+	if timer, ok := w.pending[path]; ok && timer.Stop() {
+		timer.Reset(libraryWatchDebounce)
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(libraryWatchDebounce, func() {
+		w.mu.Lock()
+		// Cancelled, replaced, or the watcher was stopped while this callback was starting
+		if w.pending[path] != timer {
+			w.mu.Unlock()
+			return
+		}
+		delete(w.pending, path)
+		w.indexWG.Add(1)
+		w.mu.Unlock()
+		defer w.indexWG.Done()
+
+		if err := IndexLibraryFile(path, ""); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("[Library] Failed to index %s: %v\n", path, err)
+		}
+	})
+	w.pending[path] = timer
+}
+
+func (w *libraryWatcher) cancel(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if timer, ok := w.pending[path]; ok {
+		timer.Stop()
+		delete(w.pending, path)
+	}
+}
+
+func (w *libraryWatcher) scanDir(dir string) {
+	db, err := globalLibrary.open()
+	if err != nil {
+		return
+	}
+
+	globalLibrary.scanMu.Lock()
+	defer globalLibrary.scanMu.Unlock()
+	if err := scanLibraryDir(db, dir); err != nil {
+		fmt.Printf("[Library] Failed to scan %s: %v\n", dir, err)
+	}
+}
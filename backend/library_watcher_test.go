@@ -0,0 +1,152 @@
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// newTestLibraryWatcher returns a watcher that isn't running, with a short debounce, for feeding events by hand
+func newTestLibraryWatcher(t *testing.T, debounce time.Duration) (*libraryWatcher, *fsnotify.Watcher) {
+	saved := libraryWatchDebounce
+	libraryWatchDebounce = debounce
+	t.Cleanup(func() { libraryWatchDebounce = saved })
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { watcher.Close() })
+	return &libraryWatcher{watcher: watcher, pending: make(map[string]*time.Timer)}, watcher
+}
+
+// isPending reports whether path is waiting to be indexed
+func (w *libraryWatcher) isPending(path string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, ok := w.pending[path]
+	return ok
+}
+
+// waitIdle waits until every scheduled index call has run
+func (w *libraryWatcher) waitIdle(t *testing.T) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w.mu.Lock()
+		n := len(w.pending)
+		w.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d files still pending", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	w.indexWG.Wait()
+}
+
+// libraryISRC returns the ISRC the library database has for path, or "" when it isn't there
+func libraryISRC(t *testing.T, path string) string {
+	t.Helper()
+	db, err := globalLibrary.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := queryLibraryFiles(db, "path = ?", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		return ""
+	}
+	return files[0].ISRC
+}
+
+func TestLibraryWatcherEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		indexed bool // Already in the database before the events
+		deleted bool // Gone from disk before the events
+		events  []fsnotify.Op
+		want    string
+	}{
+		{"created", "a.mp3", false, false, []fsnotify.Op{fsnotify.Create}, "AAA"},
+		{"created and written", "a.mp3", false, false, []fsnotify.Op{fsnotify.Create, fsnotify.Write, fsnotify.Write}, "AAA"},
+		{"written", "a.mp3", false, false, []fsnotify.Op{fsnotify.Write}, "AAA"},
+		{"created then removed", "a.mp3", false, true, []fsnotify.Op{fsnotify.Create, fsnotify.Remove}, ""},
+		{"removed", "a.mp3", true, true, []fsnotify.Op{fsnotify.Remove}, ""},
+		{"renamed away", "a.mp3", true, true, []fsnotify.Op{fsnotify.Rename}, ""},
+		{"written then renamed away", "a.mp3", true, false, []fsnotify.Op{fsnotify.Write, fsnotify.Rename}, ""},
+		{"not an audio file", "a.txt", false, false, []fsnotify.Op{fsnotify.Create, fsnotify.Write}, ""},
+		{"chmod only", "a.mp3", false, false, []fsnotify.Op{fsnotify.Chmod}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestLibrary(t)
+			w, watcher := newTestLibraryWatcher(t, 20*time.Millisecond)
+
+			path := filepath.Join(t.TempDir(), tt.file)
+			writeTestMP3(t, path, "AAA")
+			if tt.indexed {
+				if err := IndexLibraryFile(path, ""); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, op := range tt.events {
+				if tt.deleted && op != fsnotify.Create && op != fsnotify.Write {
+					os.Remove(path)
+				}
+				w.handle(watcher, fsnotify.Event{Name: path, Op: op})
+			}
+			w.waitIdle(t)
+
+			if got := libraryISRC(t, path); got != tt.want {
+				t.Errorf("after %v: library has ISRC %q, want %q", tt.events, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLibraryWatcherDebounce(t *testing.T) {
+	useTestLibrary(t)
+	debounce := 200 * time.Millisecond
+	w, watcher := newTestLibraryWatcher(t, debounce)
+
+	path := filepath.Join(t.TempDir(), "a.mp3")
+	writeTestMP3(t, path, "AAA")
+
+	// Writes keep pushing the index call back, well past the debounce after the first one
+	start := time.Now()
+	for time.Since(start) < debounce*3/2 {
+		w.handle(watcher, fsnotify.Event{Name: path, Op: fsnotify.Write})
+		time.Sleep(debounce / 4)
+	}
+	w.handle(watcher, fsnotify.Event{Name: path, Op: fsnotify.Write})
+	if !w.isPending(path) || libraryISRC(t, path) != "" {
+		t.Fatal("file indexed while it was still being written")
+	}
+
+	w.waitIdle(t)
+	if got := libraryISRC(t, path); got != "AAA" {
+		t.Errorf("library has ISRC %q once writes stopped, want AAA", got)
+	}
+}
+
+func TestLibraryWatcherStopped(t *testing.T) {
+	useTestLibrary(t)
+	w := &libraryWatcher{}
+
+	path := filepath.Join(t.TempDir(), "a.mp3")
+	writeTestMP3(t, path, "AAA")
+	w.schedule(path)
+	if w.isPending(path) {
+		t.Error("file scheduled on a stopped watcher")
+	}
+}
@@ -0,0 +1,656 @@
+package backend
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	pathfilepath "path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	id3v2 "github.com/bogem/id3v2/v2"
+	mewflac "github.com/mewkiz/flac"
+)
+
+// ReplayGain 2.0 reference level; track and album gains bring the audio to this loudness
+const replayGainReferenceLUFS = -18.0
+
+// Blocks quieter than this are silence and never count towards loudness (ITU-R BS.1770-4)
+const absoluteGateLUFS = -70.0
+
+// ReplayGain tag names; M4A files use the lowercase freeform names other taggers write
+const (
+	tagReplayGainTrackGain = "REPLAYGAIN_TRACK_GAIN"
+	tagReplayGainTrackPeak = "REPLAYGAIN_TRACK_PEAK"
+	tagReplayGainAlbumGain = "REPLAYGAIN_ALBUM_GAIN"
+	tagReplayGainAlbumPeak = "REPLAYGAIN_ALBUM_PEAK"
+)
+
+// LoudnessScanRequest selects the files to measure
+type LoudnessScanRequest struct {
+	Folder    string   `json:"folder,omitempty"` // Scanned recursively for FLAC, MP3 and M4A files
+	Files     []string `json:"files,omitempty"`
+	WriteTags bool     `json:"write_tags"` // Write ReplayGain tags; otherwise only measure
+}
+
+// LoudnessResult is the loudness of one file per ITU-R BS.1770 and EBU R128.
+// Album values are measured over every scanned file with the same album and album artist tags.
+type LoudnessResult struct {
+	Path          string   `json:"path"`
+	Album         string   `json:"album,omitempty"`
+	Integrated    float64  `json:"integrated_lufs"`
+	TruePeak      float64  `json:"true_peak_dbtp"`
+	LoudnessRange float64  `json:"loudness_range_lu"`
+	TrackGain     float64  `json:"track_gain_db"`
+	TrackPeak     float64  `json:"track_peak"` // Linear true peak
+	AlbumGain     *float64 `json:"album_gain_db,omitempty"`
+	AlbumPeak     *float64 `json:"album_peak,omitempty"`
+	Tagged        bool     `json:"tagged"`
+	Error         string   `json:"error,omitempty"`
+}
+
+// loudnessMeasurement keeps the gating blocks of a track so albums can be measured over all of their tracks
+type loudnessMeasurement struct {
+	blocks    []float64 // Mean square of each 400 ms block
+	shortTerm []float64 // Mean square of each 3 s window
+	truePeak  float64   // Linear
+}
+
+// ScanLoudness measures the integrated loudness, true peak and loudness range of each file and its album,
+// optionally writing REPLAYGAIN_TRACK_* and REPLAYGAIN_ALBUM_* tags
+func ScanLoudness(req LoudnessScanRequest) ([]LoudnessResult, error) {
+	files := append([]string(nil), req.Files...)
+	if req.Folder != "" {
+		found, err := ListAudioFiles(req.Folder)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range found {
+			files = append(files, file.Path)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no audio files to scan")
+	}
+
+	results := make([]LoudnessResult, len(files))
+	measurements := make([]*loudnessMeasurement, len(files))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, runtime.NumCPU())
+	for i, file := range files {
+		wg.Add(1)
+		go func(idx int, path string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			result := LoudnessResult{Path: path}
+			m, err := measureLoudness(path)
+			if err == nil {
+				err = result.setTrack(m)
+			}
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				measurements[idx] = m
+			}
+			results[idx] = result
+		}(i, file)
+	}
+	wg.Wait()
+
+	// Group the measured tracks into albums by their tags
+	albums := make(map[string][]int)
+	for i, result := range results {
+		if measurements[i] == nil {
+			continue
+		}
+		metadata, err := ReadAudioMetadata(result.Path)
+		if err != nil || metadata.Album == "" {
+			continue
+		}
+		results[i].Album = metadata.Album
+		key := strings.ToLower(firstNonEmpty(metadata.AlbumArtist, metadata.Artist) + "\x00" + metadata.Album)
+		albums[key] = append(albums[key], i)
+	}
+	for _, indexes := range albums {
+		album := &loudnessMeasurement{}
+		for _, i := range indexes {
+			album.blocks = append(album.blocks, measurements[i].blocks...)
+			album.truePeak = math.Max(album.truePeak, measurements[i].truePeak)
+		}
+		integrated := gatedLoudness(album.blocks, -10)
+		if math.IsInf(integrated, -1) {
+			continue
+		}
+		gain := replayGainReferenceLUFS - integrated
+		for _, i := range indexes {
+			results[i].AlbumGain = &gain
+			results[i].AlbumPeak = &album.truePeak
+		}
+	}
+
+	if req.WriteTags {
+		tagged := 0
+		for i := range results {
+			if results[i].Error != "" {
+				continue
+			}
+			if err := writeReplayGainTags(results[i]); err != nil {
+				results[i].Error = err.Error()
+				continue
+			}
+			results[i].Tagged = true
+			tagged++
+		}
+		fmt.Printf("[Loudness] Tagged %d of %d files\n", tagged, len(results))
+	}
+
+	return results, nil
+}
+
+// setTrack fills in the track values of a measurement
+func (r *LoudnessResult) setTrack(m *loudnessMeasurement) error {
+	integrated := gatedLoudness(m.blocks, -10)
+	if math.IsInf(integrated, -1) {
+		return fmt.Errorf("no audio above the silence threshold")
+	}
+	r.Integrated = integrated
+	r.LoudnessRange = loudnessRange(m.shortTerm)
+	r.TrackGain = replayGainReferenceLUFS - integrated
+	r.TrackPeak = m.truePeak
+	r.TruePeak = 20 * math.Log10(math.Max(m.truePeak, 1e-10))
+	return nil
+}
+
+// measureLoudness decodes a file and runs it through the loudness meter
+func measureLoudness(filePath string) (*loudnessMeasurement, error) {
+	stream, err := decodePCM(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.close()
+
+	meter := newLoudnessMeter(stream.sampleRate, stream.channels)
+	for {
+		samples, err := stream.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode audio: %v", err)
+		}
+		meter.add(samples)
+	}
+
+	return &loudnessMeasurement{
+		blocks:    meter.windows(4),  // 400 ms momentary blocks
+		shortTerm: meter.windows(30), // 3 s short-term windows
+		truePeak:  meter.truePeak,
+	}, nil
+}
+
+// gatedLoudness returns the loudness in LUFS of the blocks above the absolute gate and relativeGate LU
+// below their own loudness, or -Inf when every block is silent
+func gatedLoudness(blocks []float64, relativeGate float64) float64 {
+	absolute := loudnessToPower(absoluteGateLUFS)
+	var sum float64
+	var n int
+	for _, z := range blocks {
+		if z > absolute {
+			sum += z
+			n++
+		}
+	}
+	if n == 0 {
+		return math.Inf(-1)
+	}
+
+	relative := sum / float64(n) * math.Pow(10, relativeGate/10)
+	sum, n = 0, 0
+	for _, z := range blocks {
+		if z > absolute && z > relative {
+			sum += z
+			n++
+		}
+	}
+	if n == 0 {
+		return math.Inf(-1)
+	}
+	return powerToLoudness(sum / float64(n))
+}
+
+// loudnessRange returns the EBU R128 loudness range: the spread between the 10th and 95th percentile
+// of the gated short-term loudness
+func loudnessRange(shortTerm []float64) float64 {
+	absolute := loudnessToPower(absoluteGateLUFS)
+	var sum float64
+	var gated []float64
+	for _, z := range shortTerm {
+		if z > absolute {
+			sum += z
+			gated = append(gated, z)
+		}
+	}
+	if len(gated) == 0 {
+		return 0
+	}
+
+	relative := sum / float64(len(gated)) * math.Pow(10, -20.0/10)
+	var loudness []float64
+	for _, z := range gated {
+		if z > relative {
+			loudness = append(loudness, powerToLoudness(z))
+		}
+	}
+	if len(loudness) == 0 {
+		return 0
+	}
+	sort.Float64s(loudness)
+	percentile := func(p float64) float64 {
+		return loudness[int(math.Round(p*float64(len(loudness)-1)))]
+	}
+	return percentile(0.95) - percentile(0.10)
+}
+
+func powerToLoudness(z float64) float64 {
+	return -0.691 + 10*math.Log10(z)
+}
+
+func loudnessToPower(lufs float64) float64 {
+	return math.Pow(10, (lufs+0.691)/10)
+}
+
+// biquad is a second-order IIR filter in transposed direct form II
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+	return y
+}
+
+// kWeighting returns the BS.1770 pre-filter (high shelf) and RLB high-pass filter for a sample rate
+func kWeighting(sampleRate float64) [2]biquad {
+	// High shelf modelling the acoustic effect of the head
+	f0, gain, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / sampleRate)
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	// High-pass filter
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / sampleRate)
+	a0 = 1 + k/q + k*k
+	highPass := biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return [2]biquad{shelf, highPass}
+}
+
+// truePeakFilter oversamples a channel with a polyphase windowed-sinc FIR to find inter-sample peaks
+type truePeakFilter struct {
+	phases  [][]float64
+	history []float64 // Most recent input last
+}
+
+func newTruePeakFilter(sampleRate int) *truePeakFilter {
+	// 4x below 96 kHz and 2x below 192 kHz, which keeps the oversampled rate at 192 kHz or more
+	factor := 1
+	switch {
+	case sampleRate < 96000:
+		factor = 4
+	case sampleRate < 192000:
+		factor = 2
+	}
+
+	const tapsPerPhase = 12
+	taps := tapsPerPhase * factor
+	phases := make([][]float64, factor)
+	for p := range phases {
+		phases[p] = make([]float64, tapsPerPhase)
+	}
+	for j := 0; j < taps; j++ {
+		m := float64(j) - float64(taps-1)/2
+		c := 1.0
+		if math.Abs(m) > 1e-6 {
+			x := m * math.Pi / float64(factor)
+			c = math.Sin(x) / x
+		}
+		c *= 0.5 * (1 - math.Cos(2*math.Pi*float64(j)/float64(taps-1))) // Hann window
+		phases[j%factor][j/factor] = c
+	}
+	return &truePeakFilter{phases: phases, history: make([]float64, tapsPerPhase)}
+}
+
+// process returns the largest absolute value among the oversampled points for input x
+func (f *truePeakFilter) process(x float64) float64 {
+	copy(f.history, f.history[1:])
+	f.history[len(f.history)-1] = x
+
+	peak := math.Abs(x)
+	if len(f.phases) == 1 {
+		return peak
+	}
+	last := len(f.history) - 1
+	for _, phase := range f.phases {
+		var y float64
+		for i, c := range phase {
+			y += c * f.history[last-i]
+		}
+		peak = math.Max(peak, math.Abs(y))
+	}
+	return peak
+}
+
+// loudnessMeter accumulates K-weighted channel power in 100 ms steps; gating blocks are built from the steps
+type loudnessMeter struct {
+	channels  int
+	weights   []float64 // BS.1770 channel weights; 0 for LFE
+	filters   [][2]biquad
+	peaks     []*truePeakFilter
+	stepSize  int     // Samples per channel in 100 ms
+	stepFill  int     // Samples per channel in the current step
+	stepPower float64 // Weighted sum of squares of the current step
+	steps     []float64
+	truePeak  float64
+}
+
+func newLoudnessMeter(sampleRate, channels int) *loudnessMeter {
+	m := &loudnessMeter{
+		channels: channels,
+		weights:  make([]float64, channels),
+		filters:  make([][2]biquad, channels),
+		peaks:    make([]*truePeakFilter, channels),
+		stepSize: max(sampleRate/10, 1),
+	}
+	for ch := 0; ch < channels; ch++ {
+		m.weights[ch] = 1
+		// 5.1 in SMPTE order: L, R, C, LFE, Ls, Rs
+		if channels == 6 {
+			switch ch {
+			case 3:
+				m.weights[ch] = 0
+			case 4, 5:
+				m.weights[ch] = 1.41
+			}
+		}
+		m.filters[ch] = kWeighting(float64(sampleRate))
+		m.peaks[ch] = newTruePeakFilter(sampleRate)
+	}
+	return m
+}
+
+// add feeds interleaved samples in [-1, 1]
+func (m *loudnessMeter) add(samples []float64) {
+	for i := 0; i+m.channels <= len(samples); i += m.channels {
+		for ch := 0; ch < m.channels; ch++ {
+			x := samples[i+ch]
+			m.truePeak = math.Max(m.truePeak, m.peaks[ch].process(x))
+			if m.weights[ch] == 0 {
+				continue
+			}
+			y := m.filters[ch][1].process(m.filters[ch][0].process(x))
+			m.stepPower += m.weights[ch] * y * y
+		}
+		m.stepFill++
+		if m.stepFill == m.stepSize {
+			m.steps = append(m.steps, m.stepPower)
+			m.stepPower, m.stepFill = 0, 0
+		}
+	}
+}
+
+// windows returns the mean square of every window of n steps, advancing one step at a time.
+// A track shorter than one window is measured as a single window.
+func (m *loudnessMeter) windows(n int) []float64 {
+	steps := m.steps
+	if len(steps) < n {
+		if len(steps) == 0 {
+			return nil
+		}
+		var sum float64
+		for _, p := range steps {
+			sum += p
+		}
+		return []float64{sum / float64(len(steps)*m.stepSize)}
+	}
+
+	windows := make([]float64, 0, len(steps)-n+1)
+	var sum float64
+	for i, p := range steps {
+		sum += p
+		if i >= n {
+			sum -= steps[i-n]
+		}
+		if i >= n-1 {
+			windows = append(windows, sum/float64(n*m.stepSize))
+		}
+	}
+	return windows
+}
+
+// pcmStream delivers decoded audio as interleaved float samples in [-1, 1]
+type pcmStream struct {
+	sampleRate int
+	channels   int
+	next       func() ([]float64, error) // io.EOF after the last samples
+	close      func()
+}
+
+// decodePCM decodes FLAC natively and other formats through ffmpeg
+func decodePCM(filePath string) (*pcmStream, error) {
+	if strings.ToLower(pathfilepath.Ext(filePath)) == ".flac" {
+		return decodeFlacPCM(filePath)
+	}
+	return decodeFFmpegPCM(filePath)
+}
+
+func decodeFlacPCM(filePath string) (*pcmStream, error) {
+	stream, err := mewflac.ParseFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse FLAC file: %w", err)
+	}
+
+	channels := int(stream.Info.NChannels)
+	scale := float64(int64(1) << (stream.Info.BitsPerSample - 1))
+	var buf []float64
+	return &pcmStream{
+		sampleRate: int(stream.Info.SampleRate),
+		channels:   channels,
+		next: func() ([]float64, error) {
+			frame, err := stream.ParseNext()
+			if err != nil {
+				return nil, err
+			}
+			n := frame.Subframes[0].NSamples
+			buf = buf[:0]
+			for i := 0; i < n; i++ {
+				for ch := 0; ch < channels; ch++ {
+					buf = append(buf, float64(frame.Subframes[ch].Samples[i])/scale)
+				}
+			}
+			return buf, nil
+		},
+		close: func() { stream.Close() },
+	}, nil
+}
+
+// decodeFFmpegPCM has ffmpeg decode the first audio stream to a 32-bit float WAV on stdout
+func decodeFFmpegPCM(filePath string) (*pcmStream, error) {
+	ffmpegPath, err := GetFFmpegPath()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg not found: %w", err)
+	}
+
+	cmd := exec.Command(ffmpegPath, "-v", "error", "-i", filePath, "-map", "0:a:0", "-c:a", "pcm_f32le", "-f", "wav", "-")
+	setHideWindow(cmd)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	stop := func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+
+	r := bufio.NewReaderSize(stdout, 64*1024)
+	sampleRate, channels, err := readWAVHeader(r)
+	if err != nil {
+		stop()
+		return nil, fmt.Errorf("failed to decode audio: %v", err)
+	}
+
+	raw := make([]byte, 4*channels*4096)
+	var buf []float64
+	return &pcmStream{
+		sampleRate: sampleRate,
+		channels:   channels,
+		next: func() ([]float64, error) {
+			n, err := io.ReadFull(r, raw)
+			if err == io.ErrUnexpectedEOF {
+				err = nil
+			}
+			if n == 0 {
+				if err == nil {
+					err = io.EOF
+				}
+				return nil, err
+			}
+			n -= n % (4 * channels)
+			buf = buf[:0]
+			for i := 0; i < n; i += 4 {
+				buf = append(buf, float64(math.Float32frombits(binary.LittleEndian.Uint32(raw[i:]))))
+			}
+			return buf, nil
+		},
+		close: stop,
+	}, nil
+}
+
+// readWAVHeader reads up to the start of the sample data and returns the sample rate and channel count
+func readWAVHeader(r io.Reader) (int, int, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return 0, 0, err
+	}
+	if string(riff[:4]) != "RIFF" || string(riff[8:]) != "WAVE" {
+		return 0, 0, errors.New("not a WAV stream")
+	}
+
+	sampleRate, channels := 0, 0
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return 0, 0, err
+		}
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+		switch string(chunk[:4]) {
+		case "fmt ":
+			format := make([]byte, size)
+			if _, err := io.ReadFull(r, format); err != nil {
+				return 0, 0, err
+			}
+			if len(format) < 8 {
+				return 0, 0, errors.New("invalid WAV format chunk")
+			}
+			channels = int(binary.LittleEndian.Uint16(format[2:]))
+			sampleRate = int(binary.LittleEndian.Uint32(format[4:]))
+		case "data":
+			if sampleRate == 0 || channels == 0 {
+				return 0, 0, errors.New("WAV stream has no format chunk")
+			}
+			return sampleRate, channels, nil
+		default:
+			if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+}
+
+// writeReplayGainTags stores the track and album gain and peak of a result, removing stale album values
+func writeReplayGainTags(result LoudnessResult) error {
+	values := map[string]string{
+		tagReplayGainTrackGain: fmt.Sprintf("%.2f dB", result.TrackGain),
+		tagReplayGainTrackPeak: fmt.Sprintf("%.6f", result.TrackPeak),
+		tagReplayGainAlbumGain: "",
+		tagReplayGainAlbumPeak: "",
+	}
+	if result.AlbumGain != nil {
+		values[tagReplayGainAlbumGain] = fmt.Sprintf("%.2f dB", *result.AlbumGain)
+		values[tagReplayGainAlbumPeak] = fmt.Sprintf("%.6f", *result.AlbumPeak)
+	}
+	names := []string{tagReplayGainTrackGain, tagReplayGainTrackPeak, tagReplayGainAlbumGain, tagReplayGainAlbumPeak}
+
+	switch strings.ToLower(pathfilepath.Ext(result.Path)) {
+	case ".flac":
+		fields := make(map[string][]string, len(values))
+		for name, value := range values {
+			fields[name] = nil
+			if value != "" {
+				fields[name] = []string{value}
+			}
+		}
+		return updateFlacComments(result.Path, fields)
+
+	case ".mp3":
+		tag, err := id3v2.Open(result.Path, id3v2.Options{Parse: true})
+		if err != nil {
+			return fmt.Errorf("failed to open MP3 file: %w", err)
+		}
+		defer tag.Close()
+		for _, name := range names {
+			setMp3UserText(tag, name, values[name])
+		}
+		if err := tag.Save(); err != nil {
+			return fmt.Errorf("failed to save MP3 tags: %w", err)
+		}
+		return nil
+
+	case ".m4a":
+		err := updateMP4Tags(result.Path, func(tags *mp4Tags) {
+			for _, name := range names {
+				key := mp4FreeformKey(strings.ToLower(name))
+				if values[name] == "" {
+					tags.set(key)
+				} else {
+					tags.setText(key, values[name])
+				}
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("failed to save M4A tags: %w", err)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported file format: %s", pathfilepath.Ext(result.Path))
+	}
+}
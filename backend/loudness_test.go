@@ -0,0 +1,66 @@
+package backend
+
+import (
+	"math"
+	"testing"
+)
+
+// measureTone returns the integrated loudness of seconds of a 1 kHz sine at dbfs on every channel
+func measureTone(sampleRate, channels int, dbfs, seconds float64) float64 {
+	meter := newLoudnessMeter(sampleRate, channels)
+	amplitude := math.Pow(10, dbfs/20)
+	n := int(seconds * float64(sampleRate))
+	samples := make([]float64, 0, n*channels)
+	for i := 0; i < n; i++ {
+		x := amplitude * math.Sin(2*math.Pi*1000*float64(i)/float64(sampleRate))
+		for ch := 0; ch < channels; ch++ {
+			samples = append(samples, x)
+		}
+	}
+	meter.add(samples)
+	return gatedLoudness(meter.windows(4), -10)
+}
+
+func TestGatedLoudnessReferenceTone(t *testing.T) {
+	// EBU Tech 3341: a stereo 1 kHz sine at -23 dBFS measures -23 LUFS; mono is 3 dB quieter
+	tests := []struct {
+		name       string
+		sampleRate int
+		channels   int
+		dbfs       float64
+		want       float64
+	}{
+		{"stereo -23 dBFS", 48000, 2, -23, -23},
+		{"stereo -20 dBFS", 48000, 2, -20, -20},
+		{"stereo -20 dBFS at 44.1 kHz", 44100, 2, -20, -20},
+		{"mono -20 dBFS", 48000, 1, -20, -23.01},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := measureTone(tt.sampleRate, tt.channels, tt.dbfs, 5)
+			if math.Abs(got-tt.want) > 0.1 {
+				t.Errorf("loudness = %.2f LUFS, want %.2f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGatedLoudnessGates(t *testing.T) {
+	if got := gatedLoudness(nil, -10); !math.IsInf(got, -1) {
+		t.Errorf("no blocks: got %v, want -Inf", got)
+	}
+
+	silent := loudnessToPower(-80)
+	if got := gatedLoudness([]float64{silent, silent}, -10); !math.IsInf(got, -1) {
+		t.Errorf("silent blocks: got %v, want -Inf", got)
+	}
+
+	// Silence is below the absolute gate and the -40 LUFS block below the relative one,
+	// so only the -20 LUFS blocks count
+	loud := loudnessToPower(-20)
+	blocks := []float64{loud, silent, loud, loudnessToPower(-40), silent, loud}
+	if got := gatedLoudness(blocks, -10); math.Abs(got+20) > 1e-9 {
+		t.Errorf("gated loudness = %v, want -20", got)
+	}
+}
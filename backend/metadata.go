@@ -3,12 +3,10 @@ package backend
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	pathfilepath "path/filepath"
+	"sort"
 	"strconv"
 	"strings"
-	"sync"
-	"time"
 
 	id3v2 "github.com/bogem/id3v2/v2"
 	"github.com/go-flac/flacpicture"
@@ -18,7 +16,9 @@ import (
 
 type Metadata struct {
 	Title       string
-	Artist      string
+	Artist      string   // Display artist, e.g. "A, B"
+	Artists     []string // Individual track artists, written as separate tag values unless JoinArtists is set
+	JoinArtists bool     // Write only the joined Artist value, for players that don't read multi-value tags
 	Album       string
 	AlbumArtist string
 	Date        string // Recorded date (full date YYYY-MM-DD)
@@ -29,8 +29,36 @@ type Metadata struct {
 	ISRC        string
 	Lyrics      string
 	Description string
+	ExtendedTags
 }
 
+// ExtendedTags are the Spotify identifiers and release details written next to the basic tags,
+// so files can be matched back to Spotify without searching
+type ExtendedTags struct {
+	SpotifyTrackID string   `json:"spotify_track_id,omitempty"`
+	SpotifyAlbumID string   `json:"spotify_album_id,omitempty"`
+	ReleaseType    string   `json:"release_type,omitempty"` // album, single or compilation
+	Label          string   `json:"label,omitempty"`
+	Copyright      string   `json:"copyright,omitempty"`
+	TotalDiscs     int      `json:"total_discs,omitempty"`
+	Genres         []string `json:"genres,omitempty"`
+	OriginalDate   string   `json:"original_date,omitempty"` // First release date (YYYY-MM-DD)
+	DurationMS     int      `json:"duration_ms,omitempty"`
+}
+
+// Tag names of the extended tags: Vorbis comment fields, and the descriptions of MP3 TXXX
+// and M4A freeform items that have no dedicated frame
+const (
+	tagSpotifyTrackID = "SPOTIFY_TRACK_ID"
+	tagSpotifyAlbumID = "SPOTIFY_ALBUM_ID"
+	tagReleaseType    = "RELEASETYPE"
+	tagLabel          = "LABEL"
+	tagCopyright      = "COPYRIGHT"
+	tagTotalDiscs     = "TOTALDISCS"
+	tagGenre          = "GENRE"
+	tagOriginalDate   = "ORIGINALDATE"
+)
+
 func EmbedMetadata(filePath string, metadata Metadata, coverPath string) error {
 	ext := strings.ToLower(pathfilepath.Ext(filePath))
 
@@ -39,11 +67,35 @@ func EmbedMetadata(filePath string, metadata Metadata, coverPath string) error {
 		return embedFlacMetadata(filePath, metadata, coverPath)
 	case ".mp3":
 		return embedMp3Metadata(filePath, metadata, coverPath)
+	case ".m4a":
+		return embedM4AMetadata(filePath, metadata, coverPath)
 	default:
 		return fmt.Errorf("unsupported file format: %s", ext)
 	}
 }
 
+// artistValues returns the artist tag values: each of Artists, or the joined Artist in legacy mode
+func (m Metadata) artistValues() []string {
+	if !m.JoinArtists {
+		var artists []string
+		for _, artist := range m.Artists {
+			if artist = strings.TrimSpace(artist); artist != "" {
+				artists = append(artists, artist)
+			}
+		}
+		if len(artists) > 0 {
+			return artists
+		}
+	}
+	if m.Artist == "" && len(m.Artists) > 0 {
+		return []string{strings.Join(m.Artists, ", ")}
+	}
+	if m.Artist == "" {
+		return nil
+	}
+	return []string{m.Artist}
+}
+
 func embedFlacMetadata(filePath string, metadata Metadata, coverPath string) error {
 	f, err := flac.ParseFile(filePath)
 	if err != nil {
@@ -63,8 +115,16 @@ func embedFlacMetadata(filePath string, metadata Metadata, coverPath string) err
 	if metadata.Title != "" {
 		_ = cmt.Add(flacvorbis.FIELD_TITLE, metadata.Title)
 	}
-	if metadata.Artist != "" {
-		_ = cmt.Add(flacvorbis.FIELD_ARTIST, metadata.Artist)
+	if artists := metadata.artistValues(); len(artists) > 1 {
+		// One ARTIST per artist, plus the ARTISTS field music servers use for artist credits
+		for _, artist := range artists {
+			_ = cmt.Add(flacvorbis.FIELD_ARTIST, artist)
+		}
+		for _, artist := range artists {
+			_ = cmt.Add("ARTISTS", artist)
+		}
+	} else if len(artists) == 1 {
+		_ = cmt.Add(flacvorbis.FIELD_ARTIST, artists[0])
 	}
 	if metadata.Album != "" {
 		_ = cmt.Add(flacvorbis.FIELD_ALBUM, metadata.Album)
@@ -84,9 +144,18 @@ func embedFlacMetadata(filePath string, metadata Metadata, coverPath string) err
 	if metadata.DiscNumber > 0 {
 		_ = cmt.Add("DISCNUMBER", strconv.Itoa(metadata.DiscNumber))
 	}
+	if metadata.TotalDiscs > 0 {
+		_ = cmt.Add(tagTotalDiscs, strconv.Itoa(metadata.TotalDiscs))
+	}
 	if metadata.ISRC != "" {
 		_ = cmt.Add(flacvorbis.FIELD_ISRC, metadata.ISRC)
 	}
+	for _, field := range metadata.extendedTextTags() {
+		_ = cmt.Add(field[0], field[1])
+	}
+	for _, genre := range metadata.Genres {
+		_ = cmt.Add(tagGenre, genre)
+	}
 	if metadata.Description != "" {
 		_ = cmt.Add("DESCRIPTION", metadata.Description)
 	}
@@ -126,8 +195,12 @@ func embedMp3Metadata(filePath string, metadata Metadata, coverPath string) erro
 	if metadata.Title != "" {
 		tag.SetTitle(metadata.Title)
 	}
-	if metadata.Artist != "" {
-		tag.SetArtist(metadata.Artist)
+	if artists := metadata.artistValues(); len(artists) > 1 {
+		// Multiple values in one text frame are null-separated, which only ID3v2.4 supports
+		tag.SetVersion(4)
+		tag.SetArtist(strings.Join(artists, "\x00"))
+	} else if len(artists) == 1 {
+		tag.SetArtist(artists[0])
 	}
 	if metadata.Album != "" {
 		tag.SetAlbum(metadata.Album)
@@ -148,7 +221,11 @@ func embedMp3Metadata(filePath string, metadata Metadata, coverPath string) erro
 		tag.AddTextFrame(tag.CommonID("Track number/Position in set"), tag.DefaultEncoding(), trackStr)
 	}
 	if metadata.DiscNumber > 0 {
-		tag.AddTextFrame(tag.CommonID("Part of a set"), tag.DefaultEncoding(), strconv.Itoa(metadata.DiscNumber))
+		discStr := strconv.Itoa(metadata.DiscNumber)
+		if metadata.TotalDiscs > 0 {
+			discStr = fmt.Sprintf("%d/%d", metadata.DiscNumber, metadata.TotalDiscs)
+		}
+		tag.AddTextFrame(tag.CommonID("Part of a set"), tag.DefaultEncoding(), discStr)
 	}
 
 	// Add ISRC (International Standard Recording Code)
@@ -156,13 +233,38 @@ func embedMp3Metadata(filePath string, metadata Metadata, coverPath string) erro
 		// TSRC is the ID3v2 frame for ISRC
 		tag.AddTextFrame("TSRC", tag.DefaultEncoding(), metadata.ISRC)
 	}
-	// Add Description
+
+	// Extended tags use their standard frames where ID3v2 has one, TXXX otherwise
+	if metadata.Label != "" {
+		tag.AddTextFrame("TPUB", tag.DefaultEncoding(), metadata.Label)
+	}
+	if metadata.Copyright != "" {
+		tag.AddTextFrame("TCOP", tag.DefaultEncoding(), metadata.Copyright)
+	}
+	if len(metadata.Genres) > 0 {
+		if len(metadata.Genres) > 1 {
+			tag.SetVersion(4)
+		}
+		tag.SetGenre(strings.Join(metadata.Genres, "\x00"))
+	}
+	if metadata.DurationMS > 0 {
+		tag.AddTextFrame("TLEN", tag.DefaultEncoding(), strconv.Itoa(metadata.DurationMS))
+	}
+	for _, field := range metadata.extendedTextTags() {
+		switch field[0] {
+		case tagLabel, tagCopyright:
+		case tagOriginalDate:
+			if tag.Version() == 4 {
+				tag.AddTextFrame("TDOR", tag.DefaultEncoding(), field[1])
+			} else {
+				setMp3UserText(tag, field[0], field[1])
+			}
+		default:
+			setMp3UserText(tag, field[0], field[1])
+		}
+	}
 	if metadata.Description != "" {
-		// TXXX is User Defined Text Information frame for custom fields
-		// Format: Description\0<value> where \0 is null terminator
-		// Using AddTextFrame with proper format for TXXX
-		descriptionText := "Description\x00" + metadata.Description
-		tag.AddTextFrame("TXXX", tag.DefaultEncoding(), descriptionText)
+		setMp3UserText(tag, "Description", metadata.Description)
 	}
 
 	// Add cover art if provided
@@ -187,6 +289,99 @@ func embedMp3Metadata(filePath string, metadata Metadata, coverPath string) erro
 	return nil
 }
 
+// extendedTextTags returns the non-empty text extended tags as name/value pairs
+func (m Metadata) extendedTextTags() [][2]string {
+	var fields [][2]string
+	for _, field := range [][2]string{
+		{tagSpotifyTrackID, m.SpotifyTrackID},
+		{tagSpotifyAlbumID, m.SpotifyAlbumID},
+		{tagReleaseType, m.ReleaseType},
+		{tagLabel, m.Label},
+		{tagCopyright, m.Copyright},
+		{tagOriginalDate, m.OriginalDate},
+	} {
+		if field[1] != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// mp3UserText returns the value of the TXXX frame with the given description
+func mp3UserText(tag *id3v2.Tag, description string) string {
+	for _, frame := range tag.GetFrames("TXXX") {
+		if udtf, ok := frame.(id3v2.UserDefinedTextFrame); ok && strings.EqualFold(udtf.Description, description) {
+			return udtf.Value
+		}
+	}
+	return ""
+}
+
+// setMp3UserText sets a TXXX frame, replacing an existing one with the same description.
+// An empty value removes the frame.
+func setMp3UserText(tag *id3v2.Tag, description, value string) {
+	frames := tag.GetFrames("TXXX")
+	tag.DeleteFrames("TXXX")
+	for _, frame := range frames {
+		if udtf, ok := frame.(id3v2.UserDefinedTextFrame); !ok || !strings.EqualFold(udtf.Description, description) {
+			tag.AddFrame("TXXX", frame)
+		}
+	}
+	if value == "" {
+		return
+	}
+	tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+		Encoding:    tag.DefaultEncoding(),
+		Description: description,
+		Value:       value,
+	})
+}
+
+func embedM4AMetadata(filePath string, metadata Metadata, coverPath string) error {
+	var artwork []byte
+	if coverPath != "" && fileExists(coverPath) {
+		var err error
+		if artwork, err = os.ReadFile(coverPath); err != nil {
+			fmt.Printf("Warning: Failed to embed cover art: %v\n", err)
+		}
+	}
+
+	err := updateMP4Tags(filePath, func(tags *mp4Tags) {
+		tags.setText(mp4KeyTitle, metadata.Title)
+		if artists := metadata.artistValues(); len(artists) > 1 {
+			// ©ART holds the display artist; the freeform ARTISTS item holds one value per artist
+			tags.setText(mp4KeyArtist, firstNonEmpty(metadata.Artist, strings.Join(artists, ", ")))
+			tags.setText(mp4KeyArtists, artists...)
+		} else if len(artists) == 1 {
+			tags.setText(mp4KeyArtist, artists[0])
+			tags.set(mp4KeyArtists)
+		}
+		tags.setText(mp4KeyAlbum, metadata.Album)
+		tags.setText(mp4KeyAlbumArtist, metadata.AlbumArtist)
+		tags.setText(mp4KeyDate, metadata.Date)
+		tags.setPair(mp4KeyTrack, metadata.TrackNumber, metadata.TotalTracks)
+		tags.setPair(mp4KeyDisc, metadata.DiscNumber, metadata.TotalDiscs)
+		tags.setText(mp4KeyISRC, metadata.ISRC)
+		for _, field := range metadata.extendedTextTags() {
+			if field[0] == tagCopyright {
+				tags.setText(mp4KeyCopyright, field[1])
+			} else {
+				tags.setText(mp4FreeformKey(field[0]), field[1])
+			}
+		}
+		tags.setText(mp4KeyGenre, metadata.Genres...)
+		tags.setText(mp4KeyDescription, metadata.Description)
+		tags.setText(mp4KeyLyrics, metadata.Lyrics)
+		if len(artwork) > 0 {
+			tags.setCover(artwork)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save M4A tags: %w", err)
+	}
+	return nil
+}
+
 func embedCoverArt(f *flac.File, coverPath string) error {
 	imgData, err := os.ReadFile(coverPath)
 	if err != nil {
@@ -293,6 +488,57 @@ func embedLyricsToFlac(filepath string, lyrics string) error {
 	return nil
 }
 
+// updateFlacComments replaces the named Vorbis comment fields, keeping all other comments.
+// Names in fields are upper case and match existing comments in any case; a field without values is removed.
+func updateFlacComments(filePath string, fields map[string][]string) error {
+	f, err := flac.ParseFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to parse FLAC file: %w", err)
+	}
+
+	cmtIdx := -1
+	cmt := flacvorbis.New()
+	for idx, block := range f.Meta {
+		if block.Type != flac.VorbisComment {
+			continue
+		}
+		cmtIdx = idx
+		if existing, err := flacvorbis.ParseFromMetaDataBlock(*block); err == nil {
+			cmt.Vendor = existing.Vendor
+			for _, comment := range existing.Comments {
+				name, _, _ := strings.Cut(comment, "=")
+				if _, replaced := fields[strings.ToUpper(name)]; !replaced {
+					cmt.Comments = append(cmt.Comments, comment)
+				}
+			}
+		}
+		break
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range fields[name] {
+			_ = cmt.Add(name, value)
+		}
+	}
+
+	cmtBlock := cmt.Marshal()
+	if cmtIdx < 0 {
+		f.Meta = append(f.Meta, &cmtBlock)
+	} else {
+		f.Meta[cmtIdx] = &cmtBlock
+	}
+
+	if err := f.Save(filePath); err != nil {
+		return fmt.Errorf("failed to save FLAC file: %w", err)
+	}
+	return nil
+}
+
 // embedLyricsToMp3 adds lyrics to an MP3 file using ID3v2 USLT frame while preserving existing metadata
 func embedLyricsToMp3(filepath string, lyrics string) error {
 	tag, err := id3v2.Open(filepath, id3v2.Options{Parse: true})
@@ -321,58 +567,18 @@ func embedLyricsToMp3(filepath string, lyrics string) error {
 	return nil
 }
 
-// embedLyricsToM4A adds lyrics to an M4A file using ffmpeg
+// embedLyricsToM4A adds lyrics to an M4A file's ©lyr item while preserving existing metadata
 func embedLyricsToM4A(filepath string, lyrics string) error {
-	// Use ffmpeg to embed lyrics into M4A file
-	// M4A uses iTunes metadata format with atom '©lyr' for lyrics
-	ffmpegPath, err := GetFFmpegPath()
-	if err != nil {
-		return fmt.Errorf("ffmpeg not found: %w", err)
-	}
-
-	// Create temporary output file with proper extension so ffmpeg can detect format
-	tmpOutputFile := strings.TrimSuffix(filepath, pathfilepath.Ext(filepath)) + ".tmp" + pathfilepath.Ext(filepath)
-	defer func() {
-		// Only remove if file still exists (rename might have failed)
-		if _, err := os.Stat(tmpOutputFile); err == nil {
-			os.Remove(tmpOutputFile)
-		}
-	}()
-
-	// Use ffmpeg to copy file and add lyrics metadata
-	// For M4A, we need to use the correct metadata tag format and specify output format
-	// Use -f ipod for M4A format (iPod format is compatible with M4A)
-	cmd := exec.Command(ffmpegPath,
-		"-i", filepath,
-		"-map", "0",
-		"-map_metadata", "0",
-		"-metadata", "lyrics-eng="+lyrics,
-		"-metadata", "lyrics="+lyrics,
-		"-codec", "copy",
-		"-f", "ipod", // Explicitly specify M4A/iPod format
-		"-y", // Overwrite
-		tmpOutputFile,
-	)
-
-	// Hide console window on Windows
-	setHideWindow(cmd)
-
-	output, err := cmd.CombinedOutput()
+	err := updateMP4Tags(filepath, func(tags *mp4Tags) {
+		tags.setText(mp4KeyLyrics, lyrics)
+	})
 	if err != nil {
-		fmt.Printf("[FFmpeg] Error embedding lyrics to M4A: %s\n", string(output))
-		return fmt.Errorf("ffmpeg failed to embed lyrics: %s - %w", string(output), err)
-	}
-
-	// Replace original file with new file
-	if err := os.Rename(tmpOutputFile, filepath); err != nil {
-		return fmt.Errorf("failed to replace original file: %w", err)
+		return fmt.Errorf("failed to save M4A tags: %w", err)
 	}
-
-	fmt.Printf("[FFmpeg] Lyrics embedded to M4A successfully: %d characters\n", len(lyrics))
 	return nil
 }
 
-// ReadISRCFromFile reads ISRC metadata from a FLAC or MP3 file
+// ReadISRCFromFile reads ISRC metadata from a FLAC, MP3 or M4A file
 func ReadISRCFromFile(filePath string) (string, error) {
 	if !fileExists(filePath) {
 		return "", fmt.Errorf("file does not exist")
@@ -385,6 +591,8 @@ func ReadISRCFromFile(filePath string) (string, error) {
 		return readISRCFromFlac(filePath)
 	case ".mp3":
 		return readISRCFromMp3(filePath)
+	case ".m4a":
+		return readISRCFromM4A(filePath)
 	default:
 		return "", fmt.Errorf("unsupported file format: %s", ext)
 	}
@@ -435,63 +643,38 @@ func readISRCFromMp3(filePath string) (string, error) {
 	return "", nil // No ISRC found
 }
 
-const isrcIndexCacheTTL = 15 * time.Minute
-
-type isrcIndexCache struct {
-	mu          sync.Mutex
-	index       map[string]string
-	outputDir   string
-	audioFormat string
-	lastScan    time.Time
-	dirty       bool
-}
-
-var globalISRCIndex = isrcIndexCache{}
-
-// getOrBuildISRCIndex returns a cached ISRC index for the given output directory and format.
-// It avoids rescanning the library for each playlist while still refreshing periodically.
-func getOrBuildISRCIndex(outputDir string, audioFormat string) map[string]string {
-	globalISRCIndex.mu.Lock()
-	defer globalISRCIndex.mu.Unlock()
-
-	cleanDir := pathfilepath.Clean(outputDir)
-	sameDir := strings.EqualFold(globalISRCIndex.outputDir, cleanDir)
-	sameFormat := globalISRCIndex.audioFormat == audioFormat
-	fresh := time.Since(globalISRCIndex.lastScan) < isrcIndexCacheTTL
-
-	if globalISRCIndex.index != nil && sameDir && sameFormat && fresh && !globalISRCIndex.dirty {
-		return globalISRCIndex.index
+// readISRCFromM4A reads ISRC from the freeform iTunes ISRC item of an M4A file
+func readISRCFromM4A(filePath string) (string, error) {
+	tags, err := readMP4Tags(filePath)
+	if err != nil {
+		return "", err
 	}
-
-	index := buildISRCIndex(cleanDir, audioFormat)
-	globalISRCIndex.index = index
-	globalISRCIndex.outputDir = cleanDir
-	globalISRCIndex.audioFormat = audioFormat
-	globalISRCIndex.lastScan = time.Now()
-	globalISRCIndex.dirty = false
-
-	return index
+	return tags.text(mp4KeyISRC), nil
 }
 
-// MarkISRCIndexDirty marks the in-memory ISRC index stale so it will be refreshed on next use.
-func MarkISRCIndexDirty(outputDir string, audioFormat string) {
-	globalISRCIndex.mu.Lock()
-	defer globalISRCIndex.mu.Unlock()
-
-	globalISRCIndex.outputDir = pathfilepath.Clean(outputDir)
-	globalISRCIndex.audioFormat = audioFormat
-	globalISRCIndex.dirty = true
+// TrackFileExists reports whether path is a non-empty file holding the track: its ISRC matches,
+// or either ISRC is unknown
+func TrackFileExists(path, isrc string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() || info.Size() == 0 {
+		return false
+	}
+	if isrc == "" {
+		return true
+	}
+	existing, err := ReadISRCFromFile(path)
+	return err != nil || existing == "" || strings.EqualFold(existing, isrc)
 }
 
-// CheckISRCExists checks if a file with the given ISRC already exists in the directory
+// CheckISRCExists checks if a file with the given ISRC already exists in the directory or the library
 func CheckISRCExists(outputDir string, targetISRC string, audioFormat string) (string, bool) {
 	if targetISRC == "" {
 		return "", false
 	}
 
-	index := getOrBuildISRCIndex(outputDir, audioFormat)
+	found := findISRCFiles(outputDir, []string{targetISRC}, audioFormat)
 
-	if filePath, exists := index[strings.ToUpper(targetISRC)]; exists {
+	if filePath, exists := found[strings.ToUpper(targetISRC)]; exists {
 		return filePath, true
 	}
 
@@ -580,9 +763,31 @@ func extractCoverFromM4AOrFlac(filePath string) (string, error) {
 		return "", fmt.Errorf("no cover art found")
 	}
 
-	// For M4A, try to extract using ffmpeg or return empty
-	// M4A cover art should be preserved by ffmpeg during conversion
-	return "", nil
+	tags, err := readMP4Tags(filePath)
+	if err != nil {
+		return "", err
+	}
+	covers := tags.values(mp4KeyCover)
+	if len(covers) == 0 {
+		return "", fmt.Errorf("no cover art found")
+	}
+
+	pattern := "cover-*.jpg"
+	if covers[0].kind == mp4TypePNG {
+		pattern = "cover-*.png"
+	}
+	tmpFile, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer tmpFile.Close()
+
+	if _, err := tmpFile.Write(covers[0].value); err != nil {
+		os.Remove(tmpFile.Name())
+		return "", fmt.Errorf("failed to write cover art: %w", err)
+	}
+
+	return tmpFile.Name(), nil
 }
 
 // ExtractLyrics extracts lyrics from an audio file
@@ -595,8 +800,7 @@ func ExtractLyrics(filePath string) (string, error) {
 	case ".flac":
 		return extractLyricsFromFlac(filePath)
 	case ".m4a":
-		// M4A lyrics extraction would need different approach
-		return "", nil
+		return extractLyricsFromM4A(filePath)
 	default:
 		return "", fmt.Errorf("unsupported file format: %s", ext)
 	}
@@ -631,6 +835,21 @@ func extractLyricsFromMp3(filePath string) (string, error) {
 	return uslt.Lyrics, nil
 }
 
+// extractLyricsFromM4A extracts lyrics from the ©lyr item of an M4A file
+func extractLyricsFromM4A(filePath string) (string, error) {
+	tags, err := readMP4Tags(filePath)
+	if err != nil {
+		return "", err
+	}
+	lyrics := tags.text(mp4KeyLyrics)
+	if lyrics == "" {
+		fmt.Printf("[ExtractLyrics] No lyrics found in M4A: %s\n", filePath)
+		return "", nil
+	}
+	fmt.Printf("[ExtractLyrics] Successfully extracted lyrics from M4A: %s (%d characters)\n", filePath, len(lyrics))
+	return lyrics, nil
+}
+
 // extractLyricsFromFlac extracts lyrics from FLAC file
 func extractLyricsFromFlac(filePath string) (string, error) {
 	f, err := flac.ParseFile(filePath)
@@ -676,10 +895,7 @@ func EmbedCoverArtOnly(filePath string, coverPath string) error {
 	case ".mp3":
 		return embedCoverToMp3(filePath, coverPath)
 	case ".m4a":
-		// M4A cover art should be handled by ffmpeg during conversion
-		// If not, we can try to embed using atomicparsley or similar tool
-		// For now, return nil as ffmpeg should handle it
-		return nil
+		return embedCoverToM4A(filePath, coverPath)
 	default:
 		return fmt.Errorf("unsupported file format: %s", ext)
 	}
@@ -719,6 +935,22 @@ func embedCoverToMp3(filePath string, coverPath string) error {
 	return nil
 }
 
+// embedCoverToM4A replaces the cover art of an M4A file
+func embedCoverToM4A(filePath string, coverPath string) error {
+	artwork, err := os.ReadFile(coverPath)
+	if err != nil {
+		return fmt.Errorf("failed to read cover art: %w", err)
+	}
+
+	err = updateMP4Tags(filePath, func(tags *mp4Tags) {
+		tags.setCover(artwork)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save M4A tags: %w", err)
+	}
+	return nil
+}
+
 // FileExistenceResult represents the result of checking if a file exists
 type FileExistenceResult struct {
 	ISRC       string `json:"isrc"`
@@ -728,52 +960,40 @@ type FileExistenceResult struct {
 	ArtistName string `json:"artist_name,omitempty"`
 }
 
-// CheckFilesExistParallel checks if multiple files exist in parallel
-// It builds an ISRC index from the output directory once, then checks all tracks against it
+// CheckFilesExistParallel checks if multiple files exist in the output directory or the library.
+// All ISRCs are looked up in one pass over the library database.
 func CheckFilesExistParallel(outputDir string, audioFormat string, tracks []struct {
 	ISRC       string
 	TrackName  string
 	ArtistName string
 }) []FileExistenceResult {
-	results := make([]FileExistenceResult, len(tracks))
-
-	// Build ISRC index from output directory (scan once)
-	isrcIndex := getOrBuildISRCIndex(outputDir, audioFormat)
-
-	// Check each track against the index (parallel)
-	var wg sync.WaitGroup
-	for i, track := range tracks {
-		wg.Add(1)
-		go func(idx int, t struct {
-			ISRC       string
-			TrackName  string
-			ArtistName string
-		}) {
-			defer wg.Done()
-
-			result := FileExistenceResult{
-				ISRC:       t.ISRC,
-				TrackName:  t.TrackName,
-				ArtistName: t.ArtistName,
-				Exists:     false,
-			}
+	isrcs := make([]string, 0, len(tracks))
+	for _, t := range tracks {
+		if t.ISRC != "" {
+			isrcs = append(isrcs, t.ISRC)
+		}
+	}
+	found := findISRCFiles(outputDir, isrcs, audioFormat)
 
-			if t.ISRC != "" {
-				if filePath, exists := isrcIndex[strings.ToUpper(t.ISRC)]; exists {
-					result.Exists = true
-					result.FilePath = filePath
-				}
+	results := make([]FileExistenceResult, len(tracks))
+	for i, t := range tracks {
+		results[i] = FileExistenceResult{
+			ISRC:       t.ISRC,
+			TrackName:  t.TrackName,
+			ArtistName: t.ArtistName,
+		}
+		if t.ISRC != "" {
+			if filePath, exists := found[strings.ToUpper(t.ISRC)]; exists {
+				results[i].Exists = true
+				results[i].FilePath = filePath
 			}
-
-			results[idx] = result
-		}(i, track)
+		}
 	}
-
-	wg.Wait()
 	return results
 }
 
-// buildISRCIndex scans a directory and builds a map of ISRC -> file path
+// buildISRCIndex scans a directory and builds a map of ISRC -> file path.
+// Only used when the library database is unavailable.
 func buildISRCIndex(outputDir string, audioFormat string) map[string]string {
 	index := make(map[string]string)
 
@@ -792,8 +1012,10 @@ func buildISRCIndex(outputDir string, audioFormat string) map[string]string {
 		extensions = []string{".flac"}
 	case "mp3":
 		extensions = []string{".mp3"}
+	case "m4a":
+		extensions = []string{".m4a"}
 	default:
-		extensions = []string{".mp3", ".flac"}
+		extensions = []string{".mp3", ".flac", ".m4a"}
 	}
 
 	// Walk directory recursively
@@ -0,0 +1,578 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// iTunes metadata item keys; "\xa9" is the © that starts the classic QuickTime names.
+// Freeform items are keyed "----:<mean>:<name>".
+const (
+	mp4KeyTitle       = "\xa9nam"
+	mp4KeyArtist      = "\xa9ART"
+	mp4KeyAlbum       = "\xa9alb"
+	mp4KeyAlbumArtist = "aART"
+	mp4KeyDate        = "\xa9day"
+	mp4KeyTrack       = "trkn"
+	mp4KeyDisc        = "disk"
+	mp4KeyCover       = "covr"
+	mp4KeyLyrics      = "\xa9lyr"
+	mp4KeyDescription = "desc"
+	mp4KeyGenre       = "\xa9gen"
+	mp4KeyCopyright   = "cprt"
+	mp4KeyISRC        = "----:com.apple.iTunes:ISRC"
+	mp4KeyArtists     = "----:com.apple.iTunes:ARTISTS"
+)
+
+// mp4FreeformKey returns the key of an iTunes freeform item
+func mp4FreeformKey(name string) string {
+	return "----:com.apple.iTunes:" + name
+}
+
+// Well-known types of a data atom's value
+const (
+	mp4TypeImplicit = 0 // Binary, e.g. trkn and disk
+	mp4TypeUTF8     = 1
+	mp4TypeJPEG     = 13
+	mp4TypePNG      = 14
+)
+
+// Boxes that hold other boxes on the way to the chunk offset tables and the ilst item list
+var mp4Containers = map[string]bool{
+	"moov": true, "trak": true, "mdia": true, "minf": true, "stbl": true, "udta": true, "meta": true,
+}
+
+// mp4Box is the position of a box in a file or buffer
+type mp4Box struct {
+	kind   string
+	offset int64 // Start of the header
+	header int64 // Header length: 8, or 16 with a 64-bit size
+	size   int64 // Length including the header
+}
+
+// mp4Node is a box held in memory. Containers are split into children so nested boxes can be changed.
+type mp4Node struct {
+	kind     string
+	data     []byte // Payload of a leaf box; for containers, the bytes before the first child (meta's version and flags)
+	children []*mp4Node
+}
+
+// mp4Data is one value of a metadata item
+type mp4Data struct {
+	kind  uint32 // One of the mp4Type constants
+	value []byte
+}
+
+// mp4Item is an ilst entry. Items that weren't changed are written back byte for byte from raw.
+type mp4Item struct {
+	key  string
+	data []mp4Data
+	raw  []byte
+}
+
+// mp4Tags are the iTunes-style metadata items of an MP4/M4A file, kept in file order
+type mp4Tags struct {
+	items []mp4Item
+}
+
+// readMP4Boxes lists the boxes from start to end of r
+func readMP4Boxes(r io.ReaderAt, start, end int64) ([]mp4Box, error) {
+	var boxes []mp4Box
+	for offset := start; offset+8 <= end; {
+		var hdr [16]byte
+		if _, err := r.ReadAt(hdr[:8], offset); err != nil {
+			return nil, err
+		}
+		box := mp4Box{
+			kind:   string(hdr[4:8]),
+			offset: offset,
+			header: 8,
+			size:   int64(binary.BigEndian.Uint32(hdr[:4])),
+		}
+		switch box.size {
+		case 0: // Extends to the end
+			box.size = end - offset
+		case 1: // 64-bit size follows the type
+			if _, err := r.ReadAt(hdr[8:16], offset+8); err != nil {
+				return nil, err
+			}
+			box.header = 16
+			box.size = int64(binary.BigEndian.Uint64(hdr[8:16]))
+		}
+		if box.size < box.header || box.size > end-offset {
+			return nil, fmt.Errorf("invalid %q box at offset %d", box.kind, offset)
+		}
+		boxes = append(boxes, box)
+		offset += box.size
+	}
+	return boxes, nil
+}
+
+// mp4BoxBytes returns a box with the given type and payload
+func mp4BoxBytes(kind string, payload []byte) []byte {
+	b := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(b, uint32(8+len(payload)))
+	copy(b[4:], kind)
+	return append(b, payload...)
+}
+
+// parseMP4Node splits a box payload into child boxes when kind is a container
+func parseMP4Node(kind string, payload []byte) (*mp4Node, error) {
+	node := &mp4Node{kind: kind}
+	if !mp4Containers[kind] {
+		node.data = payload
+		return node, nil
+	}
+
+	// ISO meta boxes start with a version and flags; QuickTime ones start with their first child
+	skip := 0
+	if kind == "meta" && len(payload) >= 4 && binary.BigEndian.Uint32(payload) == 0 {
+		skip = 4
+	}
+	node.data = payload[:skip]
+
+	boxes, err := readMP4Boxes(bytes.NewReader(payload), int64(skip), int64(len(payload)))
+	if err != nil {
+		return nil, err
+	}
+	for _, box := range boxes {
+		child, err := parseMP4Node(box.kind, payload[box.offset+box.header:box.offset+box.size])
+		if err != nil {
+			return nil, err
+		}
+		node.children = append(node.children, child)
+	}
+	return node, nil
+}
+
+func (n *mp4Node) marshal() []byte {
+	payload := append([]byte(nil), n.data...)
+	for _, child := range n.children {
+		payload = append(payload, child.marshal()...)
+	}
+	return mp4BoxBytes(n.kind, payload)
+}
+
+func (n *mp4Node) child(kind string) *mp4Node {
+	for _, child := range n.children {
+		if child.kind == kind {
+			return child
+		}
+	}
+	return nil
+}
+
+// ilst returns the moov.udta.meta.ilst box, creating the boxes that are missing when create is set
+func (n *mp4Node) ilst(create bool) *mp4Node {
+	node := n
+	for _, kind := range []string{"udta", "meta", "ilst"} {
+		next := node.child(kind)
+		if next == nil {
+			if !create {
+				return nil
+			}
+			next = &mp4Node{kind: kind}
+			if kind == "meta" {
+				// Version and flags, then the handler that marks the items as iTunes metadata
+				next.data = make([]byte, 4)
+				hdlr := make([]byte, 25)
+				copy(hdlr[8:], "mdirappl")
+				next.children = append(next.children, &mp4Node{kind: "hdlr", data: hdlr})
+			}
+			node.children = append(node.children, next)
+		}
+		node = next
+	}
+	return node
+}
+
+// shiftChunkOffsets moves the audio chunk offsets that point past after by delta
+func (n *mp4Node) shiftChunkOffsets(after, delta int64) error {
+	switch n.kind {
+	case "stco", "co64":
+		width := 4
+		if n.kind == "co64" {
+			width = 8
+		}
+		if len(n.data) < 8 {
+			return nil
+		}
+		count := int(binary.BigEndian.Uint32(n.data[4:8]))
+		for i := 0; i < count && 8+(i+1)*width <= len(n.data); i++ {
+			entry := n.data[8+i*width:]
+			if width == 4 {
+				offset := int64(binary.BigEndian.Uint32(entry))
+				if offset > after {
+					offset += delta
+					if offset < 0 || offset > math.MaxUint32 {
+						return fmt.Errorf("chunk offset out of range")
+					}
+					binary.BigEndian.PutUint32(entry, uint32(offset))
+				}
+			} else {
+				offset := int64(binary.BigEndian.Uint64(entry))
+				if offset > after {
+					binary.BigEndian.PutUint64(entry, uint64(offset+delta))
+				}
+			}
+		}
+	}
+	for _, child := range n.children {
+		if err := child.shiftChunkOffsets(after, delta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseMP4Items reads the items of an ilst payload
+func parseMP4Items(payload []byte) (*mp4Tags, error) {
+	boxes, err := readMP4Boxes(bytes.NewReader(payload), 0, int64(len(payload)))
+	if err != nil {
+		return nil, err
+	}
+
+	tags := &mp4Tags{}
+	for _, box := range boxes {
+		raw := payload[box.offset : box.offset+box.size]
+		item := mp4Item{key: box.kind, raw: raw}
+
+		children, err := readMP4Boxes(bytes.NewReader(raw), box.header, box.size)
+		if err != nil {
+			// Keep items we can't parse as they are
+			tags.items = append(tags.items, item)
+			continue
+		}
+		var mean, name string
+		for _, child := range children {
+			body := raw[child.offset+child.header : child.offset+child.size]
+			if len(body) < 4 {
+				continue
+			}
+			switch child.kind {
+			case "mean":
+				mean = string(body[4:])
+			case "name":
+				name = string(body[4:])
+			case "data":
+				if len(body) >= 8 {
+					// Type indicator (the low 24 bits), then a 4-byte locale
+					item.data = append(item.data, mp4Data{kind: binary.BigEndian.Uint32(body) & 0xFFFFFF, value: body[8:]})
+				}
+			}
+		}
+		if box.kind == "----" {
+			item.key = "----:" + mean + ":" + name
+		}
+		tags.items = append(tags.items, item)
+	}
+	return tags, nil
+}
+
+func (item mp4Item) marshal() []byte {
+	if item.raw != nil {
+		return item.raw
+	}
+
+	kind := item.key
+	var payload []byte
+	if strings.HasPrefix(item.key, "----:") {
+		parts := strings.SplitN(item.key, ":", 3)
+		kind = "----"
+		payload = append(payload, mp4BoxBytes("mean", append(make([]byte, 4), parts[1]...))...)
+		payload = append(payload, mp4BoxBytes("name", append(make([]byte, 4), parts[2]...))...)
+	}
+	for _, data := range item.data {
+		body := make([]byte, 8, 8+len(data.value))
+		binary.BigEndian.PutUint32(body, data.kind)
+		payload = append(payload, mp4BoxBytes("data", append(body, data.value...))...)
+	}
+	return mp4BoxBytes(kind, payload)
+}
+
+func (t *mp4Tags) marshal() []byte {
+	var b []byte
+	for _, item := range t.items {
+		b = append(b, item.marshal()...)
+	}
+	return b
+}
+
+// mp4KeysEqual compares item keys; freeform names are matched case-insensitively like other taggers do
+func mp4KeysEqual(a, b string) bool {
+	if strings.HasPrefix(a, "----:") {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+func (t *mp4Tags) values(key string) []mp4Data {
+	for _, item := range t.items {
+		if mp4KeysEqual(item.key, key) {
+			return item.data
+		}
+	}
+	return nil
+}
+
+// text returns the item's text values joined with ", "
+func (t *mp4Tags) text(key string) string {
+	var values []string
+	for _, data := range t.values(key) {
+		if data.kind == mp4TypeUTF8 {
+			values = append(values, string(data.value))
+		}
+	}
+	return strings.Join(values, ", ")
+}
+
+// pair returns the number and total of a trkn or disk item
+func (t *mp4Tags) pair(key string) (int, int) {
+	values := t.values(key)
+	if len(values) == 0 || len(values[0].value) < 6 {
+		return 0, 0
+	}
+	v := values[0].value
+	return int(binary.BigEndian.Uint16(v[2:4])), int(binary.BigEndian.Uint16(v[4:6]))
+}
+
+// set replaces the item's values, adding the item when it's new and removing it when data is empty
+func (t *mp4Tags) set(key string, data ...mp4Data) {
+	for i, item := range t.items {
+		if mp4KeysEqual(item.key, key) {
+			if len(data) == 0 {
+				t.items = append(t.items[:i], t.items[i+1:]...)
+			} else {
+				t.items[i] = mp4Item{key: item.key, data: data}
+			}
+			return
+		}
+	}
+	if len(data) > 0 {
+		t.items = append(t.items, mp4Item{key: key, data: data})
+	}
+}
+
+// setText sets the item to the non-empty values; the item is left alone when there are none
+func (t *mp4Tags) setText(key string, values ...string) {
+	var data []mp4Data
+	for _, value := range values {
+		if value != "" {
+			data = append(data, mp4Data{kind: mp4TypeUTF8, value: []byte(value)})
+		}
+	}
+	if len(data) > 0 {
+		t.set(key, data...)
+	}
+}
+
+// setPair sets a trkn or disk item; trkn has two extra padding bytes
+func (t *mp4Tags) setPair(key string, number, total int) {
+	if number <= 0 {
+		return
+	}
+	size := 6
+	if key == mp4KeyTrack {
+		size = 8
+	}
+	v := make([]byte, size)
+	binary.BigEndian.PutUint16(v[2:4], uint16(number))
+	binary.BigEndian.PutUint16(v[4:6], uint16(max(total, 0)))
+	t.set(key, mp4Data{kind: mp4TypeImplicit, value: v})
+}
+
+// setCover sets the cover image, detecting PNG and otherwise assuming JPEG
+func (t *mp4Tags) setCover(image []byte) {
+	kind := uint32(mp4TypeJPEG)
+	if bytes.HasPrefix(image, []byte("\x89PNG")) {
+		kind = mp4TypePNG
+	}
+	t.set(mp4KeyCover, mp4Data{kind: kind, value: image})
+}
+
+// readMP4Moov returns the file's top-level boxes, the index of moov among them and moov parsed
+func readMP4Moov(f *os.File) ([]mp4Box, int, *mp4Node, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	boxes, err := readMP4Boxes(f, 0, info.Size())
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to parse MP4 file: %v", err)
+	}
+	for i, box := range boxes {
+		if box.kind != "moov" {
+			continue
+		}
+		payload := make([]byte, box.size-box.header)
+		if _, err := f.ReadAt(payload, box.offset+box.header); err != nil {
+			return nil, 0, nil, err
+		}
+		moov, err := parseMP4Node("moov", payload)
+		if err != nil {
+			return nil, 0, nil, fmt.Errorf("failed to parse MP4 file: %v", err)
+		}
+		return boxes, i, moov, nil
+	}
+	return nil, 0, nil, fmt.Errorf("no moov box found")
+}
+
+// readMP4Tags reads the metadata items of an MP4/M4A file
+func readMP4Tags(filePath string) (*mp4Tags, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	_, _, moov, err := readMP4Moov(f)
+	if err != nil {
+		return nil, err
+	}
+	ilst := moov.ilst(false)
+	if ilst == nil {
+		return &mp4Tags{}, nil
+	}
+	return parseMP4Items(ilst.data)
+}
+
+// updateMP4Tags applies update to the metadata items of an MP4/M4A file and rewrites it.
+// When the moov box grows or shrinks in front of the audio data, the chunk offsets are moved to match.
+func updateMP4Tags(filePath string, update func(tags *mp4Tags)) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	boxes, moovIdx, moov, err := readMP4Moov(f)
+	if err != nil {
+		return err
+	}
+	ilst := moov.ilst(true)
+	tags, err := parseMP4Items(ilst.data)
+	if err != nil {
+		return fmt.Errorf("failed to parse MP4 tags: %v", err)
+	}
+	update(tags)
+	ilst.data = tags.marshal()
+
+	moovBox := boxes[moovIdx]
+	moovBytes := moov.marshal()
+	if delta := int64(len(moovBytes)) - moovBox.size; delta != 0 {
+		if err := moov.shiftChunkOffsets(moovBox.offset, delta); err != nil {
+			return err
+		}
+		moovBytes = moov.marshal()
+	}
+
+	tmpPath := filePath + ".tmp"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpPath)
+
+	for i, box := range boxes {
+		if i == moovIdx {
+			_, err = out.Write(moovBytes)
+		} else {
+			_, err = io.Copy(out, io.NewSectionReader(f, box.offset, box.size))
+		}
+		if err != nil {
+			out.Close()
+			return fmt.Errorf("failed to write MP4 file: %v", err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write MP4 file: %v", err)
+	}
+	f.Close()
+
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return fmt.Errorf("failed to replace original file: %v", err)
+	}
+	return nil
+}
+
+// mp4Duration returns the playing time from the movie header and the number of bytes of audio data
+func mp4Duration(filePath string) (int, int64, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	boxes, _, moov, err := readMP4Moov(f)
+	if err != nil {
+		return 0, 0, err
+	}
+	var audioBytes int64
+	for _, box := range boxes {
+		if box.kind == "mdat" {
+			audioBytes += box.size - box.header
+		}
+	}
+
+	mvhd := moov.child("mvhd")
+	if mvhd == nil || len(mvhd.data) < 20 {
+		return 0, 0, fmt.Errorf("no movie header found")
+	}
+	// Version 1 headers have 64-bit creation and modification times and duration
+	var timescale, duration uint64
+	if mvhd.data[0] == 1 {
+		if len(mvhd.data) < 32 {
+			return 0, 0, fmt.Errorf("invalid movie header")
+		}
+		timescale = uint64(binary.BigEndian.Uint32(mvhd.data[20:24]))
+		duration = binary.BigEndian.Uint64(mvhd.data[24:32])
+	} else {
+		timescale = uint64(binary.BigEndian.Uint32(mvhd.data[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(mvhd.data[16:20]))
+	}
+	if timescale == 0 {
+		return 0, 0, fmt.Errorf("movie header has no timescale")
+	}
+	return int(duration * 1000 / timescale), audioBytes, nil
+}
+
+// mp4Codec returns the sample entry type of the file's audio track, e.g. "mp4a" for AAC or "alac"
+func mp4Codec(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	_, _, moov, err := readMP4Moov(f)
+	if err != nil {
+		return "", err
+	}
+	for _, trak := range moov.children {
+		if trak.kind != "trak" {
+			continue
+		}
+		mdia := trak.child("mdia")
+		if mdia == nil {
+			continue
+		}
+		// The handler names the track type after the version, flags and pre-defined field
+		if hdlr := mdia.child("hdlr"); hdlr != nil && len(hdlr.data) >= 12 && string(hdlr.data[8:12]) != "soun" {
+			continue
+		}
+		minf := mdia.child("minf")
+		if minf == nil || minf.child("stbl") == nil {
+			continue
+		}
+		// stsd holds the version, flags and entry count, then the first sample entry's size and type
+		if stsd := minf.child("stbl").child("stsd"); stsd != nil && len(stsd.data) >= 16 {
+			return string(stsd.data[12:16]), nil
+		}
+	}
+	return "", fmt.Errorf("no audio track found")
+}
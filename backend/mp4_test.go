@@ -0,0 +1,135 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testMP4Audio = []byte("not really AAC, but the chunk offset must keep pointing at it")
+
+// buildTestMP4 returns a minimal M4A with one chunk of audio, with moov in front of mdat or after it
+func buildTestMP4(moovFirst bool) []byte {
+	ftyp := mp4BoxBytes("ftyp", []byte("M4A \x00\x00\x00\x00M4A isom"))
+
+	moov := func(chunkOffset uint32) []byte {
+		mvhd := make([]byte, 100)
+		binary.BigEndian.PutUint32(mvhd[12:16], 1000)  // Timescale
+		binary.BigEndian.PutUint32(mvhd[16:20], 42000) // Duration
+		stco := make([]byte, 12)
+		binary.BigEndian.PutUint32(stco[4:8], 1)
+		binary.BigEndian.PutUint32(stco[8:12], chunkOffset)
+
+		stbl := mp4BoxBytes("stbl", mp4BoxBytes("stco", stco))
+		trak := mp4BoxBytes("trak", mp4BoxBytes("mdia", mp4BoxBytes("minf", stbl)))
+		return mp4BoxBytes("moov", append(mp4BoxBytes("mvhd", mvhd), trak...))
+	}
+	mdat := mp4BoxBytes("mdat", testMP4Audio)
+
+	if moovFirst {
+		offset := len(ftyp) + len(moov(0)) + 8
+		return bytes.Join([][]byte{ftyp, moov(uint32(offset)), mdat}, nil)
+	}
+	offset := len(ftyp) + 8
+	return bytes.Join([][]byte{ftyp, mdat, moov(uint32(offset))}, nil)
+}
+
+// mp4ChunkAudio returns the bytes the file's first chunk offset points at
+func mp4ChunkAudio(t *testing.T, path string) []byte {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	_, _, moov, err := readMP4Moov(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := moov
+	for _, kind := range []string{"trak", "mdia", "minf", "stbl", "stco"} {
+		if node = node.child(kind); node == nil {
+			t.Fatalf("no %s box", kind)
+		}
+	}
+	offset := int64(binary.BigEndian.Uint32(node.data[8:12]))
+	audio := make([]byte, len(testMP4Audio))
+	if _, err := f.ReadAt(audio, offset); err != nil {
+		t.Fatalf("reading chunk at %d: %v", offset, err)
+	}
+	return audio
+}
+
+func TestMP4TagRoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		moovFirst bool
+	}{
+		{"moov before mdat", true},
+		{"moov after mdat", false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "track.m4a")
+			if err := os.WriteFile(path, buildTestMP4(tt.moovFirst), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := updateMP4Tags(path, func(tags *mp4Tags) {
+				tags.setText(mp4KeyTitle, "Title")
+				tags.setText(mp4KeyArtists, "One", "Two")
+				tags.setText(mp4KeyISRC, "USABC1234567")
+				tags.setPair(mp4KeyTrack, 3, 12)
+				tags.setPair(mp4KeyDisc, 1, 2)
+			})
+			if err != nil {
+				t.Fatalf("updateMP4Tags: %v", err)
+			}
+			if audio := mp4ChunkAudio(t, path); !bytes.Equal(audio, testMP4Audio) {
+				t.Fatalf("chunk offset points at %q after adding tags", audio)
+			}
+
+			tags, err := readMP4Tags(path)
+			if err != nil {
+				t.Fatalf("readMP4Tags: %v", err)
+			}
+			if got := tags.text(mp4KeyTitle); got != "Title" {
+				t.Errorf("title = %q", got)
+			}
+			if got := tags.text(mp4KeyArtists); got != "One, Two" {
+				t.Errorf("artists = %q", got)
+			}
+			if got := tags.text("----:com.apple.iTunes:isrc"); got != "USABC1234567" {
+				t.Errorf("ISRC = %q", got)
+			}
+			if n, total := tags.pair(mp4KeyTrack); n != 3 || total != 12 {
+				t.Errorf("track = %d/%d", n, total)
+			}
+			if n, total := tags.pair(mp4KeyDisc); n != 1 || total != 2 {
+				t.Errorf("disc = %d/%d", n, total)
+			}
+
+			// Shrinking moov again must move the offsets back
+			if err := updateMP4Tags(path, func(tags *mp4Tags) { tags.set(mp4KeyArtists) }); err != nil {
+				t.Fatalf("updateMP4Tags: %v", err)
+			}
+			if audio := mp4ChunkAudio(t, path); !bytes.Equal(audio, testMP4Audio) {
+				t.Fatalf("chunk offset points at %q after removing a tag", audio)
+			}
+			tags, err = readMP4Tags(path)
+			if err != nil {
+				t.Fatalf("readMP4Tags: %v", err)
+			}
+			if tags.text(mp4KeyArtists) != "" || tags.text(mp4KeyTitle) != "Title" {
+				t.Errorf("after removal: artists = %q, title = %q", tags.text(mp4KeyArtists), tags.text(mp4KeyTitle))
+			}
+
+			ms, audioBytes, err := mp4Duration(path)
+			if err != nil || ms != 42000 || audioBytes != int64(len(testMP4Audio)) {
+				t.Errorf("mp4Duration = %d, %d, %v; want 42000, %d", ms, audioBytes, err, len(testMP4Audio))
+			}
+		})
+	}
+}
@@ -0,0 +1,435 @@
+package backend
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultFilenameFormat is used when no filename format is configured
+const DefaultFilenameFormat = "title-artist"
+
+// PathTemplateData holds the track values a path template can refer to
+type PathTemplateData struct {
+	Title       string
+	Artist      string
+	Album       string
+	AlbumArtist string // {album_artist} falls back to the artist when empty
+	AlbumType   string // album, single or compilation
+	ReleaseDate string // YYYY-MM-DD or YYYY; {year} is the first four characters
+	ISRC        string
+	SpotifyID   string
+	Playlist    string
+	Track       int // Playlist position, or the album track number when numbering by album; 0 when unknown
+	Disc        int
+	Position    int // Position in the playlist or album being downloaded
+}
+
+// PathTemplate renders where a track's files go, relative to the output directory.
+//
+// Templates mix text with placeholders:
+//
+//	{title}                a field; {track} and {position} are padded to two digits
+//	{track:03}             zero-padded to three digits
+//	{title:.40}            truncated to 40 characters
+//	{artist:upper}         upper, lower or title case; modifiers combine, e.g. {album:lower:.20}
+//	{album_artist|artist}  the first field that isn't empty
+//	{disc?Disc {disc}/}    the text after "?" only when the field isn't empty
+//
+// Every folder and the file name are sanitized separately for the filesystem, so a "/" inside a value
+// never creates a folder.
+type PathTemplate struct {
+	Folder      string // e.g. "{artist}/{album}"; empty keeps files in the output directory
+	Filename    string // Template like "{track}. {title}", or a legacy format: title-artist, artist-title or title
+	TrackNumber bool   // Prefix legacy formats with the track number
+	Filesystem  string // Filesystem the names must be valid on, FilesystemWindows when empty
+}
+
+// TemplateFields are the field names templates can refer to
+var TemplateFields = []string{
+	"title", "artist", "album", "album_artist", "album_type", "year",
+	"track", "disc", "position", "isrc", "spotify_id", "playlist",
+}
+
+// Folder names use these when a field is empty, so files don't end up in an unnamed folder
+var folderFieldDefaults = map[string]string{
+	"title":        "Unknown Title",
+	"artist":       "Unknown Artist",
+	"album":        "Unknown Album",
+	"album_artist": "Unknown Artist",
+	"year":         "0000",
+	"track":        "00",
+	"disc":         "1",
+}
+
+// TrackPathData returns the template values of an album or playlist track
+func TrackPathData(track AlbumTrackMetadata, position int, playlist string) PathTemplateData {
+	return PathTemplateData{
+		Title:       track.Name,
+		Artist:      track.Artists,
+		Album:       track.AlbumName,
+		AlbumArtist: track.AlbumArtist,
+		AlbumType:   track.AlbumType,
+		ReleaseDate: track.ReleaseDate,
+		ISRC:        track.ISRC,
+		SpotifyID:   track.SpotifyID,
+		Playlist:    playlist,
+		Track:       position,
+		Disc:        track.DiscNumber,
+		Position:    position,
+	}
+}
+
+// Dir returns the folder the files go in: outputDir joined with the rendered folder template.
+// Long folder names are shortened so a file name still fits the filesystem's path length limit.
+func (t PathTemplate) Dir(outputDir string, data PathTemplateData) string {
+	folders := t.folders(data)
+	if len(folders) == 0 {
+		return outputDir
+	}
+	return filepath.Join(append([]string{outputDir}, fitFolders(outputDir, folders, t.Filesystem)...)...)
+}
+
+// FolderPath renders the folder template, empty when there is none
+func (t PathTemplate) FolderPath(data PathTemplateData) string {
+	return filepath.Join(t.folders(data)...)
+}
+
+// folders renders the folder template into sanitized folder names
+func (t PathTemplate) folders(data PathTemplateData) []string {
+	if strings.TrimSpace(t.Folder) == "" {
+		return nil
+	}
+
+	r := templateRenderer{values: data.templateValues(), defaults: folderFieldDefaults, folders: true}
+	var parts []string
+	for _, segment := range r.render(parseTemplate(t.Folder)) {
+		if segment = strings.TrimSpace(segment); segment != "" {
+			parts = append(parts, SanitizeName(segment, t.Filesystem))
+		}
+	}
+	return parts
+}
+
+// FileName renders the file name without extension
+func (t PathTemplate) FileName(data PathTemplateData) string {
+	format := t.Filename
+	if format == "" {
+		format = DefaultFilenameFormat
+	}
+
+	if !strings.Contains(format, "{") {
+		switch format {
+		case "artist-title":
+			format = "{artist} - {title}"
+		case "title":
+			format = "{title}"
+		default: // "title-artist"
+			format = "{title} - {artist}"
+		}
+		if t.TrackNumber {
+			format = "{track?{track}. }" + format
+		}
+	}
+
+	return SanitizeName(RenderTemplate(format, data), t.Filesystem)
+}
+
+// FilePath returns the full path of the file with extension ext (e.g. ".flac") in outputDir,
+// with the folders and file name shortened to fit the filesystem's name and path length limits
+func (t PathTemplate) FilePath(outputDir string, data PathTemplateData, ext string) (string, error) {
+	dir := t.Dir(outputDir, data)
+	name, err := FitFilename(dir, t.FileName(data), ext, t.Filesystem)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// RenderTemplate renders a file name template, leaving "/" as text. Separators left dangling
+// by empty fields are trimmed from the ends, so "{track}. {title}" without a track number is just the title.
+func RenderTemplate(template string, data PathTemplateData) string {
+	r := templateRenderer{values: data.templateValues()}
+	result := strings.Join(r.render(parseTemplate(template)), "")
+	result = strings.Join(strings.Fields(result), " ")
+	return strings.Trim(result, " -._")
+}
+
+func (d PathTemplateData) templateValues() map[string]string {
+	albumArtist := d.AlbumArtist
+	if strings.TrimSpace(albumArtist) == "" {
+		albumArtist = d.Artist
+	}
+	year := ""
+	if len(d.ReleaseDate) >= 4 {
+		year = d.ReleaseDate[:4]
+	}
+	values := map[string]string{
+		"title":        d.Title,
+		"artist":       d.Artist,
+		"album":        d.Album,
+		"album_artist": albumArtist,
+		"album_type":   d.AlbumType,
+		"year":         year,
+		"isrc":         d.ISRC,
+		"spotify_id":   d.SpotifyID,
+		"playlist":     d.Playlist,
+		"track":        templateNumber(d.Track),
+		"disc":         templateNumber(d.Disc),
+		"position":     templateNumber(d.Position),
+	}
+	for key, value := range values {
+		values[key] = strings.TrimSpace(value)
+	}
+	return values
+}
+
+func templateNumber(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// templateNode is literal text, or a placeholder when fields is set
+type templateNode struct {
+	text      string
+	fields    []string       // Fallback chain, first non-empty wins
+	modifiers []string       // Applied in order to the value
+	body      []templateNode // Rendered instead of the value for conditional sections
+	cond      bool
+}
+
+// parseTemplate parses a template. Braces that don't form a valid placeholder are kept as text,
+// so templates written for the old fixed placeholders render as before.
+func parseTemplate(template string) []templateNode {
+	nodes, _ := parseTemplateNodes(template, 0, false)
+	return nodes
+}
+
+func parseTemplateNodes(s string, pos int, nested bool) ([]templateNode, int) {
+	var nodes []templateNode
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			nodes = append(nodes, templateNode{text: text.String()})
+			text.Reset()
+		}
+	}
+
+	for pos < len(s) {
+		c := s[pos]
+		if nested && c == '}' {
+			break
+		}
+		if c == '{' {
+			if node, next, ok := parsePlaceholder(s, pos); ok {
+				flush()
+				nodes = append(nodes, node)
+				pos = next
+				continue
+			}
+		}
+		text.WriteByte(c)
+		pos++
+	}
+	flush()
+	return nodes, pos
+}
+
+// parsePlaceholder parses "{fields[:modifiers][?body]}" starting at the opening brace
+func parsePlaceholder(s string, pos int) (templateNode, int, bool) {
+	var node templateNode
+	pos++ // "{"
+
+	for {
+		name, next := scanTemplateWord(s, pos, isTemplateNameByte)
+		if !isTemplateField(name) {
+			return node, 0, false
+		}
+		node.fields = append(node.fields, name)
+		pos = next
+		if pos < len(s) && s[pos] == '|' {
+			pos++
+			continue
+		}
+		break
+	}
+
+	for pos < len(s) && s[pos] == ':' {
+		modifier, next := scanTemplateWord(s, pos+1, isTemplateModifierByte)
+		if !isTemplateModifier(modifier) {
+			return node, 0, false
+		}
+		node.modifiers = append(node.modifiers, modifier)
+		pos = next
+	}
+
+	if pos < len(s) && s[pos] == '?' {
+		node.cond = true
+		node.body, pos = parseTemplateNodes(s, pos+1, true)
+	}
+
+	if pos >= len(s) || s[pos] != '}' {
+		return node, 0, false
+	}
+	return node, pos + 1, true
+}
+
+func scanTemplateWord(s string, pos int, valid func(byte) bool) (string, int) {
+	start := pos
+	for pos < len(s) && valid(s[pos]) {
+		pos++
+	}
+	return s[start:pos], pos
+}
+
+func isTemplateNameByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c == '_'
+}
+
+func isTemplateModifierByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.'
+}
+
+func isTemplateField(name string) bool {
+	for _, field := range TemplateFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isTemplateModifier accepts a pad width ("03"), a truncation (".40") or a case transform
+func isTemplateModifier(modifier string) bool {
+	switch modifier {
+	case "upper", "lower", "title":
+		return true
+	}
+	digits := strings.TrimPrefix(modifier, ".")
+	if digits == "" {
+		return false
+	}
+	_, err := strconv.Atoi(digits)
+	return err == nil
+}
+
+type templateRenderer struct {
+	values   map[string]string
+	defaults map[string]string // Used when a plain placeholder renders empty
+	folders  bool              // Split the output at "/" in the template text
+}
+
+// render returns the rendered folder segments; a single segment unless folders is set
+func (r templateRenderer) render(nodes []templateNode) []string {
+	segments := []string{""}
+	r.renderInto(nodes, &segments)
+	return segments
+}
+
+func (r templateRenderer) renderInto(nodes []templateNode, segments *[]string) {
+	write := func(s string) {
+		(*segments)[len(*segments)-1] += s
+	}
+
+	for _, node := range nodes {
+		if node.fields == nil {
+			if !r.folders {
+				write(node.text)
+				continue
+			}
+			parts := strings.Split(node.text, "/")
+			write(parts[0])
+			for _, part := range parts[1:] {
+				*segments = append(*segments, part)
+			}
+			continue
+		}
+
+		field, value := r.lookup(node.fields)
+		if node.cond {
+			if value != "" {
+				r.renderInto(node.body, segments)
+			}
+			continue
+		}
+
+		if value == "" && r.defaults != nil {
+			value = r.defaults[field]
+		}
+		write(applyTemplateModifiers(field, value, node.modifiers))
+	}
+}
+
+// lookup returns the first field of the chain with a value, or the last field when all are empty
+func (r templateRenderer) lookup(fields []string) (string, string) {
+	for _, field := range fields {
+		if value := r.values[field]; value != "" {
+			return field, value
+		}
+	}
+	return fields[len(fields)-1], ""
+}
+
+func applyTemplateModifiers(field, value string, modifiers []string) string {
+	if value == "" {
+		return ""
+	}
+
+	padded := false
+	for _, modifier := range modifiers {
+		switch {
+		case modifier == "upper":
+			value = strings.ToUpper(value)
+		case modifier == "lower":
+			value = strings.ToLower(value)
+		case modifier == "title":
+			value = titleCase(value)
+		case strings.HasPrefix(modifier, "."):
+			n, _ := strconv.Atoi(modifier[1:])
+			value = truncateRunes(value, n)
+		default:
+			width, _ := strconv.Atoi(modifier)
+			value = zeroPad(value, width)
+			padded = true
+		}
+	}
+
+	if !padded && (field == "track" || field == "position") {
+		value = zeroPad(value, 2)
+	}
+	return value
+}
+
+// zeroPad pads numbers with leading zeros; other values are left alone
+func zeroPad(value string, width int) string {
+	if _, err := strconv.Atoi(value); err != nil || len(value) >= width {
+		return value
+	}
+	return strings.Repeat("0", width-len(value)) + value
+}
+
+// truncateRunes shortens value to at most n characters without splitting a character
+func truncateRunes(value string, n int) string {
+	if utf8.RuneCountInString(value) <= n {
+		return value
+	}
+	runes := []rune(value)
+	return strings.TrimSpace(string(runes[:n]))
+}
+
+// titleCase upper-cases the first letter of every word
+func titleCase(value string) string {
+	runes := []rune(strings.ToLower(value))
+	start := true
+	for i, r := range runes {
+		if start && unicode.IsLetter(r) {
+			runes[i] = unicode.ToUpper(r)
+		}
+		start = unicode.IsSpace(r) || r == '(' || r == '[' || r == '-' || r == '/'
+	}
+	return string(runes)
+}
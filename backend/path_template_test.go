@@ -0,0 +1,151 @@
+package backend
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var templateTestData = PathTemplateData{
+	Title:       "Song",
+	Artist:      "Artist",
+	Album:       "Album",
+	ReleaseDate: "2021-05-07",
+	Track:       3,
+	Disc:        2,
+	Position:    7,
+}
+
+func TestRenderTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		data     PathTemplateData
+		want     string
+	}{
+		{"fields", "{artist} - {title}", templateTestData, "Artist - Song"},
+		{"default padding", "{track}. {title}", templateTestData, "03. Song"},
+		{"explicit padding", "{track:03} {position:1}", templateTestData, "003 7"},
+		{"year", "{year} {album}", templateTestData, "2021 Album"},
+		{"truncation", "{title:.2}", PathTemplateData{Title: "Sömething"}, "Sö"},
+		{"case", "{artist:upper} {title:lower} {album:title}", PathTemplateData{Artist: "ab", Title: "CD", Album: "the (live) album"}, "AB cd The (Live) Album"},
+		{"combined modifiers", "{album:lower:.3}", PathTemplateData{Album: "ALBUM"}, "alb"},
+		{"fallback", "{album_artist}", PathTemplateData{Artist: "Artist"}, "Artist"},
+		{"fallback chain", "{playlist|album|title}", PathTemplateData{Title: "Song", Album: "Album"}, "Album"},
+		{"conditional", "{disc?Disc {disc} - }{title}", templateTestData, "Disc 2 - Song"},
+		{"empty conditional", "{disc?Disc {disc} - }{title}", PathTemplateData{Title: "Song"}, "Song"},
+		{"dangling separator", "{track}. {title}", PathTemplateData{Title: "Song"}, "Song"},
+		{"unknown placeholder", "{genre} {title}", templateTestData, "{genre} Song"},
+		{"unknown modifier", "{title:bold}", templateTestData, "{title:bold}"},
+		{"unclosed placeholder", "{title", templateTestData, "{title"},
+		{"unclosed conditional", "{disc?Disc {disc}", templateTestData, "{disc?Disc 2"},
+		{"slash kept as text", "{artist}/{title}", templateTestData, "Artist/Song"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RenderTemplate(tt.template, tt.data); got != tt.want {
+				t.Errorf("RenderTemplate(%q) = %q, want %q", tt.template, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTemplateNested(t *testing.T) {
+	nodes := parseTemplate("{disc?CD{disc:02}/}{title}")
+	if len(nodes) != 2 {
+		t.Fatalf("got %d nodes, want 2", len(nodes))
+	}
+
+	cond := nodes[0]
+	if !cond.cond || !reflect.DeepEqual(cond.fields, []string{"disc"}) {
+		t.Fatalf("first node = %+v, want a conditional on disc", cond)
+	}
+	want := []templateNode{
+		{text: "CD"},
+		{fields: []string{"disc"}, modifiers: []string{"02"}},
+		{text: "/"},
+	}
+	if !reflect.DeepEqual(cond.body, want) {
+		t.Errorf("conditional body = %+v, want %+v", cond.body, want)
+	}
+	if !reflect.DeepEqual(nodes[1].fields, []string{"title"}) {
+		t.Errorf("second node = %+v, want title", nodes[1])
+	}
+}
+
+func TestRenderFolders(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		data     PathTemplateData
+		want     []string
+	}{
+		{"segments", "{artist}/{album}", templateTestData, []string{"Artist", "Album"}},
+		{"nested disc folder", "{album}/{disc?Disc {disc}/}", templateTestData, []string{"Album", "Disc 2", ""}},
+		{"nested disc folder without disc", "{album}/{disc?Disc {disc}/}", PathTemplateData{Album: "Album"}, []string{"Album", ""}},
+		{"defaults", "{artist}/{year}", PathTemplateData{}, []string{"Unknown Artist", "0000"}},
+		{"slash in value", "{artist}", PathTemplateData{Artist: "AC/DC"}, []string{"AC/DC"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := templateRenderer{values: tt.data.templateValues(), defaults: folderFieldDefaults, folders: true}
+			if got := r.render(parseTemplate(tt.template)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("render(%q) = %q, want %q", tt.template, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPathTemplateFilePath(t *testing.T) {
+	tests := []struct {
+		name     string
+		template PathTemplate
+		data     PathTemplateData
+		want     string
+	}{
+		{
+			"nested disc folder",
+			PathTemplate{Folder: "{album_artist}/{album}/{disc?Disc {disc}/}", Filename: "{track}. {title}"},
+			templateTestData,
+			filepath.Join("out", "Artist", "Album", "Disc 2", "03. Song.flac"),
+		},
+		{
+			"no disc folder",
+			PathTemplate{Folder: "{album_artist}/{album}/{disc?Disc {disc}/}", Filename: "{track}. {title}"},
+			PathTemplateData{Artist: "Artist", Album: "Album", Title: "Song"},
+			filepath.Join("out", "Artist", "Album", "Song.flac"),
+		},
+		{
+			"slash in value is sanitized",
+			PathTemplate{Folder: "{artist}", Filename: "{title}"},
+			PathTemplateData{Artist: "AC/DC", Title: "T.N.T."},
+			filepath.Join("out", "AC DC", "T.N.T.flac"),
+		},
+		{
+			"legacy format with track number",
+			PathTemplate{Filename: "artist-title", TrackNumber: true},
+			templateTestData,
+			filepath.Join("out", "03. Artist - Song.flac"),
+		},
+		{
+			"default format",
+			PathTemplate{},
+			templateTestData,
+			filepath.Join("out", "Song - Artist.flac"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.template.FilePath("out", tt.data, ".flac")
+			if err != nil {
+				t.Fatalf("FilePath: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("FilePath = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package backend
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Playlist file formats understood by WritePlaylistFiles; also used as the file extension
+const (
+	PlaylistFormatM3U8 = "m3u8"
+	PlaylistFormatPLS  = "pls"
+	PlaylistFormatXSPF = "xspf"
+)
+
+// PlaylistFileTrack is one entry of a playlist file
+type PlaylistFileTrack struct {
+	Title      string `json:"title"`
+	Artist     string `json:"artist"`
+	Album      string `json:"album,omitempty"`
+	DurationMS int    `json:"duration_ms"`
+	Path       string `json:"path"`
+}
+
+// PlaylistFileTracks pairs tracks with their downloaded files, keeping the playlist order.
+// paths[i] belongs to tracks[i]; tracks without a file are left out.
+func PlaylistFileTracks(tracks []AlbumTrackMetadata, paths []string) []PlaylistFileTrack {
+	entries := make([]PlaylistFileTrack, 0, len(tracks))
+	for i, track := range tracks {
+		if i >= len(paths) || paths[i] == "" {
+			continue
+		}
+		entries = append(entries, PlaylistFileTrack{
+			Title:      track.Name,
+			Artist:     track.Artists,
+			Album:      track.AlbumName,
+			DurationMS: track.DurationMS,
+			Path:       paths[i],
+		})
+	}
+	return entries
+}
+
+// WritePlaylistFiles writes the playlist to dir in every requested format, replacing existing files.
+// Track paths are written relative to dir. Returns the paths of the written files.
+func WritePlaylistFiles(name, dir string, tracks []PlaylistFileTrack, formats []string) ([]string, error) {
+	if name == "" {
+		return nil, fmt.Errorf("playlist name is required")
+	}
+	if dir == "" {
+		return nil, fmt.Errorf("output directory is required")
+	}
+	if len(formats) == 0 {
+		formats = []string{PlaylistFormatM3U8}
+	}
+
+	dir = NormalizePath(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	written := make([]string, 0, len(formats))
+	for _, format := range formats {
+		format = strings.ToLower(strings.TrimSpace(format))
+
+		var content string
+		switch format {
+		case PlaylistFormatM3U8:
+			content = buildM3U8(dir, tracks)
+		case PlaylistFormatPLS:
+			content = buildPLS(dir, tracks)
+		case PlaylistFormatXSPF:
+			data, err := buildXSPF(name, dir, tracks)
+			if err != nil {
+				return written, err
+			}
+			content = data
+		default:
+			return written, fmt.Errorf("unknown playlist format: %s", format)
+		}
+
+		fileName, err := FitFilename(dir, name, "."+format, FilesystemWindows)
+		if err != nil {
+			return written, err
+		}
+		path := filepath.Join(dir, fileName)
+		tmpPath := path + ".tmp"
+		if err := os.WriteFile(tmpPath, []byte(content), 0644); err != nil {
+			return written, fmt.Errorf("failed to write playlist file: %v", err)
+		}
+		if err := os.Rename(tmpPath, path); err != nil {
+			os.Remove(tmpPath)
+			return written, fmt.Errorf("failed to write playlist file: %v", err)
+		}
+		written = append(written, path)
+	}
+
+	return written, nil
+}
+
+// playlistEntryPath returns the track's path relative to the playlist directory when possible
+func playlistEntryPath(dir, path string) string {
+	if rel, err := filepath.Rel(dir, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+// playlistEntryTitle is the "Artist - Title" display name used by M3U and PLS
+func playlistEntryTitle(track PlaylistFileTrack) string {
+	if track.Artist == "" {
+		return track.Title
+	}
+	return track.Artist + " - " + track.Title
+}
+
+// playlistEntrySeconds rounds the duration to whole seconds, -1 when unknown
+func playlistEntrySeconds(track PlaylistFileTrack) int {
+	if track.DurationMS <= 0 {
+		return -1
+	}
+	return (track.DurationMS + 500) / 1000
+}
+
+func buildM3U8(dir string, tracks []PlaylistFileTrack) string {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	for _, track := range tracks {
+		fmt.Fprintf(&b, "#EXTINF:%d,%s\n", playlistEntrySeconds(track), playlistEntryTitle(track))
+		b.WriteString(playlistEntryPath(dir, track.Path))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func buildPLS(dir string, tracks []PlaylistFileTrack) string {
+	var b strings.Builder
+	b.WriteString("[playlist]\n")
+	for i, track := range tracks {
+		n := i + 1
+		fmt.Fprintf(&b, "File%d=%s\n", n, playlistEntryPath(dir, track.Path))
+		fmt.Fprintf(&b, "Title%d=%s\n", n, playlistEntryTitle(track))
+		fmt.Fprintf(&b, "Length%d=%d\n", n, playlistEntrySeconds(track))
+	}
+	fmt.Fprintf(&b, "NumberOfEntries=%d\nVersion=2\n", len(tracks))
+	return b.String()
+}
+
+type xspfPlaylist struct {
+	XMLName   xml.Name    `xml:"playlist"`
+	Version   string      `xml:"version,attr"`
+	Namespace string      `xml:"xmlns,attr"`
+	Title     string      `xml:"title"`
+	Tracks    []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location string `xml:"location"`
+	Title    string `xml:"title,omitempty"`
+	Creator  string `xml:"creator,omitempty"`
+	Album    string `xml:"album,omitempty"`
+	Duration int    `xml:"duration,omitempty"` // Milliseconds
+}
+
+func buildXSPF(name, dir string, tracks []PlaylistFileTrack) (string, error) {
+	playlist := xspfPlaylist{
+		Version:   "1",
+		Namespace: "http://xspf.org/ns/0/",
+		Title:     name,
+		Tracks:    make([]xspfTrack, 0, len(tracks)),
+	}
+	for _, track := range tracks {
+		// XSPF locations are URIs, so relative paths use forward slashes and escaping
+		location := (&url.URL{Path: filepath.ToSlash(playlistEntryPath(dir, track.Path))}).String()
+		playlist.Tracks = append(playlist.Tracks, xspfTrack{
+			Location: location,
+			Title:    track.Title,
+			Creator:  track.Artist,
+			Album:    track.Album,
+			Duration: track.DurationMS,
+		})
+	}
+
+	data, err := xml.MarshalIndent(playlist, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to build XSPF playlist: %v", err)
+	}
+	return xml.Header + string(data) + "\n", nil
+}
@@ -0,0 +1,607 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Folder inside a subscription's output directory that receives tracks removed from the playlist
+const defaultSyncArchiveFolder = "Archive"
+
+// How often the scheduler looks for subscriptions that are due
+const syncCheckInterval = time.Minute
+
+// SyncSubscription is a Spotify playlist, album or artist mirrored to a local folder
+type SyncSubscription struct {
+	ID              string      `json:"id"`
+	URL             string      `json:"url"`
+	Name            string      `json:"name"`
+	OutputDir       string      `json:"output_dir"`
+	AudioFormat     string      `json:"audio_format"`
+	FilenameFormat  string      `json:"filename_format"`
+	TrackNumber     bool        `json:"track_number,omitempty"`
+	FolderTemplate  string      `json:"folder_template,omitempty"` // Sub-folders below OutputDir, e.g. {artist}/{album}
+	Filesystem      string      `json:"filesystem,omitempty"`      // windows, fat or posix; windows when empty
+	JoinArtists     bool        `json:"join_artists,omitempty"`    // Tag only the joined artist name
+	UserPlaylist    bool        `json:"user_playlist"`             // Fetch through the logged-in Spotify account (private playlists)
+	IntervalMinutes int         `json:"interval_minutes"`          // 0 = only sync on demand
+	ArchiveRemoved  bool        `json:"archive_removed"`           // Move tracks removed from the playlist to the archive folder
+	ArchiveDir      string      `json:"archive_dir,omitempty"`
+	PlaylistFormats []string    `json:"playlist_formats,omitempty"` // Playlist files (m3u8, pls, xspf) kept up to date in the output folder
+	KnownISRCs      []string    `json:"known_isrcs,omitempty"`      // Tracks seen on the last sync
+	Tracks          []SyncTrack `json:"tracks,omitempty"`           // Track order of the last sync, used for playlist files
+	LastSync        int64       `json:"last_sync"`                  // Unix timestamp
+	LastError       string      `json:"last_error,omitempty"`
+}
+
+// SyncTrack is a track of a subscription in playlist order
+type SyncTrack struct {
+	ISRC       string `json:"isrc"`
+	Title      string `json:"title"`
+	Artist     string `json:"artist"`
+	Album      string `json:"album,omitempty"`
+	DurationMS int    `json:"duration_ms"`
+}
+
+// SyncResult describes what a sync of one subscription did
+type SyncResult struct {
+	SubscriptionID string               `json:"subscription_id"`
+	Name           string               `json:"name"`
+	Total          int                  `json:"total"`
+	NewTracks      []AlbumTrackMetadata `json:"new_tracks"`
+	Restored       []string             `json:"restored,omitempty"` // Files moved back from the archive
+	Archived       []string             `json:"archived,omitempty"` // Files moved to the archive
+	PlaylistFiles  []string             `json:"playlist_files,omitempty"`
+	Error          string               `json:"error,omitempty"`
+}
+
+// SyncEnqueueFunc queues downloads for the new tracks of a subscription.
+// positions holds each track's 1-based position in the playlist.
+type SyncEnqueueFunc func(sub SyncSubscription, tracks []AlbumTrackMetadata, positions []int) error
+
+type playlistSyncManager struct {
+	mu      sync.Mutex
+	subs    []SyncSubscription
+	loaded  bool
+	enqueue SyncEnqueueFunc
+	running map[string]bool
+	stop    context.CancelFunc
+}
+
+var globalSyncManager = &playlistSyncManager{running: make(map[string]bool)}
+
+func syncSubscriptionsPath() (string, error) {
+	dir, err := getSpotiDownloaderDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "sync_subscriptions.json"), nil
+}
+
+// loadLocked reads the subscriptions from disk the first time they are needed
+func (m *playlistSyncManager) loadLocked() error {
+	if m.loaded {
+		return nil
+	}
+
+	path, err := syncSubscriptionsPath()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		m.loaded = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read sync subscriptions: %v", err)
+	}
+	if err := json.Unmarshal(data, &m.subs); err != nil {
+		return fmt.Errorf("failed to parse sync subscriptions: %v", err)
+	}
+	m.loaded = true
+	return nil
+}
+
+func (m *playlistSyncManager) saveLocked() error {
+	path, err := syncSubscriptionsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create .spotidownloader directory: %v", err)
+	}
+	data, err := json.MarshalIndent(m.subs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write sync subscriptions: %v", err)
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func (m *playlistSyncManager) indexLocked(id string) int {
+	for i := range m.subs {
+		if m.subs[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetSyncSubscriptions returns all subscriptions
+func GetSyncSubscriptions() ([]SyncSubscription, error) {
+	m := globalSyncManager
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.loadLocked(); err != nil {
+		return nil, err
+	}
+	subs := make([]SyncSubscription, len(m.subs))
+	copy(subs, m.subs)
+	return subs, nil
+}
+
+// AddSyncSubscription subscribes a Spotify URL to a local folder and returns the stored subscription
+func AddSyncSubscription(sub SyncSubscription) (SyncSubscription, error) {
+	if sub.UserPlaylist {
+		parsed, err := parseSpotifyURI(sub.URL)
+		if err != nil || parsed.Type != "playlist" {
+			return SyncSubscription{}, fmt.Errorf("user playlist subscriptions need a Spotify playlist URL")
+		}
+	} else if _, err := parseSpotifyURI(sub.URL); err != nil {
+		return SyncSubscription{}, err
+	}
+	if sub.OutputDir == "" {
+		return SyncSubscription{}, fmt.Errorf("output directory is required")
+	}
+	if sub.IntervalMinutes < 0 {
+		sub.IntervalMinutes = 0
+	}
+	if _, err := ResolveFilesystem(sub.Filesystem); err != nil {
+		return SyncSubscription{}, err
+	}
+	for i, format := range sub.PlaylistFormats {
+		format = strings.ToLower(strings.TrimSpace(format))
+		switch format {
+		case PlaylistFormatM3U8, PlaylistFormatPLS, PlaylistFormatXSPF:
+			sub.PlaylistFormats[i] = format
+		default:
+			return SyncSubscription{}, fmt.Errorf("unknown playlist format: %s", format)
+		}
+	}
+
+	sub.OutputDir = NormalizePath(sub.OutputDir)
+	sub.ID = fmt.Sprintf("sync-%d", time.Now().UnixNano())
+	sub.KnownISRCs = nil
+	sub.Tracks = nil
+	sub.LastSync = 0
+	sub.LastError = ""
+
+	m := globalSyncManager
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.loadLocked(); err != nil {
+		return SyncSubscription{}, err
+	}
+	m.subs = append(m.subs, sub)
+	if err := m.saveLocked(); err != nil {
+		m.subs = m.subs[:len(m.subs)-1]
+		return SyncSubscription{}, err
+	}
+	return sub, nil
+}
+
+// RemoveSyncSubscription unsubscribes. Files already downloaded are left alone.
+func RemoveSyncSubscription(id string) error {
+	m := globalSyncManager
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.loadLocked(); err != nil {
+		return err
+	}
+	i := m.indexLocked(id)
+	if i < 0 {
+		return fmt.Errorf("sync subscription %s not found", id)
+	}
+	m.subs = append(m.subs[:i], m.subs[i+1:]...)
+	return m.saveLocked()
+}
+
+// StartPlaylistSync registers the function that queues new tracks and starts the sync scheduler
+func StartPlaylistSync(enqueue SyncEnqueueFunc) {
+	m := globalSyncManager
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.enqueue = enqueue
+	if m.stop != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.stop = cancel
+	go m.schedule(ctx)
+}
+
+// StopPlaylistSync stops the sync scheduler
+func StopPlaylistSync() {
+	m := globalSyncManager
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stop != nil {
+		m.stop()
+		m.stop = nil
+	}
+}
+
+func (m *playlistSyncManager) schedule(ctx context.Context) {
+	ticker := time.NewTicker(syncCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		m.mu.Lock()
+		if err := m.loadLocked(); err != nil {
+			fmt.Printf("[Sync] %v\n", err)
+		}
+		var due []string
+		now := time.Now()
+		for _, sub := range m.subs {
+			interval := time.Duration(sub.IntervalMinutes) * time.Minute
+			if interval > 0 && now.Sub(time.Unix(sub.LastSync, 0)) >= interval {
+				due = append(due, sub.ID)
+			}
+		}
+		m.mu.Unlock()
+
+		for _, id := range due {
+			if result, err := SyncSubscriptionNow(ctx, id); err != nil {
+				fmt.Printf("[Sync] %s failed: %v\n", id, err)
+			} else {
+				fmt.Printf("[Sync] %s: %d new, %d archived\n", result.Name, len(result.NewTracks), len(result.Archived))
+			}
+		}
+	}
+}
+
+// SyncAllSubscriptions syncs every subscription once
+func SyncAllSubscriptions(ctx context.Context) ([]SyncResult, error) {
+	subs, err := GetSyncSubscriptions()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]SyncResult, 0, len(subs))
+	for _, sub := range subs {
+		result, err := SyncSubscriptionNow(ctx, sub.ID)
+		if err != nil {
+			result.SubscriptionID = sub.ID
+			result.Name = sub.Name
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// SyncSubscriptionNow fetches the subscription's tracks, queues the ones missing from its folder,
+// and archives the ones that were removed from the playlist when archiving is enabled
+func SyncSubscriptionNow(ctx context.Context, id string) (SyncResult, error) {
+	m := globalSyncManager
+	m.mu.Lock()
+	if err := m.loadLocked(); err != nil {
+		m.mu.Unlock()
+		return SyncResult{}, err
+	}
+	i := m.indexLocked(id)
+	if i < 0 {
+		m.mu.Unlock()
+		return SyncResult{}, fmt.Errorf("sync subscription %s not found", id)
+	}
+	if m.running[id] {
+		m.mu.Unlock()
+		return SyncResult{}, fmt.Errorf("sync subscription %s is already syncing", id)
+	}
+	m.running[id] = true
+	sub := m.subs[i]
+	enqueue := m.enqueue
+	m.mu.Unlock()
+
+	result, syncErr := syncSubscription(ctx, &sub, enqueue)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.running, id)
+
+	// The subscription may have been removed while syncing
+	if i := m.indexLocked(id); i >= 0 {
+		m.subs[i].LastSync = time.Now().Unix()
+		m.subs[i].LastError = ""
+		if syncErr != nil {
+			m.subs[i].LastError = syncErr.Error()
+		} else {
+			m.subs[i].Name = sub.Name
+			m.subs[i].KnownISRCs = sub.KnownISRCs
+			m.subs[i].Tracks = sub.Tracks
+		}
+		if err := m.saveLocked(); err != nil {
+			fmt.Printf("[Sync] Failed to save subscriptions: %v\n", err)
+		}
+	}
+
+	return result, syncErr
+}
+
+func syncSubscription(ctx context.Context, sub *SyncSubscription, enqueue SyncEnqueueFunc) (SyncResult, error) {
+	result := SyncResult{SubscriptionID: sub.ID, Name: sub.Name}
+
+	name, tracks, err := fetchSubscriptionTracks(ctx, *sub)
+	if err != nil {
+		return result, err
+	}
+	if sub.Name == "" {
+		sub.Name = name
+	}
+	result.Name = sub.Name
+	result.Total = len(tracks)
+
+	archiveDir := sub.ArchiveDir
+	if archiveDir == "" {
+		archiveDir = filepath.Join(sub.OutputDir, defaultSyncArchiveFolder)
+	}
+
+	// Both formats count as present so a track downgraded to MP3 isn't downloaded again on every sync
+	index := getOrBuildISRCIndex(sub.OutputDir, "")
+
+	// Tracks queued by an earlier sync that haven't finished downloading aren't in the index yet
+	pending := PendingQueueISRCs()
+
+	current := make(map[string]bool, len(tracks))
+	var newTracks []AlbumTrackMetadata
+	var positions []int
+	changed := false
+	for pos, track := range tracks {
+		isrc := strings.ToUpper(track.ISRC)
+		if isrc != "" {
+			current[isrc] = true
+		}
+
+		existing, exists := index[isrc]
+		if !exists && pending[isrc] {
+			continue
+		}
+		if isrc == "" || !exists {
+			newTracks = append(newTracks, track)
+			positions = append(positions, pos+1)
+			continue
+		}
+
+		// A track that was removed and added back again comes back out of the archive
+		if isInDir(existing, archiveDir) {
+			restored, err := moveKeepingLayout(existing, archiveDir, sub.OutputDir)
+			if err != nil {
+				fmt.Printf("[Sync] Failed to restore %s: %v\n", existing, err)
+				continue
+			}
+			result.Restored = append(result.Restored, restored)
+			changed = true
+		}
+	}
+
+	if sub.ArchiveRemoved {
+		for _, isrc := range sub.KnownISRCs {
+			if current[isrc] {
+				continue
+			}
+			existing, exists := index[isrc]
+			if !exists || isInDir(existing, archiveDir) {
+				continue
+			}
+			archived, err := moveKeepingLayout(existing, sub.OutputDir, archiveDir)
+			if err != nil {
+				fmt.Printf("[Sync] Failed to archive %s: %v\n", existing, err)
+				continue
+			}
+			result.Archived = append(result.Archived, archived)
+			changed = true
+		}
+	}
+	if changed {
+		MarkISRCIndexDirty(sub.OutputDir, "")
+	}
+
+	if len(newTracks) > 0 {
+		if enqueue == nil {
+			return result, fmt.Errorf("playlist sync has not been started")
+		}
+		if err := enqueue(*sub, newTracks, positions); err != nil {
+			return result, fmt.Errorf("failed to queue new tracks: %v", err)
+		}
+	}
+	result.NewTracks = newTracks
+
+	known := make([]string, 0, len(current))
+	order := make([]SyncTrack, 0, len(tracks))
+	for _, track := range tracks {
+		isrc := strings.ToUpper(track.ISRC)
+		if isrc != "" {
+			known = append(known, isrc)
+		}
+		order = append(order, SyncTrack{
+			ISRC:       isrc,
+			Title:      track.Name,
+			Artist:     track.Artists,
+			Album:      track.AlbumName,
+			DurationMS: track.DurationMS,
+		})
+	}
+	sub.KnownISRCs = known
+	sub.Tracks = order
+
+	// New tracks are still queued; WriteSyncPlaylistFiles adds them once they're downloaded
+	if len(sub.PlaylistFormats) > 0 {
+		files, err := writeSubscriptionPlaylist(*sub)
+		if err != nil {
+			fmt.Printf("[Sync] Failed to write playlist files for %s: %v\n", sub.Name, err)
+		}
+		result.PlaylistFiles = files
+	}
+
+	return result, nil
+}
+
+// WriteSyncPlaylistFiles regenerates a subscription's playlist files from the tracks found on its last sync
+func WriteSyncPlaylistFiles(id string) ([]string, error) {
+	m := globalSyncManager
+	m.mu.Lock()
+	if err := m.loadLocked(); err != nil {
+		m.mu.Unlock()
+		return nil, err
+	}
+	i := m.indexLocked(id)
+	if i < 0 {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("sync subscription %s not found", id)
+	}
+	sub := m.subs[i]
+	m.mu.Unlock()
+
+	if len(sub.PlaylistFormats) == 0 {
+		return nil, nil
+	}
+	return writeSubscriptionPlaylist(sub)
+}
+
+// writeSubscriptionPlaylist writes the playlist files for the subscription's tracks that are in its folder
+func writeSubscriptionPlaylist(sub SyncSubscription) ([]string, error) {
+	archiveDir := sub.ArchiveDir
+	if archiveDir == "" {
+		archiveDir = filepath.Join(sub.OutputDir, defaultSyncArchiveFolder)
+	}
+
+	index := getOrBuildISRCIndex(sub.OutputDir, "")
+	entries := make([]PlaylistFileTrack, 0, len(sub.Tracks))
+	for _, track := range sub.Tracks {
+		path, exists := index[track.ISRC]
+		if track.ISRC == "" || !exists || isInDir(path, archiveDir) {
+			continue
+		}
+		entries = append(entries, PlaylistFileTrack{
+			Title:      track.Title,
+			Artist:     track.Artist,
+			Album:      track.Album,
+			DurationMS: track.DurationMS,
+			Path:       path,
+		})
+	}
+
+	return WritePlaylistFiles(sub.Name, sub.OutputDir, entries, sub.PlaylistFormats)
+}
+
+// fetchSubscriptionTracks returns the name and tracks behind a subscription's URL
+var fetchSubscriptionTracks = func(ctx context.Context, sub SyncSubscription) (string, []AlbumTrackMetadata, error) {
+	if sub.UserPlaylist {
+		parsed, err := parseSpotifyURI(sub.URL)
+		if err != nil {
+			return "", nil, err
+		}
+		playlist, err := FetchUserPlaylistTracks(ctx, parsed.ID)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to fetch playlist: %v", err)
+		}
+		return playlist.Playlist.Name, playlist.Tracks, nil
+	}
+
+	data, err := GetFilteredSpotifyData(ctx, sub.URL, true, time.Second)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to fetch metadata: %v", err)
+	}
+	name, tracks, _, err := SpotifyDataTracks(data)
+	return name, tracks, err
+}
+
+// SpotifyDataTracks extracts the name and track list from a GetFilteredSpotifyData payload.
+// isAlbum is true for albums, artist discographies and single tracks.
+func SpotifyDataTracks(data interface{}) (name string, tracks []AlbumTrackMetadata, isAlbum bool, err error) {
+	switch payload := data.(type) {
+	case TrackResponse:
+		t := payload.Track
+		return t.Name, []AlbumTrackMetadata{{
+			SpotifyID:   t.SpotifyID,
+			Artists:     t.Artists,
+			Name:        t.Name,
+			AlbumName:   t.AlbumName,
+			AlbumArtist: t.AlbumArtist,
+			DurationMS:  t.DurationMS,
+			Images:      t.Images,
+			ReleaseDate: t.ReleaseDate,
+			TrackNumber: t.TrackNumber,
+			TotalTracks: t.TotalTracks,
+			DiscNumber:  t.DiscNumber,
+			ExternalURL: t.ExternalURL,
+			ISRC:        t.ISRC,
+			AlbumID:     t.AlbumID,
+			AlbumType:   t.AlbumType,
+			ArtistsData: t.ArtistsData,
+		}}, true, nil
+	case *AlbumResponsePayload:
+		return payload.AlbumInfo.Name, payload.TrackList, true, nil
+	case PlaylistResponsePayload:
+		return payload.PlaylistInfo.Owner.Name, payload.TrackList, false, nil
+	case *ArtistDiscographyPayload:
+		return payload.ArtistInfo.Name, payload.TrackList, true, nil
+	default:
+		return "", nil, false, fmt.Errorf("unsupported metadata payload %T", data)
+	}
+}
+
+// moveKeepingLayout moves path from below fromDir to the same relative path below toDir.
+// Folders are created as needed and an existing file at the destination is never overwritten.
+func moveKeepingLayout(path, fromDir, toDir string) (string, error) {
+	dest := layoutPath(path, fromDir, toDir)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", fmt.Errorf("failed to create folder: %v", err)
+	}
+	dest = UniquePath(dest)
+	if err := os.Rename(path, dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// layoutPath returns the path below toDir matching path's place below fromDir.
+// Files outside fromDir go straight into toDir.
+func layoutPath(path, fromDir, toDir string) string {
+	rel := filepath.Base(path)
+	if fromDir != "" && isInDir(path, fromDir) {
+		if r, err := filepath.Rel(fromDir, path); err == nil {
+			rel = r
+		}
+	}
+	return filepath.Join(toDir, rel)
+}
+
+// isInDir reports whether path is inside dir
+func isInDir(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
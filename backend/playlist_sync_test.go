@@ -0,0 +1,234 @@
+package backend
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+// useTestLibrary gives the test an empty library database under a temporary home folder
+func useTestLibrary(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	saved := globalLibrary
+	globalLibrary = &libraryDB{dirty: make(map[string]bool)}
+	t.Cleanup(func() {
+		if globalLibrary.db != nil {
+			globalLibrary.db.Close()
+		}
+		globalLibrary = saved
+	})
+}
+
+// writeTestMP3 writes an MP3 file that only carries an ISRC tag
+func writeTestMP3(t *testing.T, path, isrc string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tag.Close()
+	tag.AddTextFrame("TSRC", tag.DefaultEncoding(), isrc)
+	if err := tag.Save(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// useTestSyncTracks makes fetchSubscriptionTracks return tracks with the given ISRCs
+func useTestSyncTracks(t *testing.T, isrcs []string) {
+	saved := fetchSubscriptionTracks
+	fetchSubscriptionTracks = func(context.Context, SyncSubscription) (string, []AlbumTrackMetadata, error) {
+		tracks := make([]AlbumTrackMetadata, len(isrcs))
+		for i, isrc := range isrcs {
+			tracks[i] = AlbumTrackMetadata{ISRC: isrc, Name: "Track " + isrc}
+		}
+		return "Playlist", tracks, nil
+	}
+	t.Cleanup(func() { fetchSubscriptionTracks = saved })
+}
+
+func TestSyncSubscriptionDiff(t *testing.T) {
+	tests := []struct {
+		name          string
+		files         map[string]string // Path below the output folder -> ISRC
+		known         []string          // ISRCs seen on the previous sync
+		pending       []string          // ISRCs still in the download queue
+		archive       bool
+		playlist      []string
+		wantNew       []string
+		wantPositions []int
+		wantArchived  []string
+		wantRestored  []string
+	}{
+		{
+			name:          "first sync",
+			playlist:      []string{"AAA", "BBB"},
+			wantNew:       []string{"AAA", "BBB"},
+			wantPositions: []int{1, 2},
+		},
+		{
+			name:          "already downloaded",
+			files:         map[string]string{"Artist/a.mp3": "AAA"},
+			known:         []string{"AAA"},
+			playlist:      []string{"AAA", "BBB"},
+			wantNew:       []string{"BBB"},
+			wantPositions: []int{2},
+		},
+		{
+			name:     "ISRC case ignored",
+			files:    map[string]string{"a.mp3": "AAA"},
+			playlist: []string{"aaa"},
+		},
+		{
+			name:          "still queued from an earlier sync",
+			pending:       []string{"BBB"},
+			playlist:      []string{"AAA", "BBB"},
+			wantNew:       []string{"AAA"},
+			wantPositions: []int{1},
+		},
+		{
+			name:          "track without ISRC always queued",
+			files:         map[string]string{"a.mp3": "AAA"},
+			playlist:      []string{"AAA", ""},
+			wantNew:       []string{""},
+			wantPositions: []int{2},
+		},
+		{
+			name:         "removed track archived",
+			files:        map[string]string{"Artist/a.mp3": "AAA", "Artist/b.mp3": "BBB"},
+			known:        []string{"AAA", "BBB"},
+			archive:      true,
+			playlist:     []string{"AAA"},
+			wantArchived: []string{"Archive/Artist/b.mp3"},
+		},
+		{
+			name:     "removed track kept without archiving",
+			files:    map[string]string{"Artist/a.mp3": "AAA", "Artist/b.mp3": "BBB"},
+			known:    []string{"AAA", "BBB"},
+			playlist: []string{"AAA"},
+		},
+		{
+			name:     "track never seen isn't archived",
+			files:    map[string]string{"a.mp3": "AAA", "other.mp3": "CCC"},
+			known:    []string{"AAA"},
+			archive:  true,
+			playlist: []string{"AAA"},
+		},
+		{
+			name:         "added again restored from archive",
+			files:        map[string]string{"Artist/a.mp3": "AAA", "Archive/Artist/b.mp3": "BBB"},
+			known:        []string{"AAA"},
+			archive:      true,
+			playlist:     []string{"AAA", "BBB"},
+			wantRestored: []string{"Artist/b.mp3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestLibrary(t)
+			useTestDownloadQueue(t)
+			useTestSyncTracks(t, tt.playlist)
+
+			outputDir := t.TempDir()
+			for rel, isrc := range tt.files {
+				writeTestMP3(t, filepath.Join(outputDir, filepath.FromSlash(rel)), isrc)
+			}
+			for _, isrc := range tt.pending {
+				AddToQueue(isrc, "Track", "Artist", "Album", isrc)
+			}
+
+			var gotNew []string
+			var gotPositions []int
+			sub := &SyncSubscription{ID: "sub", OutputDir: outputDir, ArchiveRemoved: tt.archive, KnownISRCs: tt.known}
+			result, err := syncSubscription(context.Background(), sub, func(_ SyncSubscription, tracks []AlbumTrackMetadata, positions []int) error {
+				for _, track := range tracks {
+					gotNew = append(gotNew, track.ISRC)
+				}
+				gotPositions = positions
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(gotNew, tt.wantNew) || !reflect.DeepEqual(gotPositions, tt.wantPositions) {
+				t.Errorf("queued %q at %v, want %q at %v", gotNew, gotPositions, tt.wantNew, tt.wantPositions)
+			}
+			if got := relPaths(t, outputDir, result.Archived); !reflect.DeepEqual(got, tt.wantArchived) {
+				t.Errorf("archived %q, want %q", got, tt.wantArchived)
+			}
+			if got := relPaths(t, outputDir, result.Restored); !reflect.DeepEqual(got, tt.wantRestored) {
+				t.Errorf("restored %q, want %q", got, tt.wantRestored)
+			}
+			for _, rel := range append(tt.wantArchived, tt.wantRestored...) {
+				if _, err := os.Stat(filepath.Join(outputDir, filepath.FromSlash(rel))); err != nil {
+					t.Errorf("moved file missing: %v", err)
+				}
+			}
+
+			var wantKnown []string
+			for _, isrc := range tt.playlist {
+				if isrc != "" {
+					wantKnown = append(wantKnown, strings.ToUpper(isrc))
+				}
+			}
+			if !reflect.DeepEqual(sub.KnownISRCs, wantKnown) {
+				t.Errorf("known ISRCs = %q, want %q", sub.KnownISRCs, wantKnown)
+			}
+			if len(sub.Tracks) != len(tt.playlist) {
+				t.Errorf("stored %d tracks, want %d", len(sub.Tracks), len(tt.playlist))
+			}
+		})
+	}
+}
+
+// relPaths returns paths relative to dir with forward slashes
+func relPaths(t *testing.T, dir string, paths []string) []string {
+	t.Helper()
+	var rels []string
+	for _, path := range paths {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rels = append(rels, filepath.ToSlash(rel))
+	}
+	return rels
+}
+
+func TestLayoutPath(t *testing.T) {
+	from := filepath.FromSlash("/music")
+	to := filepath.FromSlash("/music/Archive")
+
+	tests := []struct {
+		name string
+		path string
+		from string
+		want string
+	}{
+		{"keeps sub-folders", "/music/Artist/Album/a.mp3", from, "/music/Archive/Artist/Album/a.mp3"},
+		{"top level", "/music/a.mp3", from, "/music/Archive/a.mp3"},
+		{"outside", "/elsewhere/Artist/a.mp3", from, "/music/Archive/a.mp3"},
+		{"sibling with common prefix", "/music2/Artist/a.mp3", from, "/music/Archive/a.mp3"},
+		{"no source folder", "/music/Artist/a.mp3", "", "/music/Archive/a.mp3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := layoutPath(filepath.FromSlash(tt.path), tt.from, to); got != filepath.FromSlash(tt.want) {
+				t.Errorf("layoutPath(%q, %q) = %q, want %q", tt.path, tt.from, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,8 +1,10 @@
 package backend
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
+	"strings"
 	"sync"
 	"time"
 )
@@ -16,6 +18,7 @@ const (
 	StatusCompleted   DownloadStatus = "completed"
 	StatusFailed      DownloadStatus = "failed"
 	StatusSkipped     DownloadStatus = "skipped"
+	StatusPaused      DownloadStatus = "paused"
 )
 
 // DownloadItem represents a single item in the download queue
@@ -33,17 +36,15 @@ type DownloadItem struct {
 	EndTime      int64          `json:"end_time"`      // Unix timestamp
 	ErrorMessage string         `json:"error_message"` // If failed
 	FilePath     string         `json:"file_path"`     // Final file path
+	Attempt      int            `json:"attempt"`       // Current attempt, 0 until the first retry
+	MaxAttempts  int            `json:"max_attempts"`  // Attempts allowed by the retry policy
+	FormatPolicy string         `json:"format_policy"` // Format policy the item was downloaded with
+	Format       string         `json:"format"`        // Format actually downloaded
+	Downgraded   bool           `json:"downgraded"`    // FLAC was preferred but only MP3 was available
 }
 
 // Global progress tracker
 var (
-	currentProgress     float64
-	currentProgressLock sync.RWMutex
-	isDownloading       bool
-	downloadingLock     sync.RWMutex
-	currentSpeed        float64
-	speedLock           sync.RWMutex
-
 	// Download queue tracking
 	downloadQueue       []DownloadItem
 	downloadQueueLock   sync.RWMutex
@@ -71,54 +72,23 @@ type DownloadQueueInfo struct {
 	CompletedCount   int            `json:"completed_count"`
 	FailedCount      int            `json:"failed_count"`
 	SkippedCount     int            `json:"skipped_count"`
+	PausedCount      int            `json:"paused_count"`
 }
 
-// GetDownloadProgress returns current download progress
+// GetDownloadProgress returns current download progress, summed over all items that are downloading
 func GetDownloadProgress() ProgressInfo {
-	downloadingLock.RLock()
-	downloading := isDownloading
-	downloadingLock.RUnlock()
-
-	currentProgressLock.RLock()
-	progress := currentProgress
-	currentProgressLock.RUnlock()
-
-	speedLock.RLock()
-	speed := currentSpeed
-	speedLock.RUnlock()
-
-	return ProgressInfo{
-		IsDownloading: downloading,
-		MBDownloaded:  progress,
-		SpeedMBps:     speed,
-	}
-}
-
-// SetDownloadSpeed updates the current download speed
-func SetDownloadSpeed(mbps float64) {
-	speedLock.Lock()
-	currentSpeed = mbps
-	speedLock.Unlock()
-}
-
-// SetDownloadProgress updates the current download progress
-func SetDownloadProgress(mbDownloaded float64) {
-	currentProgressLock.Lock()
-	currentProgress = mbDownloaded
-	currentProgressLock.Unlock()
-}
-
-// SetDownloading sets the downloading state
-func SetDownloading(downloading bool) {
-	downloadingLock.Lock()
-	isDownloading = downloading
-	downloadingLock.Unlock()
+	downloadQueueLock.RLock()
+	defer downloadQueueLock.RUnlock()
 
-	if !downloading {
-		// Reset progress when download completes
-		SetDownloadProgress(0)
-		SetDownloadSpeed(0)
+	var info ProgressInfo
+	for _, item := range downloadQueue {
+		if item.Status == StatusDownloading {
+			info.IsDownloading = true
+			info.MBDownloaded += item.Progress
+			info.SpeedMBps += item.Speed
+		}
 	}
+	return info
 }
 
 // ProgressWriter wraps an io.Writer and reports download progress
@@ -172,15 +142,11 @@ func (pw *ProgressWriter) Write(p []byte) (int, error) {
 		var speedMBps float64
 		if timeDiff > 0 {
 			speedMBps = (bytesDiff / (1024 * 1024)) / timeDiff
-			SetDownloadSpeed(speedMBps)
 			fmt.Printf("\rDownloaded: %.2f MB (%.2f MB/s)", mbDownloaded, speedMBps)
 		} else {
 			fmt.Printf("\rDownloaded: %.2f MB", mbDownloaded)
 		}
 
-		// Update global progress
-		SetDownloadProgress(mbDownloaded)
-
 		// Update individual item progress if we have an item ID
 		if pw.itemID != "" {
 			UpdateItemProgress(pw.itemID, mbDownloaded, speedMBps)
@@ -220,6 +186,7 @@ func AddToQueue(id, trackName, artistName, albumName, isrc string) {
 	}
 
 	downloadQueue = append(downloadQueue, item)
+	journalUpsert(len(downloadQueue) - 1)
 
 	// Initialize session start time if this is the first item
 	sessionStartLock.Lock()
@@ -227,6 +194,8 @@ func AddToQueue(id, trackName, artistName, albumName, isrc string) {
 		sessionStartTime = time.Now().Unix()
 	}
 	sessionStartLock.Unlock()
+
+	publishItemEvent(EventItemAdded, len(downloadQueue)-1)
 }
 
 // StartDownloadItem marks an item as currently downloading
@@ -239,6 +208,10 @@ func StartDownloadItem(id string) {
 			downloadQueue[i].Status = StatusDownloading
 			downloadQueue[i].StartTime = time.Now().Unix()
 			downloadQueue[i].Progress = 0
+			downloadQueue[i].Attempt = 0
+			downloadQueue[i].MaxAttempts = 0
+			journalUpsert(i)
+			publishItemEvent(EventItemStarted, i)
 			break
 		}
 	}
@@ -253,6 +226,40 @@ func UpdateItemProgress(id string, progress, speed float64) {
 		if downloadQueue[i].ID == id {
 			downloadQueue[i].Progress = progress
 			downloadQueue[i].Speed = speed
+			publishItemEvent(EventItemProgress, i)
+			break
+		}
+	}
+}
+
+// SetItemAttempt records that an item is being retried, e.g. attempt 2 of 5
+func SetItemAttempt(id string, attempt, maxAttempts int) {
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	for i := range downloadQueue {
+		if downloadQueue[i].ID == id {
+			downloadQueue[i].Attempt = attempt
+			downloadQueue[i].MaxAttempts = maxAttempts
+			downloadQueue[i].Speed = 0
+			publishItemEvent(EventItemUpdated, i)
+			break
+		}
+	}
+}
+
+// SetItemFormat records the format policy of an item and the format that was selected for it
+func SetItemFormat(id, policy, format string) {
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	for i := range downloadQueue {
+		if downloadQueue[i].ID == id {
+			downloadQueue[i].FormatPolicy = policy
+			downloadQueue[i].Format = format
+			downloadQueue[i].Downgraded = policy == FormatPolicyPreferFlac && format != "flac"
+			journalUpsert(i)
+			publishItemEvent(EventItemUpdated, i)
 			break
 		}
 	}
@@ -263,6 +270,11 @@ func CompleteDownloadItem(id, filePath string, finalSize float64) {
 	downloadQueueLock.Lock()
 	defer downloadQueueLock.Unlock()
 
+	// Update total downloaded
+	totalDownloadedLock.Lock()
+	totalDownloaded += finalSize
+	totalDownloadedLock.Unlock()
+
 	for i := range downloadQueue {
 		if downloadQueue[i].ID == id {
 			downloadQueue[i].Status = StatusCompleted
@@ -270,14 +282,11 @@ func CompleteDownloadItem(id, filePath string, finalSize float64) {
 			downloadQueue[i].FilePath = filePath
 			downloadQueue[i].Progress = finalSize
 			downloadQueue[i].Speed = 0
+			journalUpsert(i)
+			publishItemEvent(EventItemCompleted, i)
 			break
 		}
 	}
-
-	// Update total downloaded
-	totalDownloadedLock.Lock()
-	totalDownloaded += finalSize
-	totalDownloadedLock.Unlock()
 }
 
 // SkipDownloadItem marks an item as skipped (already exists)
@@ -291,6 +300,8 @@ func SkipDownloadItem(id, filePath string) {
 			downloadQueue[i].EndTime = time.Now().Unix()
 			downloadQueue[i].FilePath = filePath
 			downloadQueue[i].Speed = 0
+			journalUpsert(i)
+			publishItemEvent(EventItemSkipped, i)
 			break
 		}
 	}
@@ -307,21 +318,69 @@ func FailDownloadItem(id, errorMsg string) {
 			downloadQueue[i].EndTime = time.Now().Unix()
 			downloadQueue[i].ErrorMessage = errorMsg
 			downloadQueue[i].Speed = 0
+			journalUpsert(i)
+			publishItemEvent(EventItemFailed, i)
 			break
 		}
 	}
 }
 
-// GetDownloadQueue returns the complete download queue state
-func GetDownloadQueue() DownloadQueueInfo {
-	downloadingLock.RLock()
-	downloading := isDownloading
-	downloadingLock.RUnlock()
+// PauseDownloadItem marks a queued or downloading item as paused
+func PauseDownloadItem(id string) {
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	for i := range downloadQueue {
+		if downloadQueue[i].ID == id {
+			downloadQueue[i].Status = StatusPaused
+			downloadQueue[i].Speed = 0
+			journalUpsert(i)
+			publishItemEvent(EventItemPaused, i)
+			break
+		}
+	}
+}
+
+// RequeueDownloadItem puts a paused or finished item back in the queued state.
+// It reports false if no item has the given ID.
+func RequeueDownloadItem(id string) bool {
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	for i := range downloadQueue {
+		if downloadQueue[i].ID == id {
+			downloadQueue[i].Status = StatusQueued
+			downloadQueue[i].EndTime = 0
+			downloadQueue[i].ErrorMessage = ""
+			downloadQueue[i].Speed = 0
+			journalUpsert(i)
+			publishItemEvent(EventItemQueued, i)
+			return true
+		}
+	}
+	return false
+}
 
-	speedLock.RLock()
-	speed := currentSpeed
-	speedLock.RUnlock()
+// CancelDownloadItem marks a single item as skipped (cancelled)
+func CancelDownloadItem(id string) {
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
 
+	for i := range downloadQueue {
+		if downloadQueue[i].ID == id {
+			downloadQueue[i].Status = StatusSkipped
+			downloadQueue[i].EndTime = time.Now().Unix()
+			downloadQueue[i].ErrorMessage = "Cancelled"
+			downloadQueue[i].Speed = 0
+			journalUpsert(i)
+			publishItemEvent(EventItemSkipped, i)
+			break
+		}
+	}
+}
+
+// GetDownloadQueue returns the complete download queue state
+func GetDownloadQueue() DownloadQueueInfo {
 	totalDownloadedLock.RLock()
 	total := totalDownloaded
 	totalDownloadedLock.RUnlock()
@@ -334,9 +393,14 @@ func GetDownloadQueue() DownloadQueueInfo {
 	defer downloadQueueLock.RUnlock()
 
 	// Count items by status
-	var queued, completed, failed, skipped int
+	var queued, completed, failed, skipped, paused int
+	var downloading bool
+	var speed float64
 	for _, item := range downloadQueue {
 		switch item.Status {
+		case StatusDownloading:
+			downloading = true
+			speed += item.Speed
 		case StatusQueued:
 			queued++
 		case StatusCompleted:
@@ -345,6 +409,8 @@ func GetDownloadQueue() DownloadQueueInfo {
 			failed++
 		case StatusSkipped:
 			skipped++
+		case StatusPaused:
+			paused++
 		}
 	}
 
@@ -362,19 +428,42 @@ func GetDownloadQueue() DownloadQueueInfo {
 		CompletedCount:   completed,
 		FailedCount:      failed,
 		SkippedCount:     skipped,
+		PausedCount:      paused,
 	}
 }
 
+// PendingQueueISRCs returns the ISRCs (upper case) of items that are queued, downloading or paused
+func PendingQueueISRCs() map[string]bool {
+	downloadQueueLock.RLock()
+	defer downloadQueueLock.RUnlock()
+
+	pending := make(map[string]bool)
+	for _, item := range downloadQueue {
+		if item.ISRC == "" {
+			continue
+		}
+		switch item.Status {
+		case StatusQueued, StatusDownloading, StatusPaused:
+			pending[strings.ToUpper(item.ISRC)] = true
+		}
+	}
+	return pending
+}
+
 // ClearDownloadQueue clears all completed, failed, and skipped items from the queue
 func ClearDownloadQueue() {
 	downloadQueueLock.Lock()
 	defer downloadQueueLock.Unlock()
 
-	// Keep only queued and downloading items
+	// Keep only queued, downloading, and paused items
 	newQueue := make([]DownloadItem, 0)
 	for _, item := range downloadQueue {
-		if item.Status == StatusQueued || item.Status == StatusDownloading {
+		if item.Status == StatusQueued || item.Status == StatusDownloading || item.Status == StatusPaused {
 			newQueue = append(newQueue, item)
+		} else {
+			delete(queueRequests, item.ID)
+			journalAppend(journalEntry{Op: journalOpRemove, ID: item.ID})
+			publishDownloadEvent(EventItemRemoved, &item)
 		}
 	}
 	downloadQueue = newQueue
@@ -384,6 +473,8 @@ func ClearDownloadQueue() {
 func ClearAllDownloads() {
 	downloadQueueLock.Lock()
 	downloadQueue = []DownloadItem{}
+	queueRequests = make(map[string]json.RawMessage)
+	journalAppend(journalEntry{Op: journalOpClear})
 	downloadQueueLock.Unlock()
 
 	totalDownloadedLock.Lock()
@@ -394,9 +485,7 @@ func ClearAllDownloads() {
 	sessionStartTime = 0
 	sessionStartLock.Unlock()
 
-	// Reset current progress and speed
-	SetDownloadProgress(0)
-	SetDownloadSpeed(0)
+	publishDownloadEvent(EventQueueReset, nil)
 }
 
 // CancelAllQueuedItems marks all queued items as skipped (cancelled)
@@ -410,6 +499,8 @@ func CancelAllQueuedItems() {
 			downloadQueue[i].Status = StatusSkipped
 			downloadQueue[i].EndTime = time.Now().Unix()
 			downloadQueue[i].ErrorMessage = "Cancelled"
+			journalUpsert(i)
+			publishItemEvent(EventItemSkipped, i)
 		}
 	}
 }
@@ -420,7 +511,7 @@ func ResetSessionIfComplete() {
 	downloadQueueLock.RLock()
 	hasActiveOrQueued := false
 	for _, item := range downloadQueue {
-		if item.Status == StatusQueued || item.Status == StatusDownloading {
+		if item.Status == StatusQueued || item.Status == StatusDownloading || item.Status == StatusPaused {
 			hasActiveOrQueued = true
 			break
 		}
@@ -437,5 +528,7 @@ func ResetSessionIfComplete() {
 		totalDownloadedLock.Lock()
 		totalDownloaded = 0
 		totalDownloadedLock.Unlock()
+
+		publishDownloadEvent(EventQueueReset, nil)
 	}
 }
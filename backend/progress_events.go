@@ -0,0 +1,132 @@
+package backend
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DownloadEventType identifies what happened to the download queue
+type DownloadEventType string
+
+const (
+	EventItemAdded     DownloadEventType = "item-added"
+	EventItemStarted   DownloadEventType = "started"
+	EventItemProgress  DownloadEventType = "progress"
+	EventItemUpdated   DownloadEventType = "updated" // Retry attempt or format changed
+	EventItemCompleted DownloadEventType = "completed"
+	EventItemFailed    DownloadEventType = "failed"
+	EventItemSkipped   DownloadEventType = "skipped"
+	EventItemPaused    DownloadEventType = "paused"
+	EventItemQueued    DownloadEventType = "queued" // Put back in the queue after a pause
+	EventItemRemoved   DownloadEventType = "removed"
+	EventQueueReset    DownloadEventType = "reset" // The whole queue changed; reload it with GetDownloadQueue
+)
+
+// Events buffered per subscriber before new ones are dropped
+const downloadEventBuffer = 1024
+
+// DownloadEvent is a change to the download queue. Item is a snapshot of the item after the change.
+type DownloadEvent struct {
+	Type             DownloadEventType `json:"type"`
+	ItemID           string            `json:"item_id,omitempty"`
+	Item             *DownloadItem     `json:"item,omitempty"`
+	TotalDownloaded  float64           `json:"total_downloaded"`   // MB this session
+	SessionStartTime int64             `json:"session_start_time"` // Unix timestamp
+	Time             int64             `json:"time"`               // Unix milliseconds
+}
+
+type downloadSubscriber struct {
+	events  chan DownloadEvent
+	dropped bool
+}
+
+var (
+	downloadSubscribers     = make(map[int]*downloadSubscriber)
+	downloadSubscribersLock sync.Mutex
+	nextDownloadSubscriber  int
+)
+
+// SubscribeDownloadEvents returns a channel receiving every download queue event and a function that unsubscribes.
+// Events are never blocked on: a subscriber that falls behind loses events and should reload the queue.
+func SubscribeDownloadEvents() (<-chan DownloadEvent, func()) {
+	downloadSubscribersLock.Lock()
+	defer downloadSubscribersLock.Unlock()
+
+	id := nextDownloadSubscriber
+	nextDownloadSubscriber++
+	sub := &downloadSubscriber{events: make(chan DownloadEvent, downloadEventBuffer)}
+	downloadSubscribers[id] = sub
+
+	var once sync.Once
+	return sub.events, func() {
+		once.Do(func() {
+			downloadSubscribersLock.Lock()
+			delete(downloadSubscribers, id)
+			downloadSubscribersLock.Unlock()
+			close(sub.events)
+		})
+	}
+}
+
+// publishDownloadEvent sends an event to all subscribers.
+// Callers hold downloadQueueLock, which keeps events in the same order as the queue changes.
+func publishDownloadEvent(eventType DownloadEventType, item *DownloadItem) {
+	downloadSubscribersLock.Lock()
+	defer downloadSubscribersLock.Unlock()
+
+	if len(downloadSubscribers) == 0 {
+		return
+	}
+
+	event := DownloadEvent{
+		Type: eventType,
+		Time: time.Now().UnixMilli(),
+	}
+	if item != nil {
+		snapshot := *item
+		event.Item = &snapshot
+		event.ItemID = item.ID
+	}
+
+	totalDownloadedLock.RLock()
+	event.TotalDownloaded = totalDownloaded
+	totalDownloadedLock.RUnlock()
+
+	sessionStartLock.RLock()
+	event.SessionStartTime = sessionStartTime
+	sessionStartLock.RUnlock()
+
+	for _, sub := range downloadSubscribers {
+		// A subscriber that lost events gets a reset first so it reloads the whole queue
+		if sub.dropped && eventType != EventQueueReset {
+			reset := DownloadEvent{
+				Type:             EventQueueReset,
+				TotalDownloaded:  event.TotalDownloaded,
+				SessionStartTime: event.SessionStartTime,
+				Time:             event.Time,
+			}
+			select {
+			case sub.events <- reset:
+				sub.dropped = false
+			default:
+				continue
+			}
+		}
+
+		select {
+		case sub.events <- event:
+			sub.dropped = false
+		default:
+			if !sub.dropped {
+				fmt.Println("[Events] Download event subscriber is falling behind, dropping events")
+				sub.dropped = true
+			}
+		}
+	}
+}
+
+// publishItemEvent publishes an event for the queue item at index i. Callers must hold downloadQueueLock.
+func publishItemEvent(eventType DownloadEventType, i int) {
+	publishDownloadEvent(eventType, &downloadQueue[i])
+}
@@ -0,0 +1,114 @@
+package backend
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// drainEvents reads the events already buffered for a subscriber
+func drainEvents(events <-chan DownloadEvent) []DownloadEvent {
+	var got []DownloadEvent
+	for {
+		select {
+		case event := <-events:
+			got = append(got, event)
+		default:
+			return got
+		}
+	}
+}
+
+// eventSummary lists events as type or type:item ID
+func eventSummary(events []DownloadEvent) []string {
+	var summary []string
+	for _, event := range events {
+		if event.ItemID == "" {
+			summary = append(summary, string(event.Type))
+		} else {
+			summary = append(summary, string(event.Type)+":"+event.ItemID)
+		}
+	}
+	return summary
+}
+
+func publishTestEvents(prefix string, n int) {
+	for i := 0; i < n; i++ {
+		publishDownloadEvent(EventItemProgress, &DownloadItem{ID: fmt.Sprintf("%s%d", prefix, i)})
+	}
+}
+
+func TestDownloadEventSubscriberDropAndReset(t *testing.T) {
+	tests := []struct {
+		name  string
+		first int // Events published before the subscriber reads anything
+		then  int // Events published after it caught up
+		want  []string
+	}{
+		{"keeps up", 3, 1, []string{"progress:a0", "progress:a1", "progress:a2", "progress:b0"}},
+		{"falls behind", downloadEventBuffer + 5, 2, []string{"reset", "progress:b0", "progress:b1"}},
+		{"exactly full", downloadEventBuffer, 1, []string{"progress:b0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, unsubscribe := SubscribeDownloadEvents()
+			defer unsubscribe()
+
+			publishTestEvents("a", tt.first)
+			got := drainEvents(events)
+			if n := min(tt.first, downloadEventBuffer); len(got) != n {
+				t.Fatalf("received %d of the first events, want %d", len(got), n)
+			}
+			publishTestEvents("b", tt.then)
+			got = append(got, drainEvents(events)...)
+
+			// Only the tail matters once the first events have been checked
+			if summary := eventSummary(got); !reflect.DeepEqual(summary[len(summary)-len(tt.want):], tt.want) {
+				t.Errorf("events end with %q, want %q", summary[max(0, len(summary)-len(tt.want)):], tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloadEventSlowSubscriber(t *testing.T) {
+	slow, unsubscribeSlow := SubscribeDownloadEvents()
+	defer unsubscribeSlow()
+	fast, unsubscribeFast := SubscribeDownloadEvents()
+	defer unsubscribeFast()
+
+	for i := 0; i < downloadEventBuffer+10; i++ {
+		publishDownloadEvent(EventItemProgress, &DownloadItem{ID: fmt.Sprint(i)})
+		if got := drainEvents(fast); len(got) != 1 || got[0].Type != EventItemProgress {
+			t.Fatalf("fast subscriber got %q for event %d", eventSummary(got), i)
+		}
+	}
+	if got := len(drainEvents(slow)); got != downloadEventBuffer {
+		t.Errorf("slow subscriber got %d events, want %d", got, downloadEventBuffer)
+	}
+
+	// A reset published while the subscriber is behind isn't sent twice
+	publishDownloadEvent(EventQueueReset, nil)
+	if got := eventSummary(drainEvents(slow)); !reflect.DeepEqual(got, []string{"reset"}) {
+		t.Errorf("slow subscriber got %q, want one reset", got)
+	}
+}
+
+func TestDownloadEventSnapshot(t *testing.T) {
+	events, unsubscribe := SubscribeDownloadEvents()
+	item := &DownloadItem{ID: "a", Status: StatusDownloading}
+	publishDownloadEvent(EventItemStarted, item)
+	item.Status = StatusCompleted
+
+	event := <-events
+	if event.ItemID != "a" || event.Item.Status != StatusDownloading {
+		t.Errorf("event = %+v, want a snapshot of a while downloading", event)
+	}
+
+	unsubscribe()
+	unsubscribe()
+	if _, open := <-events; open {
+		t.Error("channel still open after unsubscribing")
+	}
+	publishDownloadEvent(EventItemCompleted, item)
+}
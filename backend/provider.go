@@ -0,0 +1,134 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// SpotiDownloaderProviderName is the name of the built-in provider backed by the SpotiDownloader API
+const SpotiDownloaderProviderName = "spotidownloader"
+
+// DefaultProviderOrder is used when no provider order is configured
+var DefaultProviderOrder = []string{SpotiDownloaderProviderName}
+
+// ProviderTrack describes the track a provider is asked to find
+type ProviderTrack struct {
+	SpotifyID string
+	ISRC      string
+	Title     string
+	Artist    string
+	Album     string
+}
+
+// Candidate is a downloadable source for a track offered by a provider
+type Candidate struct {
+	Provider string
+	URL      string
+	Format   string // "flac" or "mp3", also used as the file extension
+}
+
+// DownloadProvider is a source tracks can be downloaded from.
+// Resolve lists the available candidates for a track; Fetch writes a candidate's audio to w.
+type DownloadProvider interface {
+	Name() string
+	Resolve(ctx context.Context, track ProviderTrack) ([]Candidate, error)
+	Fetch(ctx context.Context, candidate Candidate, w io.Writer) error
+}
+
+// fileFetcher is implemented by providers that manage the output file themselves, e.g. to resume partial downloads
+type fileFetcher interface {
+	FetchToFile(ctx context.Context, candidate Candidate, outputPath string) error
+}
+
+var (
+	downloadProviders     = make(map[string]DownloadProvider)
+	downloadProvidersLock sync.RWMutex
+)
+
+// RegisterDownloadProvider makes a provider available to the provider order. A provider with the same name is replaced.
+// The built-in SpotiDownloader provider is always available and can't be replaced.
+func RegisterDownloadProvider(provider DownloadProvider) error {
+	name := provider.Name()
+	if name == "" {
+		return fmt.Errorf("download provider name is required")
+	}
+	if name == SpotiDownloaderProviderName {
+		return fmt.Errorf("download provider %s is built in", name)
+	}
+
+	downloadProvidersLock.Lock()
+	defer downloadProvidersLock.Unlock()
+	downloadProviders[name] = provider
+	return nil
+}
+
+// UnregisterDownloadProvider removes a registered provider
+func UnregisterDownloadProvider(name string) {
+	downloadProvidersLock.Lock()
+	defer downloadProvidersLock.Unlock()
+	delete(downloadProviders, name)
+}
+
+// DownloadProviderNames returns the names of all available providers, built-in provider first
+func DownloadProviderNames() []string {
+	downloadProvidersLock.RLock()
+	defer downloadProvidersLock.RUnlock()
+
+	names := make([]string, 0, len(downloadProviders))
+	for name := range downloadProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{SpotiDownloaderProviderName}, names...)
+}
+
+func getDownloadProvider(name string) (DownloadProvider, bool) {
+	downloadProvidersLock.RLock()
+	defer downloadProvidersLock.RUnlock()
+	provider, exists := downloadProviders[name]
+	return provider, exists
+}
+
+// selectCandidate picks the most preferred candidate allowed by the format policy
+func selectCandidate(candidates []Candidate, policy string) (Candidate, bool) {
+	for _, format := range formatsForPolicy(policy) {
+		for _, candidate := range candidates {
+			if candidate.Format == format && candidate.URL != "" {
+				return candidate, true
+			}
+		}
+	}
+	return Candidate{}, false
+}
+
+// fetchToPart downloads a candidate through provider.Fetch into a .part file, renaming it once complete
+func fetchToPart(ctx context.Context, provider DownloadProvider, candidate Candidate, outputPath, itemID string) error {
+	partPath := outputPath + partFileSuffix
+
+	out, err := os.Create(partPath)
+	if err != nil {
+		return err
+	}
+
+	progressWriter := NewProgressWriterWithID(out, itemID)
+	fetchErr := provider.Fetch(ctx, candidate, progressWriter)
+	closeErr := out.Close()
+	if fetchErr != nil {
+		os.Remove(partPath)
+		return fetchErr
+	}
+	if closeErr != nil {
+		os.Remove(partPath)
+		return closeErr
+	}
+	if progressWriter.GetTotal() == 0 {
+		os.Remove(partPath)
+		return errEmptyDownload
+	}
+
+	return os.Rename(partPath, outputPath)
+}
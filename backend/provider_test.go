@@ -0,0 +1,129 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fakeProvider serves data for every candidate, or fails with err
+type fakeProvider struct {
+	name string
+	data []byte
+	err  error
+}
+
+func (p *fakeProvider) Name() string { return p.name }
+
+func (p *fakeProvider) Resolve(ctx context.Context, track ProviderTrack) ([]Candidate, error) {
+	return []Candidate{{Provider: p.name, URL: "https://" + p.name + ".example/track", Format: "flac"}}, nil
+}
+
+func (p *fakeProvider) Fetch(ctx context.Context, candidate Candidate, w io.Writer) error {
+	if len(p.data) > 0 {
+		if _, err := w.Write(p.data); err != nil {
+			return err
+		}
+	}
+	return p.err
+}
+
+// registerTestProviders registers providers for the duration of the test
+func registerTestProviders(t *testing.T, providers ...DownloadProvider) {
+	t.Helper()
+	for _, provider := range providers {
+		if err := RegisterDownloadProvider(provider); err != nil {
+			t.Fatal(err)
+		}
+		name := provider.Name()
+		t.Cleanup(func() { UnregisterDownloadProvider(name) })
+	}
+}
+
+func TestRegisterDownloadProvider(t *testing.T) {
+	registerTestProviders(t, &fakeProvider{name: "zeta"}, &fakeProvider{name: "alpha"})
+
+	if got, want := DownloadProviderNames(), []string{SpotiDownloaderProviderName, "alpha", "zeta"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DownloadProviderNames() = %q, want %q", got, want)
+	}
+	if err := RegisterDownloadProvider(&fakeProvider{name: SpotiDownloaderProviderName}); err == nil {
+		t.Error("replaced the built-in provider")
+	}
+	if err := RegisterDownloadProvider(&fakeProvider{}); err == nil {
+		t.Error("registered a provider without a name")
+	}
+
+	UnregisterDownloadProvider("zeta")
+	if _, exists := getDownloadProvider("zeta"); exists {
+		t.Error("zeta still registered")
+	}
+}
+
+func TestDownloadProvidersOrder(t *testing.T) {
+	registerTestProviders(t, &fakeProvider{name: "alpha"}, &fakeProvider{name: "beta"})
+
+	tests := []struct {
+		name  string
+		order []string
+		want  []string
+	}{
+		{"default", nil, []string{SpotiDownloaderProviderName}},
+		{"configured", []string{"beta", SpotiDownloaderProviderName, "alpha"}, []string{"beta", SpotiDownloaderProviderName, "alpha"}},
+		{"unknown skipped", []string{"missing", "alpha"}, []string{"alpha"}},
+		{"duplicates and blanks skipped", []string{" alpha ", "", "alpha", "beta"}, []string{"alpha", "beta"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, provider := range NewSpotiDownloader("").WithProviderOrder(tt.order).downloadProviders() {
+				got = append(got, provider.Name())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("providers = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchToPart(t *testing.T) {
+	fetchErr := errors.New("connection reset")
+
+	tests := []struct {
+		name     string
+		provider *fakeProvider
+		wantErr  error
+	}{
+		{"complete", &fakeProvider{name: "fake", data: []byte("audio")}, nil},
+		{"fetch error", &fakeProvider{name: "fake", data: []byte("aud"), err: fetchErr}, fetchErr},
+		{"empty", &fakeProvider{name: "fake"}, errEmptyDownload},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputPath := filepath.Join(t.TempDir(), "track.flac")
+			err := fetchToPart(context.Background(), tt.provider, Candidate{Format: "flac"}, outputPath, "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("fetchToPart() = %v, want %v", err, tt.wantErr)
+			}
+			if _, statErr := os.Stat(outputPath + partFileSuffix); !os.IsNotExist(statErr) {
+				t.Errorf("part file left behind: %v", statErr)
+			}
+
+			data, readErr := os.ReadFile(outputPath)
+			if tt.wantErr != nil {
+				if !os.IsNotExist(readErr) {
+					t.Errorf("failed download created %s", outputPath)
+				}
+				return
+			}
+			if string(data) != string(tt.provider.data) {
+				t.Errorf("downloaded %q, want %q", data, tt.provider.data)
+			}
+		})
+	}
+}
@@ -0,0 +1,360 @@
+package backend
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Journal operations
+const (
+	journalOpUpsert  = "upsert"
+	journalOpRequest = "request"
+	journalOpRemove  = "remove"
+	journalOpClear   = "clear"
+)
+
+// Rewrite the journal once this many entries have been appended since the last compaction
+const journalCompactThreshold = 5000
+
+// Appended entries are fsynced in batches at most this long after they were written
+const journalSyncInterval = time.Second
+
+// journalEntry is a single line in the queue journal
+type journalEntry struct {
+	Op      string          `json:"op"`
+	ID      string          `json:"id,omitempty"`
+	Item    *DownloadItem   `json:"item,omitempty"`
+	Request json.RawMessage `json:"request,omitempty"`
+}
+
+// ResumableItem is a restored queue item together with the request that created it
+type ResumableItem struct {
+	Item    DownloadItem    `json:"item"`
+	Request json.RawMessage `json:"request,omitempty"`
+}
+
+// queueJournal appends queue mutations to a JSON-lines file under ~/.spotidownloader
+type queueJournal struct {
+	mu        sync.Mutex
+	file      *os.File
+	path      string
+	appended  int
+	syncTimer *time.Timer // Pending batched fsync, nil when everything written has been synced
+}
+
+var (
+	globalQueueJournal = queueJournal{}
+
+	// Request payloads attached to queue items, keyed by item ID (guarded by downloadQueueLock)
+	queueRequests = make(map[string]json.RawMessage)
+)
+
+func queueJournalPath() (string, error) {
+	dir, err := getSpotiDownloaderDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "download_queue.journal"), nil
+}
+
+// LoadDownloadQueue restores the download queue from the on-disk journal and enables journaling.
+// Items that were queued or downloading when the app stopped are restored as queued.
+func LoadDownloadQueue() error {
+	path, err := queueJournalPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create .spotidownloader directory: %v", err)
+	}
+
+	items, requests, err := replayQueueJournal(path)
+	if err != nil {
+		return err
+	}
+
+	for i := range items {
+		if items[i].Status == StatusDownloading {
+			items[i].Status = StatusQueued
+			items[i].Progress = 0
+			items[i].Speed = 0
+			items[i].StartTime = 0
+		}
+	}
+
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	downloadQueue = items
+	queueRequests = requests
+
+	globalQueueJournal.mu.Lock()
+	defer globalQueueJournal.mu.Unlock()
+
+	globalQueueJournal.path = path
+	if err := globalQueueJournal.compactLocked(); err != nil {
+		return err
+	}
+
+	if len(items) > 0 {
+		sessionStartLock.Lock()
+		if sessionStartTime == 0 {
+			sessionStartTime = time.Now().Unix()
+		}
+		sessionStartLock.Unlock()
+	}
+
+	publishDownloadEvent(EventQueueReset, nil)
+	return nil
+}
+
+// ResumeQueue returns every restored item that still needs to be downloaded (including paused ones), in queue order
+func ResumeQueue() []ResumableItem {
+	downloadQueueLock.RLock()
+	defer downloadQueueLock.RUnlock()
+
+	var pending []ResumableItem
+	for _, item := range downloadQueue {
+		if item.Status == StatusQueued || item.Status == StatusDownloading || item.Status == StatusPaused {
+			pending = append(pending, ResumableItem{
+				Item:    item,
+				Request: queueRequests[item.ID],
+			})
+		}
+	}
+	return pending
+}
+
+// AttachQueueRequest stores the request that created a queue item so it can be resumed after a restart
+func AttachQueueRequest(id string, request interface{}) error {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to encode queue request: %v", err)
+	}
+
+	downloadQueueLock.Lock()
+	defer downloadQueueLock.Unlock()
+
+	queueRequests[id] = data
+	journalAppend(journalEntry{Op: journalOpRequest, ID: id, Request: data})
+	return nil
+}
+
+// CloseDownloadQueue flushes and closes the queue journal
+func CloseDownloadQueue() error {
+	globalQueueJournal.mu.Lock()
+	defer globalQueueJournal.mu.Unlock()
+
+	if globalQueueJournal.file == nil {
+		return nil
+	}
+	if globalQueueJournal.syncTimer != nil {
+		globalQueueJournal.syncTimer.Stop()
+		globalQueueJournal.syncTimer = nil
+	}
+	if err := globalQueueJournal.file.Sync(); err != nil {
+		fmt.Printf("[QueueJournal] Failed to sync journal: %v\n", err)
+	}
+	err := globalQueueJournal.file.Close()
+	globalQueueJournal.file = nil
+	return err
+}
+
+// replayQueueJournal rebuilds the queue from the journal at path.
+// A torn final line from a crash mid-write is ignored.
+func replayQueueJournal(path string) ([]DownloadItem, map[string]json.RawMessage, error) {
+	requests := make(map[string]json.RawMessage)
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, requests, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open queue journal: %v", err)
+	}
+	defer f.Close()
+
+	var order []string
+	added := make(map[string]int) // Index in order of the latest time each item was added
+	items := make(map[string]DownloadItem)
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+
+		switch entry.Op {
+		case journalOpUpsert:
+			if entry.Item == nil {
+				continue
+			}
+			if _, exists := items[entry.Item.ID]; !exists {
+				added[entry.Item.ID] = len(order)
+				order = append(order, entry.Item.ID)
+			}
+			items[entry.Item.ID] = *entry.Item
+		case journalOpRequest:
+			requests[entry.ID] = entry.Request
+		case journalOpRemove:
+			delete(items, entry.ID)
+			delete(requests, entry.ID)
+		case journalOpClear:
+			order = nil
+			added = make(map[string]int)
+			items = make(map[string]DownloadItem)
+			requests = make(map[string]json.RawMessage)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read queue journal: %v", err)
+	}
+
+	queue := make([]DownloadItem, 0, len(items))
+	for i, id := range order {
+		// An ID appears twice in order if it was removed and then re-added; it belongs where it was re-added
+		if item, exists := items[id]; exists && added[id] == i {
+			queue = append(queue, item)
+		}
+	}
+
+	live := make(map[string]bool, len(queue))
+	for _, item := range queue {
+		live[item.ID] = true
+	}
+	for id := range requests {
+		if !live[id] {
+			delete(requests, id)
+		}
+	}
+
+	return queue, requests, nil
+}
+
+// compactLocked rewrites the journal as one upsert per live item and reopens it for appending.
+// The new journal is written to a temp file and renamed over the old one so a crash never loses it.
+// Callers must hold both downloadQueueLock and globalQueueJournal.mu.
+func (j *queueJournal) compactLocked() error {
+	if j.path == "" {
+		return nil
+	}
+
+	tmpPath := j.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create queue journal: %v", err)
+	}
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for i := range downloadQueue {
+		item := downloadQueue[i]
+		if err := enc.Encode(journalEntry{Op: journalOpUpsert, Item: &item}); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to write queue journal: %v", err)
+		}
+		if req, exists := queueRequests[item.ID]; exists {
+			if err := enc.Encode(journalEntry{Op: journalOpRequest, ID: item.ID, Request: req}); err != nil {
+				tmp.Close()
+				return fmt.Errorf("failed to write queue journal: %v", err)
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write queue journal: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync queue journal: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close queue journal: %v", err)
+	}
+
+	if j.syncTimer != nil {
+		j.syncTimer.Stop()
+		j.syncTimer = nil
+	}
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+	if err := os.Rename(tmpPath, j.path); err != nil {
+		return fmt.Errorf("failed to replace queue journal: %v", err)
+	}
+
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open queue journal: %v", err)
+	}
+	j.file = f
+	j.appended = 0
+	return nil
+}
+
+// journalAppend writes one entry to the journal. It is a no-op until LoadDownloadQueue has run.
+// The entry is fsynced later in a batch so progress updates don't wait on the disk under downloadQueueLock.
+// Callers must hold downloadQueueLock.
+func journalAppend(entry journalEntry) {
+	globalQueueJournal.mu.Lock()
+	defer globalQueueJournal.mu.Unlock()
+
+	if globalQueueJournal.file == nil {
+		return
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		fmt.Printf("[QueueJournal] Failed to encode entry: %v\n", err)
+		return
+	}
+	data = append(data, '\n')
+
+	if _, err := globalQueueJournal.file.Write(data); err != nil {
+		fmt.Printf("[QueueJournal] Failed to write entry: %v\n", err)
+		return
+	}
+	if globalQueueJournal.syncTimer == nil {
+		globalQueueJournal.syncTimer = time.AfterFunc(journalSyncInterval, globalQueueJournal.syncPending)
+	}
+
+	globalQueueJournal.appended++
+	if globalQueueJournal.appended >= journalCompactThreshold {
+		if err := globalQueueJournal.compactLocked(); err != nil {
+			fmt.Printf("[QueueJournal] Failed to compact journal: %v\n", err)
+		}
+	}
+}
+
+// syncPending fsyncs the entries appended since the last sync.
+// The sync itself runs without holding the journal lock so appends are never blocked by it.
+func (j *queueJournal) syncPending() {
+	j.mu.Lock()
+	j.syncTimer = nil
+	file := j.file
+	j.mu.Unlock()
+
+	if file == nil {
+		return
+	}
+	// The file may have been closed by a compaction or shutdown in the meantime; both sync it themselves
+	if err := file.Sync(); err != nil && !errors.Is(err, os.ErrClosed) {
+		fmt.Printf("[QueueJournal] Failed to sync journal: %v\n", err)
+	}
+}
+
+// journalUpsert records the current state of the queue item at index i.
+// Callers must hold downloadQueueLock.
+func journalUpsert(i int) {
+	item := downloadQueue[i]
+	journalAppend(journalEntry{Op: journalOpUpsert, Item: &item})
+}
@@ -0,0 +1,186 @@
+package backend
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// journalLine encodes an entry as it would be appended to the journal
+func journalLine(t *testing.T, entry journalEntry) string {
+	t.Helper()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func upsertLine(t *testing.T, id string, status DownloadStatus) string {
+	return journalLine(t, journalEntry{Op: journalOpUpsert, Item: &DownloadItem{ID: id, Status: status}})
+}
+
+func requestLine(t *testing.T, id string) string {
+	return journalLine(t, journalEntry{Op: journalOpRequest, ID: id, Request: json.RawMessage(`{"isrc":"` + id + `"}`)})
+}
+
+// writeJournal writes lines to a journal file and returns its path
+func writeJournal(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "download_queue.journal")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReplayQueueJournal(t *testing.T) {
+	tests := []struct {
+		name         string
+		lines        []string
+		wantItems    []string // ID:status in queue order
+		wantRequests []string
+	}{
+		{
+			"latest state wins",
+			[]string{upsertLine(t, "a", StatusQueued), upsertLine(t, "b", StatusQueued), upsertLine(t, "a", StatusCompleted)},
+			[]string{"a:completed", "b:queued"},
+			nil,
+		},
+		{
+			"requests attached",
+			[]string{upsertLine(t, "a", StatusQueued), requestLine(t, "a"), upsertLine(t, "b", StatusFailed)},
+			[]string{"a:queued", "b:failed"},
+			[]string{"a"},
+		},
+		{
+			"remove drops item and request",
+			[]string{upsertLine(t, "a", StatusQueued), requestLine(t, "a"), upsertLine(t, "b", StatusQueued), journalLine(t, journalEntry{Op: journalOpRemove, ID: "a"})},
+			[]string{"b:queued"},
+			nil,
+		},
+		{
+			"removed then added again moves to the end",
+			[]string{upsertLine(t, "a", StatusQueued), upsertLine(t, "b", StatusQueued), journalLine(t, journalEntry{Op: journalOpRemove, ID: "a"}), upsertLine(t, "a", StatusPaused)},
+			[]string{"b:queued", "a:paused"},
+			nil,
+		},
+		{
+			"clear",
+			[]string{upsertLine(t, "a", StatusQueued), requestLine(t, "a"), journalLine(t, journalEntry{Op: journalOpClear}), upsertLine(t, "b", StatusQueued)},
+			[]string{"b:queued"},
+			nil,
+		},
+		{
+			"request without item dropped",
+			[]string{requestLine(t, "a"), upsertLine(t, "b", StatusQueued)},
+			[]string{"b:queued"},
+			nil,
+		},
+		{
+			"torn final line ignored",
+			[]string{upsertLine(t, "a", StatusQueued), `{"op":"upsert","item":{"id":"b","sta`},
+			[]string{"a:queued"},
+			nil,
+		},
+		{
+			"upsert without item ignored",
+			[]string{`{"op":"upsert"}`, upsertLine(t, "a", StatusQueued)},
+			[]string{"a:queued"},
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, requests, err := replayQueueJournal(writeJournal(t, tt.lines...))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, item := range items {
+				got = append(got, item.ID+":"+string(item.Status))
+			}
+			if !reflect.DeepEqual(got, tt.wantItems) {
+				t.Errorf("items = %q, want %q", got, tt.wantItems)
+			}
+
+			var gotRequests []string
+			for id := range requests {
+				gotRequests = append(gotRequests, id)
+			}
+			if !reflect.DeepEqual(gotRequests, tt.wantRequests) {
+				t.Errorf("requests for %q, want %q", gotRequests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestReplayQueueJournalMissingFile(t *testing.T) {
+	items, requests, err := replayQueueJournal(filepath.Join(t.TempDir(), "missing.journal"))
+	if err != nil || len(items) != 0 || len(requests) != 0 {
+		t.Errorf("got %d items, %d requests, %v; want an empty queue", len(items), len(requests), err)
+	}
+}
+
+func TestCompactQueueJournal(t *testing.T) {
+	savedQueue, savedRequests := downloadQueue, queueRequests
+	t.Cleanup(func() { downloadQueue, queueRequests = savedQueue, savedRequests })
+
+	path := writeJournal(t,
+		upsertLine(t, "a", StatusQueued),
+		requestLine(t, "a"),
+		upsertLine(t, "a", StatusDownloading),
+		upsertLine(t, "b", StatusQueued),
+		journalLine(t, journalEntry{Op: journalOpRemove, ID: "b"}),
+		upsertLine(t, "c", StatusFailed),
+	)
+	items, requests, err := replayQueueJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	downloadQueueLock.Lock()
+	downloadQueue, queueRequests = items, requests
+	j := &queueJournal{path: path}
+	j.mu.Lock()
+	err = j.compactLocked()
+	j.mu.Unlock()
+	downloadQueueLock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.file.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One upsert per live item and the request of a
+	if n := strings.Count(string(data), "\n"); n != 3 {
+		t.Errorf("compacted journal has %d lines, want 3:\n%s", n, data)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temp file left behind: %v", err)
+	}
+
+	compacted, compactedRequests, err := replayQueueJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(compacted, items) || !reflect.DeepEqual(compactedRequests, requests) {
+		t.Errorf("compaction changed the queue: got %+v, want %+v", compacted, items)
+	}
+
+	// The journal is reopened for appending
+	if _, err := j.file.WriteString(upsertLine(t, "d", StatusQueued) + "\n"); err != nil {
+		t.Fatal(err)
+	}
+	if appended, _, _ := replayQueueJournal(path); len(appended) != 3 || appended[2].ID != "d" {
+		t.Errorf("append after compaction: got %+v", appended)
+	}
+}
@@ -0,0 +1,477 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	pathfilepath "path/filepath"
+	"slices"
+	"strings"
+)
+
+// How a file was matched to a Spotify track
+const (
+	RetagMatchTag    = "tag"    // SPOTIFY_TRACK_ID tag written by an earlier download
+	RetagMatchISRC   = "isrc"   // ISRC search
+	RetagMatchSearch = "search" // Title and artist search
+)
+
+// RetagRequest refreshes the tags of files from Spotify metadata.
+// A refresh never removes tags: fields Spotify has no value for keep their current values.
+type RetagRequest struct {
+	Folder          string   `json:"folder,omitempty"` // Scanned recursively for FLAC, MP3 and M4A files
+	Files           []string `json:"files,omitempty"`
+	Locked          []string `json:"locked,omitempty"` // Tags kept as they are, by alias such as "genre" or native name
+	Cover           bool     `json:"cover"`            // Also replace the embedded cover
+	MaxQualityCover bool     `json:"max_quality_cover"`
+	JoinArtists     bool     `json:"join_artists"`
+	DryRun          bool     `json:"dry_run"` // Only report the changes
+}
+
+// RetagResult lists the tag changes made, or that would be made in a dry run, to one file
+type RetagResult struct {
+	Path      string      `json:"path"`
+	SpotifyID string      `json:"spotify_id,omitempty"`
+	MatchedBy string      `json:"matched_by,omitempty"`
+	Changes   []TagChange `json:"changes"`
+	Cover     bool        `json:"cover"` // The cover was replaced
+	Error     string      `json:"error,omitempty"`
+}
+
+// retagJob holds what's shared between the files of one request
+type retagJob struct {
+	req        RetagRequest
+	client     *SpotifyMetadataClient
+	downloader *SpotiDownloader // Only used to fetch covers
+	albums     map[string]*albumRaw
+}
+
+// RetagFiles matches each file to a Spotify track and rewrites its tags, and optionally its cover,
+// the way a fresh download would
+func RetagFiles(ctx context.Context, req RetagRequest) ([]RetagResult, error) {
+	files := append([]string(nil), req.Files...)
+	if req.Folder != "" {
+		found, err := ListAudioFiles(req.Folder)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range found {
+			files = append(files, file.Path)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no audio files to tag")
+	}
+
+	job := &retagJob{
+		req:        req,
+		client:     NewSpotifyMetadataClient(),
+		downloader: NewSpotiDownloader(""),
+		albums:     make(map[string]*albumRaw),
+	}
+
+	results := make([]RetagResult, 0, len(files))
+	updated := 0
+	for _, path := range files {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		result := job.retag(ctx, path)
+		if result.Error == "" && (len(result.Changes) > 0 || result.Cover) {
+			updated++
+		}
+		results = append(results, result)
+	}
+
+	if !req.DryRun {
+		fmt.Printf("[Retag] Updated %d of %d files\n", updated, len(files))
+	}
+	return results, nil
+}
+
+func (j *retagJob) retag(ctx context.Context, path string) RetagResult {
+	result := RetagResult{Path: path, Changes: []TagChange{}}
+
+	track, matchedBy, err := j.match(ctx, path)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.SpotifyID = track.SpotifyID
+	result.MatchedBy = matchedBy
+
+	// A dry run tags a copy of the file's tags without the audio, so the report shows
+	// exactly what a real run would change without copying whole files
+	workPath := path
+	if j.req.DryRun {
+		workPath, err = copyTagsToTemp(path)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		defer os.Remove(workPath)
+	}
+
+	var coverPath string
+	if j.req.Cover && !j.req.DryRun && track.Images != "" {
+		coverPath, err = j.downloader.downloadCoverImage(track.Images, os.TempDir(), j.req.MaxQualityCover)
+		if err != nil {
+			fmt.Printf("Warning: Failed to download cover image: %v\n", err)
+			coverPath = ""
+		} else {
+			defer os.Remove(coverPath)
+		}
+	}
+
+	changes, err := j.rewrite(workPath, track, coverPath)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Changes = changes
+	result.Cover = coverPath != ""
+
+	if !j.req.DryRun {
+		if err := IndexLibraryFile(path, track.SpotifyID); err != nil {
+			fmt.Printf("[Library] Failed to index %s: %v\n", path, err)
+		}
+	}
+	return result
+}
+
+// rewrite embeds the track's metadata, then restores locked tags and tags the new metadata has no value for
+func (j *retagJob) rewrite(path string, track AlbumTrackMetadata, coverPath string) ([]TagChange, error) {
+	before, err := ReadAllTags(path)
+	if err != nil {
+		return nil, err
+	}
+
+	locked := make([]string, 0, len(j.req.Locked))
+	for _, name := range j.req.Locked {
+		key, err := nativeTagKey(before, name)
+		if err != nil {
+			return nil, err
+		}
+		locked = append(locked, key)
+		// Locking the artist also keeps the multi-value artist list written next to it
+		if strings.EqualFold(name, "artist") && artistListKey(before.Format) != "" {
+			locked = append(locked, artistListKey(before.Format))
+		}
+	}
+	isLocked := func(key string) bool {
+		return slices.ContainsFunc(locked, func(k string) bool { return tagKeysEqual(before.Format, k, key) })
+	}
+
+	extended := track.ExtendedTags()
+	metadata := Metadata{
+		Title:        track.Name,
+		Artist:       track.Artists,
+		Artists:      track.ArtistNames(),
+		JoinArtists:  j.req.JoinArtists,
+		Album:        track.AlbumName,
+		AlbumArtist:  track.AlbumArtist,
+		Date:         track.ReleaseDate,
+		TrackNumber:  track.TrackNumber,
+		TotalTracks:  track.TotalTracks,
+		DiscNumber:   track.DiscNumber,
+		ISRC:         track.ISRC,
+		Description:  "https://open.spotify.com/track/" + track.SpotifyID,
+		ExtendedTags: extended,
+	}
+	if err := EmbedMetadata(path, metadata, coverPath); err != nil {
+		return nil, err
+	}
+
+	after, err := ReadAllTags(path)
+	if err != nil {
+		return nil, err
+	}
+	var restore []TagEdit
+	listKey := artistListKey(before.Format)
+	for _, field := range before.Fields {
+		if field.ReadOnly {
+			continue
+		}
+		if isLocked(field.Key) {
+			restore = append(restore, TagEdit{Key: field.Key, Values: field.Values})
+		} else if len(tagValues(after, field.Key)) == 0 && !tagKeysEqual(before.Format, field.Key, listKey) {
+			restore = append(restore, TagEdit{Key: field.Key, Values: field.Values})
+		}
+	}
+	if listKey != "" && !isLocked(listKey) && len(metadata.artistValues()) < 2 {
+		// The artist list follows the artist tag, so an outdated list is removed
+		restore = append(restore, TagEdit{Key: listKey})
+	}
+	for _, key := range locked {
+		// Locked tags the file didn't have stay absent
+		if len(tagValues(before, key)) == 0 && len(tagValues(after, key)) > 0 {
+			restore = append(restore, TagEdit{Key: key})
+		}
+	}
+	if len(restore) > 0 {
+		if _, err := writeFileTags(path, restore, false); err != nil {
+			return nil, err
+		}
+		if after, err = ReadAllTags(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return diffFileTags(before, after), nil
+}
+
+// match finds the file's Spotify track by its Spotify ID tag, its ISRC, or its title and artist
+func (j *retagJob) match(ctx context.Context, path string) (AlbumTrackMetadata, string, error) {
+	metadata, err := ReadAudioMetadata(path)
+	if err != nil {
+		return AlbumTrackMetadata{}, "", err
+	}
+
+	if metadata.SpotifyTrackID != "" {
+		track, err := j.fetchTrack(ctx, metadata.SpotifyTrackID)
+		return track, RetagMatchTag, err
+	}
+
+	if isrc, _ := ReadISRCFromFile(path); isrc != "" {
+		results, err := j.client.SearchByType(ctx, "isrc:"+isrc, "track", 10, 0)
+		if err != nil {
+			return AlbumTrackMetadata{}, "", err
+		}
+		if len(results) > 0 {
+			// The same recording can be on several releases; prefer the file's album
+			best := results[0]
+			for _, r := range results {
+				if metadata.Album != "" && normalizeDuplicateText(r.AlbumName) == normalizeDuplicateText(metadata.Album) {
+					best = r
+					break
+				}
+			}
+			track, err := j.fetchTrack(ctx, best.ID)
+			return track, RetagMatchISRC, err
+		}
+	}
+
+	firstArtist := strings.TrimSpace(strings.Split(metadata.Artist, ",")[0])
+	title := normalizeDuplicateText(metadata.Title)
+	artist := normalizeDuplicateText(firstArtist)
+	if title == "" || artist == "" {
+		return AlbumTrackMetadata{}, "", fmt.Errorf("no ISRC, title or artist to match")
+	}
+	unquote := strings.NewReplacer(`"`, "")
+	query := fmt.Sprintf(`track:"%s" artist:"%s"`, unquote.Replace(metadata.Title), unquote.Replace(firstArtist))
+	results, err := j.client.SearchByType(ctx, query, "track", 10, 0)
+	if err != nil {
+		return AlbumTrackMetadata{}, "", err
+	}
+	// Only accept an exact title and artist match; a wrong match would be worse than incomplete tags
+	for _, r := range results {
+		if normalizeDuplicateText(r.Name) == title && strings.Contains(normalizeDuplicateText(r.Artists), artist) {
+			track, err := j.fetchTrack(ctx, r.ID)
+			return track, RetagMatchSearch, err
+		}
+	}
+	return AlbumTrackMetadata{}, "", fmt.Errorf("no matching Spotify track found")
+}
+
+// fetchTrack returns the track with its album's label, copyright and disc count, and the genres of its album or artist
+func (j *retagJob) fetchTrack(ctx context.Context, trackID string) (AlbumTrackMetadata, error) {
+	token, err := j.client.getAccessToken(ctx)
+	if err != nil {
+		return AlbumTrackMetadata{}, fmt.Errorf("failed to get access token: %w", err)
+	}
+	raw, err := j.client.fetchTrack(ctx, trackID, token)
+	if err != nil {
+		return AlbumTrackMetadata{}, fmt.Errorf("failed to fetch track: %v", err)
+	}
+
+	album, ok := j.albums[raw.Album.ID]
+	if !ok {
+		if album, err = j.client.fetchAlbum(ctx, raw.Album.ID, token, false, 0); err != nil {
+			return AlbumTrackMetadata{}, fmt.Errorf("failed to fetch album: %v", err)
+		}
+		j.albums[raw.Album.ID] = album
+	}
+
+	totalDiscs := 0
+	for _, item := range album.Data.Tracks.Items {
+		totalDiscs = maxInt(totalDiscs, item.DiscNumber)
+	}
+	track := AlbumTrackMetadata{
+		SpotifyID:   raw.ID,
+		Artists:     joinArtists(raw.Artists),
+		Name:        raw.Name,
+		AlbumName:   raw.Album.Name,
+		AlbumArtist: joinArtists(raw.Album.Artists),
+		DurationMS:  raw.DurationMS,
+		Images:      firstImageURL(raw.Album.Images),
+		ReleaseDate: raw.Album.ReleaseDate,
+		TrackNumber: raw.TrackNumber,
+		TotalTracks: raw.Album.TotalTracks,
+		DiscNumber:  raw.DiscNumber,
+		ExternalURL: raw.ExternalURL.Spotify,
+		ISRC:        raw.ExternalID.ISRC,
+		AlbumType:   raw.Album.AlbumType,
+		AlbumID:     raw.Album.ID,
+		ArtistsData: artistSimples(raw.Artists),
+		Label:       album.Data.Label,
+		Copyright:   albumCopyright(album.Data.Copyrights),
+		TotalDiscs:  totalDiscs,
+		Genres:      album.Data.Genres,
+	}
+	tracks := []AlbumTrackMetadata{track}
+	j.client.fillArtistGenres(ctx, token, tracks)
+	return tracks[0], nil
+}
+
+// artistListKey returns the tag holding one value per artist next to the display artist, if the format has one
+func artistListKey(format string) string {
+	switch format {
+	case "flac":
+		return "ARTISTS"
+	case "m4a":
+		return mp4DisplayKey(mp4KeyArtists)
+	default:
+		return ""
+	}
+}
+
+// tagValues returns the values of the field with the key
+func tagValues(tags *FileTags, key string) []string {
+	for _, field := range tags.Fields {
+		if tagKeysEqual(tags.Format, field.Key, key) {
+			return field.Values
+		}
+	}
+	return nil
+}
+
+// diffFileTags lists the fields whose values differ, in the order they appear
+func diffFileTags(before, after *FileTags) []TagChange {
+	changes := []TagChange{}
+	seen := make(map[string]bool)
+	for _, tags := range []*FileTags{before, after} {
+		for _, field := range tags.Fields {
+			if field.ReadOnly || seen[field.Key] {
+				continue
+			}
+			seen[field.Key] = true
+			oldValues, newValues := tagValues(before, field.Key), tagValues(after, field.Key)
+			if !slices.Equal(oldValues, newValues) {
+				changes = append(changes, TagChange{Key: field.Key, Old: append([]string{}, oldValues...), New: append([]string{}, newValues...)})
+			}
+		}
+	}
+	return changes
+}
+
+// copyTagsToTemp copies the tags of a file, without its audio, to a stub in the temp folder with the same extension:
+// the FLAC metadata blocks, the leading ID3v2 tag of an MP3, or every top-level MP4 box but mdat.
+// Embedding metadata in the stub changes the tags the same way it would change the file.
+func copyTagsToTemp(path string) (string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	ext := strings.ToLower(pathfilepath.Ext(path))
+	out, err := os.CreateTemp("", "retag-*"+ext)
+	if err != nil {
+		return "", err
+	}
+	switch ext {
+	case ".flac":
+		err = copyFlacMetadata(out, in)
+	case ".mp3":
+		err = copyID3v2Tag(out, in)
+	case ".m4a":
+		err = copyMP4Metadata(out, in)
+	default:
+		err = fmt.Errorf("unsupported file format: %s", pathfilepath.Ext(path))
+	}
+	if err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
+
+// copyFlacMetadata copies the "fLaC" marker, every metadata block and the sync code of the first frame
+func copyFlacMetadata(w io.Writer, r io.Reader) error {
+	var marker [4]byte
+	if _, err := io.ReadFull(r, marker[:]); err != nil || string(marker[:]) != "fLaC" {
+		return fmt.Errorf("not a FLAC file")
+	}
+	if _, err := w.Write(marker[:]); err != nil {
+		return err
+	}
+	for {
+		// Last-block flag and type, then a 24-bit length
+		var header [4]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return fmt.Errorf("truncated FLAC metadata: %v", err)
+		}
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		if _, err := w.Write(header[:]); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(w, r, length); err != nil {
+			return fmt.Errorf("truncated FLAC metadata: %v", err)
+		}
+		if header[0]&0x80 != 0 {
+			break
+		}
+	}
+	// The FLAC parser checks that the audio starts with a frame sync code
+	if _, err := io.CopyN(w, r, 2); err != nil {
+		return fmt.Errorf("no FLAC audio frames found")
+	}
+	return nil
+}
+
+// copyID3v2Tag copies the ID3v2 tag at the start of an MP3; a file without one gives an empty stub
+func copyID3v2Tag(w io.Writer, r io.Reader) error {
+	var header [10]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil || string(header[:3]) != "ID3" {
+		return nil
+	}
+	size := int64(header[6]&0x7F)<<21 | int64(header[7]&0x7F)<<14 | int64(header[8]&0x7F)<<7 | int64(header[9]&0x7F)
+	if header[5]&0x10 != 0 {
+		size += 10 // Footer present
+	}
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(w, r, size); err != nil {
+		return fmt.Errorf("truncated ID3v2 tag: %v", err)
+	}
+	return nil
+}
+
+// copyMP4Metadata copies every top-level box except the audio data.
+// The chunk offsets in the copy point nowhere, which doesn't matter for reading and writing tags.
+func copyMP4Metadata(w io.Writer, f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	boxes, err := readMP4Boxes(f, 0, info.Size())
+	if err != nil {
+		return fmt.Errorf("failed to parse MP4 file: %v", err)
+	}
+	for _, box := range boxes {
+		if box.kind == "mdat" {
+			continue
+		}
+		if _, err := io.Copy(w, io.NewSectionReader(f, box.offset, box.size)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Longest Retry-After we are willing to wait for
+const maxRetryAfter = 2 * time.Minute
+
+var (
+	errEmptyResponse      = errors.New("API returned empty response")
+	errIncompleteDownload = errors.New("incomplete download")
+	errEmptyDownload      = errors.New("downloaded file is empty")
+)
+
+// RetryPolicy controls how failed SpotiDownloader API calls and transfers are retried
+type RetryPolicy struct {
+	MaxAttempts int           // Total attempts including the first one
+	BaseDelay   time.Duration // Delay before the first retry, doubled on each retry
+	MaxDelay    time.Duration // Upper bound for the backoff delay
+}
+
+// DefaultRetryPolicy is used by NewSpotiDownloader
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   1 * time.Second,
+	MaxDelay:    30 * time.Second,
+}
+
+// httpStatusError is returned when a server answers with a non-success status code
+type httpStatusError struct {
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration // From the Retry-After header, 0 if absent
+}
+
+func (e *httpStatusError) Error() string {
+	return e.Message
+}
+
+// newHTTPStatusError builds an httpStatusError from a response; prefix and body make up the message
+func newHTTPStatusError(resp *http.Response, prefix, body string) *httpStatusError {
+	statusErr := &httpStatusError{
+		StatusCode: resp.StatusCode,
+		Message:    fmt.Sprintf("%s %d: %s", prefix, resp.StatusCode, strings.TrimSpace(body)),
+	}
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+		statusErr.RetryAfter = parseRetryAfter(retryAfter)
+	}
+	return statusErr
+}
+
+// IsRetryableError reports whether a failed request is worth trying again
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		switch {
+		case statusErr.StatusCode == http.StatusRequestTimeout,
+			statusErr.StatusCode == http.StatusTooEarly,
+			statusErr.StatusCode == http.StatusTooManyRequests:
+			return true
+		case statusErr.StatusCode >= 500:
+			return true
+		default:
+			return false
+		}
+	}
+
+	if errors.Is(err, errEmptyResponse) ||
+		errors.Is(err, errIncompleteDownload) ||
+		errors.Is(err, errEmptyDownload) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	// DNS lookups and dial/read/write failures are transient; certificate errors,
+	// unsupported schemes and malformed URLs would fail the same way again
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		// TLS alerts from the peer are also reported as *net.OpError ("remote error")
+		return opErr.Op == "dial" || opErr.Op == "read" || opErr.Op == "write"
+	}
+
+	// The server dropping a kept-alive connection surfaces as a bare EOF from the transport
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && errors.Is(urlErr.Err, io.EOF)
+}
+
+// Do calls fn until it succeeds, returns a non-retryable error, or runs out of attempts.
+// onRetry is called before each retry with the upcoming attempt number (2-based) and the delay.
+func (p RetryPolicy) Do(ctx context.Context, onRetry func(attempt int, err error, delay time.Duration), fn func() error) error {
+	maxAttempts := p.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= maxAttempts || !IsRetryableError(err) {
+			return err
+		}
+
+		delay := p.backoff(attempt, err)
+		if onRetry != nil {
+			onRetry(attempt+1, err, delay)
+		}
+		if sleepErr := sleepWithContext(ctx, delay); sleepErr != nil {
+			return err
+		}
+	}
+}
+
+// backoff returns the delay before the retry following attempt.
+// It honors Retry-After when the server sent one, otherwise uses exponential backoff with jitter.
+func (p RetryPolicy) backoff(attempt int, err error) time.Duration {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		if statusErr.RetryAfter > maxRetryAfter {
+			return maxRetryAfter
+		}
+		return statusErr.RetryAfter
+	}
+
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	// Equal jitter: half fixed, half random, so workers that failed together don't retry together
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
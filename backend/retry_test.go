@@ -0,0 +1,154 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"cancelled", fmt.Errorf("request: %w", context.Canceled), false},
+		{"deadline", fmt.Errorf("request: %w", context.DeadlineExceeded), true},
+		{"408", &httpStatusError{StatusCode: http.StatusRequestTimeout}, true},
+		{"425", &httpStatusError{StatusCode: http.StatusTooEarly}, true},
+		{"429", &httpStatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{"500", &httpStatusError{StatusCode: http.StatusInternalServerError}, true},
+		{"503 wrapped", fmt.Errorf("download: %w", &httpStatusError{StatusCode: http.StatusServiceUnavailable}), true},
+		{"401", &httpStatusError{StatusCode: http.StatusUnauthorized}, false},
+		{"404", &httpStatusError{StatusCode: http.StatusNotFound}, false},
+		{"empty response", errEmptyResponse, true},
+		{"incomplete download", fmt.Errorf("%w: got 10 of 20 bytes", errIncompleteDownload), true},
+		{"empty download", errEmptyDownload, true},
+		{"unexpected EOF", io.ErrUnexpectedEOF, true},
+		{"connection reset", &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{"connection refused", os.NewSyscallError("connect", syscall.ECONNREFUSED), true},
+		{"broken pipe", syscall.EPIPE, true},
+		{"timeout", fmt.Errorf("read: %w", os.ErrDeadlineExceeded), true},
+		{"dns", &net.DNSError{Err: "no such host", Name: "example.invalid"}, true},
+		{"dial", &net.OpError{Op: "dial", Err: errors.New("network is unreachable")}, true},
+		{"tls alert", &net.OpError{Op: "remote error", Err: errors.New("tls: bad certificate")}, false},
+		{"kept-alive connection dropped", &url.Error{Op: "Get", URL: "https://example.com", Err: io.EOF}, true},
+		{"unsupported scheme", &url.Error{Op: "Get", URL: "ftp://example.com", Err: errors.New("unsupported protocol scheme")}, false},
+		{"other", errors.New("invalid JSON"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryableError(tt.err); got != tt.want {
+				t.Errorf("IsRetryableError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	retryable := errors.New("temporary")
+
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		attempt int
+		err     error
+		min     time.Duration
+		max     time.Duration
+	}{
+		{"first retry", policy, 1, retryable, 500 * time.Millisecond, time.Second},
+		{"doubles", policy, 3, retryable, 2 * time.Second, 4 * time.Second},
+		{"capped", policy, 8, retryable, 5 * time.Second, 10 * time.Second},
+		{"no cap", RetryPolicy{BaseDelay: time.Second}, 4, retryable, 4 * time.Second, 8 * time.Second},
+		{"no delay", RetryPolicy{}, 3, retryable, 0, 0},
+		{"retry after", policy, 1, &httpStatusError{StatusCode: 429, RetryAfter: 42 * time.Second}, 42 * time.Second, 42 * time.Second},
+		{"retry after capped", policy, 1, &httpStatusError{StatusCode: 429, RetryAfter: time.Hour}, maxRetryAfter, maxRetryAfter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				if got := tt.policy.backoff(tt.attempt, tt.err); got < tt.min || got > tt.max {
+					t.Fatalf("backoff(%d) = %s, want between %s and %s", tt.attempt, got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	retryable := &httpStatusError{StatusCode: http.StatusBadGateway, Message: "bad gateway"}
+	permanent := &httpStatusError{StatusCode: http.StatusNotFound, Message: "not found"}
+
+	tests := []struct {
+		name        string
+		maxAttempts int
+		errs        []error // Returned by successive calls; nil after the last one
+		wantCalls   int
+		wantErr     error
+	}{
+		{"succeeds first time", 3, nil, 1, nil},
+		{"succeeds after retries", 3, []error{retryable, retryable}, 3, nil},
+		{"runs out of attempts", 3, []error{retryable, retryable, retryable, retryable}, 3, retryable},
+		{"permanent error", 3, []error{retryable, permanent, retryable}, 2, permanent},
+		{"at least one attempt", 0, []error{retryable}, 1, retryable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := RetryPolicy{MaxAttempts: tt.maxAttempts}
+			calls := 0
+			var retries []int
+			err := policy.Do(context.Background(), func(attempt int, err error, delay time.Duration) {
+				retries = append(retries, attempt)
+			}, func() error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+
+			if err != tt.wantErr {
+				t.Errorf("Do() = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("fn called %d times, want %d", calls, tt.wantCalls)
+			}
+			for i, attempt := range retries {
+				if attempt != i+2 {
+					t.Errorf("retry %d reported attempt %d, want %d", i, attempt, i+2)
+				}
+			}
+			if len(retries) != calls-1 {
+				t.Errorf("onRetry called %d times for %d calls", len(retries), calls)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDoStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour}
+	retryable := fmt.Errorf("%w: got 10 of 20 bytes", errIncompleteDownload)
+
+	calls := 0
+	err := policy.Do(ctx, func(int, error, time.Duration) { cancel() }, func() error {
+		calls++
+		return retryable
+	})
+	if err != retryable || calls != 1 {
+		t.Errorf("got %v after %d calls, want the first error after 1 call", err, calls)
+	}
+}
@@ -0,0 +1,263 @@
+package backend
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Filesystems that names are sanitized for
+const (
+	FilesystemWindows = "windows" // NTFS; the default, since its rules are safe everywhere
+	FilesystemFAT     = "fat"     // exFAT and FAT32, e.g. USB sticks and SD cards for car stereos
+	FilesystemPOSIX   = "posix"   // Linux and macOS file systems
+)
+
+// Longest file or folder name in bytes; ext4 counts UTF-8 bytes, NTFS and exFAT count UTF-16 units,
+// so a UTF-8 byte limit is safe on all of them
+const maxNameBytes = 255
+
+// Names are never shortened below this many bytes to fit a path length limit
+const minFittedNameBytes = 32
+
+// Folder names are never shortened below this many UTF-16 units to fit a path length limit
+const minFittedFolderUnits = 16
+
+// Room left for the extension when folders are shortened, enough for ".flac", ".m3u8" and ".xspf"
+const maxExtUnits = 5
+
+type filesystemProfile struct {
+	invalid       string // Characters replaced with a space
+	reservedNames bool   // CON, PRN, AUX, NUL, COM1-9 and LPT1-9 can't be used
+	trimTrailing  bool   // Names can't end in a dot or space
+	maxPath       int    // Longest full path in UTF-16 units, 0 for no limit
+}
+
+var filesystemProfiles = map[string]filesystemProfile{
+	FilesystemWindows: {invalid: `<>:"/\|?*`, reservedNames: true, trimTrailing: true, maxPath: 259}, // MAX_PATH minus the terminator
+	FilesystemFAT:     {invalid: `<>:"/\|?*`, reservedNames: true, trimTrailing: true, maxPath: 255},
+	FilesystemPOSIX:   {invalid: "/"},
+}
+
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+var (
+	whitespacePattern = regexp.MustCompile(`\s+`)
+	underscorePattern = regexp.MustCompile(`_+`)
+)
+
+// ResolveFilesystem validates a filesystem name, defaulting to FilesystemWindows when empty
+func ResolveFilesystem(filesystem string) (string, error) {
+	switch filesystem {
+	case "":
+		return FilesystemWindows, nil
+	case FilesystemWindows, FilesystemFAT, FilesystemPOSIX:
+		return filesystem, nil
+	default:
+		return "", fmt.Errorf("unknown filesystem: %s", filesystem)
+	}
+}
+
+func profileFor(filesystem string) filesystemProfile {
+	if profile, ok := filesystemProfiles[filesystem]; ok {
+		return profile
+	}
+	return filesystemProfiles[FilesystemWindows]
+}
+
+// SanitizeFilename makes name safe as a file or folder name on every supported filesystem
+func SanitizeFilename(name string) string {
+	return SanitizeName(name, FilesystemWindows)
+}
+
+// SanitizeName makes name safe as a single file or folder name on the given filesystem.
+// Invalid characters become spaces, the name is NFC-normalized and at most 255 bytes,
+// and reserved device names get a trailing underscore. Returns "Unknown" when nothing is left.
+func SanitizeName(name, filesystem string) string {
+	profile := profileFor(filesystem)
+	name = norm.NFC.String(name)
+
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case strings.ContainsRune(profile.invalid, r):
+			b.WriteByte(' ')
+		case unicode.IsSpace(r):
+			b.WriteByte(' ')
+		case r < 0x20 || r == 0x7F:
+			// Control characters
+		case isEmoji(r):
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	result := whitespacePattern.ReplaceAllString(b.String(), " ")
+	result = underscorePattern.ReplaceAllString(result, "_")
+	result = trimName(result, profile)
+	result = truncateName(result, maxNameBytes, profile)
+
+	if result == "" {
+		return "Unknown"
+	}
+
+	if profile.reservedNames {
+		base := result
+		if i := strings.IndexByte(base, '.'); i >= 0 {
+			base = base[:i]
+		}
+		if windowsReservedNames[strings.ToUpper(strings.TrimSpace(base))] {
+			result = base + "_" + result[len(base):]
+		}
+	}
+
+	return result
+}
+
+// FitFilename sanitizes name and shortens it so that name plus ext stays within the name length limit
+// and, inside dir, within the filesystem's path length limit. The extension is always kept.
+// It fails when dir leaves less than minFittedNameBytes for the name.
+func FitFilename(dir, name, ext, filesystem string) (string, error) {
+	profile := profileFor(filesystem)
+	name = SanitizeName(name, filesystem)
+
+	limit := maxNameBytes - len(ext)
+	if profile.maxPath > 0 {
+		available := profile.maxPath - utf16Len(filepath.Join(dir, "x")) + 1 - utf16Len(ext)
+		if available < minFittedNameBytes {
+			return "", fmt.Errorf("path too long: %s leaves %d characters for the file name, the limit is %d", dir, max(available, 0), profile.maxPath)
+		}
+		// UTF-16 units never exceed UTF-8 bytes, so a byte limit fits the path
+		limit = min(limit, available)
+	}
+	if len(name) > limit {
+		name = truncateName(name, limit, profile)
+	}
+	return name + ext, nil
+}
+
+// fitFolders shortens the longest of the folder names below dir until dir, the folders and a
+// minFittedNameBytes file name fit the filesystem's path length limit. Folders that still don't
+// fit are left for FitFilename to report.
+func fitFolders(dir string, folders []string, filesystem string) []string {
+	profile := profileFor(filesystem)
+	if profile.maxPath <= 0 || len(folders) == 0 {
+		return folders
+	}
+
+	fitted := append([]string(nil), folders...)
+	for {
+		parts := append([]string{dir}, fitted...)
+		over := utf16Len(filepath.Join(append(parts, "x")...)) - 1 + minFittedNameBytes + maxExtUnits - profile.maxPath
+		if over <= 0 {
+			return fitted
+		}
+
+		longest := -1
+		for i, folder := range fitted {
+			if utf16Len(folder) > minFittedFolderUnits && (longest < 0 || utf16Len(folder) > utf16Len(fitted[longest])) {
+				longest = i
+			}
+		}
+		if longest < 0 {
+			return fitted
+		}
+
+		units := max(utf16Len(fitted[longest])-over, minFittedFolderUnits)
+		shortened := truncateUnits(fitted[longest], units, profile)
+		if shortened == "" || shortened == fitted[longest] {
+			return fitted
+		}
+		fitted[longest] = shortened
+	}
+}
+
+// UniquePath returns path, or when a file already exists there, the first free
+// "name (2).ext", "name (3).ext", ... that still fits the name length limit
+func UniquePath(path string) string {
+	return uniquePath(path, func(candidate string) bool {
+		_, err := os.Lstat(candidate)
+		return err == nil
+	})
+}
+
+func uniquePath(path string, taken func(string) bool) string {
+	if !taken(path) {
+		return path
+	}
+
+	dir := filepath.Dir(path)
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(filepath.Base(path), ext)
+	for n := 2; ; n++ {
+		suffix := fmt.Sprintf(" (%d)", n)
+		stem := truncateName(base, maxNameBytes-len(suffix)-len(ext), filesystemProfile{trimTrailing: true})
+		candidate := filepath.Join(dir, stem+suffix+ext)
+		if !taken(candidate) {
+			return candidate
+		}
+	}
+}
+
+// trimName drops separators and dots the filesystem doesn't allow at the ends of a name.
+// Leading dots are always dropped so names never become hidden files.
+func trimName(name string, profile filesystemProfile) string {
+	name = strings.Trim(name, "_ ")
+	name = strings.TrimLeft(name, ". ")
+	if profile.trimTrailing {
+		name = strings.TrimRight(name, ". ")
+	}
+	return name
+}
+
+// truncateName shortens name to at most limit bytes without splitting a character
+func truncateName(name string, limit int, profile filesystemProfile) string {
+	if len(name) <= limit {
+		return name
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(name[cut]) {
+		cut--
+	}
+	return trimName(name[:cut], profile)
+}
+
+// truncateUnits shortens name to at most limit UTF-16 units without splitting a character
+func truncateUnits(name string, limit int, profile filesystemProfile) string {
+	units := 0
+	for i, r := range name {
+		units += utf16.RuneLen(r)
+		if units > limit {
+			return trimName(name[:i], profile)
+		}
+	}
+	return name
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// isEmoji reports whether r is in one of the common emoji blocks
+func isEmoji(r rune) bool {
+	return (r >= 0x1F300 && r <= 0x1F9FF) || // Miscellaneous Symbols and Pictographs, Emoticons, Transport, Supplemental Symbols
+		(r >= 0x2600 && r <= 0x26FF) || // Miscellaneous Symbols
+		(r >= 0x2700 && r <= 0x27BF) || // Dingbats
+		(r >= 0xFE00 && r <= 0xFE0F) || // Variation Selectors
+		(r >= 0x1F1E0 && r <= 0x1F1FF) // Regional Indicator Symbols (flags)
+}
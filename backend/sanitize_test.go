@@ -0,0 +1,148 @@
+package backend
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		filesystem string
+		want       string
+	}{
+		{"invalid characters", `a<b>c:d"e/f\g|h?i*j`, FilesystemWindows, "a b c d e f g h i j"},
+		{"posix keeps colons", "a:b/c", FilesystemPOSIX, "a:b c"},
+		{"whitespace collapsed", "a \t\n b", FilesystemWindows, "a b"},
+		{"control characters dropped", "a\x00b\x7fc", FilesystemWindows, "abc"},
+		{"emoji dropped", "song 🎵", FilesystemWindows, "song"},
+		{"leading dots dropped", "...hidden", FilesystemPOSIX, "hidden"},
+		{"trailing dots trimmed", "name...", FilesystemWindows, "name"},
+		{"trailing dots kept on posix", "name...", FilesystemPOSIX, "name..."},
+		{"reserved name", "CON", FilesystemWindows, "CON_"},
+		{"reserved name any case", "nul", FilesystemFAT, "nul_"},
+		{"reserved name with extension", "com1.txt", FilesystemWindows, "com1_.txt"},
+		{"reserved name allowed on posix", "CON", FilesystemPOSIX, "CON"},
+		{"reserved prefix is fine", "CONSOLE", FilesystemWindows, "CONSOLE"},
+		{"NFC", "é", FilesystemWindows, "é"},
+		{"empty", " ?* ", FilesystemWindows, "Unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeName(tt.input, tt.filesystem); got != tt.want {
+				t.Errorf("SanitizeName(%q, %s) = %q, want %q", tt.input, tt.filesystem, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeNameTruncatesBytes(t *testing.T) {
+	// 3 bytes each, so 255 bytes can't end on a character boundary after an "a"
+	name := "a" + strings.Repeat("音", 100)
+	got := SanitizeName(name, FilesystemPOSIX)
+	if len(got) > maxNameBytes {
+		t.Errorf("got %d bytes, want at most %d", len(got), maxNameBytes)
+	}
+	if !utf8.ValidString(got) {
+		t.Errorf("truncation split a character: %q", got)
+	}
+	if want := "a" + strings.Repeat("音", 84); got != want {
+		t.Errorf("got %d bytes, want %d", len(got), len(want))
+	}
+}
+
+func TestFitFilename(t *testing.T) {
+	t.Run("keeps extension", func(t *testing.T) {
+		got, err := FitFilename("", strings.Repeat("a", 300), ".flac", FilesystemPOSIX)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != maxNameBytes || !strings.HasSuffix(got, ".flac") {
+			t.Errorf("got %d bytes %q, want %d bytes ending in .flac", len(got), got, maxNameBytes)
+		}
+	})
+
+	t.Run("fits path limit", func(t *testing.T) {
+		dir := strings.Repeat("d", 200)
+		got, err := FitFilename(dir, strings.Repeat("é", 100), ".flac", FilesystemWindows)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := utf16Len(filepath.Join(dir, got)); n > 259 {
+			t.Errorf("path is %d UTF-16 units, want at most 259", n)
+		}
+		if !utf8.ValidString(got) || !strings.HasSuffix(got, ".flac") {
+			t.Errorf("got %q", got)
+		}
+	})
+
+	t.Run("no path limit on posix", func(t *testing.T) {
+		dir := strings.Repeat("d", 1000)
+		got, err := FitFilename(dir, "name", ".flac", FilesystemPOSIX)
+		if err != nil || got != "name.flac" {
+			t.Errorf("got %q, %v; want name.flac", got, err)
+		}
+	})
+
+	t.Run("folder too long", func(t *testing.T) {
+		dir := strings.Repeat("d", 240)
+		if got, err := FitFilename(dir, "name", ".flac", FilesystemWindows); err == nil {
+			t.Errorf("got %q, want an error", got)
+		}
+	})
+}
+
+func TestFitFolders(t *testing.T) {
+	dir := filepath.Join("C:", "Music")
+	folders := []string{strings.Repeat("a", 200), strings.Repeat("b", 20), strings.Repeat("c", 120)}
+
+	fitted := fitFolders(dir, folders, FilesystemWindows)
+	path := filepath.Join(append([]string{dir}, fitted...)...)
+	if n := utf16Len(path) + 1 + minFittedNameBytes + maxExtUnits; n > 259 {
+		t.Errorf("folders leave room for a %d unit path, want at most 259", n)
+	}
+	if fitted[1] != folders[1] {
+		t.Errorf("short folder changed to %q", fitted[1])
+	}
+	if _, err := FitFilename(path, "name", ".flac", FilesystemWindows); err != nil {
+		t.Errorf("FitFilename after fitting folders: %v", err)
+	}
+
+	if got := fitFolders(dir, folders, FilesystemPOSIX); strings.Join(got, "/") != strings.Join(folders, "/") {
+		t.Errorf("posix folders changed to %q", got)
+	}
+}
+
+func TestUniquePath(t *testing.T) {
+	taken := map[string]bool{
+		filepath.Join("dir", "song.flac"):     true,
+		filepath.Join("dir", "song (2).flac"): true,
+		filepath.Join("dir", "other.flac"):    true,
+	}
+	isTaken := func(path string) bool { return taken[path] }
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{filepath.Join("dir", "free.flac"), filepath.Join("dir", "free.flac")},
+		{filepath.Join("dir", "other.flac"), filepath.Join("dir", "other (2).flac")},
+		{filepath.Join("dir", "song.flac"), filepath.Join("dir", "song (3).flac")},
+	}
+	for _, tt := range tests {
+		if got := uniquePath(tt.path, isTaken); got != tt.want {
+			t.Errorf("uniquePath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+
+	long := filepath.Join("dir", strings.Repeat("音", 84)+".flac")
+	got := uniquePath(long, func(path string) bool { return path == long })
+	name := filepath.Base(got)
+	if len(name) > maxNameBytes || !utf8.ValidString(name) || !strings.HasSuffix(name, " (2).flac") {
+		t.Errorf("uniquePath of a long name = %q (%d bytes)", name, len(name))
+	}
+}
@@ -0,0 +1,376 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+const (
+	defaultDownloadWorkers = 3
+	defaultHostConcurrency = 2
+)
+
+// DownloadJob is a unit of work run by the download scheduler.
+// Run performs the download and is responsible for marking the queue item completed, skipped, or failed.
+type DownloadJob struct {
+	ItemID  string
+	BatchID string
+	Run     func(ctx context.Context) error
+}
+
+// scheduledJob tracks a job while it is pending or running
+type scheduledJob struct {
+	job         DownloadJob
+	cancel      context.CancelFunc
+	running     bool
+	paused      bool
+	cancelled   bool
+	interrupted bool // The running transfer was stopped by a pause
+}
+
+// DownloadScheduler runs queued download jobs on a configurable number of workers
+type DownloadScheduler struct {
+	mu            sync.Mutex
+	cond          *sync.Cond
+	workers       int
+	activeWorkers int
+	pending       []*scheduledJob
+	jobs          map[string]*scheduledJob
+	pausedBatches map[string]bool
+}
+
+var (
+	globalScheduler     *DownloadScheduler
+	globalSchedulerOnce sync.Once
+)
+
+// GetDownloadScheduler returns the process-wide download scheduler, starting it on first use
+func GetDownloadScheduler() *DownloadScheduler {
+	globalSchedulerOnce.Do(func() {
+		globalScheduler = NewDownloadScheduler(defaultDownloadWorkers)
+	})
+	return globalScheduler
+}
+
+// NewDownloadScheduler creates a scheduler and starts its workers
+func NewDownloadScheduler(workers int) *DownloadScheduler {
+	s := &DownloadScheduler{
+		jobs:          make(map[string]*scheduledJob),
+		pausedBatches: make(map[string]bool),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	s.SetWorkers(workers)
+	return s
+}
+
+// SetWorkers changes the number of concurrent downloads. Extra workers exit once their current job finishes.
+func (s *DownloadScheduler) SetWorkers(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.workers = workers
+	for s.activeWorkers < s.workers {
+		s.activeWorkers++
+		go s.worker()
+	}
+	s.cond.Broadcast()
+}
+
+// Workers returns the configured number of concurrent downloads
+func (s *DownloadScheduler) Workers() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.workers
+}
+
+// Submit queues jobs for download. Jobs whose item is already scheduled are ignored.
+func (s *DownloadScheduler) Submit(jobs ...DownloadJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, job := range jobs {
+		if _, exists := s.jobs[job.ItemID]; exists {
+			continue
+		}
+		sj := &scheduledJob{job: job}
+		s.jobs[job.ItemID] = sj
+		s.pending = append(s.pending, sj)
+	}
+	s.cond.Broadcast()
+}
+
+// PauseItem stops an item from starting, or interrupts it if it is already downloading
+func (s *DownloadScheduler) PauseItem(itemID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sj, exists := s.jobs[itemID]
+	if !exists {
+		return fmt.Errorf("download item %s is not scheduled", itemID)
+	}
+	s.pauseLocked(sj)
+	return nil
+}
+
+// ResumeItem lets a paused item run again
+func (s *DownloadScheduler) ResumeItem(itemID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sj, exists := s.jobs[itemID]
+	if !exists {
+		return fmt.Errorf("download item %s is not scheduled", itemID)
+	}
+	s.resumeLocked(sj)
+	s.cond.Broadcast()
+	return nil
+}
+
+// CancelItem removes an item from the schedule, interrupting it if it is downloading
+func (s *DownloadScheduler) CancelItem(itemID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sj, exists := s.jobs[itemID]
+	if !exists {
+		return fmt.Errorf("download item %s is not scheduled", itemID)
+	}
+	s.cancelLocked(sj)
+	return nil
+}
+
+// PauseBatch pauses every item in a batch
+func (s *DownloadScheduler) PauseBatch(batchID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pausedBatches[batchID] = true
+	for _, sj := range s.jobs {
+		if sj.job.BatchID == batchID {
+			s.pauseLocked(sj)
+		}
+	}
+}
+
+// ResumeBatch resumes every paused item in a batch
+func (s *DownloadScheduler) ResumeBatch(batchID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.pausedBatches, batchID)
+	for _, sj := range s.jobs {
+		if sj.job.BatchID == batchID {
+			s.resumeLocked(sj)
+		}
+	}
+	s.cond.Broadcast()
+}
+
+// CancelBatch cancels every item in a batch
+func (s *DownloadScheduler) CancelBatch(batchID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.pausedBatches, batchID)
+	for _, sj := range s.jobs {
+		if sj.job.BatchID == batchID {
+			s.cancelLocked(sj)
+		}
+	}
+}
+
+func (s *DownloadScheduler) pauseLocked(sj *scheduledJob) {
+	if sj.paused || sj.cancelled {
+		return
+	}
+	sj.paused = true
+	if sj.running {
+		// The worker records the paused state once the transfer has stopped
+		sj.interrupted = true
+		sj.cancel()
+		return
+	}
+	PauseDownloadItem(sj.job.ItemID)
+}
+
+func (s *DownloadScheduler) resumeLocked(sj *scheduledJob) {
+	if !sj.paused || sj.cancelled {
+		return
+	}
+	sj.paused = false
+	// An interrupted job is re-queued by its worker once it has stopped
+	if !sj.running {
+		RequeueDownloadItem(sj.job.ItemID)
+	}
+}
+
+func (s *DownloadScheduler) cancelLocked(sj *scheduledJob) {
+	if sj.cancelled {
+		return
+	}
+	sj.cancelled = true
+	if sj.running {
+		// The worker records the cancellation once the transfer has stopped
+		sj.cancel()
+		return
+	}
+	s.removePendingLocked(sj)
+	delete(s.jobs, sj.job.ItemID)
+	CancelDownloadItem(sj.job.ItemID)
+}
+
+func (s *DownloadScheduler) removePendingLocked(target *scheduledJob) {
+	for i, sj := range s.pending {
+		if sj == target {
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// nextRunnableLocked pops the first pending job that is not paused
+func (s *DownloadScheduler) nextRunnableLocked() *scheduledJob {
+	for i, sj := range s.pending {
+		if sj.paused || s.pausedBatches[sj.job.BatchID] {
+			continue
+		}
+		s.pending = append(s.pending[:i], s.pending[i+1:]...)
+		return sj
+	}
+	return nil
+}
+
+func (s *DownloadScheduler) worker() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		if s.activeWorkers > s.workers {
+			s.activeWorkers--
+			return
+		}
+
+		sj := s.nextRunnableLocked()
+		if sj == nil {
+			s.cond.Wait()
+			continue
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		sj.running = true
+		sj.cancel = cancel
+
+		s.mu.Unlock()
+		err := s.runJob(ctx, sj.job)
+		cancel()
+		s.mu.Lock()
+
+		sj.running = false
+		sj.cancel = nil
+		interrupted := sj.interrupted
+		sj.interrupted = false
+
+		switch {
+		case err == nil:
+			// Finished before the pause or cancel took effect; keep the status set by the job
+			delete(s.jobs, sj.job.ItemID)
+		case sj.cancelled:
+			CancelDownloadItem(sj.job.ItemID)
+			delete(s.jobs, sj.job.ItemID)
+		case sj.paused:
+			PauseDownloadItem(sj.job.ItemID)
+			s.pending = append(s.pending, sj)
+		case interrupted:
+			// Resumed while the paused transfer was still shutting down
+			RequeueDownloadItem(sj.job.ItemID)
+			s.pending = append(s.pending, sj)
+		default:
+			delete(s.jobs, sj.job.ItemID)
+		}
+		s.cond.Broadcast()
+	}
+}
+
+// runJob runs a job, converting a panic into a failed item so one bad job can't kill a worker
+func (s *DownloadScheduler) runJob(ctx context.Context, job DownloadJob) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("download panicked: %v", r)
+			FailDownloadItem(job.ItemID, err.Error())
+		}
+	}()
+	return job.Run(ctx)
+}
+
+// hostLimiter caps concurrent transfers per remote host
+type hostLimiter struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active map[string]int
+}
+
+var globalHostLimiter = newHostLimiter(defaultHostConcurrency)
+
+func newHostLimiter(limit int) *hostLimiter {
+	l := &hostLimiter{
+		limit:  limit,
+		active: make(map[string]int),
+	}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// SetHostConcurrency sets how many transfers may run against the same host at once (0 = unlimited)
+func SetHostConcurrency(limit int) {
+	if limit < 0 {
+		limit = 0
+	}
+	globalHostLimiter.mu.Lock()
+	globalHostLimiter.limit = limit
+	globalHostLimiter.mu.Unlock()
+	globalHostLimiter.cond.Broadcast()
+}
+
+// acquireHostSlot blocks until a transfer slot for host is free or ctx is done.
+// The returned function releases the slot.
+func acquireHostSlot(ctx context.Context, host string) (func(), error) {
+	l := globalHostLimiter
+
+	// Wake waiters when the context is cancelled so they can give up
+	stop := context.AfterFunc(ctx, func() {
+		l.mu.Lock()
+		l.cond.Broadcast()
+		l.mu.Unlock()
+	})
+	defer stop()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for l.limit > 0 && l.active[host] >= l.limit {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		l.cond.Wait()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l.active[host]++
+	return func() {
+		l.mu.Lock()
+		l.active[host]--
+		if l.active[host] <= 0 {
+			delete(l.active, host)
+		}
+		l.mu.Unlock()
+		l.cond.Broadcast()
+	}, nil
+}
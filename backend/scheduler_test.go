@@ -0,0 +1,342 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testJob blocks each run until it is released or its context is cancelled
+type testJob struct {
+	id          string
+	started     chan struct{}
+	release     chan struct{}
+	releaseOnce sync.Once
+	runs        atomic.Int32
+}
+
+func newTestJob(t *testing.T, id string) *testJob {
+	t.Helper()
+	AddToQueue(id, "Track", "Artist", "Album", "")
+	return &testJob{id: id, started: make(chan struct{}, 10), release: make(chan struct{})}
+}
+
+func (j *testJob) job(batchID string) DownloadJob {
+	return DownloadJob{
+		ItemID:  j.id,
+		BatchID: batchID,
+		Run: func(ctx context.Context) error {
+			j.runs.Add(1)
+			j.started <- struct{}{}
+			select {
+			case <-j.release:
+				CompleteDownloadItem(j.id, "", 0)
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	}
+}
+
+func (j *testJob) finish() {
+	j.releaseOnce.Do(func() { close(j.release) })
+}
+
+func (j *testJob) waitStarted(t *testing.T) {
+	t.Helper()
+	select {
+	case <-j.started:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("%s did not start", j.id)
+	}
+}
+
+func (j *testJob) assertNotStarted(t *testing.T) {
+	t.Helper()
+	select {
+	case <-j.started:
+		t.Fatalf("%s started", j.id)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// queueItemStatus returns the status of a download queue item
+func queueItemStatus(id string) DownloadStatus {
+	downloadQueueLock.RLock()
+	defer downloadQueueLock.RUnlock()
+	for _, item := range downloadQueue {
+		if item.ID == id {
+			return item.Status
+		}
+	}
+	return ""
+}
+
+func waitForStatus(t *testing.T, id string, status DownloadStatus) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for queueItemStatus(id) != status {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s is %q, want %q", id, queueItemStatus(id), status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// useTestDownloadQueue gives the test an empty download queue and restores the old one afterwards
+func useTestDownloadQueue(t *testing.T) {
+	downloadQueueLock.Lock()
+	saved := downloadQueue
+	downloadQueue = nil
+	downloadQueueLock.Unlock()
+	t.Cleanup(func() {
+		downloadQueueLock.Lock()
+		downloadQueue = saved
+		downloadQueueLock.Unlock()
+	})
+}
+
+func TestDownloadSchedulerWorkers(t *testing.T) {
+	useTestDownloadQueue(t)
+
+	for _, workers := range []int{1, 3} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			s := NewDownloadScheduler(workers)
+			var jobs []*testJob
+			for i := 0; i < 5; i++ {
+				job := newTestJob(t, t.Name()+string(rune('a'+i)))
+				jobs = append(jobs, job)
+				s.Submit(job.job("batch"))
+			}
+
+			for _, job := range jobs[:workers] {
+				job.waitStarted(t)
+			}
+			jobs[workers].assertNotStarted(t)
+
+			for _, job := range jobs {
+				job.finish()
+			}
+			for _, job := range jobs {
+				waitForStatus(t, job.id, StatusCompleted)
+				if n := job.runs.Load(); n != 1 {
+					t.Errorf("%s ran %d times, want once", job.id, n)
+				}
+			}
+		})
+	}
+}
+
+func TestDownloadSchedulerPauseResumeCancel(t *testing.T) {
+	useTestDownloadQueue(t)
+
+	// With one worker a is running and b is pending when act is called
+	tests := []struct {
+		name  string
+		act   func(t *testing.T, s *DownloadScheduler, a, b *testJob)
+		wantA DownloadStatus
+		runsA int32
+		wantB DownloadStatus
+		runsB int32
+	}{
+		{
+			"pause and resume pending item",
+			func(t *testing.T, s *DownloadScheduler, a, b *testJob) {
+				if err := s.PauseItem(b.id); err != nil {
+					t.Fatal(err)
+				}
+				waitForStatus(t, b.id, StatusPaused)
+				a.finish()
+				waitForStatus(t, a.id, StatusCompleted)
+				b.assertNotStarted(t)
+				if err := s.ResumeItem(b.id); err != nil {
+					t.Fatal(err)
+				}
+				b.waitStarted(t)
+			},
+			StatusCompleted, 1, StatusCompleted, 1,
+		},
+		{
+			"cancel pending item",
+			func(t *testing.T, s *DownloadScheduler, a, b *testJob) {
+				if err := s.CancelItem(b.id); err != nil {
+					t.Fatal(err)
+				}
+				waitForStatus(t, b.id, StatusSkipped)
+				if err := s.ResumeItem(b.id); err == nil {
+					t.Error("resumed a cancelled item")
+				}
+			},
+			StatusCompleted, 1, StatusSkipped, 0,
+		},
+		{
+			"pause and resume running item",
+			func(t *testing.T, s *DownloadScheduler, a, b *testJob) {
+				if err := s.PauseItem(a.id); err != nil {
+					t.Fatal(err)
+				}
+				waitForStatus(t, a.id, StatusPaused)
+				b.waitStarted(t)
+				if err := s.ResumeItem(a.id); err != nil {
+					t.Fatal(err)
+				}
+				waitForStatus(t, a.id, StatusQueued)
+			},
+			StatusCompleted, 2, StatusCompleted, 1,
+		},
+		{
+			"cancel running item",
+			func(t *testing.T, s *DownloadScheduler, a, b *testJob) {
+				if err := s.CancelItem(a.id); err != nil {
+					t.Fatal(err)
+				}
+				waitForStatus(t, a.id, StatusSkipped)
+				b.waitStarted(t)
+			},
+			StatusSkipped, 1, StatusCompleted, 1,
+		},
+		{
+			"pause and resume batch",
+			func(t *testing.T, s *DownloadScheduler, a, b *testJob) {
+				s.PauseBatch("batch")
+				waitForStatus(t, a.id, StatusPaused)
+				waitForStatus(t, b.id, StatusPaused)
+				b.assertNotStarted(t)
+				s.ResumeBatch("batch")
+				// a was interrupted, so it is queued again behind b
+				b.waitStarted(t)
+			},
+			StatusCompleted, 2, StatusCompleted, 1,
+		},
+		{
+			"cancel batch",
+			func(t *testing.T, s *DownloadScheduler, a, b *testJob) {
+				s.CancelBatch("batch")
+				waitForStatus(t, a.id, StatusSkipped)
+				waitForStatus(t, b.id, StatusSkipped)
+				b.assertNotStarted(t)
+			},
+			StatusSkipped, 1, StatusSkipped, 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewDownloadScheduler(1)
+			a := newTestJob(t, t.Name()+"/a")
+			b := newTestJob(t, t.Name()+"/b")
+			s.Submit(a.job("batch"), b.job("batch"))
+			a.waitStarted(t)
+
+			tt.act(t, s, a, b)
+
+			a.finish()
+			b.finish()
+			waitForStatus(t, a.id, tt.wantA)
+			waitForStatus(t, b.id, tt.wantB)
+			if n := a.runs.Load(); n != tt.runsA {
+				t.Errorf("a ran %d times, want %d", n, tt.runsA)
+			}
+			if n := b.runs.Load(); n != tt.runsB {
+				t.Errorf("b ran %d times, want %d", n, tt.runsB)
+			}
+		})
+	}
+}
+
+func TestDownloadSchedulerUnknownItem(t *testing.T) {
+	s := NewDownloadScheduler(1)
+	for name, fn := range map[string]func(string) error{"pause": s.PauseItem, "resume": s.ResumeItem, "cancel": s.CancelItem} {
+		if err := fn("missing"); err == nil {
+			t.Errorf("%s of an unscheduled item succeeded", name)
+		}
+	}
+}
+
+// useTestHostLimiter replaces the shared host limiter for the test
+func useTestHostLimiter(t *testing.T, limit int) {
+	saved := globalHostLimiter
+	globalHostLimiter = newHostLimiter(limit)
+	t.Cleanup(func() { globalHostLimiter = saved })
+}
+
+func TestAcquireHostSlot(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   int
+		held    []string
+		host    string
+		wantErr bool
+	}{
+		{"under limit", 2, []string{"a.example"}, "a.example", false},
+		{"at limit", 2, []string{"a.example", "a.example"}, "a.example", true},
+		{"other host", 2, []string{"a.example", "a.example"}, "b.example", false},
+		{"unlimited", 0, []string{"a.example", "a.example", "a.example"}, "a.example", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestHostLimiter(t, tt.limit)
+			for _, host := range tt.held {
+				release, err := acquireHostSlot(context.Background(), host)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer release()
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			release, err := acquireHostSlot(ctx, tt.host)
+			if tt.wantErr {
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("got %v, want the context deadline", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got %v, want a slot", err)
+			}
+			release()
+		})
+	}
+}
+
+func TestAcquireHostSlotWaitsForRelease(t *testing.T) {
+	useTestHostLimiter(t, 1)
+
+	release, err := acquireHostSlot(context.Background(), "a.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() {
+		release, err := acquireHostSlot(context.Background(), "a.example")
+		if err == nil {
+			release()
+		}
+		acquired <- err
+	}()
+
+	select {
+	case err := <-acquired:
+		t.Fatalf("second slot acquired while the first was held: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("waiter was not woken by the release")
+	}
+}
@@ -0,0 +1,100 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Parameters used when a rejected session token is refreshed automatically
+const (
+	tokenRefreshTimeout = 5
+	tokenRefreshRetry   = 3
+)
+
+// tokenRefresh is a FetchSessionTokenWithParams call shared by every downloader waiting on it
+type tokenRefresh struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// sessionTokenStore remembers which tokens were replaced so a batch started with an old token
+// picks up the refreshed one instead of hitting the API with a token it already rejected
+type sessionTokenStore struct {
+	mu       sync.Mutex
+	replaced map[string]string // Rejected token -> token that replaced it
+	inflight *tokenRefresh
+}
+
+var globalSessionTokens = sessionTokenStore{
+	replaced: make(map[string]string),
+}
+
+// fetchRefreshedToken fetches the token that replaces a rejected one
+var fetchRefreshedToken = func() (string, error) {
+	return FetchSessionTokenWithParams(tokenRefreshTimeout, tokenRefreshRetry)
+}
+
+// isAuthError reports whether the API rejected the session token
+func isAuthError(err error) bool {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden
+	}
+	return false
+}
+
+// CurrentSessionToken returns the newest token known to replace token, or token itself if it was never refreshed
+func CurrentSessionToken(token string) string {
+	globalSessionTokens.mu.Lock()
+	defer globalSessionTokens.mu.Unlock()
+	return globalSessionTokens.resolveLocked(token)
+}
+
+func (st *sessionTokenStore) resolveLocked(token string) string {
+	// Follow the chain of replacements; the length bound guards against a cycle
+	for i := 0; i <= len(st.replaced); i++ {
+		next, exists := st.replaced[token]
+		if !exists || next == token {
+			break
+		}
+		token = next
+	}
+	return token
+}
+
+// RefreshSessionToken fetches a new token to replace rejected.
+// Concurrent callers share a single FetchSessionTokenWithParams call, and callers whose token
+// was already replaced get the replacement without fetching again.
+func RefreshSessionToken(rejected string) (string, error) {
+	st := &globalSessionTokens
+
+	st.mu.Lock()
+	if current := st.resolveLocked(rejected); current != rejected {
+		st.mu.Unlock()
+		return current, nil
+	}
+	if refresh := st.inflight; refresh != nil {
+		st.mu.Unlock()
+		<-refresh.done
+		return refresh.token, refresh.err
+	}
+	refresh := &tokenRefresh{done: make(chan struct{})}
+	st.inflight = refresh
+	st.mu.Unlock()
+
+	fmt.Println("[TokenFetcher] Session token rejected, fetching a new one")
+	refresh.token, refresh.err = fetchRefreshedToken()
+
+	st.mu.Lock()
+	st.inflight = nil
+	if refresh.err == nil {
+		st.replaced[rejected] = refresh.token
+	}
+	st.mu.Unlock()
+	close(refresh.done)
+
+	return refresh.token, refresh.err
+}
@@ -0,0 +1,144 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// useTestSessionTokens starts the test with no replaced tokens and fetches replacements with fetch
+func useTestSessionTokens(t *testing.T, fetch func() (string, error)) {
+	globalSessionTokens.mu.Lock()
+	savedReplaced := globalSessionTokens.replaced
+	globalSessionTokens.replaced = make(map[string]string)
+	globalSessionTokens.mu.Unlock()
+	savedFetch := fetchRefreshedToken
+	fetchRefreshedToken = fetch
+
+	t.Cleanup(func() {
+		globalSessionTokens.mu.Lock()
+		globalSessionTokens.replaced = savedReplaced
+		globalSessionTokens.mu.Unlock()
+		fetchRefreshedToken = savedFetch
+	})
+}
+
+func TestCurrentSessionToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		replaced map[string]string
+		token    string
+		want     string
+	}{
+		{"never replaced", map[string]string{"a": "b"}, "x", "x"},
+		{"replaced", map[string]string{"a": "b"}, "a", "b"},
+		{"replaced twice", map[string]string{"a": "b", "b": "c"}, "a", "c"},
+		{"newest", map[string]string{"a": "b", "b": "c"}, "c", "c"},
+		{"cycle", map[string]string{"a": "b", "b": "a"}, "a", "b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestSessionTokens(t, nil)
+			globalSessionTokens.replaced = tt.replaced
+			if got := CurrentSessionToken(tt.token); got != tt.want {
+				t.Errorf("CurrentSessionToken(%q) = %q, want %q", tt.token, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefreshSessionTokenSingleFlight(t *testing.T) {
+	var fetches atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	useTestSessionTokens(t, func() (string, error) {
+		if fetches.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return "new", nil
+	})
+
+	const callers = 8
+	var wg sync.WaitGroup
+	tokens := make([]string, callers)
+	errs := make([]error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], errs[i] = RefreshSessionToken("old")
+		}(i)
+	}
+
+	<-started
+	// Give the other callers time to find the refresh in flight
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetched %d tokens, want 1", n)
+	}
+	for i := range tokens {
+		if tokens[i] != "new" || errs[i] != nil {
+			t.Errorf("caller %d got %q, %v; want new", i, tokens[i], errs[i])
+		}
+	}
+
+	// A batch still holding the rejected token gets the replacement without another fetch
+	if token, err := RefreshSessionToken("old"); token != "new" || err != nil {
+		t.Errorf("second refresh got %q, %v; want new", token, err)
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetched %d tokens after the second refresh, want 1", n)
+	}
+	if got := CurrentSessionToken("old"); got != "new" {
+		t.Errorf("CurrentSessionToken(old) = %q, want new", got)
+	}
+}
+
+func TestRefreshSessionTokenError(t *testing.T) {
+	fetchErr := errors.New("token fetcher failed")
+	var fetches atomic.Int32
+	useTestSessionTokens(t, func() (string, error) {
+		if fetches.Add(1) == 1 {
+			return "", fetchErr
+		}
+		return "new", nil
+	})
+
+	if _, err := RefreshSessionToken("old"); err != fetchErr {
+		t.Fatalf("got %v, want the fetch error", err)
+	}
+	if got := CurrentSessionToken("old"); got != "old" {
+		t.Errorf("failed refresh replaced the token with %q", got)
+	}
+	if token, err := RefreshSessionToken("old"); token != "new" || err != nil {
+		t.Errorf("retry got %q, %v; want new", token, err)
+	}
+}
+
+func TestIsAuthError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&httpStatusError{StatusCode: http.StatusUnauthorized}, true},
+		{fmt.Errorf("download: %w", &httpStatusError{StatusCode: http.StatusForbidden}), true},
+		{&httpStatusError{StatusCode: http.StatusTooManyRequests}, false},
+		{errors.New("401 Unauthorized"), false},
+		{nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := isAuthError(tt.err); got != tt.want {
+			t.Errorf("isAuthError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
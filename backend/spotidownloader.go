@@ -2,24 +2,43 @@ package backend
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
 
 const (
 	spotidownloaderAPIBase = "https://api.spotidownloader.com"
+
+	// Suffix for in-progress downloads; the file is renamed once complete
+	partFileSuffix = ".part"
 )
 
+var errRangeNotSatisfiable = errors.New("partial download can't be resumed")
+
 type SpotiDownloader struct {
-	sessionToken string
-	httpClient   *http.Client
+	sessionToken  string
+	httpClient    *http.Client
+	ctx           context.Context
+	itemID        string // Queue item that receives transfer progress
+	verifyRetries int    // Re-downloads allowed when a file fails the integrity check
+	retryPolicy   RetryPolicy
+	providerOrder []string          // Download providers to try, in order
+	formatPolicy  string            // One of the FormatPolicy constants, derived from the audio format when empty
+	pathData      *PathTemplateData // Values for the filename template, built from the track arguments when nil
+	filesystem    string            // Filesystem file names must be valid on
+	artists       []string          // Individual track artists for multi-value artist tags
+	joinArtists   bool              // Tag only the joined artist string
+	extendedTags  ExtendedTags      // Spotify identifiers and release details to embed
+	baseDir       string            // Folder the output folder was rendered below, searched for existing files
 }
 
 type FlacAvailableRequest struct {
@@ -42,26 +61,164 @@ type DownloadResponse struct {
 
 func NewSpotiDownloader(sessionToken string) *SpotiDownloader {
 	return &SpotiDownloader{
-		sessionToken: sessionToken,
+		sessionToken: CurrentSessionToken(sessionToken),
 		httpClient: &http.Client{
 			Timeout: 60 * time.Second,
 		},
+		verifyRetries: 1,
+		retryPolicy:   DefaultRetryPolicy,
+	}
+}
+
+// WithContext returns a copy of the downloader whose requests are bound to ctx
+func (s *SpotiDownloader) WithContext(ctx context.Context) *SpotiDownloader {
+	copied := *s
+	copied.ctx = ctx
+	return &copied
+}
+
+// WithItemID returns a copy of the downloader that reports transfer progress to a queue item
+func (s *SpotiDownloader) WithItemID(itemID string) *SpotiDownloader {
+	copied := *s
+	copied.itemID = itemID
+	return &copied
+}
+
+// WithVerifyRetries returns a copy of the downloader that re-downloads a corrupt file up to retries times
+func (s *SpotiDownloader) WithVerifyRetries(retries int) *SpotiDownloader {
+	copied := *s
+	copied.verifyRetries = retries
+	return &copied
+}
+
+// WithRetryPolicy returns a copy of the downloader that retries failed requests according to policy
+func (s *SpotiDownloader) WithRetryPolicy(policy RetryPolicy) *SpotiDownloader {
+	copied := *s
+	copied.retryPolicy = policy
+	return &copied
+}
+
+// WithProviderOrder returns a copy of the downloader that tries the named download providers in order
+func (s *SpotiDownloader) WithProviderOrder(order []string) *SpotiDownloader {
+	copied := *s
+	copied.providerOrder = append([]string(nil), order...)
+	return &copied
+}
+
+// WithFormatPolicy returns a copy of the downloader that selects formats according to policy
+func (s *SpotiDownloader) WithFormatPolicy(policy string) *SpotiDownloader {
+	copied := *s
+	copied.formatPolicy = policy
+	return &copied
+}
+
+// WithPathData returns a copy of the downloader that names files from data, so fields such as
+// {playlist} or {album_type} that DownloadByISRC doesn't take as arguments are available to the template
+func (s *SpotiDownloader) WithPathData(data PathTemplateData) *SpotiDownloader {
+	copied := *s
+	copied.pathData = &data
+	return &copied
+}
+
+// WithFilesystem returns a copy of the downloader that names files for the given filesystem
+func (s *SpotiDownloader) WithFilesystem(filesystem string) *SpotiDownloader {
+	copied := *s
+	copied.filesystem = filesystem
+	return &copied
+}
+
+// WithArtists returns a copy of the downloader that tags each of artists as a separate artist value.
+// Without it, files are tagged with the single artist string passed to DownloadByISRC.
+func (s *SpotiDownloader) WithArtists(artists []string) *SpotiDownloader {
+	copied := *s
+	copied.artists = append([]string(nil), artists...)
+	return &copied
+}
+
+// WithJoinedArtists returns a copy of the downloader that tags the joined artist string
+// instead of one value per artist, for players that only show the first value
+func (s *SpotiDownloader) WithJoinedArtists(join bool) *SpotiDownloader {
+	copied := *s
+	copied.joinArtists = join
+	return &copied
+}
+
+// WithExtendedTags returns a copy of the downloader that also embeds the Spotify identifiers
+// and release details in tags. The track ID and original date default to the DownloadByISRC arguments.
+func (s *SpotiDownloader) WithExtendedTags(tags ExtendedTags) *SpotiDownloader {
+	copied := *s
+	copied.extendedTags = tags
+	return &copied
+}
+
+// WithBaseDir returns a copy of the downloader that looks for existing copies of a track in dir
+// (and the library) instead of only in the rendered output folder
+func (s *SpotiDownloader) WithBaseDir(dir string) *SpotiDownloader {
+	copied := *s
+	copied.baseDir = dir
+	return &copied
+}
+
+// withRetry runs fn under the downloader's retry policy, surfacing the attempt count on the queue item
+func (s *SpotiDownloader) withRetry(operation string, fn func() error) error {
+	return s.retryPolicy.Do(s.context(), func(attempt int, err error, delay time.Duration) {
+		fmt.Printf("[Retry] %s failed (%v), attempt %d/%d in %s\n", operation, err, attempt, s.retryPolicy.MaxAttempts, delay.Round(time.Millisecond))
+		if s.itemID != "" {
+			SetItemAttempt(s.itemID, attempt, s.retryPolicy.MaxAttempts)
+		}
+	}, fn)
+}
+
+// withAuthRetry is withRetry for SpotiDownloader API calls and transfers. When the session token is rejected,
+// the token is refreshed once and the call repeated without counting against the retry policy.
+func (s *SpotiDownloader) withAuthRetry(operation string, fn func() error) error {
+	refreshed := false
+	return s.withRetry(operation, func() error {
+		err := fn()
+		if err == nil || refreshed || !isAuthError(err) {
+			return err
+		}
+		refreshed = true
+
+		token, refreshErr := RefreshSessionToken(CurrentSessionToken(s.sessionToken))
+		if refreshErr != nil {
+			return fmt.Errorf("%v (session token refresh failed: %v)", err, refreshErr)
+		}
+		s.sessionToken = token
+		return fn()
+	})
+}
+
+func (s *SpotiDownloader) context() context.Context {
+	if s.ctx != nil {
+		return s.ctx
 	}
+	return context.Background()
 }
 
 func (s *SpotiDownloader) IsFlacAvailable(trackID string) (bool, error) {
+	var available bool
+	err := s.withAuthRetry("FLAC availability check", func() error {
+		var err error
+		available, err = s.isFlacAvailableOnce(trackID)
+		return err
+	})
+	return available, err
+}
+
+func (s *SpotiDownloader) isFlacAvailableOnce(trackID string) (bool, error) {
 	reqBody := FlacAvailableRequest{ID: trackID}
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
 		return false, err
 	}
 
-	req, err := http.NewRequest("POST", spotidownloaderAPIBase+"/isFlacAvailable", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(s.context(), "POST", spotidownloaderAPIBase+"/isFlacAvailable", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return false, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+s.sessionToken)
+	req.Header.Set("Authorization", "Bearer "+CurrentSessionToken(s.sessionToken))
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Origin", "https://spotidownloader.com")
 	req.Header.Set("Referer", "https://spotidownloader.com/")
@@ -74,7 +231,7 @@ func (s *SpotiDownloader) IsFlacAvailable(trackID string) (bool, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return false, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return false, newHTTPStatusError(resp, "API returned status", string(body))
 	}
 
 	// Read body first to handle encoding issues
@@ -84,7 +241,7 @@ func (s *SpotiDownloader) IsFlacAvailable(trackID string) (bool, error) {
 	}
 
 	if len(body) == 0 {
-		return false, fmt.Errorf("API returned empty response")
+		return false, errEmptyResponse
 	}
 
 	var result FlacAvailableResponse
@@ -101,18 +258,28 @@ func (s *SpotiDownloader) IsFlacAvailable(trackID string) (bool, error) {
 }
 
 func (s *SpotiDownloader) GetDownloadLink(trackID string) (*DownloadResponse, error) {
+	var result *DownloadResponse
+	err := s.withAuthRetry("Download link request", func() error {
+		var err error
+		result, err = s.getDownloadLinkOnce(trackID)
+		return err
+	})
+	return result, err
+}
+
+func (s *SpotiDownloader) getDownloadLinkOnce(trackID string) (*DownloadResponse, error) {
 	reqBody := DownloadRequest{ID: trackID}
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", spotidownloaderAPIBase+"/download", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(s.context(), "POST", spotidownloaderAPIBase+"/download", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+s.sessionToken)
+	req.Header.Set("Authorization", "Bearer "+CurrentSessionToken(s.sessionToken))
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Origin", "https://spotidownloader.com")
 	req.Header.Set("Referer", "https://spotidownloader.com/")
@@ -125,7 +292,7 @@ func (s *SpotiDownloader) GetDownloadLink(trackID string) (*DownloadResponse, er
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return nil, newHTTPStatusError(resp, "API returned status", string(body))
 	}
 
 	// Read body first to handle encoding issues and provide better error messages
@@ -135,7 +302,7 @@ func (s *SpotiDownloader) GetDownloadLink(trackID string) (*DownloadResponse, er
 	}
 
 	if len(body) == 0 {
-		return nil, fmt.Errorf("API returned empty response")
+		return nil, errEmptyResponse
 	}
 
 	var result DownloadResponse
@@ -155,8 +322,48 @@ func (s *SpotiDownloader) GetDownloadLink(trackID string) (*DownloadResponse, er
 	return &result, nil
 }
 
+// DownloadFile downloads downloadURL to outputPath.
+// Data is written to outputPath + ".part" and resumed with a Range request if a previous attempt was interrupted.
+// The part file is renamed to outputPath only once its size matches the size announced by the server.
 func (s *SpotiDownloader) DownloadFile(downloadURL, outputPath string) error {
-	req, err := http.NewRequest("GET", downloadURL, nil)
+	// Create output directory if it doesn't exist
+	dir := filepath.Dir(outputPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	partPath := outputPath + partFileSuffix
+
+	// Each retry resumes from whatever the previous attempt left in the part file.
+	// A rejected session token is refreshed once, like the API calls.
+	err := s.withAuthRetry("Download", func() error {
+		var offset int64
+		if info, err := os.Stat(partPath); err == nil {
+			offset = info.Size()
+		}
+
+		err := s.downloadToPart(downloadURL, partPath, offset)
+		if err == errRangeNotSatisfiable {
+			// The part file doesn't match the remote file anymore, start over
+			fmt.Printf("Partial file %s can't be resumed, restarting download\n", partPath)
+			os.Remove(partPath)
+			err = s.downloadToPart(downloadURL, partPath, 0)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(partPath, outputPath); err != nil {
+		return fmt.Errorf("failed to move completed download into place: %w", err)
+	}
+	return nil
+}
+
+// downloadToPart fetches downloadURL into partPath, requesting only the bytes after offset
+func (s *SpotiDownloader) downloadToPart(downloadURL, partPath string, offset int64) error {
+	req, err := http.NewRequestWithContext(s.context(), "GET", downloadURL, nil)
 	if err != nil {
 		return err
 	}
@@ -164,50 +371,247 @@ func (s *SpotiDownloader) DownloadFile(downloadURL, outputPath string) error {
 	req.Header.Set("Referer", "https://spotidownloader.com/")
 	req.Header.Set("Origin", "https://spotidownloader.com")
 	// Some download links require the same bearer token used for the API calls.
-	if s.sessionToken != "" {
-		req.Header.Set("Authorization", "Bearer "+s.sessionToken)
+	// The link may have been resolved on a copy of the downloader that refreshed the token since.
+	if token := CurrentSessionToken(s.sessionToken); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
 	}
 
+	// Respect the per-host concurrency limit shared by all scheduler workers
+	release, err := acquireHostSlot(s.context(), req.URL.Host)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	var expectedSize int64 = -1
+	flags := os.O_CREATE | os.O_WRONLY
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			return errRangeNotSatisfiable
+		}
+		fmt.Printf("Resuming download at %.2f MB\n", float64(offset)/(1024*1024))
+		flags |= os.O_APPEND
+		expectedSize = total
+		if expectedSize < 0 && resp.ContentLength >= 0 {
+			expectedSize = offset + resp.ContentLength
+		}
+	case http.StatusOK:
+		// Server ignored the Range header (or none was sent), rewrite the whole file
+		offset = 0
+		flags |= os.O_TRUNC
+		expectedSize = resp.ContentLength
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The part file may already hold the whole file
+		if _, total, ok := parseContentRange(resp.Header.Get("Content-Range")); ok && total == offset {
+			return nil
+		}
+		return errRangeNotSatisfiable
+	default:
 		// Read a small portion of the body to surface server error details without buffering the whole file
 		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-		return fmt.Errorf("failed to download file: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		return newHTTPStatusError(resp, "failed to download file: status", string(body))
 	}
 
-	// Create output directory if it doesn't exist
-	dir := filepath.Dir(outputPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	out, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
 		return err
 	}
 
-	// Create the file
-	out, err := os.Create(outputPath)
+	// Use ProgressWriter to track download progress, counting bytes already on disk
+	progressWriter := NewProgressWriterWithID(out, s.itemID)
+	progressWriter.total = offset
+	progressWriter.lastPrinted = offset
+	progressWriter.lastBytes = offset
+
+	// Write the body to file with progress tracking
+	_, copyErr := io.Copy(progressWriter, resp.Body)
+	closeErr := out.Close()
+	if copyErr != nil {
+		return copyErr
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	info, err := os.Stat(partPath)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
+	if expectedSize >= 0 && info.Size() != expectedSize {
+		return fmt.Errorf("%w: got %d of %d bytes", errIncompleteDownload, info.Size(), expectedSize)
+	}
+	if info.Size() == 0 {
+		return errEmptyDownload
+	}
 
-	// Use ProgressWriter to track download progress
-	progressWriter := NewProgressWriter(out)
+	// Print final progress
+	mbDownloaded := float64(progressWriter.GetTotal()) / (1024 * 1024)
+	fmt.Printf("\rDownloaded: %.2f MB - Complete\n", mbDownloaded)
 
-	// Write the body to file with progress tracking
-	_, err = io.Copy(progressWriter, resp.Body)
+	return nil
+}
 
-	// Print final progress
-	if err == nil {
-		mbDownloaded := float64(progressWriter.GetTotal()) / (1024 * 1024)
-		fmt.Printf("\rDownloaded: %.2f MB - Complete\n", mbDownloaded)
+// parseContentRange parses "bytes start-end/total" or "bytes */total".
+// total is -1 when the server reports it as unknown ("*").
+func parseContentRange(header string) (start, total int64, ok bool) {
+	header = strings.TrimSpace(header)
+	if !strings.HasPrefix(header, "bytes ") {
+		return 0, 0, false
+	}
+	spec := strings.TrimPrefix(header, "bytes ")
+
+	slash := strings.LastIndex(spec, "/")
+	if slash < 0 {
+		return 0, 0, false
+	}
+	rangePart, totalPart := spec[:slash], spec[slash+1:]
+
+	total = -1
+	if totalPart != "*" {
+		n, err := strconv.ParseInt(totalPart, 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+		total = n
+	}
+
+	if rangePart == "*" {
+		return 0, total, true
+	}
+	dash := strings.Index(rangePart, "-")
+	if dash < 0 {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(rangePart[:dash], 10, 64)
+	if err != nil {
+		return 0, 0, false
 	}
+	return start, total, true
+}
+
+// Name implements DownloadProvider
+func (s *SpotiDownloader) Name() string {
+	return SpotiDownloaderProviderName
+}
 
+// Resolve implements DownloadProvider using the SpotiDownloader download links for the Spotify track
+func (s *SpotiDownloader) Resolve(ctx context.Context, track ProviderTrack) ([]Candidate, error) {
+	downloadResp, err := s.WithContext(ctx).GetDownloadLink(track.SpotifyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get download link: %v", err)
+	}
+
+	var candidates []Candidate
+	if downloadResp.LinkFlac != "" {
+		candidates = append(candidates, Candidate{Provider: SpotiDownloaderProviderName, URL: downloadResp.LinkFlac, Format: "flac"})
+	}
+	if downloadResp.Link != "" {
+		candidates = append(candidates, Candidate{Provider: SpotiDownloaderProviderName, URL: downloadResp.Link, Format: "mp3"})
+	}
+	return candidates, nil
+}
+
+// Fetch implements DownloadProvider by streaming the candidate to w
+func (s *SpotiDownloader) Fetch(ctx context.Context, candidate Candidate, w io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", candidate.URL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	release, err := acquireHostSlot(ctx, req.URL.Host)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return newHTTPStatusError(resp, "failed to download file: status", string(body))
+	}
+
+	_, err = io.Copy(w, resp.Body)
 	return err
 }
 
+// FetchToFile downloads the candidate with resume and retry support
+func (s *SpotiDownloader) FetchToFile(ctx context.Context, candidate Candidate, outputPath string) error {
+	return s.WithContext(ctx).DownloadFile(candidate.URL, outputPath)
+}
+
+// downloadProviders returns the configured providers in priority order, skipping unknown names
+func (s *SpotiDownloader) downloadProviders() []DownloadProvider {
+	order := s.providerOrder
+	if len(order) == 0 {
+		order = DefaultProviderOrder
+	}
+
+	var providers []DownloadProvider
+	seen := make(map[string]bool)
+	for _, name := range order {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		if name == SpotiDownloaderProviderName {
+			providers = append(providers, s)
+			continue
+		}
+		provider, exists := getDownloadProvider(name)
+		if !exists {
+			fmt.Printf("[Provider] Unknown download provider %q, skipping\n", name)
+			continue
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+// fetchCandidate downloads a candidate to outputPath and makes sure it is valid audio before it gets tagged
+func (s *SpotiDownloader) fetchCandidate(provider DownloadProvider, candidate Candidate, outputPath string) error {
+	for attempt := 0; ; attempt++ {
+		var err error
+		if ff, ok := provider.(fileFetcher); ok {
+			err = ff.FetchToFile(s.context(), candidate, outputPath)
+		} else {
+			err = fetchToPart(s.context(), provider, candidate, outputPath, s.itemID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to download file: %v", err)
+		}
+
+		verifyErr := VerifyAudioFile(outputPath)
+		if verifyErr == nil {
+			return nil
+		}
+
+		os.Remove(outputPath)
+		if attempt >= s.verifyRetries {
+			return fmt.Errorf("integrity check failed: %v", verifyErr)
+		}
+		fmt.Printf("Integrity check failed (%v), downloading again\n", verifyErr)
+	}
+}
+
 func (s *SpotiDownloader) DownloadByISRC(
 	trackID string,
 	isrc string,
@@ -231,55 +635,101 @@ func (s *SpotiDownloader) DownloadByISRC(
 	// Only normalize path separators for user's download path
 	outputDir = NormalizePath(outputDir)
 
-	// Get download links
-	downloadResp, err := s.GetDownloadLink(trackID)
+	policy, err := ResolveFormatPolicy(s.formatPolicy, audioFormat)
 	if err != nil {
-		return "", fmt.Errorf("failed to get download link: %v", err)
-	}
-
-	// Select the appropriate download link based on format
-	var downloadURL string
-	var fileExt string
-
-	if audioFormat == "flac" && downloadResp.LinkFlac != "" {
-		downloadURL = downloadResp.LinkFlac
-		fileExt = ".flac"
-	} else {
-		downloadURL = downloadResp.Link
-		fileExt = ".mp3"
-	}
-
-	if downloadURL == "" {
-		return "", fmt.Errorf("no download link available")
+		return "", err
 	}
 
-	// Build filename
 	// Check if file with same ISRC already exists
 	if isrc != "" {
-		if existingFile, exists := CheckISRCExists(outputDir, isrc, audioFormat); exists {
+		checkDir := outputDir
+		if s.baseDir != "" {
+			checkDir = s.baseDir
+		}
+		if existingFile, exists := CheckISRCExists(checkDir, isrc, audioFormat); exists {
 			fmt.Printf("File with ISRC %s already exists: %s\n", isrc, existingFile)
 			return "EXISTS:" + existingFile, nil
 		}
 	}
 
-	filename := BuildFilename(trackName, artistName, albumName, albumArtist, releaseDate, discNumber, filenameFormat, includeTrackNumber, position, useAlbumTrackNumber)
-	filename = SanitizeFilename(filename) + fileExt
+	filename := PathTemplate{Filename: filenameFormat, TrackNumber: includeTrackNumber, Filesystem: s.filesystem}.FileName(s.trackPathData(trackID, isrc, trackName, artistName, albumName, albumArtist, releaseDate, position, actualTrackNumber, discNumber, useAlbumTrackNumber))
 
-	outputPath := filepath.Join(outputDir, filename)
+	track := ProviderTrack{
+		SpotifyID: trackID,
+		ISRC:      isrc,
+		Title:     trackName,
+		Artist:    artistName,
+		Album:     albumName,
+	}
 
-	// Check if file already exists by filename
-	if fileInfo, err := os.Stat(outputPath); err == nil && fileInfo.Size() > 0 {
-		return "EXISTS:" + outputPath, nil
+	// Try each provider in priority order until one delivers a valid file
+	providers := s.downloadProviders()
+	if len(providers) == 0 {
+		return "", fmt.Errorf("no download providers configured")
 	}
 
-	// Download the file
-	if err := s.DownloadFile(downloadURL, outputPath); err != nil {
-		return "", fmt.Errorf("failed to download file: %v", err)
+	var outputPath string
+	var providerErrs []string
+	for _, provider := range providers {
+		candidates, err := provider.Resolve(s.context(), track)
+		if err == nil && len(candidates) == 0 {
+			err = fmt.Errorf("no download link available")
+		}
+		var candidate Candidate
+		if err == nil {
+			var ok bool
+			if candidate, ok = selectCandidate(candidates, policy); !ok {
+				err = fmt.Errorf("no download link available")
+				if policy == FormatPolicyFlacOnly {
+					err = fmt.Errorf("FLAC is not available for this track")
+				}
+			}
+		}
+
+		if err == nil {
+			if s.itemID != "" {
+				SetItemFormat(s.itemID, policy, candidate.Format)
+			}
+			if policy == FormatPolicyPreferFlac && candidate.Format != "flac" {
+				fmt.Printf("FLAC not available from %s, falling back to %s\n", provider.Name(), strings.ToUpper(candidate.Format))
+			}
+
+			fileName, err := FitFilename(outputDir, filename, "."+candidate.Format, s.filesystem)
+			if err != nil {
+				return "", err
+			}
+			outputPath = filepath.Join(outputDir, fileName)
+
+			// Check if file already exists by filename
+			if TrackFileExists(outputPath, isrc) {
+				return "EXISTS:" + outputPath, nil
+			}
+			if info, statErr := os.Stat(outputPath); statErr == nil && info.Size() > 0 {
+				// A different recording with the same name, e.g. two long titles shortened alike
+				outputPath = UniquePath(outputPath)
+			}
+
+			err = s.fetchCandidate(provider, candidate, outputPath)
+		}
+		if err == nil {
+			break
+		}
+
+		outputPath = ""
+		if len(providers) == 1 {
+			return "", err
+		}
+		fmt.Printf("[Provider] %s failed: %v\n", provider.Name(), err)
+		providerErrs = append(providerErrs, fmt.Sprintf("%s: %v", provider.Name(), err))
+	}
+	if outputPath == "" {
+		return "", fmt.Errorf("all download providers failed: %s", strings.Join(providerErrs, "; "))
 	}
 
 	// Download cover image if provided
 	var coverPath string
 	if coverURL != "" {
+		var err error
 		coverPath, err = s.downloadCoverImage(coverURL, outputDir, embedMaxQualityCover)
 		if err != nil {
 			fmt.Printf("Warning: Failed to download cover image: %v\n", err)
@@ -287,18 +737,33 @@ func (s *SpotiDownloader) DownloadByISRC(
 		}
 	}
 
+	extended := s.extendedTags
+	if extended.SpotifyTrackID == "" && trackID != isrc {
+		extended.SpotifyTrackID = trackID
+	}
+	if extended.OriginalDate == "" {
+		extended.OriginalDate = releaseDate
+	}
+	description := "https://github.com/afkarxyz/SpotiDownloader"
+	if extended.SpotifyTrackID != "" {
+		description = "https://open.spotify.com/track/" + extended.SpotifyTrackID
+	}
+
 	// Embed metadata for both MP3 and FLAC
 	metadata := Metadata{
-		Title:       trackName,
-		Artist:      artistName,
-		Album:       albumName,
-		AlbumArtist: albumArtist,
-		Date:        releaseDate, // Recorded date (full date YYYY-MM-DD)
-		TrackNumber: actualTrackNumber,
-		TotalTracks: totalTracks, // Total tracks in album from Spotify
-		DiscNumber:  discNumber,
-		ISRC:        isrc,
-		Description: "https://github.com/afkarxyz/SpotiDownloader",
+		Title:        trackName,
+		Artist:       artistName,
+		Artists:      s.artists,
+		JoinArtists:  s.joinArtists,
+		Album:        albumName,
+		AlbumArtist:  albumArtist,
+		Date:         releaseDate, // Recorded date (full date YYYY-MM-DD)
+		TrackNumber:  actualTrackNumber,
+		TotalTracks:  totalTracks, // Total tracks in album from Spotify
+		DiscNumber:   discNumber,
+		ISRC:         isrc,
+		Description:  description,
+		ExtendedTags: extended,
 	}
 
 	if err := EmbedMetadata(outputPath, metadata, coverPath); err != nil {
@@ -310,7 +775,13 @@ func (s *SpotiDownloader) DownloadByISRC(
 		os.Remove(coverPath)
 	}
 
-	if isrc != "" {
+	// trackID falls back to the ISRC when the Spotify ID is unknown
+	spotifyID := trackID
+	if trackID == isrc {
+		spotifyID = ""
+	}
+	if err := IndexLibraryFile(outputPath, spotifyID); err != nil {
+		fmt.Printf("[Library] Failed to index %s: %v\n", outputPath, err)
 		MarkISRCIndexDirty(outputDir, audioFormat)
 	}
 
@@ -335,9 +806,8 @@ func (s *SpotiDownloader) downloadCoverImage(coverURL, outputDir string, embedMa
 		return "", fmt.Errorf("failed to download cover: status %d", resp.StatusCode)
 	}
 
-	// Create temp file for cover
-	coverPath := filepath.Join(outputDir, ".temp_cover.jpg")
-	out, err := os.Create(coverPath)
+	// Create temp file for cover (unique per download so concurrent workers don't clobber each other)
+	out, err := os.CreateTemp(outputDir, ".temp_cover-*.jpg")
 	if err != nil {
 		return "", err
 	}
@@ -345,70 +815,11 @@ func (s *SpotiDownloader) downloadCoverImage(coverURL, outputDir string, embedMa
 
 	_, err = io.Copy(out, resp.Body)
 	if err != nil {
+		os.Remove(out.Name())
 		return "", err
 	}
 
-	return coverPath, nil
-}
-
-// Helper function to sanitize filename
-func SanitizeFilename(filename string) string {
-	// Replace forward slash with space (more natural than underscore)
-	result := strings.ReplaceAll(filename, "/", " ")
-
-	// Remove other invalid filesystem characters (replace with space)
-	invalid := []string{"\\", ":", "*", "?", "\"", "<", ">", "|"}
-	for _, char := range invalid {
-		result = strings.ReplaceAll(result, char, " ")
-	}
-
-	// Remove control characters and emoji
-	var sanitized strings.Builder
-	for _, r := range result {
-		// Keep printable characters and valid Unicode characters
-		// Remove control characters, but keep spaces, tabs, newlines for now
-		if r < 0x20 && r != 0x09 && r != 0x0A && r != 0x0D {
-			continue
-		}
-		if r == 0x7F {
-			continue
-		}
-		// Remove emoji ranges (most emoji are in these ranges)
-		if (r >= 0x1F300 && r <= 0x1F9FF) || // Miscellaneous Symbols and Pictographs, Emoticons
-			(r >= 0x2600 && r <= 0x26FF) || // Miscellaneous Symbols
-			(r >= 0x2700 && r <= 0x27BF) || // Dingbats
-			(r >= 0xFE00 && r <= 0xFE0F) || // Variation Selectors
-			(r >= 0x1F900 && r <= 0x1F9FF) || // Supplemental Symbols and Pictographs
-			(r >= 0x1F600 && r <= 0x1F64F) || // Emoticons
-			(r >= 0x1F680 && r <= 0x1F6FF) || // Transport and Map Symbols
-			(r >= 0x1F1E0 && r <= 0x1F1FF) { // Regional Indicator Symbols (flags)
-			continue
-		}
-		sanitized.WriteRune(r)
-	}
-
-	result = sanitized.String()
-	result = strings.TrimSpace(result)
-
-	// Remove leading/trailing dots and spaces (Windows doesn't allow these)
-	result = strings.Trim(result, ". ")
-
-	// Normalize consecutive spaces to single space
-	re := regexp.MustCompile(`\s+`)
-	result = re.ReplaceAllString(result, " ")
-
-	// Normalize consecutive underscores to single underscore
-	re = regexp.MustCompile(`_+`)
-	result = re.ReplaceAllString(result, "_")
-
-	// Remove leading/trailing underscores and spaces
-	result = strings.Trim(result, "_ ")
-
-	if result == "" {
-		return "Unknown"
-	}
-
-	return result
+	return out.Name(), nil
 }
 
 // NormalizePath only normalizes path separators without modifying folder names
@@ -460,63 +871,28 @@ func sanitizeFolderName(name string) string {
 	return SanitizeFilename(name)
 }
 
-// Helper function to build filename
-func BuildFilename(trackName, artistName, albumName, albumArtist, releaseDate string, discNumber int, format string, includeTrackNumber bool, position int, useAlbumTrackNumber bool) string {
-	safeTitle := SanitizeFilename(trackName)
-	safeArtist := SanitizeFilename(artistName)
-	safeAlbum := SanitizeFilename(albumName)
-	safeAlbumArtist := SanitizeFilename(albumArtist)
-
-	// Extract year from release date (format: YYYY-MM-DD or YYYY)
-	year := ""
-	if len(releaseDate) >= 4 {
-		year = releaseDate[:4]
+// trackPathData returns the filename template values set with WithPathData, or builds them from the track arguments
+func (s *SpotiDownloader) trackPathData(trackID, isrc, trackName, artistName, albumName, albumArtist, releaseDate string, position, albumTrackNumber, discNumber int, useAlbumTrackNumber bool) PathTemplateData {
+	if s.pathData != nil {
+		return *s.pathData
 	}
 
-	var filename string
-
-	// Check if format is a template (contains {})
-	if strings.Contains(format, "{") {
-		filename = format
-		filename = strings.ReplaceAll(filename, "{title}", safeTitle)
-		filename = strings.ReplaceAll(filename, "{artist}", safeArtist)
-		filename = strings.ReplaceAll(filename, "{album}", safeAlbum)
-		filename = strings.ReplaceAll(filename, "{album_artist}", safeAlbumArtist)
-		filename = strings.ReplaceAll(filename, "{year}", year)
-
-		// Handle disc number
-		if discNumber > 0 {
-			filename = strings.ReplaceAll(filename, "{disc}", fmt.Sprintf("%d", discNumber))
-		} else {
-			filename = strings.ReplaceAll(filename, "{disc}", "")
-		}
-
-		// Handle track number - if position is 0, remove {track} and surrounding separators
-		if position > 0 {
-			filename = strings.ReplaceAll(filename, "{track}", fmt.Sprintf("%02d", position))
-		} else {
-			// Remove {track} with common separators like ". " or " - " or ". "
-			filename = regexp.MustCompile(`\{track\}\.\s*`).ReplaceAllString(filename, "")
-			filename = regexp.MustCompile(`\{track\}\s*-\s*`).ReplaceAllString(filename, "")
-			filename = regexp.MustCompile(`\{track\}\s*`).ReplaceAllString(filename, "")
-		}
-		return filename
+	data := PathTemplateData{
+		Title:       trackName,
+		Artist:      artistName,
+		Album:       albumName,
+		AlbumArtist: albumArtist,
+		ReleaseDate: releaseDate,
+		ISRC:        isrc,
+		Track:       position,
+		Disc:        discNumber,
+		Position:    position,
 	}
-
-	// Legacy format support
-	switch format {
-	case "artist-title":
-		filename = fmt.Sprintf("%s - %s", safeArtist, safeTitle)
-	case "title":
-		filename = safeTitle
-	default: // "title-artist"
-		filename = fmt.Sprintf("%s - %s", safeTitle, safeArtist)
+	if trackID != isrc {
+		data.SpotifyID = trackID
 	}
-
-	// Add track number prefix if enabled (legacy behavior)
-	if includeTrackNumber && position > 0 {
-		filename = fmt.Sprintf("%02d. %s", position, filename)
+	if useAlbumTrackNumber && albumTrackNumber > 0 {
+		data.Track = albumTrackNumber
 	}
-
-	return filename
+	return data
 }
@@ -0,0 +1,60 @@
+package backend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadFileSessionToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		replaced map[string]string // Tokens refreshed before the download starts
+		accepted string
+		want     []string // Bearer tokens the server sees
+	}{
+		{"current token", nil, "old", []string{"old"}},
+		{"refreshed on another copy", map[string]string{"old": "new"}, "new", []string{"new"}},
+		{"rejected transfer refreshes", nil, "new", []string{"old", "new"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestSessionTokens(t, func() (string, error) { return "new", nil })
+			for old, token := range tt.replaced {
+				globalSessionTokens.replaced[old] = token
+			}
+
+			var seen []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				token := r.Header.Get("Authorization")
+				seen = append(seen, token)
+				if token != "Bearer "+tt.accepted {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				w.Write([]byte("audio"))
+			}))
+			defer server.Close()
+
+			outputPath := filepath.Join(t.TempDir(), "track.flac")
+			if err := NewSpotiDownloader("old").DownloadFile(server.URL, outputPath); err != nil {
+				t.Fatal(err)
+			}
+			if data, err := os.ReadFile(outputPath); err != nil || string(data) != "audio" {
+				t.Errorf("downloaded %q, %v", data, err)
+			}
+
+			if len(seen) != len(tt.want) {
+				t.Fatalf("server saw %q, want tokens %q", seen, tt.want)
+			}
+			for i, token := range tt.want {
+				if seen[i] != "Bearer "+token {
+					t.Errorf("request %d sent %q, want Bearer %s", i, seen[i], token)
+				}
+			}
+		})
+	}
+}
@@ -574,6 +574,7 @@ func (m *spotifyAuthManager) fetchPlaylistWithTracks(ctx context.Context, playli
 			tracks = append(tracks, page.tracks...)
 		}
 	}
+	client.fillArtistGenres(ctx, token, tracks)
 
 	cover := ""
 	if len(playlistInfo.Images) > 0 {
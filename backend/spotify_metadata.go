@@ -22,6 +22,7 @@ const (
 	albumBaseURL        = "https://api.spotify.com/v1/albums/%s"
 	trackBaseURL        = "https://api.spotify.com/v1/tracks/%s"
 	artistBaseURL       = "https://api.spotify.com/v1/artists/%s"
+	artistsBaseURL      = "https://api.spotify.com/v1/artists?ids=%s"
 	artistAlbumsBaseURL = "https://api.spotify.com/v1/artists/%s/albums"
 )
 
@@ -29,6 +30,15 @@ var (
 	errInvalidSpotifyURL = errors.New("invalid or unsupported Spotify URL")
 )
 
+// Most artists the several-artists endpoint accepts per request
+const maxArtistsPerRequest = 50
+
+var (
+	// Genres of every artist looked up so far, keyed by artist ID; Spotify albums rarely have genres of their own
+	artistGenreCache = make(map[string][]string)
+	artistGenreLock  sync.Mutex
+)
+
 // SpotifyMetadataClient mirrors the behaviour of Doc/getMetadata.py and interacts with Spotify's web API.
 type SpotifyMetadataClient struct {
 	httpClient     *http.Client
@@ -69,19 +79,22 @@ func NewSpotifyMetadataClient() *SpotifyMetadataClient {
 
 // TrackMetadata mirrors the filtered track payload returned by the Python script.
 type TrackMetadata struct {
-	SpotifyID   string `json:"spotify_id,omitempty"`
-	Artists     string `json:"artists"`
-	Name        string `json:"name"`
-	AlbumName   string `json:"album_name"`
-	AlbumArtist string `json:"album_artist,omitempty"`
-	DurationMS  int    `json:"duration_ms"`
-	Images      string `json:"images"`
-	ReleaseDate string `json:"release_date"`
-	TrackNumber int    `json:"track_number"`
-	TotalTracks int    `json:"total_tracks,omitempty"`
-	DiscNumber  int    `json:"disc_number,omitempty"`
-	ExternalURL string `json:"external_urls"`
-	ISRC        string `json:"isrc"`
+	SpotifyID   string         `json:"spotify_id,omitempty"`
+	Artists     string         `json:"artists"`
+	Name        string         `json:"name"`
+	AlbumName   string         `json:"album_name"`
+	AlbumArtist string         `json:"album_artist,omitempty"`
+	DurationMS  int            `json:"duration_ms"`
+	Images      string         `json:"images"`
+	ReleaseDate string         `json:"release_date"`
+	TrackNumber int            `json:"track_number"`
+	TotalTracks int            `json:"total_tracks,omitempty"`
+	DiscNumber  int            `json:"disc_number,omitempty"`
+	ExternalURL string         `json:"external_urls"`
+	ISRC        string         `json:"isrc"`
+	AlbumID     string         `json:"album_id,omitempty"`
+	AlbumType   string         `json:"album_type,omitempty"`
+	ArtistsData []ArtistSimple `json:"artists_data,omitempty"`
 }
 
 // ArtistSimple holds basic artist info for clickable artists
@@ -112,6 +125,10 @@ type AlbumTrackMetadata struct {
 	ArtistID    string         `json:"artist_id,omitempty"`
 	ArtistURL   string         `json:"artist_url,omitempty"`
 	ArtistsData []ArtistSimple `json:"artists_data,omitempty"`
+	Label       string         `json:"label,omitempty"`
+	Copyright   string         `json:"copyright,omitempty"`
+	TotalDiscs  int            `json:"total_discs,omitempty"`
+	Genres      []string       `json:"genres,omitempty"`
 }
 
 type TrackResponse struct {
@@ -276,12 +293,22 @@ type playlistResponse struct {
 	} `json:"tracks"`
 }
 
+type copyright struct {
+	Text string `json:"text"`
+	Type string `json:"type"` // C for copyright, P for sound recording copyright
+}
+
 type albumResponse struct {
-	Name        string   `json:"name"`
-	ReleaseDate string   `json:"release_date"`
-	TotalTracks int      `json:"total_tracks"`
-	Images      []image  `json:"images"`
-	Artists     []artist `json:"artists"`
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	AlbumType   string      `json:"album_type"`
+	ReleaseDate string      `json:"release_date"`
+	TotalTracks int         `json:"total_tracks"`
+	Label       string      `json:"label"`
+	Copyrights  []copyright `json:"copyrights"`
+	Genres      []string    `json:"genres"`
+	Images      []image     `json:"images"`
+	Artists     []artist    `json:"artists"`
 	Tracks      struct {
 		Items []trackSimplified `json:"items"`
 		Next  string            `json:"next"`
@@ -301,6 +328,7 @@ type artistResponse struct {
 
 type playlistRaw struct {
 	Data         playlistResponse
+	Token        string
 	BatchEnabled bool
 	BatchCount   int
 }
@@ -369,7 +397,7 @@ func (c *SpotifyMetadataClient) getRawSpotifyData(ctx context.Context, parsed sp
 func (c *SpotifyMetadataClient) processSpotifyData(ctx context.Context, raw interface{}) (interface{}, error) {
 	switch payload := raw.(type) {
 	case *playlistRaw:
-		return c.formatPlaylistData(payload), nil
+		return c.formatPlaylistData(ctx, payload), nil
 	case *albumRaw:
 		return c.formatAlbumData(ctx, payload)
 	case *trackFull:
@@ -407,6 +435,7 @@ func (c *SpotifyMetadataClient) fetchPlaylist(ctx context.Context, playlistID, t
 
 	return &playlistRaw{
 		Data:         data,
+		Token:        token,
 		BatchEnabled: batch,
 		BatchCount:   batches,
 	}, nil
@@ -488,7 +517,7 @@ func (c *SpotifyMetadataClient) fetchArtist(ctx context.Context, artistID, token
 	return &artistData, nil
 }
 
-func (c *SpotifyMetadataClient) formatPlaylistData(raw *playlistRaw) PlaylistResponsePayload {
+func (c *SpotifyMetadataClient) formatPlaylistData(ctx context.Context, raw *playlistRaw) PlaylistResponsePayload {
 	var info PlaylistInfoMetadata
 	info.Tracks.Total = raw.Data.Tracks.Total
 	info.Followers.Total = raw.Data.Followers.Total
@@ -509,14 +538,7 @@ func (c *SpotifyMetadataClient) formatPlaylistData(raw *playlistRaw) PlaylistRes
 			artistID = item.Track.Artists[0].ID
 			artistURL = fmt.Sprintf("https://open.spotify.com/artist/%s", item.Track.Artists[0].ID)
 		}
-		artistsData := make([]ArtistSimple, 0, len(item.Track.Artists))
-		for _, a := range item.Track.Artists {
-			artistsData = append(artistsData, ArtistSimple{
-				ID:          a.ID,
-				Name:        a.Name,
-				ExternalURL: fmt.Sprintf("https://open.spotify.com/artist/%s", a.ID),
-			})
-		}
+		artistsData := artistSimples(item.Track.Artists)
 		tracks = append(tracks, AlbumTrackMetadata{
 			SpotifyID:   item.Track.ID,
 			Artists:     joinArtists(item.Track.Artists),
@@ -539,6 +561,8 @@ func (c *SpotifyMetadataClient) formatPlaylistData(raw *playlistRaw) PlaylistRes
 		})
 	}
 
+	c.fillArtistGenres(ctx, raw.Token, tracks)
+
 	return PlaylistResponsePayload{
 		PlaylistInfo: info,
 		TrackList:    tracks,
@@ -565,6 +589,12 @@ func (c *SpotifyMetadataClient) formatAlbumData(ctx context.Context, raw *albumR
 		info.Batch = strconv.Itoa(maxInt(1, raw.BatchCount))
 	}
 
+	totalDiscs := 0
+	for _, item := range raw.Data.Tracks.Items {
+		totalDiscs = maxInt(totalDiscs, item.DiscNumber)
+	}
+	copyrightText := albumCopyright(raw.Data.Copyrights)
+
 	tracks := make([]AlbumTrackMetadata, 0, len(raw.Data.Tracks.Items))
 	cache := make(map[string]string)
 	for _, item := range raw.Data.Tracks.Items {
@@ -583,9 +613,18 @@ func (c *SpotifyMetadataClient) formatAlbumData(ctx context.Context, raw *albumR
 			DiscNumber:  item.DiscNumber,
 			ExternalURL: item.ExternalURL.Spotify,
 			ISRC:        isrc,
+			AlbumType:   raw.Data.AlbumType,
+			AlbumID:     raw.Data.ID,
+			Label:       raw.Data.Label,
+			Copyright:   copyrightText,
+			TotalDiscs:  totalDiscs,
+			Genres:      raw.Data.Genres,
+			ArtistsData: artistSimples(item.Artists),
 		})
 	}
 
+	c.fillArtistGenres(ctx, raw.Token, tracks)
+
 	return &AlbumResponsePayload{
 		AlbumInfo: info,
 		TrackList: tracks,
@@ -634,6 +673,10 @@ func (c *SpotifyMetadataClient) formatArtistDiscographyData(ctx context.Context,
 			fmt.Printf("Error getting tracks for album %s: %v\n", alb.Name, err)
 			continue
 		}
+		totalDiscs := 0
+		for _, tr := range tracks {
+			totalDiscs = maxInt(totalDiscs, tr.DiscNumber)
+		}
 
 		for _, tr := range tracks {
 			isrc := c.fetchTrackISRC(ctx, tr.ID, raw.Token, isrcCache)
@@ -642,14 +685,7 @@ func (c *SpotifyMetadataClient) formatArtistDiscographyData(ctx context.Context,
 				artistID = tr.Artists[0].ID
 				artistURL = fmt.Sprintf("https://open.spotify.com/artist/%s", tr.Artists[0].ID)
 			}
-			artistsData := make([]ArtistSimple, 0, len(tr.Artists))
-			for _, a := range tr.Artists {
-				artistsData = append(artistsData, ArtistSimple{
-					ID:          a.ID,
-					Name:        a.Name,
-					ExternalURL: fmt.Sprintf("https://open.spotify.com/artist/%s", a.ID),
-				})
-			}
+			artistsData := artistSimples(tr.Artists)
 			allTracks = append(allTracks, AlbumTrackMetadata{
 				SpotifyID:   tr.ID,
 				Artists:     joinArtists(tr.Artists),
@@ -670,6 +706,8 @@ func (c *SpotifyMetadataClient) formatArtistDiscographyData(ctx context.Context,
 				ArtistID:    artistID,
 				ArtistURL:   artistURL,
 				ArtistsData: artistsData,
+				TotalDiscs:  totalDiscs,
+				Genres:      raw.Artist.Genres,
 			})
 		}
 	}
@@ -714,10 +752,26 @@ func formatTrackData(raw *trackFull) TrackResponse {
 			DiscNumber:  raw.DiscNumber,
 			ExternalURL: raw.ExternalURL.Spotify,
 			ISRC:        raw.ExternalID.ISRC,
+			AlbumID:     raw.Album.ID,
+			AlbumType:   raw.Album.AlbumType,
+			ArtistsData: artistSimples(raw.Artists),
 		},
 	}
 }
 
+// albumCopyright returns the album's copyright line, preferring the © notice over the ℗ one
+func albumCopyright(copyrights []copyright) string {
+	for _, c := range copyrights {
+		if c.Type == "C" {
+			return c.Text
+		}
+	}
+	if len(copyrights) > 0 {
+		return copyrights[0].Text
+	}
+	return ""
+}
+
 func (c *SpotifyMetadataClient) collectAlbumTracks(ctx context.Context, albumID, token string) ([]trackSimplified, error) {
 	url := fmt.Sprintf("%s/tracks?limit=50", fmt.Sprintf(albumBaseURL, albumID))
 	var tracks []trackSimplified
@@ -728,6 +782,71 @@ func (c *SpotifyMetadataClient) collectAlbumTracks(ctx context.Context, albumID,
 	return tracks, nil
 }
 
+// fillArtistGenres gives tracks without genres those of their primary artist.
+// Artists are looked up 50 at a time and cached, so genres never fail a metadata fetch.
+func (c *SpotifyMetadataClient) fillArtistGenres(ctx context.Context, token string, tracks []AlbumTrackMetadata) {
+	var ids []string
+	for _, track := range tracks {
+		if len(track.Genres) == 0 && len(track.ArtistsData) > 0 && track.ArtistsData[0].ID != "" {
+			ids = append(ids, track.ArtistsData[0].ID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	genres := c.fetchArtistGenres(ctx, token, ids)
+	for i := range tracks {
+		if len(tracks[i].Genres) == 0 && len(tracks[i].ArtistsData) > 0 {
+			tracks[i].Genres = genres[tracks[i].ArtistsData[0].ID]
+		}
+	}
+}
+
+// fetchArtistGenres returns the genres of the given artists, fetching the ones not cached yet
+func (c *SpotifyMetadataClient) fetchArtistGenres(ctx context.Context, token string, ids []string) map[string][]string {
+	genres := make(map[string][]string, len(ids))
+	var missing []string
+
+	artistGenreLock.Lock()
+	for _, id := range ids {
+		if _, done := genres[id]; done {
+			continue
+		}
+		if cached, ok := artistGenreCache[id]; ok {
+			genres[id] = cached
+		} else {
+			genres[id] = nil
+			missing = append(missing, id)
+		}
+	}
+	artistGenreLock.Unlock()
+
+	for start := 0; start < len(missing) && token != ""; start += maxArtistsPerRequest {
+		batch := missing[start:min(start+maxArtistsPerRequest, len(missing))]
+		var data struct {
+			Artists []struct {
+				ID     string   `json:"id"`
+				Genres []string `json:"genres"`
+			} `json:"artists"`
+		}
+		if err := c.getJSON(ctx, fmt.Sprintf(artistsBaseURL, strings.Join(batch, ",")), token, &data); err != nil {
+			fmt.Printf("[Metadata] Failed to fetch artist genres: %v\n", err)
+			break
+		}
+
+		artistGenreLock.Lock()
+		for _, a := range data.Artists {
+			if a.ID != "" {
+				artistGenreCache[a.ID] = a.Genres
+				genres[a.ID] = a.Genres
+			}
+		}
+		artistGenreLock.Unlock()
+	}
+	return genres
+}
+
 func (c *SpotifyMetadataClient) fetchTrackISRC(ctx context.Context, trackID, token string, cache map[string]string) string {
 	if trackID == "" || token == "" {
 		return ""
@@ -1041,6 +1160,19 @@ func firstImageURL(images []image) string {
 	return images[0].URL
 }
 
+// artistSimples returns the ID, name and link of each artist, in credit order
+func artistSimples(artists []artist) []ArtistSimple {
+	simples := make([]ArtistSimple, 0, len(artists))
+	for _, a := range artists {
+		simples = append(simples, ArtistSimple{
+			ID:          a.ID,
+			Name:        a.Name,
+			ExternalURL: fmt.Sprintf("https://open.spotify.com/artist/%s", a.ID),
+		})
+	}
+	return simples
+}
+
 func joinArtists(artists []artist) string {
 	if len(artists) == 0 {
 		return ""
@@ -1054,6 +1186,32 @@ func joinArtists(artists []artist) string {
 	return strings.Join(names, ", ")
 }
 
+// ExtendedTags returns the Spotify identifiers and release details to embed for the track
+func (t AlbumTrackMetadata) ExtendedTags() ExtendedTags {
+	return ExtendedTags{
+		SpotifyTrackID: t.SpotifyID,
+		SpotifyAlbumID: t.AlbumID,
+		ReleaseType:    t.AlbumType,
+		Label:          t.Label,
+		Copyright:      t.Copyright,
+		TotalDiscs:     t.TotalDiscs,
+		Genres:         t.Genres,
+		OriginalDate:   t.ReleaseDate,
+		DurationMS:     t.DurationMS,
+	}
+}
+
+// ArtistNames returns the names of the track's individual artists, for multi-value artist tags
+func (t AlbumTrackMetadata) ArtistNames() []string {
+	names := make([]string, 0, len(t.ArtistsData))
+	for _, a := range t.ArtistsData {
+		if a.Name != "" {
+			names = append(names, a.Name)
+		}
+	}
+	return names
+}
+
 func firstNonEmpty(values ...string) string {
 	for _, v := range values {
 		if strings.TrimSpace(v) != "" {
@@ -1064,13 +1222,24 @@ func firstNonEmpty(values ...string) string {
 }
 
 func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
 	if value == "" {
 		return 5 * time.Second
 	}
-	secs, err := strconv.Atoi(strings.TrimSpace(value))
+	secs, err := strconv.Atoi(value)
 	if err != nil {
+		// Retry-After may also be an HTTP date
+		if when, err := http.ParseTime(value); err == nil {
+			if d := time.Until(when); d > 0 {
+				return d + time.Second
+			}
+			return time.Second
+		}
 		return 5 * time.Second
 	}
+	if secs < 0 {
+		secs = 0
+	}
 	return time.Duration(secs+1) * time.Second
 }
 
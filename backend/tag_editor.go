@@ -0,0 +1,589 @@
+package backend
+
+import (
+	"encoding/binary"
+	"fmt"
+	pathfilepath "path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	id3v2 "github.com/bogem/id3v2/v2"
+	"github.com/go-flac/flacpicture"
+	"github.com/go-flac/flacvorbis"
+	"github.com/go-flac/go-flac"
+)
+
+// TagField is one tag under its native name: a Vorbis comment field, an ID3v2 frame ID or an MP4 item key.
+// ID3v2 frames that carry a description are keyed "TXXX:<description>", "COMM:<description>" and
+// "USLT:<description>"; MP4 freeform items are keyed "----:<mean>:<name>".
+type TagField struct {
+	Key      string   `json:"key"`
+	Values   []string `json:"values"`
+	ReadOnly bool     `json:"read_only,omitempty"` // Binary data; always kept, but can't be edited as text
+}
+
+// TagPicture describes an embedded picture; pictures are kept as they are when tags are written
+type TagPicture struct {
+	Type        int    `json:"type"` // ID3v2/FLAC picture type, 3 is the front cover
+	MIME        string `json:"mime"`
+	Description string `json:"description,omitempty"`
+	Size        int    `json:"size"`
+}
+
+// FileTags are all tags of an audio file in file order
+type FileTags struct {
+	Path     string       `json:"path"`
+	Format   string       `json:"format"` // flac, mp3 or m4a
+	Fields   []TagField   `json:"fields"`
+	Pictures []TagPicture `json:"pictures,omitempty"`
+
+	id3Version byte // ID3v2 major version of an MP3's tag, 3 or 4
+}
+
+// TagEdit replaces every value of a tag. Key is a native name or one of the format-independent
+// names in tagAliases, such as "albumartist". Empty Values removes the tag.
+type TagEdit struct {
+	Key    string   `json:"key"`
+	Values []string `json:"values"`
+}
+
+// TagWriteRequest applies the same edits to every file
+type TagWriteRequest struct {
+	Files  []string  `json:"files"`
+	Edits  []TagEdit `json:"edits"`
+	DryRun bool      `json:"dry_run"` // Only report the changes
+}
+
+// TagChange is the difference one edit makes to a file
+type TagChange struct {
+	Key string   `json:"key"` // Native name
+	Old []string `json:"old"`
+	New []string `json:"new"`
+}
+
+// TagWriteResult lists the changes made, or that would be made in a dry run, to one file
+type TagWriteResult struct {
+	Path    string      `json:"path"`
+	Changes []TagChange `json:"changes"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// tagAliases maps format-independent names to the native FLAC, MP3 and M4A names
+var tagAliases = map[string][3]string{
+	"title":       {"TITLE", "TIT2", mp4KeyTitle},
+	"artist":      {"ARTIST", "TPE1", mp4KeyArtist},
+	"album":       {"ALBUM", "TALB", mp4KeyAlbum},
+	"albumartist": {"ALBUMARTIST", "TPE2", mp4KeyAlbumArtist},
+	"date":        {"DATE", "TDRC", mp4KeyDate},
+	"tracknumber": {"TRACKNUMBER", "TRCK", mp4KeyTrack},
+	"discnumber":  {"DISCNUMBER", "TPOS", mp4KeyDisc},
+	"genre":       {tagGenre, "TCON", mp4KeyGenre},
+	"composer":    {"COMPOSER", "TCOM", "\xa9wrt"},
+	"comment":     {"COMMENT", "COMM:", "\xa9cmt"},
+	"lyrics":      {"LYRICS", "USLT:", mp4KeyLyrics},
+	"isrc":        {"ISRC", "TSRC", mp4KeyISRC},
+	"label":       {tagLabel, "TPUB", mp4FreeformKey(tagLabel)},
+	"copyright":   {tagCopyright, "TCOP", mp4KeyCopyright},
+}
+
+// MP4 integer items and their value width in bytes; other integer items keep their width
+var mp4IntegerWidths = map[string]int{
+	"cpil": 1, "pgap": 1, "pcst": 1, "rtng": 1, "stik": 1, "hdvd": 1, "tmpo": 2,
+}
+
+const mp4TypeInteger = 21 // Big-endian signed integer
+
+// ReadAllTags returns every tag of a FLAC, MP3 or M4A file
+func ReadAllTags(filePath string) (*FileTags, error) {
+	format := strings.TrimPrefix(strings.ToLower(pathfilepath.Ext(filePath)), ".")
+	tags := &FileTags{Path: filePath, Format: format, Fields: []TagField{}}
+
+	var err error
+	switch format {
+	case "flac":
+		err = readFlacTags(tags)
+	case "mp3":
+		err = readMp3Tags(tags)
+	case "m4a":
+		err = readM4ATags(tags)
+	default:
+		return nil, fmt.Errorf("unsupported file format: %s", pathfilepath.Ext(filePath))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// WriteTags applies the edits to every file, or with DryRun only reports what would change.
+// Files whose tags already match are left untouched.
+func WriteTags(req TagWriteRequest) ([]TagWriteResult, error) {
+	if len(req.Files) == 0 {
+		return nil, fmt.Errorf("no files to tag")
+	}
+	if len(req.Edits) == 0 {
+		return nil, fmt.Errorf("no tag edits")
+	}
+
+	results := make([]TagWriteResult, 0, len(req.Files))
+	written := 0
+	for _, path := range req.Files {
+		result := TagWriteResult{Path: path, Changes: []TagChange{}}
+		changes, err := writeFileTags(path, req.Edits, req.DryRun)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Changes = changes
+			if !req.DryRun && len(changes) > 0 {
+				written++
+			}
+		}
+		results = append(results, result)
+	}
+
+	if !req.DryRun {
+		fmt.Printf("[Tags] Updated %d of %d files\n", written, len(req.Files))
+	}
+	return results, nil
+}
+
+func writeFileTags(path string, edits []TagEdit, dryRun bool) ([]TagChange, error) {
+	current, err := ReadAllTags(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []TagChange
+	for _, edit := range edits {
+		key, err := nativeTagKey(current, edit.Key)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]string, 0, len(edit.Values))
+		for _, value := range edit.Values {
+			if value != "" {
+				values = append(values, value)
+			}
+		}
+
+		old := []string{}
+		for _, field := range current.Fields {
+			if !tagKeysEqual(current.Format, field.Key, key) {
+				continue
+			}
+			if field.ReadOnly {
+				return nil, fmt.Errorf("%s can't be edited as text", field.Key)
+			}
+			old = append(old, field.Values...)
+		}
+		if slices.Equal(old, values) {
+			continue
+		}
+
+		// A later edit of the same tag wins
+		changes = slices.DeleteFunc(changes, func(c TagChange) bool { return tagKeysEqual(current.Format, c.Key, key) })
+		changes = append(changes, TagChange{Key: key, Old: old, New: values})
+	}
+
+	if dryRun || len(changes) == 0 {
+		return changes, nil
+	}
+
+	switch current.Format {
+	case "flac":
+		err = writeFlacTagChanges(path, changes)
+	case "mp3":
+		err = writeMp3TagChanges(path, changes)
+	case "m4a":
+		err = writeM4ATagChanges(path, changes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// nativeTagKey resolves an alias and validates the key for the format of tags
+func nativeTagKey(tags *FileTags, key string) (string, error) {
+	format := tags.Format
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return "", fmt.Errorf("tag key is required")
+	}
+
+	if alias, ok := tagAliases[strings.ToLower(key)]; ok {
+		switch format {
+		case "flac":
+			return alias[0], nil
+		case "mp3":
+			if strings.EqualFold(key, "date") {
+				return id3DateFrame(tags.id3Version), nil
+			}
+			return alias[1], nil
+		default:
+			return mp4DisplayKey(alias[2]), nil
+		}
+	}
+
+	switch format {
+	case "flac":
+		if strings.ContainsRune(key, '=') {
+			return "", fmt.Errorf("invalid Vorbis comment name: %s", key)
+		}
+		return strings.ToUpper(key), nil
+	case "mp3":
+		id, _, hasDescription := strings.Cut(key, ":")
+		described := id == "TXXX" || id == "COMM" || id == "USLT"
+		if len(id) != 4 || (id[0] != 'T' && !described) {
+			return "", fmt.Errorf("%s can't be edited as text", key)
+		}
+		if described != hasDescription {
+			return "", fmt.Errorf("invalid ID3v2 frame key: %s", key)
+		}
+		return key, nil
+	default:
+		if !strings.HasPrefix(key, "----:") && len(mp4NativeKey(key)) != 4 {
+			return "", fmt.Errorf("invalid MP4 item key: %s", key)
+		}
+		if mp4NativeKey(key) == mp4KeyCover {
+			return "", fmt.Errorf("%s can't be edited as text", key)
+		}
+		return key, nil
+	}
+}
+
+// id3DateFrame returns the frame holding the release date: TYER in ID3v2.3 and TDRC in ID3v2.4
+func id3DateFrame(version byte) string {
+	tag := id3v2.NewEmptyTag()
+	tag.SetVersion(version)
+	if tag.Version() == 3 {
+		return tag.CommonID("Year")
+	}
+	return tag.CommonID("Recording time")
+}
+
+// tagKeysEqual compares native keys; Vorbis names and MP4 freeform names ignore case
+func tagKeysEqual(format, a, b string) bool {
+	switch format {
+	case "flac":
+		return strings.EqualFold(a, b)
+	case "m4a":
+		return mp4KeysEqual(mp4NativeKey(a), mp4NativeKey(b))
+	default:
+		return a == b
+	}
+}
+
+// addTagValue appends value to the field with the key, or adds the field
+func (t *FileTags) addTagValue(key, value string, readOnly bool) {
+	for i := range t.Fields {
+		if t.Fields[i].Key == key {
+			t.Fields[i].Values = append(t.Fields[i].Values, value)
+			return
+		}
+	}
+	t.Fields = append(t.Fields, TagField{Key: key, Values: []string{value}, ReadOnly: readOnly})
+}
+
+func readFlacTags(tags *FileTags) error {
+	f, err := flac.ParseFile(tags.Path)
+	if err != nil {
+		return fmt.Errorf("failed to parse FLAC file: %w", err)
+	}
+
+	for _, block := range f.Meta {
+		switch block.Type {
+		case flac.VorbisComment:
+			cmt, err := flacvorbis.ParseFromMetaDataBlock(*block)
+			if err != nil {
+				return fmt.Errorf("failed to parse Vorbis comments: %w", err)
+			}
+			for _, comment := range cmt.Comments {
+				name, value, _ := strings.Cut(comment, "=")
+				tags.addTagValue(strings.ToUpper(name), value, false)
+			}
+		case flac.Picture:
+			pic, err := flacpicture.ParseFromMetaDataBlock(*block)
+			if err != nil {
+				continue
+			}
+			tags.Pictures = append(tags.Pictures, TagPicture{
+				Type:        int(pic.PictureType),
+				MIME:        pic.MIME,
+				Description: pic.Description,
+				Size:        len(pic.ImageData),
+			})
+		}
+	}
+	return nil
+}
+
+func writeFlacTagChanges(path string, changes []TagChange) error {
+	fields := make(map[string][]string, len(changes))
+	for _, change := range changes {
+		fields[strings.ToUpper(change.Key)] = change.New
+	}
+	return updateFlacComments(path, fields)
+}
+
+func readMp3Tags(tags *FileTags) error {
+	tag, err := id3v2.Open(tags.Path, id3v2.Options{Parse: true})
+	if err != nil {
+		return fmt.Errorf("failed to open MP3 file: %w", err)
+	}
+	defer tag.Close()
+	tags.id3Version = tag.Version()
+
+	frames := tag.AllFrames()
+	ids := make([]string, 0, len(frames))
+	for id := range frames {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		for _, frame := range frames[id] {
+			switch f := frame.(type) {
+			case id3v2.TextFrame:
+				for _, value := range splitID3Values(f.Text) {
+					tags.addTagValue(id, value, false)
+				}
+			case id3v2.UserDefinedTextFrame:
+				for _, value := range splitID3Values(f.Value) {
+					tags.addTagValue("TXXX:"+f.Description, value, false)
+				}
+			case id3v2.CommentFrame:
+				tags.addTagValue("COMM:"+f.Description, f.Text, false)
+			case id3v2.UnsynchronisedLyricsFrame:
+				tags.addTagValue("USLT:"+f.ContentDescriptor, f.Lyrics, false)
+			case id3v2.PictureFrame:
+				tags.Pictures = append(tags.Pictures, TagPicture{
+					Type:        int(f.PictureType),
+					MIME:        f.MimeType,
+					Description: f.Description,
+					Size:        len(f.Picture),
+				})
+			default:
+				tags.addTagValue(id, fmt.Sprintf("%d bytes", frame.Size()), true)
+			}
+		}
+	}
+	return nil
+}
+
+// splitID3Values splits the null-separated values of an ID3v2.4 text frame
+func splitID3Values(text string) []string {
+	values := strings.Split(strings.TrimRight(text, "\x00"), "\x00")
+	if len(values) == 1 && values[0] == "" {
+		return nil
+	}
+	return values
+}
+
+func writeMp3TagChanges(path string, changes []TagChange) error {
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		return fmt.Errorf("failed to open MP3 file: %w", err)
+	}
+	defer tag.Close()
+
+	for _, change := range changes {
+		id, description, _ := strings.Cut(change.Key, ":")
+		if len(change.New) > 1 && id != "COMM" && id != "USLT" {
+			// Null-separated multiple values need ID3v2.4
+			tag.SetVersion(4)
+		}
+
+		switch id {
+		case "TXXX":
+			setMp3UserText(tag, description, strings.Join(change.New, "\x00"))
+
+		case "COMM", "USLT":
+			language := "eng"
+			frames := tag.GetFrames(id)
+			tag.DeleteFrames(id)
+			for _, frame := range frames {
+				switch f := frame.(type) {
+				case id3v2.CommentFrame:
+					if f.Description == description {
+						language = f.Language
+						continue
+					}
+				case id3v2.UnsynchronisedLyricsFrame:
+					if f.ContentDescriptor == description {
+						language = f.Language
+						continue
+					}
+				}
+				tag.AddFrame(id, frame)
+			}
+			for _, value := range change.New {
+				if id == "COMM" {
+					tag.AddCommentFrame(id3v2.CommentFrame{Encoding: tag.DefaultEncoding(), Language: language, Description: description, Text: value})
+				} else {
+					tag.AddUnsynchronisedLyricsFrame(id3v2.UnsynchronisedLyricsFrame{Encoding: tag.DefaultEncoding(), Language: language, ContentDescriptor: description, Lyrics: value})
+				}
+			}
+
+		default:
+			tag.DeleteFrames(id)
+			if len(change.New) > 0 {
+				tag.AddTextFrame(id, tag.DefaultEncoding(), strings.Join(change.New, "\x00"))
+			}
+		}
+	}
+
+	if err := tag.Save(); err != nil {
+		return fmt.Errorf("failed to save MP3 tags: %w", err)
+	}
+	return nil
+}
+
+// mp4DisplayKey turns an item key into UTF-8; classic item names are Latin-1, so "\xa9nam" becomes "©nam"
+func mp4DisplayKey(key string) string {
+	if strings.HasPrefix(key, "----:") {
+		return key
+	}
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		b.WriteRune(rune(key[i]))
+	}
+	return b.String()
+}
+
+// mp4NativeKey reverses mp4DisplayKey
+func mp4NativeKey(key string) string {
+	if strings.HasPrefix(key, "----:") {
+		return key
+	}
+	b := make([]byte, 0, len(key))
+	for _, r := range key {
+		if r > 0xFF {
+			return key
+		}
+		b = append(b, byte(r))
+	}
+	return string(b)
+}
+
+func readM4ATags(tags *FileTags) error {
+	items, err := readMP4Tags(tags.Path)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items.items {
+		key := mp4DisplayKey(item.key)
+		if len(item.data) == 0 {
+			tags.addTagValue(key, fmt.Sprintf("%d bytes", len(item.raw)), true)
+			continue
+		}
+		for _, data := range item.data {
+			switch {
+			case data.kind == mp4TypeJPEG || data.kind == mp4TypePNG:
+				mime := "image/jpeg"
+				if data.kind == mp4TypePNG {
+					mime = "image/png"
+				}
+				tags.Pictures = append(tags.Pictures, TagPicture{Type: 3, MIME: mime, Size: len(data.value)})
+			case data.kind == mp4TypeUTF8:
+				tags.addTagValue(key, string(data.value), false)
+			case data.kind == mp4TypeInteger && len(data.value) <= 8:
+				tags.addTagValue(key, strconv.FormatInt(mp4Integer(data.value), 10), false)
+			case (item.key == mp4KeyTrack || item.key == mp4KeyDisc) && len(data.value) >= 6:
+				number, total := int(binary.BigEndian.Uint16(data.value[2:4])), int(binary.BigEndian.Uint16(data.value[4:6]))
+				value := strconv.Itoa(number)
+				if total > 0 {
+					value += "/" + strconv.Itoa(total)
+				}
+				tags.addTagValue(key, value, false)
+			default:
+				tags.addTagValue(key, fmt.Sprintf("%d bytes", len(data.value)), true)
+			}
+		}
+	}
+	return nil
+}
+
+// mp4Integer decodes a big-endian signed integer of up to 8 bytes
+func mp4Integer(b []byte) int64 {
+	var v int64
+	for _, c := range b {
+		v = v<<8 | int64(c)
+	}
+	if len(b) > 0 && len(b) < 8 && b[0]&0x80 != 0 {
+		v -= 1 << (8 * len(b))
+	}
+	return v
+}
+
+func writeM4ATagChanges(path string, changes []TagChange) error {
+	// Validate before rewriting the file, since updateMP4Tags can't fail part way
+	data := make([][]mp4Data, len(changes))
+	current, err := readMP4Tags(path)
+	if err != nil {
+		return err
+	}
+	for i, change := range changes {
+		key := mp4NativeKey(change.Key)
+		for _, value := range change.New {
+			d, err := mp4ValueData(key, value, current.values(key))
+			if err != nil {
+				return err
+			}
+			data[i] = append(data[i], d)
+		}
+	}
+
+	err = updateMP4Tags(path, func(tags *mp4Tags) {
+		for i, change := range changes {
+			tags.set(mp4NativeKey(change.Key), data[i]...)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save M4A tags: %w", err)
+	}
+	return nil
+}
+
+// mp4ValueData encodes a text value for an item, keeping the type of the item's existing values
+func mp4ValueData(key, value string, existing []mp4Data) (mp4Data, error) {
+	if key == mp4KeyTrack || key == mp4KeyDisc {
+		numberText, totalText, _ := strings.Cut(value, "/")
+		number, err := strconv.Atoi(strings.TrimSpace(numberText))
+		if err != nil || number < 0 || number > 0xFFFF {
+			return mp4Data{}, fmt.Errorf("invalid %s value: %s", mp4DisplayKey(key), value)
+		}
+		total := 0
+		if totalText != "" {
+			if total, err = strconv.Atoi(strings.TrimSpace(totalText)); err != nil || total < 0 || total > 0xFFFF {
+				return mp4Data{}, fmt.Errorf("invalid %s value: %s", mp4DisplayKey(key), value)
+			}
+		}
+		v := make([]byte, 6, 8)
+		if key == mp4KeyTrack {
+			v = v[:8]
+		}
+		binary.BigEndian.PutUint16(v[2:4], uint16(number))
+		binary.BigEndian.PutUint16(v[4:6], uint16(total))
+		return mp4Data{kind: mp4TypeImplicit, value: v}, nil
+	}
+
+	width, integer := mp4IntegerWidths[key]
+	if len(existing) > 0 && existing[0].kind == mp4TypeInteger {
+		width, integer = len(existing[0].value), true
+	}
+	if !integer {
+		return mp4Data{kind: mp4TypeUTF8, value: []byte(value)}, nil
+	}
+
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || width < 1 || width > 8 || (width < 8 && (n < -(1<<(8*width-1)) || n >= 1<<(8*width))) {
+		return mp4Data{}, fmt.Errorf("invalid %s value: %s", mp4DisplayKey(key), value)
+	}
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, uint64(n))
+	return mp4Data{kind: mp4TypeInteger, value: v[8-width:]}, nil
+}
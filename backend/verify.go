@@ -0,0 +1,387 @@
+package backend
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	pathfilepath "path/filepath"
+	"strings"
+
+	mewflac "github.com/mewkiz/flac"
+)
+
+// Minimum number of consecutive MPEG frames an MP3 must contain to be considered audio
+const minMp3Frames = 10
+
+// VerifyAudioFile checks that a downloaded file is complete, decodable audio.
+// FLAC files are fully decoded and compared against the STREAMINFO MD5; MP3 files have every frame header walked.
+// Other formats are not checked.
+func VerifyAudioFile(filePath string) error {
+	ext := strings.ToLower(pathfilepath.Ext(filePath))
+
+	switch ext {
+	case ".flac":
+		return verifyFlac(filePath)
+	case ".mp3":
+		return verifyMp3(filePath)
+	default:
+		return nil
+	}
+}
+
+// verifyFlac decodes every frame (which also checks each frame's CRC) and compares the MD5 of the decoded samples
+func verifyFlac(filePath string) error {
+	stream, err := mewflac.ParseFile(filePath)
+	if err != nil {
+		return fmt.Errorf("invalid FLAC stream: %w", err)
+	}
+	defer stream.Close()
+
+	var zeroMD5 [md5.Size]byte
+	checkMD5 := stream.Info.MD5sum != zeroMD5
+	hash := md5.New()
+
+	var samples uint64
+	for {
+		frame, err := stream.ParseNext()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("corrupt FLAC frame after %d samples: %w", samples, err)
+		}
+		if checkMD5 {
+			frame.Hash(hash)
+		}
+		samples += uint64(frame.BlockSize)
+	}
+
+	if stream.Info.NSamples > 0 && samples != stream.Info.NSamples {
+		return fmt.Errorf("truncated FLAC: decoded %d of %d samples", samples, stream.Info.NSamples)
+	}
+
+	// An all-zero MD5 means the encoder didn't compute one
+	if checkMD5 {
+		var sum [md5.Size]byte
+		copy(sum[:], hash.Sum(nil))
+		if sum != stream.Info.MD5sum {
+			return fmt.Errorf("FLAC MD5 mismatch: audio data is corrupt")
+		}
+	}
+
+	return nil
+}
+
+// MPEG audio bitrates in kbps, indexed by [version row][layer row][bitrate index]
+var mp3Bitrates = [2][3][16]int{
+	{ // MPEG-1
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0}, // Layer I
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},    // Layer II
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},     // Layer III
+	},
+	{ // MPEG-2 and MPEG-2.5
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0}, // Layer I
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},      // Layer II
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},      // Layer III
+	},
+}
+
+// MPEG audio sample rates in Hz, indexed by [version bits][sample rate index]
+var mp3SampleRates = [4][3]int{
+	{11025, 12000, 8000},  // MPEG-2.5
+	{0, 0, 0},             // Reserved
+	{22050, 24000, 16000}, // MPEG-2
+	{44100, 48000, 32000}, // MPEG-1
+}
+
+// mp3FrameLength returns the length in bytes of the MPEG audio frame with the given 4-byte header,
+// or an error if the header is invalid
+func mp3FrameLength(header []byte) (int, error) {
+	if header[0] != 0xFF || header[1]&0xE0 != 0xE0 {
+		return 0, errors.New("missing frame sync")
+	}
+
+	versionBits := (header[1] >> 3) & 0x03
+	layerBits := (header[1] >> 1) & 0x03
+	bitrateIndex := header[2] >> 4
+	sampleRateIndex := (header[2] >> 2) & 0x03
+	padding := int((header[2] >> 1) & 0x01)
+
+	if versionBits == 1 {
+		return 0, errors.New("reserved MPEG version")
+	}
+	if layerBits == 0 {
+		return 0, errors.New("reserved MPEG layer")
+	}
+	if bitrateIndex == 0 || bitrateIndex == 15 {
+		return 0, errors.New("free-format or invalid bitrate")
+	}
+	if sampleRateIndex == 3 {
+		return 0, errors.New("reserved sample rate")
+	}
+
+	versionRow := 1
+	if versionBits == 3 {
+		versionRow = 0
+	}
+	layer := 4 - int(layerBits) // 1, 2, or 3
+
+	bitrate := mp3Bitrates[versionRow][layer-1][bitrateIndex] * 1000
+	sampleRate := mp3SampleRates[versionBits][sampleRateIndex]
+
+	switch {
+	case layer == 1:
+		return (12*bitrate/sampleRate + padding) * 4, nil
+	case layer == 3 && versionRow == 1:
+		return 72*bitrate/sampleRate + padding, nil
+	default:
+		return 144*bitrate/sampleRate + padding, nil
+	}
+}
+
+// verifyMp3 walks the chain of MPEG frame headers from the first frame to the end of the file.
+// A frame that runs past the end of the file or a broken chain means the file is truncated or corrupt.
+func verifyMp3(filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	r := bufio.NewReaderSize(f, 64*1024)
+	var pos int64
+
+	// Skip a leading ID3v2 tag
+	if head, err := r.Peek(10); err == nil && bytes.Equal(head[:3], []byte("ID3")) {
+		tagSize := int64(head[6]&0x7F)<<21 | int64(head[7]&0x7F)<<14 | int64(head[8]&0x7F)<<7 | int64(head[9]&0x7F)
+		tagSize += 10
+		if head[5]&0x10 != 0 {
+			tagSize += 10 // Footer present
+		}
+		if _, err := r.Discard(int(tagSize)); err != nil {
+			return fmt.Errorf("truncated ID3v2 tag")
+		}
+		pos += tagSize
+	}
+
+	// Some encoders pad between the tag and the first frame; scan for the first sync word
+	for {
+		b, err := r.Peek(4)
+		if err != nil {
+			return fmt.Errorf("no MPEG audio frames found")
+		}
+		if _, err := mp3FrameLength(b); err == nil {
+			break
+		}
+		r.Discard(1)
+		pos++
+	}
+
+	frames := 0
+	for pos < size {
+		header, err := r.Peek(4)
+		if err != nil {
+			return fmt.Errorf("truncated MP3: partial frame header at byte %d", pos)
+		}
+
+		frameLen, err := mp3FrameLength(header)
+		if err != nil {
+			// Trailing ID3v1, APEv2, or Lyrics3 tags end the audio stream
+			if tail, _ := r.Peek(8); isMp3TrailingTag(tail) {
+				break
+			}
+			return fmt.Errorf("corrupt MP3 frame at byte %d after %d frames: %v", pos, frames, err)
+		}
+
+		if pos+int64(frameLen) > size {
+			return fmt.Errorf("truncated MP3: last frame needs %d bytes, only %d left", frameLen, size-pos)
+		}
+		if _, err := r.Discard(frameLen); err != nil {
+			return fmt.Errorf("truncated MP3 at byte %d: %v", pos, err)
+		}
+		pos += int64(frameLen)
+		frames++
+	}
+
+	if frames < minMp3Frames {
+		return fmt.Errorf("MP3 contains only %d audio frames", frames)
+	}
+
+	return nil
+}
+
+func isMp3TrailingTag(b []byte) bool {
+	return bytes.HasPrefix(b, []byte("TAG")) ||
+		bytes.HasPrefix(b, []byte("APETAGEX")) ||
+		bytes.HasPrefix(b, []byte("LYRICS"))
+}
+
+// readAudioDuration returns the playing time of a FLAC, MP3 or M4A file and the number of bytes of audio data,
+// from which the average bitrate follows
+func readAudioDuration(filePath string) (int, int64, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	switch strings.ToLower(pathfilepath.Ext(filePath)) {
+	case ".flac":
+		stream, err := mewflac.ParseFile(filePath)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid FLAC stream: %w", err)
+		}
+		defer stream.Close()
+
+		if stream.Info.SampleRate == 0 {
+			return 0, 0, errors.New("FLAC stream has no sample rate")
+		}
+		durationMS := int(stream.Info.NSamples * 1000 / uint64(stream.Info.SampleRate))
+
+		// "fLaC" marker, then the STREAMINFO block and the other metadata blocks, each with a 4-byte header
+		metaSize := int64(4 + 4 + 34)
+		for _, block := range stream.Blocks {
+			metaSize += 4 + block.Header.Length
+		}
+		return durationMS, info.Size() - metaSize, nil
+	case ".mp3":
+		return mp3Duration(filePath)
+	case ".m4a":
+		return mp4Duration(filePath)
+	default:
+		return 0, 0, fmt.Errorf("unsupported file format")
+	}
+}
+
+// readAudioCodec returns the codec of a FLAC, MP3 or M4A file's audio stream: flac, alac, aac or mp3
+func readAudioCodec(filePath string) (string, error) {
+	switch strings.ToLower(pathfilepath.Ext(filePath)) {
+	case ".flac":
+		return "flac", nil
+	case ".mp3":
+		return "mp3", nil
+	case ".m4a":
+		entry, err := mp4Codec(filePath)
+		if err != nil {
+			return "", err
+		}
+		switch entry {
+		case "alac":
+			return "alac", nil
+		case "mp4a":
+			return "aac", nil
+		case "fLaC":
+			return "flac", nil
+		default:
+			return strings.ToLower(strings.TrimSpace(entry)), nil
+		}
+	default:
+		return "", fmt.Errorf("unsupported file format")
+	}
+}
+
+// mp3Duration reads the frame count from a Xing/Info or VBRI header when present,
+// otherwise it assumes a constant bitrate and derives the duration from the first frame
+func mp3Duration(filePath string) (int, int64, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	r := bufio.NewReaderSize(f, 64*1024)
+	var pos int64
+
+	// Skip a leading ID3v2 tag
+	if head, err := r.Peek(10); err == nil && bytes.Equal(head[:3], []byte("ID3")) {
+		tagSize := int64(head[6]&0x7F)<<21 | int64(head[7]&0x7F)<<14 | int64(head[8]&0x7F)<<7 | int64(head[9]&0x7F)
+		tagSize += 10
+		if head[5]&0x10 != 0 {
+			tagSize += 10 // Footer present
+		}
+		if _, err := r.Discard(int(tagSize)); err != nil {
+			return 0, 0, fmt.Errorf("truncated ID3v2 tag")
+		}
+		pos += tagSize
+	}
+
+	var frame []byte
+	for {
+		header, err := r.Peek(4)
+		if err != nil {
+			return 0, 0, fmt.Errorf("no MPEG audio frames found")
+		}
+		if _, err := mp3FrameLength(header); err == nil {
+			// The VBRI header sits 36 bytes into the frame, Xing/Info within the first 40
+			frame, _ = r.Peek(64)
+			break
+		}
+		r.Discard(1)
+		pos++
+	}
+
+	audioBytes := info.Size() - pos
+	if audioBytes >= 128 {
+		tail := make([]byte, 3)
+		if _, err := f.ReadAt(tail, info.Size()-128); err == nil && bytes.Equal(tail, []byte("TAG")) {
+			audioBytes -= 128 // ID3v1 tag
+		}
+	}
+
+	versionBits := (frame[1] >> 3) & 0x03
+	layer := 4 - int((frame[1]>>1)&0x03)
+	sampleRate := mp3SampleRates[versionBits][(frame[2]>>2)&0x03]
+	samplesPerFrame := 1152
+	if layer == 1 {
+		samplesPerFrame = 384
+	} else if layer == 3 && versionBits != 3 {
+		samplesPerFrame = 576
+	}
+
+	// Xing/Info follows the side information, whose size depends on the MPEG version and channel mode
+	mono := frame[3]>>6 == 3
+	xingOffset := 4 + 32
+	switch {
+	case versionBits == 3 && mono, versionBits != 3 && !mono:
+		xingOffset = 4 + 17
+	case versionBits != 3 && mono:
+		xingOffset = 4 + 9
+	}
+
+	var frames uint32
+	if len(frame) >= xingOffset+12 {
+		tag := string(frame[xingOffset : xingOffset+4])
+		flags := binary.BigEndian.Uint32(frame[xingOffset+4:])
+		if (tag == "Xing" || tag == "Info") && flags&0x01 != 0 {
+			frames = binary.BigEndian.Uint32(frame[xingOffset+8:])
+		}
+	}
+	if frames == 0 && len(frame) >= 36+18 && string(frame[36:40]) == "VBRI" {
+		frames = binary.BigEndian.Uint32(frame[36+14:])
+	}
+	if frames > 0 {
+		return int(int64(frames) * int64(samplesPerFrame) * 1000 / int64(sampleRate)), audioBytes, nil
+	}
+
+	versionRow := 1
+	if versionBits == 3 {
+		versionRow = 0
+	}
+	bitrate := mp3Bitrates[versionRow][layer-1][frame[2]>>4] // kbps
+	return int(audioBytes * 8 / int64(bitrate)), audioBytes, nil
+}
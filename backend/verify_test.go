@@ -0,0 +1,165 @@
+package backend
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	mewflac "github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
+)
+
+// writeTestFlac writes a stereo 16-bit FLAC of frames blocks of a 440 Hz tone and returns its path
+func writeTestFlac(t *testing.T, frames int) string {
+	t.Helper()
+	const blockSize = 4096
+	path := filepath.Join(t.TempDir(), "track.flac")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := &meta.StreamInfo{
+		BlockSizeMin:  blockSize,
+		BlockSizeMax:  blockSize,
+		SampleRate:    44100,
+		NChannels:     2,
+		BitsPerSample: 16,
+	}
+	enc, err := mewflac.NewEncoder(f, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < frames; i++ {
+		samples := make([]int32, blockSize)
+		for j := range samples {
+			n := float64(i*blockSize + j)
+			samples[j] = int32(8000 * math.Sin(2*math.Pi*440*n/44100))
+		}
+		fr := &frame.Frame{
+			Header: frame.Header{
+				HasFixedBlockSize: true,
+				BlockSize:         blockSize,
+				SampleRate:        44100,
+				Channels:          frame.ChannelsLR,
+				BitsPerSample:     16,
+			},
+			Subframes: []*frame.Subframe{
+				{SubHeader: frame.SubHeader{Pred: frame.PredVerbatim}, Samples: samples, NSamples: blockSize},
+				{SubHeader: frame.SubHeader{Pred: frame.PredVerbatim}, Samples: samples, NSamples: blockSize},
+			},
+		}
+		if err := enc.WriteFrame(fr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// truncateFile cuts n bytes off the end of the file at path
+func truncateFile(t *testing.T, path string, n int64) {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, info.Size()-n); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyFlac(t *testing.T) {
+	path := writeTestFlac(t, 8)
+	if err := verifyFlac(path); err != nil {
+		t.Fatalf("complete file: %v", err)
+	}
+
+	for _, n := range []int64{1, 100, 20000} {
+		path := writeTestFlac(t, 8)
+		truncateFile(t, path, n)
+		if err := verifyFlac(path); err == nil {
+			t.Errorf("file truncated by %d bytes passed verification", n)
+		}
+	}
+
+	path = writeTestFlac(t, 8)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xFF
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyFlac(path); err == nil {
+		t.Error("corrupt file passed verification")
+	}
+}
+
+// testMp3Frame is an MPEG-1 Layer III frame header: 128 kbps, 44.1 kHz, no padding, so 417 bytes
+var testMp3Frame = []byte{0xFF, 0xFB, 0x90, 0x00}
+
+// writeTestMp3 writes an ID3v2 tag, frames silent MP3 frames and the given trailer, and returns the path
+func writeTestMp3(t *testing.T, frames int, trailer []byte) string {
+	t.Helper()
+	frameLen, err := mp3FrameLength(testMp3Frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	b.Write([]byte("ID3\x04\x00\x00\x00\x00\x00\x0A"))
+	b.Write(make([]byte, 10))
+	for i := 0; i < frames; i++ {
+		b.Write(testMp3Frame)
+		b.Write(make([]byte, frameLen-len(testMp3Frame)))
+	}
+	b.Write(trailer)
+
+	path := filepath.Join(t.TempDir(), "track.mp3")
+	if err := os.WriteFile(path, b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVerifyMp3(t *testing.T) {
+	if n, err := mp3FrameLength(testMp3Frame); err != nil || n != 417 {
+		t.Fatalf("mp3FrameLength = %d, %v; want 417", n, err)
+	}
+
+	if err := verifyMp3(writeTestMp3(t, 20, nil)); err != nil {
+		t.Errorf("complete file: %v", err)
+	}
+	id3v1 := append([]byte("TAG"), make([]byte, 125)...)
+	if err := verifyMp3(writeTestMp3(t, 20, id3v1)); err != nil {
+		t.Errorf("file with ID3v1 tag: %v", err)
+	}
+
+	for _, n := range []int64{1, 200, 416} {
+		path := writeTestMp3(t, 20, nil)
+		truncateFile(t, path, n)
+		if err := verifyMp3(path); err == nil {
+			t.Errorf("file truncated by %d bytes passed verification", n)
+		}
+	}
+
+	path := writeTestMp3(t, 20, nil)
+	truncateFile(t, path, 417*20-2)
+	if err := verifyMp3(path); err == nil {
+		t.Error("file truncated inside the first frame header passed verification")
+	}
+
+	if err := verifyMp3(writeTestMp3(t, minMp3Frames-1, nil)); err == nil {
+		t.Error("file with too few frames passed verification")
+	}
+	if err := verifyMp3(writeTestMp3(t, 20, []byte("garbage!"))); err == nil {
+		t.Error("file with trailing garbage passed verification")
+	}
+}
@@ -0,0 +1,147 @@
+// Command spotidl is a headless front-end for the SpotiDownloader backend.
+// It calls the backend package directly, so it runs without Wails or a window.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Exit codes reported by every subcommand
+const (
+	exitOK      = 0 // Everything succeeded
+	exitFailure = 1 // Nothing succeeded, or a fatal error occurred
+	exitUsage   = 2 // Invalid arguments
+	exitPartial = 3 // Some items succeeded and some failed
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+var commands = []command{
+	{"fetch", "Fetch Spotify metadata for a URL", runFetch},
+	{"download", "Download every track behind a Spotify URL", runDownload},
+	{"lyrics", "Download .lrc lyrics for every track behind a Spotify URL", runLyrics},
+	{"cover", "Download cover art for every track behind a Spotify URL", runCover},
+	{"convert", "Convert audio files with ffmpeg", runConvert},
+	{"analyze", "Analyze the audio quality of FLAC files", runAnalyze},
+	{"rename", "Rename audio files from their metadata", runRename},
+	{"tags", "Show or edit every tag of audio files", runTags},
+	{"retag", "Refresh the tags of audio files from Spotify metadata", runRetag},
+	{"loudness", "Measure loudness and write ReplayGain tags", runLoudness},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		printUsage()
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:])
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "spotidl: unknown command %q\n\n", args[0])
+	printUsage()
+	return exitUsage
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: spotidl <command> [flags] [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'spotidl <command> -h' for command flags.")
+}
+
+// newFlagSet creates a flag set with the --json flag shared by all subcommands
+func newFlagSet(name, usage string) (*flag.FlagSet, *bool) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: spotidl %s %s\n\nFlags:\n", name, usage)
+		fs.PrintDefaults()
+	}
+	jsonOutput := fs.Bool("json", false, "print machine-readable JSON instead of text")
+	return fs, jsonOutput
+}
+
+// parseFlags parses args and returns a non-negative exit code if the command should stop
+func parseFlags(fs *flag.FlagSet, args []string) int {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	return -1
+}
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "spotidl: failed to encode JSON: %v\n", err)
+		return
+	}
+	fmt.Println(string(data))
+}
+
+// fatal reports an error in the selected output format and returns exitFailure
+func fatal(jsonOutput bool, err error) int {
+	if jsonOutput {
+		printJSON(map[string]string{"error": err.Error()})
+	} else {
+		fmt.Fprintf(os.Stderr, "spotidl: %v\n", err)
+	}
+	return exitFailure
+}
+
+// exitCodeFor maps success/failure counts to an exit code
+func exitCodeFor(succeeded, failed int) int {
+	switch {
+	case failed == 0:
+		return exitOK
+	case succeeded == 0:
+		return exitFailure
+	default:
+		return exitPartial
+	}
+}
+
+// requireArgs prints usage and returns exitUsage if fewer than min positional arguments were given
+func requireArgs(fs *flag.FlagSet, min int) int {
+	if fs.NArg() < min {
+		fs.Usage()
+		return exitUsage
+	}
+	return -1
+}
+
+// statusLabel renders a short status tag for text output
+func statusLabel(success, skipped bool) string {
+	switch {
+	case skipped:
+		return "SKIP"
+	case success:
+		return "OK  "
+	default:
+		return "FAIL"
+	}
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"spotidownloader/backend"
+	"strings"
+	"time"
+)
+
+// trackResult is the per-track outcome printed by download, lyrics, and cover
+type trackResult struct {
+	Name          string `json:"name"`
+	Artists       string `json:"artists"`
+	ISRC          string `json:"isrc,omitempty"`
+	Success       bool   `json:"success"`
+	AlreadyExists bool   `json:"already_exists,omitempty"`
+	File          string `json:"file,omitempty"`
+	Format        string `json:"format,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// batchSummary is the JSON document printed by download, lyrics, and cover
+type batchSummary struct {
+	Name      string        `json:"name,omitempty"`
+	Total     int           `json:"total"`
+	Succeeded int           `json:"succeeded"`
+	Skipped   int           `json:"skipped"`
+	Failed    int           `json:"failed"`
+	Results   []trackResult `json:"results"`
+}
+
+func (s *batchSummary) add(r trackResult, jsonOutput bool) {
+	s.Results = append(s.Results, r)
+	switch {
+	case !r.Success:
+		s.Failed++
+	case r.AlreadyExists:
+		s.Skipped++
+	default:
+		s.Succeeded++
+	}
+
+	if jsonOutput {
+		return
+	}
+	line := fmt.Sprintf("[%s] %s - %s", statusLabel(r.Success, r.AlreadyExists), r.Name, r.Artists)
+	if r.Error != "" {
+		line += ": " + r.Error
+	} else if r.File != "" {
+		line += " -> " + r.File
+	}
+	fmt.Println(line)
+}
+
+func (s *batchSummary) finish(jsonOutput bool) int {
+	s.Total = len(s.Results)
+	if jsonOutput {
+		printJSON(s)
+	} else {
+		fmt.Printf("\n%d downloaded, %d skipped, %d failed (%d total)\n", s.Succeeded, s.Skipped, s.Failed, s.Total)
+	}
+	return exitCodeFor(s.Succeeded+s.Skipped, s.Failed)
+}
+
+// fetchTracks resolves a Spotify URL into its name and track list
+func fetchTracks(ctx context.Context, url string, batch bool, delay time.Duration) (string, []backend.AlbumTrackMetadata, bool, error) {
+	data, err := backend.GetFilteredSpotifyData(ctx, url, batch, delay)
+	if err != nil {
+		return "", nil, false, fmt.Errorf("failed to fetch metadata: %v", err)
+	}
+	return backend.SpotifyDataTracks(data)
+}
+
+// outputDirFor returns the download directory, adding a playlist sub-folder like the GUI does
+func outputDirFor(base, name string, isAlbum, playlistFolder bool) string {
+	if base == "" {
+		base = backend.GetDefaultMusicPath()
+	}
+	base = backend.NormalizePath(base)
+	if playlistFolder && !isAlbum && name != "" {
+		return backend.SanitizeFolderPath(base + string(os.PathSeparator) + strings.ReplaceAll(name, "/", " "))
+	}
+	return base
+}
+
+func runFetch(args []string) int {
+	fs, jsonOutput := newFlagSet("fetch", "[flags] <spotify-url>")
+	batch := fs.Bool("batch", false, "fetch large playlists in batches")
+	delay := fs.Float64("delay", 1.0, "delay between batches in seconds")
+	timeout := fs.Float64("timeout", 300, "request timeout in seconds")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if code := requireArgs(fs, 1); code >= 0 {
+		return code
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*timeout*float64(time.Second)))
+	defer cancel()
+
+	if *jsonOutput {
+		data, err := backend.GetFilteredSpotifyData(ctx, fs.Arg(0), *batch, time.Duration(*delay*float64(time.Second)))
+		if err != nil {
+			return fatal(true, fmt.Errorf("failed to fetch metadata: %v", err))
+		}
+		printJSON(data)
+		return exitOK
+	}
+
+	name, tracks, _, err := fetchTracks(ctx, fs.Arg(0), *batch, time.Duration(*delay*float64(time.Second)))
+	if err != nil {
+		return fatal(false, err)
+	}
+
+	fmt.Printf("%s (%d tracks)\n\n", name, len(tracks))
+	for i, t := range tracks {
+		fmt.Printf("%4d. %s - %s [%s]\n", i+1, t.Name, t.Artists, t.ISRC)
+	}
+	return exitOK
+}
+
+func runDownload(args []string) int {
+	fs, jsonOutput := newFlagSet("download", "[flags] <spotify-url>")
+	outputDir := fs.String("o", "", "output directory (default: ~/Music)")
+	audioFormat := fs.String("format", "mp3", "audio format: mp3 or flac")
+	folderTemplate := fs.String("folder-template", "", "sub-folders for each track, e.g. {artist}/{album}")
+	filenameFormat := fs.String("filename-format", "title-artist", "filename format or template, e.g. {track}. {title} - {artist}")
+	trackNumber := fs.Bool("track-number", false, "prefix legacy filename formats with the track number")
+	filesystem := fs.String("filesystem", backend.FilesystemWindows, "filesystem names must be valid on: windows, fat or posix")
+	token := fs.String("token", "", "session token (fetched automatically when empty)")
+	embedLyrics := fs.Bool("lyrics", false, "embed lyrics into downloaded files")
+	maxCover := fs.Bool("max-cover", false, "embed max quality cover art")
+	joinArtists := fs.Bool("join-artists", false, "tag artists as one comma-joined value instead of one value per artist")
+	replayGain := fs.Bool("replaygain", false, "write ReplayGain track and album tags after downloading an album")
+	playlistFolder := fs.Bool("playlist-folder", true, "put playlist downloads in a sub-folder named after the playlist")
+	batch := fs.Bool("batch", false, "fetch large playlists in batches")
+	formatPolicy := fs.String("format-policy", "", "flac-only, prefer-flac or mp3-only (default: derived from --format)")
+	providers := fs.String("providers", backend.SpotiDownloaderProviderName, "comma-separated download providers to try, in order")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if code := requireArgs(fs, 1); code >= 0 {
+		return code
+	}
+	if _, err := backend.ResolveFilesystem(*filesystem); err != nil {
+		fmt.Fprintf(os.Stderr, "spotidl: %v\n", err)
+		return exitUsage
+	}
+
+	policy, err := backend.ResolveFormatPolicy(*formatPolicy, *audioFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "spotidl: %v\n", err)
+		return exitUsage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	name, tracks, isAlbum, err := fetchTracks(ctx, fs.Arg(0), *batch, time.Second)
+	if err != nil {
+		return fatal(*jsonOutput, err)
+	}
+
+	sessionToken := *token
+	if sessionToken == "" {
+		sessionToken, err = backend.FetchSessionToken()
+		if err != nil {
+			return fatal(*jsonOutput, fmt.Errorf("failed to fetch session token: %v", err))
+		}
+	}
+
+	dir := outputDirFor(*outputDir, name, isAlbum, *playlistFolder)
+	downloader := backend.NewSpotiDownloader(sessionToken).WithProviderOrder(strings.Split(*providers, ",")).WithFormatPolicy(policy).WithFilesystem(*filesystem).WithJoinedArtists(*joinArtists).WithBaseDir(dir)
+	summary := batchSummary{Name: name}
+	var files []string
+
+	for i, t := range tracks {
+		result := trackResult{Name: t.Name, Artists: t.Artists, ISRC: t.ISRC}
+		if t.ISRC == "" && t.SpotifyID == "" {
+			result.Error = "track ID or ISRC is required"
+			summary.add(result, *jsonOutput)
+			continue
+		}
+
+		trackID := t.SpotifyID
+		if trackID == "" {
+			trackID = t.ISRC
+		}
+
+		// Same priority as App.DownloadTrack: album track number first, then playlist position
+		position := i + 1
+		actualTrackNumber := position
+		if t.TrackNumber > 0 {
+			actualTrackNumber = t.TrackNumber
+		}
+
+		pathData := backend.TrackPathData(t, position, name)
+		trackDir := backend.PathTemplate{Folder: *folderTemplate, Filesystem: *filesystem}.Dir(dir, pathData)
+
+		filename, err := downloader.WithPathData(pathData).WithArtists(t.ArtistNames()).WithExtendedTags(t.ExtendedTags()).DownloadByISRC(
+			trackID,
+			t.ISRC,
+			trackDir,
+			*audioFormat,
+			*filenameFormat,
+			*trackNumber,
+			position,
+			t.Name,
+			t.Artists,
+			t.AlbumName,
+			t.AlbumArtist,
+			t.ReleaseDate,
+			t.Images,
+			actualTrackNumber,
+			t.DiscNumber,
+			t.TotalTracks,
+			false,
+			*maxCover,
+		)
+		if err != nil {
+			result.Error = err.Error()
+			summary.add(result, *jsonOutput)
+			continue
+		}
+
+		result.Success = true
+		if strings.HasPrefix(filename, "EXISTS:") {
+			result.AlreadyExists = true
+			filename = strings.TrimPrefix(filename, "EXISTS:")
+		}
+		result.File = filename
+		result.Format = strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+		files = append(files, filename)
+
+		if *embedLyrics && !result.AlreadyExists && t.SpotifyID != "" {
+			embedTrackLyrics(filename, t)
+		}
+
+		summary.add(result, *jsonOutput)
+	}
+
+	if *replayGain && isAlbum && len(files) > 0 {
+		if _, err := backend.ScanLoudness(backend.LoudnessScanRequest{Files: files, WriteTags: true}); err != nil {
+			fmt.Fprintf(os.Stderr, "spotidl: failed to write ReplayGain tags: %v\n", err)
+		}
+	}
+
+	return summary.finish(*jsonOutput)
+}
+
+// embedTrackLyrics fetches lyrics from all sources and embeds them, logging failures to stderr
+func embedTrackLyrics(filePath string, t backend.AlbumTrackMetadata) {
+	client := backend.NewLyricsClient()
+	lyricsResp, _, err := client.FetchLyricsAllSources(t.SpotifyID, t.Name, t.Artists)
+	if err != nil || lyricsResp == nil || len(lyricsResp.Lines) == 0 {
+		fmt.Fprintf(os.Stderr, "spotidl: no lyrics found for %s\n", t.Name)
+		return
+	}
+
+	lyrics := client.ConvertToLRC(lyricsResp, t.Name, t.Artists)
+	if lyrics == "" {
+		return
+	}
+	if err := backend.EmbedLyricsOnly(filePath, lyrics); err != nil {
+		fmt.Fprintf(os.Stderr, "spotidl: failed to embed lyrics into %s: %v\n", filePath, err)
+	}
+}
+
+func runLyrics(args []string) int {
+	fs, jsonOutput := newFlagSet("lyrics", "[flags] <spotify-url>")
+	outputDir := fs.String("o", "", "output directory (default: ~/Music)")
+	folderTemplate := fs.String("folder-template", "", "sub-folders for each track, e.g. {artist}/{album}")
+	filenameFormat := fs.String("filename-format", "title-artist", "filename format or template")
+	trackNumber := fs.Bool("track-number", false, "prefix legacy filename formats with the track number")
+	filesystem := fs.String("filesystem", backend.FilesystemWindows, "filesystem names must be valid on: windows, fat or posix")
+	playlistFolder := fs.Bool("playlist-folder", true, "put playlist downloads in a sub-folder named after the playlist")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if code := requireArgs(fs, 1); code >= 0 {
+		return code
+	}
+	if _, err := backend.ResolveFilesystem(*filesystem); err != nil {
+		fmt.Fprintf(os.Stderr, "spotidl: %v\n", err)
+		return exitUsage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	name, tracks, isAlbum, err := fetchTracks(ctx, fs.Arg(0), false, time.Second)
+	if err != nil {
+		return fatal(*jsonOutput, err)
+	}
+
+	dir := outputDirFor(*outputDir, name, isAlbum, *playlistFolder)
+	client := backend.NewLyricsClient()
+	summary := batchSummary{Name: name}
+
+	for i, t := range tracks {
+		result := trackResult{Name: t.Name, Artists: t.Artists, ISRC: t.ISRC}
+		if t.SpotifyID == "" {
+			result.Error = "Spotify ID is required"
+			summary.add(result, *jsonOutput)
+			continue
+		}
+
+		resp, err := client.DownloadLyrics(backend.LyricsDownloadRequest{
+			SpotifyID:      t.SpotifyID,
+			TrackName:      t.Name,
+			ArtistName:     t.Artists,
+			AlbumName:      t.AlbumName,
+			AlbumArtist:    t.AlbumArtist,
+			ReleaseDate:    t.ReleaseDate,
+			OutputDir:      dir,
+			FolderTemplate: *folderTemplate,
+			PlaylistName:   name,
+			Filesystem:     *filesystem,
+			FilenameFormat: *filenameFormat,
+			TrackNumber:    *trackNumber,
+			Position:       i + 1,
+			DiscNumber:     t.DiscNumber,
+		})
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Success = resp.Success
+			result.AlreadyExists = resp.AlreadyExists
+			result.File = resp.File
+			result.Error = resp.Error
+		}
+		summary.add(result, *jsonOutput)
+	}
+
+	return summary.finish(*jsonOutput)
+}
+
+func runCover(args []string) int {
+	fs, jsonOutput := newFlagSet("cover", "[flags] <spotify-url>")
+	outputDir := fs.String("o", "", "output directory (default: ~/Music)")
+	folderTemplate := fs.String("folder-template", "", "sub-folders for each track, e.g. {artist}/{album}")
+	filenameFormat := fs.String("filename-format", "title-artist", "filename format or template")
+	trackNumber := fs.Bool("track-number", false, "prefix legacy filename formats with the track number")
+	filesystem := fs.String("filesystem", backend.FilesystemWindows, "filesystem names must be valid on: windows, fat or posix")
+	playlistFolder := fs.Bool("playlist-folder", true, "put playlist downloads in a sub-folder named after the playlist")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if code := requireArgs(fs, 1); code >= 0 {
+		return code
+	}
+	if _, err := backend.ResolveFilesystem(*filesystem); err != nil {
+		fmt.Fprintf(os.Stderr, "spotidl: %v\n", err)
+		return exitUsage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	name, tracks, isAlbum, err := fetchTracks(ctx, fs.Arg(0), false, time.Second)
+	if err != nil {
+		return fatal(*jsonOutput, err)
+	}
+
+	dir := outputDirFor(*outputDir, name, isAlbum, *playlistFolder)
+	client := backend.NewCoverClient()
+	summary := batchSummary{Name: name}
+
+	for i, t := range tracks {
+		result := trackResult{Name: t.Name, Artists: t.Artists, ISRC: t.ISRC}
+		if t.Images == "" {
+			result.Error = "Cover URL is required"
+			summary.add(result, *jsonOutput)
+			continue
+		}
+
+		resp, err := client.DownloadCover(backend.CoverDownloadRequest{
+			CoverURL:       t.Images,
+			TrackName:      t.Name,
+			ArtistName:     t.Artists,
+			AlbumName:      t.AlbumName,
+			AlbumArtist:    t.AlbumArtist,
+			ReleaseDate:    t.ReleaseDate,
+			OutputDir:      dir,
+			FolderTemplate: *folderTemplate,
+			PlaylistName:   name,
+			Filesystem:     *filesystem,
+			FilenameFormat: *filenameFormat,
+			TrackNumber:    *trackNumber,
+			Position:       i + 1,
+			DiscNumber:     t.DiscNumber,
+		})
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Success = resp.Success
+			result.AlreadyExists = resp.AlreadyExists
+			result.File = resp.File
+			result.Error = resp.Error
+		}
+		summary.add(result, *jsonOutput)
+	}
+
+	return summary.finish(*jsonOutput)
+}
+
+func runRetag(args []string) int {
+	fs, jsonOutput := newFlagSet("retag", "[flags] <file-or-folder>...")
+	lock := fs.String("lock", "", "comma-separated tags to keep as they are, e.g. genre,comment")
+	cover := fs.Bool("cover", false, "also replace the embedded cover")
+	maxCover := fs.Bool("max-cover", false, "embed max quality cover art")
+	joinArtists := fs.Bool("join-artists", false, "tag artists as one comma-joined value instead of one value per artist")
+	dryRun := fs.Bool("dry-run", false, "only show the changes")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if code := requireArgs(fs, 1); code >= 0 {
+		return code
+	}
+
+	req := backend.RetagRequest{Cover: *cover, MaxQualityCover: *maxCover, JoinArtists: *joinArtists, DryRun: *dryRun}
+	if *lock != "" {
+		req.Locked = strings.Split(*lock, ",")
+	}
+	for _, arg := range fs.Args() {
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			found, err := backend.ListAudioFiles(arg)
+			if err != nil {
+				return fatal(*jsonOutput, err)
+			}
+			for _, file := range found {
+				req.Files = append(req.Files, file.Path)
+			}
+		} else {
+			req.Files = append(req.Files, arg)
+		}
+	}
+
+	results, err := backend.RetagFiles(context.Background(), req)
+	if err != nil {
+		return fatal(*jsonOutput, err)
+	}
+
+	succeeded, failed := 0, 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		} else {
+			succeeded++
+		}
+	}
+
+	if *jsonOutput {
+		printJSON(results)
+		return exitCodeFor(succeeded, failed)
+	}
+	for _, r := range results {
+		if r.Error != "" {
+			fmt.Printf("[%s] %s: %s\n", statusLabel(false, false), r.Path, r.Error)
+			continue
+		}
+		fmt.Printf("[%s] %s (matched by %s: %s)\n", statusLabel(true, len(r.Changes) == 0 && !r.Cover), r.Path, r.MatchedBy, r.SpotifyID)
+		for _, c := range r.Changes {
+			fmt.Printf("  %s: %q -> %q\n", c.Key, strings.Join(c.Old, "; "), strings.Join(c.New, "; "))
+		}
+		if r.Cover {
+			fmt.Println("  cover replaced")
+		}
+	}
+	fmt.Printf("\n%d matched, %d failed\n", succeeded, failed)
+
+	return exitCodeFor(succeeded, failed)
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"spotidownloader/backend"
+	"strings"
+)
+
+func runConvert(args []string) int {
+	fs, jsonOutput := newFlagSet("convert", "[flags] <file>...")
+	outputFormat := fs.String("format", "mp3", "output format: mp3 or m4a")
+	bitrate := fs.String("bitrate", "320k", "output bitrate (ignored for ALAC)")
+	codec := fs.String("codec", "aac", "m4a codec: aac or alac")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if code := requireArgs(fs, 1); code >= 0 {
+		return code
+	}
+
+	results, err := backend.ConvertAudio(backend.ConvertAudioRequest{
+		InputFiles:   fs.Args(),
+		OutputFormat: *outputFormat,
+		Bitrate:      *bitrate,
+		Codec:        *codec,
+	})
+	if err != nil {
+		return fatal(*jsonOutput, err)
+	}
+
+	succeeded, failed := 0, 0
+	for _, r := range results {
+		if r.Success {
+			succeeded++
+		} else {
+			failed++
+		}
+	}
+
+	if *jsonOutput {
+		printJSON(results)
+	} else {
+		for _, r := range results {
+			if r.Success {
+				fmt.Printf("[%s] %s -> %s\n", statusLabel(true, false), r.InputFile, r.OutputFile)
+			} else {
+				fmt.Printf("[%s] %s: %s\n", statusLabel(false, false), r.InputFile, r.Error)
+			}
+		}
+		fmt.Printf("\n%d converted, %d failed\n", succeeded, failed)
+	}
+
+	return exitCodeFor(succeeded, failed)
+}
+
+// analyzeResult pairs an analysis with the file it belongs to for JSON output
+type analyzeResult struct {
+	File     string                  `json:"file"`
+	Analysis *backend.AnalysisResult `json:"analysis,omitempty"`
+	Error    string                  `json:"error,omitempty"`
+}
+
+func runAnalyze(args []string) int {
+	fs, jsonOutput := newFlagSet("analyze", "[flags] <file.flac>...")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if code := requireArgs(fs, 1); code >= 0 {
+		return code
+	}
+
+	var results []analyzeResult
+	succeeded, failed := 0, 0
+	for _, file := range fs.Args() {
+		result := analyzeResult{File: file}
+		analysis, err := backend.AnalyzeTrack(file)
+		if err != nil {
+			result.Error = err.Error()
+			failed++
+		} else {
+			// The spectrum is far too large for terminal output
+			analysis.Spectrum = nil
+			result.Analysis = analysis
+			succeeded++
+		}
+		results = append(results, result)
+	}
+
+	if *jsonOutput {
+		printJSON(results)
+		return exitCodeFor(succeeded, failed)
+	}
+
+	for _, r := range results {
+		if r.Error != "" {
+			fmt.Printf("%s\n  error: %s\n\n", r.File, r.Error)
+			continue
+		}
+		a := r.Analysis
+		fmt.Printf("%s\n", r.File)
+		fmt.Printf("  Sample rate:    %d Hz\n", a.SampleRate)
+		fmt.Printf("  Bit depth:      %s\n", a.BitDepth)
+		fmt.Printf("  Channels:       %d\n", a.Channels)
+		fmt.Printf("  Duration:       %.2f s\n", a.Duration)
+		fmt.Printf("  Dynamic range:  %.2f dB\n", a.DynamicRange)
+		fmt.Printf("  Peak amplitude: %.2f dB\n", a.PeakAmplitude)
+		fmt.Printf("  RMS level:      %.2f dB\n\n", a.RMSLevel)
+	}
+
+	return exitCodeFor(succeeded, failed)
+}
+
+func runRename(args []string) int {
+	fs, jsonOutput := newFlagSet("rename", "[flags] <file>...")
+	format := fs.String("format", "{title} - {artist}", "filename template")
+	dryRun := fs.Bool("dry-run", false, "only preview the new names")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if code := requireArgs(fs, 1); code >= 0 {
+		return code
+	}
+
+	succeeded, failed := 0, 0
+
+	if *dryRun {
+		previews := backend.PreviewRename(fs.Args(), *format)
+		for _, p := range previews {
+			if p.Error != "" {
+				failed++
+			} else {
+				succeeded++
+			}
+		}
+		if *jsonOutput {
+			printJSON(previews)
+		} else {
+			for _, p := range previews {
+				if p.Error != "" {
+					fmt.Printf("[%s] %s: %s\n", statusLabel(false, false), p.OldName, p.Error)
+				} else {
+					fmt.Printf("[%s] %s -> %s\n", statusLabel(true, false), p.OldName, p.NewName)
+				}
+			}
+		}
+		return exitCodeFor(succeeded, failed)
+	}
+
+	results := backend.RenameFiles(fs.Args(), *format)
+	for _, r := range results {
+		if r.Success {
+			succeeded++
+		} else {
+			failed++
+		}
+	}
+
+	if *jsonOutput {
+		printJSON(results)
+	} else {
+		for _, r := range results {
+			if r.Success {
+				fmt.Printf("[%s] %s -> %s\n", statusLabel(true, false), r.OldPath, r.NewPath)
+			} else {
+				fmt.Printf("[%s] %s: %s\n", statusLabel(false, false), r.OldPath, r.Error)
+			}
+		}
+		fmt.Printf("\n%d renamed, %d failed\n", succeeded, failed)
+	}
+
+	return exitCodeFor(succeeded, failed)
+}
+
+func runTags(args []string) int {
+	fs, jsonOutput := newFlagSet("tags", "[flags] <file>...")
+	var edits []backend.TagEdit
+	fs.Func("set", "set a tag, e.g. albumartist=Various Artists; repeat a key for multiple values", func(s string) error {
+		key, value, ok := strings.Cut(s, "=")
+		if !ok {
+			return fmt.Errorf("expected key=value")
+		}
+		for i := range edits {
+			if edits[i].Key == key {
+				edits[i].Values = append(edits[i].Values, value)
+				return nil
+			}
+		}
+		edits = append(edits, backend.TagEdit{Key: key, Values: []string{value}})
+		return nil
+	})
+	fs.Func("remove", "remove a tag", func(key string) error {
+		edits = append(edits, backend.TagEdit{Key: key})
+		return nil
+	})
+	dryRun := fs.Bool("dry-run", false, "only show the changes")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if code := requireArgs(fs, 1); code >= 0 {
+		return code
+	}
+
+	succeeded, failed := 0, 0
+
+	// Without edits, list the tags
+	if len(edits) == 0 {
+		var results []*backend.FileTags
+		for _, file := range fs.Args() {
+			tags, err := backend.ReadAllTags(file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "spotidl: %s: %v\n", file, err)
+				failed++
+				continue
+			}
+			results = append(results, tags)
+			succeeded++
+		}
+		if *jsonOutput {
+			printJSON(results)
+			return exitCodeFor(succeeded, failed)
+		}
+		for _, tags := range results {
+			fmt.Printf("%s (%s)\n", tags.Path, tags.Format)
+			for _, field := range tags.Fields {
+				for _, value := range field.Values {
+					fmt.Printf("  %-28s %s\n", field.Key, value)
+				}
+			}
+			for _, pic := range tags.Pictures {
+				fmt.Printf("  %-28s type %d, %s, %d bytes\n", "[picture]", pic.Type, pic.MIME, pic.Size)
+			}
+			fmt.Println()
+		}
+		return exitCodeFor(succeeded, failed)
+	}
+
+	results, err := backend.WriteTags(backend.TagWriteRequest{Files: fs.Args(), Edits: edits, DryRun: *dryRun})
+	if err != nil {
+		return fatal(*jsonOutput, err)
+	}
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		} else {
+			succeeded++
+		}
+	}
+
+	if *jsonOutput {
+		printJSON(results)
+		return exitCodeFor(succeeded, failed)
+	}
+	for _, r := range results {
+		if r.Error != "" {
+			fmt.Printf("[%s] %s: %s\n", statusLabel(false, false), r.Path, r.Error)
+			continue
+		}
+		fmt.Printf("[%s] %s\n", statusLabel(true, len(r.Changes) == 0), r.Path)
+		for _, c := range r.Changes {
+			fmt.Printf("  %s: %q -> %q\n", c.Key, strings.Join(c.Old, "; "), strings.Join(c.New, "; "))
+		}
+	}
+
+	return exitCodeFor(succeeded, failed)
+}
+
+func runLoudness(args []string) int {
+	fs, jsonOutput := newFlagSet("loudness", "[flags] <file-or-folder>...")
+	write := fs.Bool("write", false, "write ReplayGain track and album tags")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if code := requireArgs(fs, 1); code >= 0 {
+		return code
+	}
+
+	// Folders are scanned recursively; albums are grouped across all arguments
+	var files []string
+	for _, arg := range fs.Args() {
+		info, err := os.Stat(arg)
+		if err != nil || !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		found, err := backend.ListAudioFiles(arg)
+		if err != nil {
+			return fatal(*jsonOutput, err)
+		}
+		for _, file := range found {
+			files = append(files, file.Path)
+		}
+	}
+
+	results, err := backend.ScanLoudness(backend.LoudnessScanRequest{Files: files, WriteTags: *write})
+	if err != nil {
+		return fatal(*jsonOutput, err)
+	}
+
+	succeeded, failed := 0, 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		} else {
+			succeeded++
+		}
+	}
+
+	if *jsonOutput {
+		printJSON(results)
+		return exitCodeFor(succeeded, failed)
+	}
+
+	for _, r := range results {
+		if r.Error != "" {
+			fmt.Printf("%s\n  error: %s\n\n", r.Path, r.Error)
+			continue
+		}
+		fmt.Printf("%s\n", r.Path)
+		fmt.Printf("  Integrated:     %.1f LUFS\n", r.Integrated)
+		fmt.Printf("  True peak:      %.1f dBTP\n", r.TruePeak)
+		fmt.Printf("  Loudness range: %.1f LU\n", r.LoudnessRange)
+		fmt.Printf("  Track gain:     %+.2f dB\n", r.TrackGain)
+		if r.AlbumGain != nil {
+			fmt.Printf("  Album gain:     %+.2f dB (%s)\n", *r.AlbumGain, r.Album)
+		}
+		fmt.Println()
+	}
+	if *write {
+		fmt.Printf("%d tagged, %d failed\n", succeeded, failed)
+	}
+
+	return exitCodeFor(succeeded, failed)
+}
@@ -36,7 +36,7 @@ import { SpotifyAccountPage } from "@/components/SpotifyAccountPage";
 import type { HistoryItem } from "@/components/FetchHistory";
 
 // Hooks
-import { useDownload } from "@/hooks/useDownload";
+import { useDownload, offerResumeQueue } from "@/hooks/useDownload";
 import { useMetadata } from "@/hooks/useMetadata";
 import { useLyrics } from "@/hooks/useLyrics";
 import { useCover } from "@/hooks/useCover";
@@ -97,6 +97,7 @@ function App() {
     mediaQuery.addEventListener("change", handleChange);
     checkForUpdates();
     loadHistory();
+    offerResumeQueue();
 
     // Scroll listener for jump to top button
     const handleScroll = () => {
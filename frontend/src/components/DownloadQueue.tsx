@@ -1,4 +1,3 @@
-import { useEffect, useState } from "react";
 import { X, Download, CheckCircle2, XCircle, Clock, FileCheck, Trash2, HardDrive, Zap, Timer } from "lucide-react";
 import { Button } from "@/components/ui/button";
 import {
@@ -8,8 +7,8 @@ import {
   DialogTitle,
 } from "@/components/ui/dialog";
 import { Badge } from "@/components/ui/badge";
-import { GetDownloadQueue, ClearCompletedDownloads } from "../../wailsjs/go/main/App";
-import { backend } from "../../wailsjs/go/models";
+import { ClearCompletedDownloads } from "../../wailsjs/go/main/App";
+import { useDownloadQueueData } from "@/hooks/useDownloadQueueData";
 
 interface DownloadQueueProps {
   isOpen: boolean;
@@ -17,47 +16,13 @@ interface DownloadQueueProps {
 }
 
 export function DownloadQueue({ isOpen, onClose }: DownloadQueueProps) {
-  const [queueInfo, setQueueInfo] = useState<backend.DownloadQueueInfo>(
-    new backend.DownloadQueueInfo({
-      is_downloading: false,
-      queue: [],
-      current_speed: 0,
-      total_downloaded: 0,
-      session_start_time: 0,
-      queued_count: 0,
-      completed_count: 0,
-      failed_count: 0,
-      skipped_count: 0,
-    })
-  );
-
-  useEffect(() => {
-    if (!isOpen) return;
-
-    const fetchQueue = async () => {
-      try {
-        const info = await GetDownloadQueue();
-        setQueueInfo(info);
-      } catch (error) {
-        console.error("Failed to get download queue:", error);
-      }
-    };
-
-    // Initial fetch
-    fetchQueue();
-
-    // Poll every 500ms when dialog is open
-    const interval = setInterval(fetchQueue, 500);
-
-    return () => clearInterval(interval);
-  }, [isOpen]);
+  // Kept up to date by events pushed from the backend
+  const queueInfo = useDownloadQueueData();
 
   const handleClearHistory = async () => {
     try {
+      // Removed items arrive as events
       await ClearCompletedDownloads();
-      // Refetch immediately to update UI
-      const info = await GetDownloadQueue();
-      setQueueInfo(info);
     } catch (error) {
       console.error("Failed to clear history:", error);
     }
@@ -243,6 +208,11 @@ export function DownloadQueue({ isOpen, onClose }: DownloadQueueProps) {
                               ? `${queueInfo.current_speed.toFixed(2)} MB/s`
                               : "—"}
                           </span>
+                          {item.attempt > 1 && (
+                            <span className="text-yellow-600 dark:text-yellow-500">
+                              retry {item.attempt}/{item.max_attempts}
+                            </span>
+                          )}
                         </div>
                       )}
 
@@ -11,7 +11,7 @@ import {
 } from "@/components/ui/select";
 
 import { Tooltip, TooltipContent, TooltipTrigger } from "@/components/ui/tooltip";
-import { FolderOpen, Save, RotateCcw, Info } from "lucide-react";
+import { FolderOpen, Save, RotateCcw, Info, ChevronUp, ChevronDown } from "lucide-react";
 import {
   Dialog,
   DialogContent,
@@ -21,11 +21,15 @@ import {
   DialogTitle,
 } from "@/components/ui/dialog";
 import { Switch } from "@/components/ui/switch";
-import { getSettings, getSettingsWithDefaults, saveSettings, resetToDefaultSettings, applyThemeMode, applyFont, FONT_OPTIONS, FOLDER_PRESETS, FILENAME_PRESETS, TEMPLATE_VARIABLES, type Settings as SettingsType, type FontFamily, type FolderPreset, type FilenamePreset } from "@/lib/settings";
+import { getSettings, getSettingsWithDefaults, saveSettings, resetToDefaultSettings, applyThemeMode, applyFont, FONT_OPTIONS, FOLDER_PRESETS, FILENAME_PRESETS, FILESYSTEM_OPTIONS, TEMPLATE_VARIABLES, TEMPLATE_SYNTAX, type Settings as SettingsType, type FontFamily, type FolderPreset, type FilenamePreset, type TargetFilesystem } from "@/lib/settings";
 import { themes, applyTheme } from "@/lib/themes";
 import { SelectFolder } from "../../wailsjs/go/main/App";
 import { toastWithSound as toast } from "@/lib/toast-with-sound";
 
+// Available after Wails regenerates bindings
+const GetDownloadProviders = (): Promise<string[]> =>
+  (window as any)["go"]["main"]["App"]["GetDownloadProviders"]();
+
 // Audio Format Icons
 const FlacIcon = () => (
   <svg width="16" height="16" xmlns="http://www.w3.org/2000/svg" viewBox="0 0 16 16" className="inline-block mr-2 fill-muted-foreground">
@@ -46,6 +50,25 @@ export function SettingsPage() {
   const [tempSettings, setTempSettings] = useState<SettingsType>(savedSettings);
   const [isDark, setIsDark] = useState(document.documentElement.classList.contains('dark'));
   const [showResetConfirm, setShowResetConfirm] = useState(false);
+  const [providers, setProviders] = useState<string[]>([]);
+
+  useEffect(() => {
+    GetDownloadProviders()
+      .then((names) => setProviders(names || []))
+      .catch((err) => console.error("Failed to load download providers:", err));
+  }, []);
+
+  // Saved order first, then providers registered since the order was saved
+  const providerOrder = [
+    ...tempSettings.providerOrder.filter((name) => providers.includes(name)),
+    ...providers.filter((name) => !tempSettings.providerOrder.includes(name)),
+  ];
+
+  const moveProvider = (index: number, offset: number) => {
+    const order = [...providerOrder];
+    [order[index], order[index + offset]] = [order[index + offset], order[index]];
+    setTempSettings((prev) => ({ ...prev, providerOrder: order }));
+  };
 
   useEffect(() => {
     applyThemeMode(savedSettings.themeMode);
@@ -248,7 +271,51 @@ export function SettingsPage() {
             </Select>
           </div>
 
-          {/* Embed Lyrics & Embed Max Quality Cover */}
+          {/* Download Sources */}
+          {providerOrder.length > 0 && (
+            <div className="space-y-2">
+              <div className="flex items-center gap-2">
+                <Label className="text-sm">Download Sources</Label>
+                <Tooltip>
+                  <TooltipTrigger asChild>
+                    <Info className="h-3.5 w-3.5 text-muted-foreground cursor-help" />
+                  </TooltipTrigger>
+                  <TooltipContent side="top" className="max-w-xs">
+                    <p className="text-xs">Sources are tried from top to bottom until one has the track.</p>
+                  </TooltipContent>
+                </Tooltip>
+              </div>
+              <div className="border rounded-md divide-y">
+                {providerOrder.map((name, index) => (
+                  <div key={name} className="flex items-center justify-between px-3 py-1.5 text-sm">
+                    <span className="font-mono">{index + 1}. {name}</span>
+                    <div className="flex items-center gap-1">
+                      <Button
+                        variant="ghost"
+                        size="icon"
+                        className="h-6 w-6"
+                        disabled={index === 0}
+                        onClick={() => moveProvider(index, -1)}
+                      >
+                        <ChevronUp className="h-3.5 w-3.5" />
+                      </Button>
+                      <Button
+                        variant="ghost"
+                        size="icon"
+                        className="h-6 w-6"
+                        disabled={index === providerOrder.length - 1}
+                        onClick={() => moveProvider(index, 1)}
+                      >
+                        <ChevronDown className="h-3.5 w-3.5" />
+                      </Button>
+                    </div>
+                  </div>
+                ))}
+              </div>
+            </div>
+          )}
+
+          {/* Embed Lyrics, Embed Max Quality Cover & Join Artist Tags */}
           <div className="flex items-center gap-6">
             <div className="flex items-center gap-3">
               <Label htmlFor="embed-lyrics" className="cursor-pointer text-sm">Embed Lyrics</Label>
@@ -266,6 +333,22 @@ export function SettingsPage() {
                 onCheckedChange={(checked) => setTempSettings(prev => ({ ...prev, embedMaxQualityCover: checked }))}
               />
             </div>
+            <div className="flex items-center gap-3">
+              <Label htmlFor="join-artists" className="cursor-pointer text-sm">Join Artist Tags</Label>
+              <Switch
+                id="join-artists"
+                checked={tempSettings.joinArtists}
+                onCheckedChange={(checked) => setTempSettings(prev => ({ ...prev, joinArtists: checked }))}
+              />
+            </div>
+            <div className="flex items-center gap-3">
+              <Label htmlFor="replay-gain" className="cursor-pointer text-sm">ReplayGain for Albums</Label>
+              <Switch
+                id="replay-gain"
+                checked={tempSettings.replayGain}
+                onCheckedChange={(checked) => setTempSettings(prev => ({ ...prev, replayGain: checked }))}
+              />
+            </div>
           </div>
 
           <div className="border-t" />
@@ -280,6 +363,7 @@ export function SettingsPage() {
                 </TooltipTrigger>
                 <TooltipContent side="top">
                   <p className="text-xs whitespace-nowrap">Variables: {TEMPLATE_VARIABLES.map(v => v.key).join(", ")}</p>
+                  <p className="text-xs whitespace-nowrap">Syntax: {TEMPLATE_SYNTAX.map(v => `${v.key} ${v.description.toLowerCase()}`).join("; ")}</p>
                 </TooltipContent>
               </Tooltip>
             </div>
@@ -332,6 +416,7 @@ export function SettingsPage() {
                 </TooltipTrigger>
                 <TooltipContent side="top">
                   <p className="text-xs whitespace-nowrap">Variables: {TEMPLATE_VARIABLES.map(v => v.key).join(", ")}</p>
+                  <p className="text-xs whitespace-nowrap">Syntax: {TEMPLATE_SYNTAX.map(v => `${v.key} ${v.description.toLowerCase()}`).join("; ")}</p>
                 </TooltipContent>
               </Tooltip>
             </div>
@@ -371,6 +456,37 @@ export function SettingsPage() {
               </p>
             )}
           </div>
+
+          <div className="border-t" />
+
+          {/* Target Filesystem */}
+          <div className="space-y-2">
+            <div className="flex items-center gap-2">
+              <Label className="text-sm">Target Filesystem</Label>
+              <Tooltip>
+                <TooltipTrigger asChild>
+                  <Info className="h-3.5 w-3.5 text-muted-foreground cursor-help" />
+                </TooltipTrigger>
+                <TooltipContent side="top">
+                  <p className="text-xs whitespace-nowrap">Invalid characters, reserved names and overly long names are fixed for this filesystem</p>
+                </TooltipContent>
+              </Tooltip>
+            </div>
+            <Select
+              value={tempSettings.filesystem}
+              onValueChange={(value: TargetFilesystem) => setTempSettings(prev => ({ ...prev, filesystem: value }))}
+            >
+              <SelectTrigger className="h-9 w-fit">
+                <SelectValue />
+              </SelectTrigger>
+              <SelectContent>
+                {Object.entries(FILESYSTEM_OPTIONS).map(([key, { label }]) => (
+                  <SelectItem key={key} value={key}>{label}</SelectItem>
+                ))}
+              </SelectContent>
+            </Select>
+            <p className="text-xs text-muted-foreground">{FILESYSTEM_OPTIONS[tempSettings.filesystem]?.description}</p>
+          </div>
         </div>
       </div>
 
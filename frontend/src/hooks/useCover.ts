@@ -1,6 +1,6 @@
 import { useState, useRef } from "react";
 import { downloadCover } from "@/lib/api";
-import { getSettings, parseTemplate, type TemplateData } from "@/lib/settings";
+import { getSettings } from "@/lib/settings";
 import { toastWithSound as toast } from "@/lib/toast-with-sound";
 import { joinPath, sanitizePath } from "@/lib/utils";
 import { logger } from "@/lib/logger";
@@ -44,34 +44,11 @@ export function useCover() {
       const os = settings.operatingSystem;
       let outputDir = settings.downloadPath;
 
-      // Replace forward slashes in template data values to prevent them from being interpreted as path separators
-      const placeholder = "__SLASH_PLACEHOLDER__";
-      const templateData: TemplateData = {
-        artist: artistName?.replace(/\//g, placeholder),
-        album: albumName?.replace(/\//g, placeholder),
-        title: trackName?.replace(/\//g, placeholder),
-        track: position,
-        playlist: playlistName?.replace(/\//g, placeholder),
-      };
-
       // For playlist/discography, prepend the folder name
       if (playlistName) {
         outputDir = joinPath(os, outputDir, sanitizePath(playlistName.replace(/\//g, " "), os));
       }
 
-      // Apply folder template
-      if (settings.folderTemplate) {
-        const folderPath = parseTemplate(settings.folderTemplate, templateData);
-        if (folderPath) {
-          const parts = folderPath.split("/").filter((p: string) => p.trim());
-          for (const part of parts) {
-            // Restore any slashes that were in the original values as spaces
-            const sanitizedPart = part.replace(new RegExp(placeholder, "g"), " ");
-            outputDir = joinPath(os, outputDir, sanitizePath(sanitizedPart, os));
-          }
-        }
-      }
-
       const response = await downloadCover({
         cover_url: coverUrl,
         track_name: trackName,
@@ -80,6 +57,9 @@ export function useCover() {
         album_artist: albumArtist || "",
         release_date: releaseDate || "",
         output_dir: outputDir,
+        folder_template: settings.folderTemplate || undefined,
+        filesystem: settings.filesystem,
+        playlist_name: playlistName,
         filename_format: settings.filenameTemplate || "{title}",
         track_number: settings.trackNumber,
         position: position || 0,
@@ -152,38 +132,16 @@ export function useCover() {
         const os = settings.operatingSystem;
         let outputDir = settings.downloadPath;
 
-        // Replace forward slashes in template data values to prevent them from being interpreted as path separators
-        const placeholder = "__SLASH_PLACEHOLDER__";
         // Determine if we should use album track number or sequential position
         const useAlbumTrackNumber = settings.folderTemplate?.includes("{album}") || false;
         // Use track.track_number for album context, otherwise use sequential position (consistent with track download)
         const trackPosition = useAlbumTrackNumber ? (track.track_number || i + 1) : (i + 1);
-        const templateData: TemplateData = {
-          artist: track.artists?.replace(/\//g, placeholder),
-          album: track.album_name?.replace(/\//g, placeholder),
-          title: track.name?.replace(/\//g, placeholder),
-          track: trackPosition,
-          playlist: playlistName?.replace(/\//g, placeholder),
-        };
 
         // For playlist/discography, prepend the folder name
         if (playlistName) {
           outputDir = joinPath(os, outputDir, sanitizePath(playlistName.replace(/\//g, " "), os));
         }
 
-        // Apply folder template
-        if (settings.folderTemplate) {
-          const folderPath = parseTemplate(settings.folderTemplate, templateData);
-          if (folderPath) {
-            const parts = folderPath.split("/").filter((p: string) => p.trim());
-            for (const part of parts) {
-              // Restore any slashes that were in the original values as spaces
-              const sanitizedPart = part.replace(new RegExp(placeholder, "g"), " ");
-              outputDir = joinPath(os, outputDir, sanitizePath(sanitizedPart, os));
-            }
-          }
-        }
-
         const response = await downloadCover({
           cover_url: track.images,
           track_name: track.name,
@@ -192,6 +150,9 @@ export function useCover() {
           album_artist: track.album_artist,
           release_date: track.release_date,
           output_dir: outputDir,
+          folder_template: settings.folderTemplate || undefined,
+          filesystem: settings.filesystem,
+          playlist_name: playlistName,
           filename_format: settings.filenameTemplate || "{title}",
           track_number: settings.trackNumber,
           position: trackPosition,
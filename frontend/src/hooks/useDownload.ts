@@ -1,11 +1,21 @@
 import { useState, useRef } from "react";
-import { downloadTrack } from "@/lib/api";
-import { getSettings, parseTemplate, type TemplateData } from "@/lib/settings";
+import { GetDownloadQueue } from "../../wailsjs/go/main/App";
+import { EventsOn } from "../../wailsjs/runtime/runtime";
+import { backend } from "../../wailsjs/go/models";
+import { getSettings } from "@/lib/settings";
 import { ensureValidToken } from "@/lib/token-manager";
 import { toastWithSound as toast } from "@/lib/toast-with-sound";
 import { joinPath, sanitizePath } from "@/lib/utils";
 import { logger } from "@/lib/logger";
-import type { TrackMetadata } from "@/types/api";
+import { DOWNLOAD_EVENT, type DownloadEvent } from "@/lib/download-events";
+import type {
+  TrackMetadata,
+  DownloadRequest,
+  LoudnessScanRequest,
+  LoudnessResult,
+  FlacAvailabilityRequest,
+  FlacAvailability,
+} from "@/types/api";
 
 // Type definitions for new backend functions
 interface CheckFileExistenceRequest {
@@ -27,6 +37,142 @@ const CheckFilesExistence = (outputDir: string, audioFormat: string, tracks: Che
   (window as any)["go"]["main"]["App"]["CheckFilesExistence"](outputDir, audioFormat, tracks);
 const SkipDownloadItem = (itemID: string, filePath: string): Promise<void> =>
   (window as any)["go"]["main"]["App"]["SkipDownloadItem"](itemID, filePath);
+const ScanLoudness = (req: LoudnessScanRequest): Promise<LoudnessResult[]> =>
+  (window as any)["go"]["main"]["App"]["ScanLoudness"](req);
+const CheckFlacAvailability = (req: FlacAvailabilityRequest): Promise<FlacAvailability[]> =>
+  (window as any)["go"]["main"]["App"]["CheckFlacAvailability"](req);
+const ResumeQueue = (): Promise<DownloadRequest[] | null> =>
+  (window as any)["go"]["main"]["App"]["ResumeQueue"]();
+const QueueDownloads = (reqs: DownloadRequest[]): Promise<{ batch_id: string; item_ids: string[] }> =>
+  (window as any)["go"]["main"]["App"]["QueueDownloads"](reqs);
+const PauseDownloadBatch = (batchID: string): Promise<void> =>
+  (window as any)["go"]["main"]["App"]["PauseDownloadBatch"](batchID);
+const ResumeDownloadBatch = (batchID: string): Promise<void> =>
+  (window as any)["go"]["main"]["App"]["ResumeDownloadBatch"](batchID);
+const CancelDownloadBatch = (batchID: string): Promise<void> =>
+  (window as any)["go"]["main"]["App"]["CancelDownloadBatch"](batchID);
+
+// The scheduler marks cancelled items as skipped with this message
+const CANCELLED = "Cancelled";
+
+function isFinished(item: backend.DownloadItem) {
+  return item.status === "completed" || item.status === "failed" || item.status === "skipped";
+}
+
+// Hands the requests to the backend scheduler. onUpdate sees every change to the batch's items, and
+// done resolves with each item once all of them have finished.
+async function queueDownloads(
+  reqs: DownloadRequest[],
+  onUpdate: (item: backend.DownloadItem) => void
+): Promise<{ batchID: string; done: Promise<Map<string, backend.DownloadItem>> }> {
+  // Item IDs are chosen here so events can be matched to the batch before QueueDownloads returns
+  const now = Date.now();
+  const queued = reqs.map((req, i) => ({ ...req, item_id: `${req.isrc}-${now}-${i}` }));
+  const itemIDs = new Set(queued.map((req) => req.item_id));
+  const finished = new Map<string, backend.DownloadItem>();
+
+  let unsubscribe = () => {};
+  const done = new Promise<Map<string, backend.DownloadItem>>((resolve) => {
+    const record = (item: backend.DownloadItem) => {
+      if (!itemIDs.has(item.id)) return;
+      onUpdate(item);
+      if (isFinished(item)) {
+        finished.set(item.id, item);
+      } else {
+        finished.delete(item.id);
+      }
+      if (finished.size === itemIDs.size) {
+        unsubscribe();
+        resolve(finished);
+      }
+    };
+
+    unsubscribe = EventsOn(DOWNLOAD_EVENT, async (event: DownloadEvent) => {
+      if (event.type === "reset") {
+        // Events were dropped; read the batch's items from the queue instead
+        try {
+          const info = await GetDownloadQueue();
+          info.queue.forEach(record);
+        } catch (err) {
+          logger.error(`failed to reload download queue: ${err}`);
+        }
+        return;
+      }
+      if (event.item) record(event.item);
+    });
+  });
+
+  try {
+    const { batch_id } = await QueueDownloads(queued);
+    return { batchID: batch_id, done };
+  } catch (err) {
+    unsubscribe();
+    throw err;
+  }
+}
+
+// Warns before a FLAC batch starts when some tracks will fall back to MP3
+async function warnUnavailableFlac(tracks: TrackMetadata[]) {
+  const trackIDs = tracks.map((track) => track.spotify_id).filter((id): id is string => !!id);
+  if (trackIDs.length === 0) return;
+  logger.info(`checking flac availability for ${trackIDs.length} tracks...`);
+  try {
+    const sessionToken = await ensureValidToken();
+    const results = await CheckFlacAvailability({ session_token: sessionToken, track_ids: trackIDs });
+    const unavailable = results.filter((r) => !r.available && !r.error).length;
+    if (unavailable > 0) {
+      toast.warning(`${unavailable} of ${trackIDs.length} tracks are not available in FLAC and will be downloaded as MP3`);
+    }
+  } catch (err) {
+    logger.error(`flac availability check failed: ${err}`);
+  }
+}
+
+// Offers to finish downloads that were interrupted when the app last stopped
+export async function offerResumeQueue() {
+  let requests: DownloadRequest[] | null;
+  try {
+    requests = await ResumeQueue();
+  } catch (err) {
+    logger.error(`failed to read interrupted downloads: ${err}`);
+    return;
+  }
+  if (!requests || requests.length === 0) return;
+
+  const pending = requests;
+  toast.info(`${pending.length} interrupted downloads in queue`, {
+    duration: Infinity,
+    action: {
+      label: "Resume",
+      onClick: async () => {
+        try {
+          // Journaled requests don't keep the short-lived session token
+          const sessionToken = await ensureValidToken();
+          await QueueDownloads(pending.map((req) => ({ ...req, session_token: sessionToken })));
+          logger.info(`resumed ${pending.length} downloads`);
+        } catch (err) {
+          toast.error(`Failed to resume downloads: ${err}`);
+        }
+      },
+    },
+  });
+}
+
+// Measures the album's loudness and writes ReplayGain tags to its files
+async function writeAlbumReplayGain(files: string[]) {
+  if (files.length === 0) return;
+  logger.info(`writing replaygain tags for ${files.length} files...`);
+  try {
+    const results = await ScanLoudness({ files, write_tags: true });
+    const failed = results.filter((r) => r.error);
+    for (const r of failed) {
+      logger.error(`replaygain failed: ${r.path} - ${r.error}`);
+    }
+    logger.success(`replaygain tags written to ${results.length - failed.length} files`);
+  } catch (err) {
+    logger.error(`replaygain error: ${err}`);
+  }
+}
 
 export function useDownload() {
   const [downloadProgress, setDownloadProgress] = useState<number>(0);
@@ -41,83 +187,56 @@ export function useDownload() {
     name: string;
     artists: string;
   } | null>(null);
-  const shouldStopDownloadRef = useRef(false);
-  const isPausedRef = useRef(false);
-
-  const waitIfPaused = async () => {
-    while (isPausedRef.current && !shouldStopDownloadRef.current) {
-      await new Promise((resolve) => setTimeout(resolve, 300));
-    }
-  };
+  const batchIDRef = useRef<string | null>(null);
 
-  const downloadWithSpotiDownloader = async (
+  const buildDownloadRequest = (
     track: TrackMetadata,
     // eslint-disable-next-line @typescript-eslint/no-explicit-any
     settings: any,
+    sessionToken: string,
     playlistName?: string,
     position?: number,
-    retryCount: number = 0,
-    isAlbum?: boolean,
-    releaseYear?: string
-  ) => {
-    const sessionToken = await ensureValidToken();
+    isAlbum?: boolean
+  ): DownloadRequest => {
     const os = settings.operatingSystem;
     let outputDir = settings.downloadPath;
     let useAlbumTrackNumber = false;
 
-    // Replace forward slashes in template data values to prevent them from being interpreted as path separators
-    const placeholder = "__SLASH_PLACEHOLDER__";
-    const templateData: TemplateData = {
-      artist: track.artists?.replace(/\//g, placeholder) || undefined,
-      album: track.album_name?.replace(/\//g, placeholder) || undefined,
-      album_artist: track.album_artist?.replace(/\//g, placeholder) || track.artists?.replace(/\//g, placeholder) || undefined,
-      title: track.name?.replace(/\//g, placeholder) || undefined,
-      track: position,
-      disc: track.disc_number,
-      year: releaseYear || track.release_date?.substring(0, 4),
-      playlist: playlistName?.replace(/\//g, placeholder) || undefined,
-      isrc: track.isrc,
-    };
-
     if (playlistName && !isAlbum) {
       outputDir = joinPath(os, outputDir, sanitizePath(playlistName.replace(/\//g, " "), os));
     }
 
-    if (settings.folderTemplate) {
-      const folderPath = parseTemplate(settings.folderTemplate, templateData);
-      if (folderPath) {
-        // Split by / (template separators), then restore placeholders as spaces
-        const parts = folderPath.split("/").filter((p: string) => p.trim());
-        for (const part of parts) {
-          // Restore any slashes that were in the original values as spaces
-          const sanitizedPart = part.replace(new RegExp(placeholder, "g"), " ");
-          outputDir = joinPath(os, outputDir, sanitizePath(sanitizedPart, os));
-        }
-      }
-
-      // Use album track number if template contains {album}
-      if (settings.folderTemplate.includes("{album}")) {
-        useAlbumTrackNumber = true;
-      }
+    // The backend renders the folder template below output_dir; use album track numbers when folders are per album
+    if (settings.folderTemplate?.includes("{album}")) {
+      useAlbumTrackNumber = true;
     }
 
-    const { AddToDownloadQueue } = await import("../../wailsjs/go/main/App");
-    const itemID = await AddToDownloadQueue(track.isrc, track.name || "", track.artists || "", track.album_name || "");
-
-    const response = await downloadTrack({
+    return {
       isrc: track.isrc,
       track_id: track.spotify_id,
       session_token: sessionToken,
       track_name: track.name,
       artist_name: track.artists,
+      artists: track.artists_data?.map((artist) => artist.name),
+      join_artists: settings.joinArtists,
       album_name: track.album_name,
       album_artist: track.album_artist,
       release_date: track.release_date,
+      album_type: track.album_type,
       cover_url: track.images,
       album_track_number: track.track_number,
       disc_number: track.disc_number,
       total_tracks: track.total_tracks, // Total tracks in album from Spotify
+      total_discs: track.total_discs,
+      album_id: track.album_id,
+      label: track.label,
+      copyright: track.copyright,
+      genres: track.genres,
+      duration_ms: track.duration_ms,
       output_dir: outputDir,
+      folder_template: settings.folderTemplate || undefined,
+      filesystem: settings.filesystem,
+      playlist_name: playlistName,
       audio_format: settings.audioFormat,
       filename_format: settings.filenameTemplate,
       track_number: settings.trackNumber,
@@ -126,23 +245,25 @@ export function useDownload() {
       spotify_id: track.spotify_id,
       embed_lyrics: settings.embedLyrics,
       embed_max_quality_cover: settings.embedMaxQualityCover,
-      item_id: itemID,
-    });
+      provider_order: settings.providerOrder,
+    };
+  };
 
-    if (!response.success && retryCount < 2) {
-      const errorMsg = response.error?.toLowerCase() || "";
-      if (errorMsg.includes("unauthorized") || errorMsg.includes("403") || errorMsg.includes("err_unauthorized")) {
-        await ensureValidToken(true);
-        return downloadWithSpotiDownloader(track, settings, playlistName, position, retryCount + 1, isAlbum, releaseYear);
-      }
+  const markFinished = (item: backend.DownloadItem) => {
+    if (item.status === "failed") {
+      setFailedTracks((prev) => new Set(prev).add(item.isrc));
+      return;
     }
-
-    if (!response.success && response.item_id) {
-      const { MarkDownloadItemFailed } = await import("../../wailsjs/go/main/App");
-      await MarkDownloadItemFailed(response.item_id, response.error || "Download failed");
+    if (item.status === "skipped" && item.error_message === CANCELLED) return;
+    if (item.status === "skipped") {
+      setSkippedTracks((prev) => new Set(prev).add(item.isrc));
     }
-
-    return response;
+    setDownloadedTracks((prev) => new Set(prev).add(item.isrc));
+    setFailedTracks((prev) => {
+      const newSet = new Set(prev);
+      newSet.delete(item.isrc);
+      return newSet;
+    });
   };
 
   const handleDownloadTrack = async (
@@ -162,27 +283,21 @@ export function useDownload() {
     setDownloadingTrack(track.isrc);
 
     try {
-      const response = await downloadWithSpotiDownloader(track, settings, playlistName, position, 0, isAlbum);
-
-      if (response.success) {
-        if (response.already_exists) {
-          logger.info(`skipped: ${track.name} - ${track.artists} (already exists)`);
-          toast.info(response.message);
-          setSkippedTracks((prev) => new Set(prev).add(track.isrc));
-        } else {
-          logger.success(`downloaded: ${track.name} - ${track.artists}`);
-          toast.success(response.message);
-        }
-        setDownloadedTracks((prev) => new Set(prev).add(track.isrc));
-        setFailedTracks((prev) => {
-          const newSet = new Set(prev);
-          newSet.delete(track.isrc);
-          return newSet;
-        });
+      const sessionToken = await ensureValidToken();
+      const req = buildDownloadRequest(track, settings, sessionToken, playlistName, position, isAlbum);
+      const { done } = await queueDownloads([req], () => {});
+      const [item] = [...(await done).values()];
+
+      markFinished(item);
+      if (item.status === "completed") {
+        logger.success(`downloaded: ${track.name} - ${track.artists}`);
+        toast.success("Download completed successfully");
+      } else if (item.status === "skipped") {
+        logger.info(`skipped: ${track.name} - ${track.artists} (${item.error_message || "already exists"})`);
+        toast.info(item.error_message || "File already exists");
       } else {
-        logger.error(`failed: ${track.name} - ${track.artists} - ${response.error}`);
-        toast.error(response.error || "Download failed");
-        setFailedTracks((prev) => new Set(prev).add(track.isrc));
+        logger.error(`failed: ${track.name} - ${track.artists} - ${item.error_message}`);
+        toast.error(item.error_message || "Download failed");
       }
     } catch (err) {
       logger.error(`error: ${track.name} - ${err}`);
@@ -193,42 +308,32 @@ export function useDownload() {
     }
   };
 
-  const handleDownloadSelected = async (
-    selectedTracks: string[],
-    allTracks: TrackMetadata[],
+  // Downloads tracks as one scheduler batch; positions are the tracks' 1-based positions in the list shown
+  const downloadBatch = async (
+    tracks: TrackMetadata[],
+    positions: number[],
+    type: "all" | "selected",
     playlistName?: string,
     isAlbum?: boolean
   ) => {
-    if (selectedTracks.length === 0) {
-      toast.error("No tracks selected");
-      return;
-    }
-
-    shouldStopDownloadRef.current = false;
-    isPausedRef.current = false;
     setIsPaused(false);
 
-    logger.info(`starting batch download: ${selectedTracks.length} selected tracks`);
+    logger.info(`starting batch download: ${tracks.length} ${type === "selected" ? "selected " : ""}tracks`);
     const settings = getSettings();
     setIsDownloading(true);
-    setBulkDownloadType("selected");
+    setBulkDownloadType(type);
     setDownloadProgress(0);
 
-    // Build output directory path
+    // Build output directory path (same logic as buildDownloadRequest)
     let outputDir = settings.downloadPath;
     const os = settings.operatingSystem;
     if (playlistName && !isAlbum) {
       outputDir = joinPath(os, outputDir, sanitizePath(playlistName.replace(/\//g, " "), os));
     }
 
-    // Get selected track objects
-    const selectedTrackObjects = selectedTracks
-      .map((isrc) => allTracks.find((t) => t.isrc === isrc))
-      .filter((t): t is TrackMetadata => t !== undefined);
-
     // Check file existence in parallel first
     logger.info(`checking existing files in parallel...`);
-    const existenceChecks = selectedTrackObjects.map((track) => ({
+    const existenceChecks = tracks.map((track) => ({
       isrc: track.isrc,
       track_name: track.name || "",
       artist_name: track.artists || "",
@@ -249,85 +354,95 @@ export function useDownload() {
 
     // Mark existing files as skipped immediately and add to queue
     const { AddToDownloadQueue } = await import("../../wailsjs/go/main/App");
-    for (const track of selectedTrackObjects) {
+    for (const track of tracks) {
       if (existingISRCs.has(track.isrc)) {
         const itemID = await AddToDownloadQueue(track.isrc, track.name || "", track.artists || "", track.album_name || "");
         const filePath = existingFilePaths.get(track.isrc) || "";
+        // Use a small delay to ensure the item is added before skipping
         setTimeout(() => SkipDownloadItem(itemID, filePath), 10);
         setSkippedTracks((prev) => new Set(prev).add(track.isrc));
         setDownloadedTracks((prev) => new Set(prev).add(track.isrc));
       }
     }
 
-    // Filter out existing tracks
-    const tracksToDownload = selectedTrackObjects.filter((track) => !existingISRCs.has(track.isrc));
-
     let successCount = 0;
     let errorCount = 0;
     let skippedCount = existingISRCs.size;
-    const total = selectedTracks.length;
+    let cancelledCount = 0;
+    const albumFiles = [...existingFilePaths.values()].filter(Boolean);
+    const total = tracks.length;
 
     // Update progress to reflect already-skipped tracks
     setDownloadProgress(Math.round((skippedCount / total) * 100));
 
-    for (let i = 0; i < tracksToDownload.length; i++) {
-      await waitIfPaused();
+    const toDownload = tracks
+      .map((track, i) => ({ track, position: positions[i] }))
+      .filter(({ track }) => !existingISRCs.has(track.isrc));
 
-      if (shouldStopDownloadRef.current) {
-        toast.info(`Download stopped. ${successCount} tracks downloaded, ${tracksToDownload.length - i} remaining.`);
-        break;
+    if (toDownload.length > 0) {
+      if (settings.audioFormat === "flac") {
+        await warnUnavailableFlac(toDownload.map(({ track }) => track));
       }
 
-      const track = tracksToDownload[i];
-      const isrc = track.isrc;
-      // Calculate original position in selected list
-      const originalIndex = selectedTracks.indexOf(isrc);
-      setDownloadingTrack(isrc);
-      setCurrentDownloadInfo({ name: track.name, artists: track.artists });
-
       try {
-        const releaseYear = track.release_date?.substring(0, 4);
-        const response = await downloadWithSpotiDownloader(track, settings, playlistName, originalIndex + 1, 0, isAlbum, releaseYear);
+        const sessionToken = await ensureValidToken();
+        const reqs = toDownload.map(({ track, position }) =>
+          buildDownloadRequest(track, settings, sessionToken, playlistName, position, isAlbum)
+        );
+
+        let finishedCount = 0;
+        const { batchID, done } = await queueDownloads(reqs, (item) => {
+          if (item.status === "downloading") {
+            setDownloadingTrack(item.isrc);
+            setCurrentDownloadInfo({ name: item.track_name, artists: item.artist_name });
+          } else if (isFinished(item)) {
+            finishedCount++;
+            markFinished(item);
+            setDownloadProgress(Math.min(100, Math.round(((skippedCount + finishedCount) / total) * 100)));
+          }
+        });
+        batchIDRef.current = batchID;
 
-        if (response.success) {
-          if (response.already_exists) {
+        for (const item of (await done).values()) {
+          if (item.status === "completed") {
+            successCount++;
+            if (item.file_path) albumFiles.push(item.file_path);
+            logger.success(`downloaded: ${item.track_name} - ${item.artist_name}`);
+          } else if (item.status === "skipped" && item.error_message === CANCELLED) {
+            cancelledCount++;
+          } else if (item.status === "skipped") {
             skippedCount++;
-            logger.info(`skipped: ${track.name} - ${track.artists} (already exists)`);
-            setSkippedTracks((prev) => new Set(prev).add(isrc));
+            if (item.file_path) albumFiles.push(item.file_path);
+            logger.info(`skipped: ${item.track_name} - ${item.artist_name} (already exists)`);
           } else {
-            successCount++;
-            logger.success(`downloaded: ${track.name} - ${track.artists}`);
+            errorCount++;
+            logger.error(`failed: ${item.track_name} - ${item.artist_name} - ${item.error_message}`);
           }
-          setDownloadedTracks((prev) => new Set(prev).add(isrc));
-          setFailedTracks((prev) => {
-            const newSet = new Set(prev);
-            newSet.delete(isrc);
-            return newSet;
-          });
-        } else {
-          errorCount++;
-          logger.error(`failed: ${track.name} - ${track.artists}`);
-          setFailedTracks((prev) => new Set(prev).add(isrc));
         }
       } catch (err) {
-        errorCount++;
-        logger.error(`error: ${track.name} - ${err}`);
-        setFailedTracks((prev) => new Set(prev).add(isrc));
+        errorCount = toDownload.length;
+        logger.error(`failed to queue downloads: ${err}`);
+        for (const { track } of toDownload) {
+          setFailedTracks((prev) => new Set(prev).add(track.isrc));
+        }
       }
-
-      const completedCount = skippedCount + successCount + errorCount;
-      setDownloadProgress(Math.min(100, Math.round((completedCount / total) * 100)));
     }
 
+    batchIDRef.current = null;
     setDownloadingTrack(null);
     setCurrentDownloadInfo(null);
     setIsDownloading(false);
     setBulkDownloadType(null);
-    shouldStopDownloadRef.current = false;
-    isPausedRef.current = false;
     setIsPaused(false);
 
     logger.info(`batch complete: ${successCount} downloaded, ${skippedCount} skipped, ${errorCount} failed`);
+    if (cancelledCount > 0) {
+      toast.info(`Download stopped. ${successCount} tracks downloaded, ${cancelledCount} remaining.`);
+      return;
+    }
+    if (isAlbum && settings.replayGain) {
+      await writeAlbumReplayGain(albumFiles);
+    }
     if (errorCount === 0 && skippedCount === 0) {
       toast.success(`Downloaded ${successCount} tracks successfully`);
     } else if (errorCount === 0 && successCount === 0) {
@@ -343,6 +458,31 @@ export function useDownload() {
     }
   };
 
+  const handleDownloadSelected = async (
+    selectedTracks: string[],
+    allTracks: TrackMetadata[],
+    playlistName?: string,
+    isAlbum?: boolean
+  ) => {
+    if (selectedTracks.length === 0) {
+      toast.error("No tracks selected");
+      return;
+    }
+
+    // Get selected track objects, numbered by their position in the selection
+    const selected = selectedTracks
+      .map((isrc, i) => ({ track: allTracks.find((t) => t.isrc === isrc), position: i + 1 }))
+      .filter((s): s is { track: TrackMetadata; position: number } => s.track !== undefined);
+
+    await downloadBatch(
+      selected.map((s) => s.track),
+      selected.map((s) => s.position),
+      "selected",
+      playlistName,
+      isAlbum
+    );
+  };
+
   const handleDownloadAll = async (
     tracks: TrackMetadata[],
     playlistName?: string,
@@ -355,158 +495,36 @@ export function useDownload() {
       return;
     }
 
-    shouldStopDownloadRef.current = false;
-    isPausedRef.current = false;
-    setIsPaused(false);
-
-    logger.info(`starting batch download: ${tracksWithIsrc.length} tracks`);
-    const settings = getSettings();
-    setIsDownloading(true);
-    setBulkDownloadType("all");
-    setDownloadProgress(0);
-
-    // Build output directory path (same logic as downloadWithSpotiDownloader)
-    let outputDir = settings.downloadPath;
-    const os = settings.operatingSystem;
-    if (playlistName && !isAlbum) {
-      outputDir = joinPath(os, outputDir, sanitizePath(playlistName.replace(/\//g, " "), os));
-    }
-
-    // Check file existence in parallel first
-    logger.info(`checking existing files in parallel...`);
-    const existenceChecks = tracksWithIsrc.map((track) => ({
-      isrc: track.isrc,
-      track_name: track.name || "",
-      artist_name: track.artists || "",
-    }));
-
-    const existenceResults = await CheckFilesExistence(outputDir, settings.audioFormat, existenceChecks);
-    const existingISRCs = new Set<string>();
-    const existingFilePaths = new Map<string, string>();
-
-    for (const result of existenceResults) {
-      if (result.exists) {
-        existingISRCs.add(result.isrc);
-        existingFilePaths.set(result.isrc, result.file_path || "");
-      }
-    }
-
-    logger.info(`found ${existingISRCs.size} existing files`);
-
-    // Mark existing files as skipped immediately and add to queue
-    const { AddToDownloadQueue } = await import("../../wailsjs/go/main/App");
-    for (const track of tracksWithIsrc) {
-      if (existingISRCs.has(track.isrc)) {
-        const itemID = await AddToDownloadQueue(track.isrc, track.name || "", track.artists || "", track.album_name || "");
-        const filePath = existingFilePaths.get(track.isrc) || "";
-        // Use a small delay to ensure the item is added before skipping
-        setTimeout(() => SkipDownloadItem(itemID, filePath), 10);
-        setSkippedTracks((prev) => new Set(prev).add(track.isrc));
-        setDownloadedTracks((prev) => new Set(prev).add(track.isrc));
-      }
-    }
-
-    // Filter out existing tracks
-    const tracksToDownload = tracksWithIsrc.filter((track) => !existingISRCs.has(track.isrc));
-
-    let successCount = 0;
-    let errorCount = 0;
-    let skippedCount = existingISRCs.size;
-    const total = tracksWithIsrc.length;
-
-    // Update progress to reflect already-skipped tracks
-    setDownloadProgress(Math.round((skippedCount / total) * 100));
-
-    for (let i = 0; i < tracksToDownload.length; i++) {
-      await waitIfPaused();
-
-      if (shouldStopDownloadRef.current) {
-        toast.info(`Download stopped. ${successCount} tracks downloaded, ${tracksToDownload.length - i} remaining.`);
-        break;
-      }
-
-      const track = tracksToDownload[i];
-      // Calculate original position in full list
-      const originalIndex = tracksWithIsrc.findIndex((t) => t.isrc === track.isrc);
-      setDownloadingTrack(track.isrc);
-      setCurrentDownloadInfo({ name: track.name, artists: track.artists });
-
-      try {
-        const releaseYear = track.release_date?.substring(0, 4);
-        const response = await downloadWithSpotiDownloader(track, settings, playlistName, originalIndex + 1, 0, isAlbum, releaseYear);
-
-        if (response.success) {
-          if (response.already_exists) {
-            skippedCount++;
-            logger.info(`skipped: ${track.name} - ${track.artists} (already exists)`);
-            setSkippedTracks((prev) => new Set(prev).add(track.isrc));
-          } else {
-            successCount++;
-            logger.success(`downloaded: ${track.name} - ${track.artists}`);
-          }
-          setDownloadedTracks((prev) => new Set(prev).add(track.isrc));
-          setFailedTracks((prev) => {
-            const newSet = new Set(prev);
-            newSet.delete(track.isrc);
-            return newSet;
-          });
-        } else {
-          errorCount++;
-          logger.error(`failed: ${track.name} - ${track.artists}`);
-          setFailedTracks((prev) => new Set(prev).add(track.isrc));
-        }
-      } catch (err) {
-        errorCount++;
-        logger.error(`error: ${track.name} - ${err}`);
-        setFailedTracks((prev) => new Set(prev).add(track.isrc));
-      }
-
-      const completedCount = skippedCount + successCount + errorCount;
-      setDownloadProgress(Math.min(100, Math.round((completedCount / total) * 100)));
-    }
-
-    setDownloadingTrack(null);
-    setCurrentDownloadInfo(null);
-    setIsDownloading(false);
-    setBulkDownloadType(null);
-    shouldStopDownloadRef.current = false;
-    isPausedRef.current = false;
-    setIsPaused(false);
-
-    logger.info(`batch complete: ${successCount} downloaded, ${skippedCount} skipped, ${errorCount} failed`);
-    if (errorCount === 0 && skippedCount === 0) {
-      toast.success(`Downloaded ${successCount} tracks successfully`);
-    } else if (errorCount === 0 && successCount === 0) {
-      toast.info(`${skippedCount} tracks already exist`);
-    } else if (errorCount === 0) {
-      toast.info(`${successCount} downloaded, ${skippedCount} skipped`);
-    } else {
-      const parts = [];
-      if (successCount > 0) parts.push(`${successCount} downloaded`);
-      if (skippedCount > 0) parts.push(`${skippedCount} skipped`);
-      parts.push(`${errorCount} failed`);
-      toast.warning(parts.join(", "));
-    }
+    await downloadBatch(
+      tracksWithIsrc,
+      tracksWithIsrc.map((_, i) => i + 1),
+      "all",
+      playlistName,
+      isAlbum
+    );
   };
 
   const handleStopDownload = () => {
+    const batchID = batchIDRef.current;
+    if (!batchID) return;
     logger.info("download stopped by user");
-    shouldStopDownloadRef.current = true;
-    isPausedRef.current = false;
+    CancelDownloadBatch(batchID);
     setIsPaused(false);
     toast.info("Stopping download...");
   };
 
   const handlePauseDownload = () => {
-    if (!isDownloading) return;
-    isPausedRef.current = true;
+    const batchID = batchIDRef.current;
+    if (!isDownloading || !batchID) return;
+    PauseDownloadBatch(batchID);
     setIsPaused(true);
     toast.info("Download paused");
   };
 
   const handleResumeDownload = () => {
-    if (!isPausedRef.current) return;
-    isPausedRef.current = false;
+    const batchID = batchIDRef.current;
+    if (!isPaused || !batchID) return;
+    ResumeDownloadBatch(batchID);
     setIsPaused(false);
     toast.info("Resuming download...");
   };
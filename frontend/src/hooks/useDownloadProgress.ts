@@ -1,5 +1,5 @@
-import { useState, useEffect, useRef } from "react";
-import { GetDownloadProgress } from "../../wailsjs/go/main/App";
+import { useMemo } from "react";
+import { useDownloadQueueData } from "./useDownloadQueueData";
 
 export interface DownloadProgressInfo {
   is_downloading: boolean;
@@ -8,37 +8,18 @@ export interface DownloadProgressInfo {
 }
 
 export function useDownloadProgress() {
-  const [progress, setProgress] = useState<DownloadProgressInfo>({
-    is_downloading: false,
-    mb_downloaded: 0,
-    speed_mbps: 0,
-  });
-  const intervalRef = useRef<number | null>(null);
+  const queueInfo = useDownloadQueueData();
 
-  useEffect(() => {
-    // Poll progress every 200ms for smooth updates
-    const pollProgress = async () => {
-      try {
-        const progressInfo = await GetDownloadProgress();
-        setProgress(progressInfo);
-      } catch (error) {
-        console.error("Failed to get download progress:", error);
+  // Summed over all items that are downloading, same as GetDownloadProgress
+  return useMemo<DownloadProgressInfo>(() => {
+    const progress = { is_downloading: false, mb_downloaded: 0, speed_mbps: 0 };
+    for (const item of queueInfo.queue) {
+      if (item.status === "downloading") {
+        progress.is_downloading = true;
+        progress.mb_downloaded += item.progress;
+        progress.speed_mbps += item.speed;
       }
-    };
-
-    // Start polling
-    intervalRef.current = window.setInterval(pollProgress, 200);
-
-    // Initial fetch
-    pollProgress();
-
-    // Cleanup
-    return () => {
-      if (intervalRef.current) {
-        clearInterval(intervalRef.current);
-      }
-    };
-  }, []);
-
-  return progress;
+    }
+    return progress;
+  }, [queueInfo]);
 }
@@ -1,21 +1,11 @@
 import { useEffect, useState } from "react";
 import { GetDownloadQueue } from "../../wailsjs/go/main/App";
+import { EventsOn } from "../../wailsjs/runtime/runtime";
 import { backend } from "../../wailsjs/go/models";
+import { DOWNLOAD_EVENT, applyDownloadEvent, emptyQueueInfo, type DownloadEvent } from "@/lib/download-events";
 
 export function useDownloadQueueData() {
-  const [queueInfo, setQueueInfo] = useState<backend.DownloadQueueInfo>(
-    new backend.DownloadQueueInfo({
-      is_downloading: false,
-      queue: [],
-      current_speed: 0,
-      total_downloaded: 0,
-      session_start_time: 0,
-      queued_count: 0,
-      completed_count: 0,
-      failed_count: 0,
-      skipped_count: 0,
-    })
-  );
+  const [queueInfo, setQueueInfo] = useState<backend.DownloadQueueInfo>(emptyQueueInfo);
 
   useEffect(() => {
     const fetchQueue = async () => {
@@ -27,13 +17,18 @@ export function useDownloadQueueData() {
       }
     };
 
-    // Initial fetch
+    // Initial fetch, then apply the changes pushed by the backend
     fetchQueue();
 
-    // Poll every 200ms
-    const interval = setInterval(fetchQueue, 200);
+    const unsubscribe = EventsOn(DOWNLOAD_EVENT, (event: DownloadEvent) => {
+      if (event.type === "reset") {
+        fetchQueue();
+        return;
+      }
+      setQueueInfo((prev) => applyDownloadEvent(prev, event));
+    });
 
-    return () => clearInterval(interval);
+    return () => unsubscribe();
   }, []);
 
   return queueInfo;
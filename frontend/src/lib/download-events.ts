@@ -0,0 +1,94 @@
+import { backend } from "../../wailsjs/go/models";
+
+// Wails event the backend pushes download queue changes on
+export const DOWNLOAD_EVENT = "download:event";
+
+export type DownloadEventType =
+  | "item-added"
+  | "started"
+  | "progress"
+  | "updated"
+  | "completed"
+  | "failed"
+  | "skipped"
+  | "paused"
+  | "queued"
+  | "removed"
+  | "reset"; // The whole queue changed, reload it with GetDownloadQueue
+
+export interface DownloadEvent {
+  type: DownloadEventType;
+  item_id?: string;
+  item?: backend.DownloadItem;
+  total_downloaded: number;
+  session_start_time: number;
+  time: number; // Unix milliseconds
+}
+
+export function emptyQueueInfo(): backend.DownloadQueueInfo {
+  return new backend.DownloadQueueInfo({
+    is_downloading: false,
+    queue: [],
+    current_speed: 0,
+    total_downloaded: 0,
+    session_start_time: 0,
+    queued_count: 0,
+    completed_count: 0,
+    failed_count: 0,
+    skipped_count: 0,
+    paused_count: 0,
+  });
+}
+
+// Apply an item event to the queue state. "reset" events are not handled here; reload the queue instead.
+export function applyDownloadEvent(info: backend.DownloadQueueInfo, event: DownloadEvent): backend.DownloadQueueInfo {
+  let queue = info.queue;
+
+  if (event.type === "removed") {
+    queue = queue.filter((item) => item.id !== event.item_id);
+  } else if (event.item) {
+    const updated = event.item;
+    const index = queue.findIndex((item) => item.id === updated.id);
+    queue = index === -1 ? [...queue, updated] : queue.map((item, i) => (i === index ? updated : item));
+  }
+
+  let queued = 0, completed = 0, failed = 0, skipped = 0, paused = 0;
+  let downloading = false;
+  let speed = 0;
+  for (const item of queue) {
+    switch (item.status) {
+      case "downloading":
+        downloading = true;
+        speed += item.speed;
+        break;
+      case "queued":
+        queued++;
+        break;
+      case "completed":
+        completed++;
+        break;
+      case "failed":
+        failed++;
+        break;
+      case "skipped":
+        skipped++;
+        break;
+      case "paused":
+        paused++;
+        break;
+    }
+  }
+
+  return new backend.DownloadQueueInfo({
+    is_downloading: downloading,
+    queue,
+    current_speed: speed,
+    total_downloaded: event.total_downloaded,
+    session_start_time: event.session_start_time,
+    queued_count: queued,
+    completed_count: completed,
+    failed_count: failed,
+    skipped_count: skipped,
+    paused_count: paused,
+  });
+}
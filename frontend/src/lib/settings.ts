@@ -6,6 +6,8 @@ export type FontFamily = "google-sans" | "inter" | "poppins" | "roboto" | "dm-sa
 export type FolderPreset = "none" | "artist" | "album" | "year-album" | "year-artist-album" | "artist-album" | "artist-year-album" | "artist-year-nested-album" | "album-artist" | "album-artist-album" | "album-artist-year-album" | "album-artist-year-nested-album" | "year" | "year-artist" | "custom";
 
 // Filename format presets
+export type TargetFilesystem = "windows" | "fat" | "posix";
+
 export type FilenamePreset = "title" | "title-artist" | "artist-title" | "track-title" | "track-title-artist" | "track-artist-title" | "title-album-artist" | "track-title-album-artist" | "artist-album-title" | "track-dash-title" | "disc-track-title" | "disc-track-title-artist" | "custom";
 
 export interface Settings {
@@ -21,6 +23,7 @@ export interface Settings {
   folderTemplate: string;
   filenamePreset: FilenamePreset;
   filenameTemplate: string;
+  filesystem: TargetFilesystem; // File and folder names are made valid for this filesystem
   // Legacy settings (kept for migration)
   filenameFormat?: "title-artist" | "artist-title" | "title";
   useAlbumArtist?: boolean; // Deprecated - use {album_artist} in template instead
@@ -30,10 +33,14 @@ export interface Settings {
   sfxEnabled: boolean;
   embedLyrics: boolean;
   embedMaxQualityCover: boolean;
+  joinArtists: boolean; // Tag artists as one "A, B" value instead of one value per artist
+  replayGain: boolean; // Write ReplayGain track and album tags after album downloads
   operatingSystem: "Windows" | "linux/MacOS";
   // Token fetcher settings
   tokenTimeout: number; // Timeout in seconds (5, 10, 15, 20, 25, 30)
   tokenRetry: number; // Retry count (1, 2, 3, 4, 5)
+  // Download providers to try, in order
+  providerOrder: string[];
 }
 
 // Folder preset templates
@@ -55,6 +62,13 @@ export const FOLDER_PRESETS: Record<FolderPreset, { label: string; template: str
   "custom": { label: "Custom...", template: "{artist}/{album}" },
 };
 
+// Filesystems that file and folder names can be made valid for
+export const FILESYSTEM_OPTIONS: Record<TargetFilesystem, { label: string; description: string }> = {
+  "windows": { label: "Windows (NTFS)", description: "Safe on every system" },
+  "fat": { label: "USB / SD card (FAT32, exFAT)", description: "Shorter paths for car stereos and players" },
+  "posix": { label: "Linux / macOS", description: "Only \"/\" is replaced" },
+};
+
 // Filename preset templates
 export const FILENAME_PRESETS: Record<FilenamePreset, { label: string; template: string }> = {
   "title": { label: "Title", template: "{title}" },
@@ -81,6 +95,20 @@ export const TEMPLATE_VARIABLES = [
   { key: "{track}", description: "Track number", example: "01" },
   { key: "{disc}", description: "Disc number", example: "1" },
   { key: "{year}", description: "Release year", example: "2014" },
+  { key: "{position}", description: "Position in the playlist", example: "07" },
+  { key: "{playlist}", description: "Playlist name", example: "Today's Top Hits" },
+  { key: "{album_type}", description: "Album type", example: "album" },
+  { key: "{isrc}", description: "ISRC", example: "USCJY1431309" },
+  { key: "{spotify_id}", description: "Spotify track ID", example: "0cqRj7pUJDkTCEsJkx8snD" },
+];
+
+// Template syntax beyond plain variables
+export const TEMPLATE_SYNTAX = [
+  { key: "{track:03}", description: "Zero-pad to 3 digits" },
+  { key: "{title:.40}", description: "Truncate to 40 characters" },
+  { key: "{artist:upper}", description: "Upper, lower or title case" },
+  { key: "{album_artist|artist}", description: "First non-empty variable" },
+  { key: "{disc?Disc {disc}/}", description: "Only when the variable has a value" },
 ];
 
 // Auto-detect operating system
@@ -104,13 +132,17 @@ export const DEFAULT_SETTINGS: Settings = {
   folderTemplate: "",
   filenamePreset: "title-artist",
   filenameTemplate: "{title} - {artist}",
+  filesystem: "windows",
   trackNumber: false,
   sfxEnabled: true,
   embedLyrics: false,
   embedMaxQualityCover: false,
+  joinArtists: false,
+  replayGain: false,
   operatingSystem: detectOS(),
   tokenTimeout: 5,
-  tokenRetry: 1
+  tokenRetry: 1,
+  providerOrder: ["spotidownloader"]
 };
 
 export const FONT_OPTIONS: { value: FontFamily; label: string; fontFamily: string }[] = [
@@ -203,38 +235,6 @@ export function getSettings(): Settings {
   return DEFAULT_SETTINGS;
 }
 
-// Parse template and replace variables with actual values
-export interface TemplateData {
-  artist?: string;
-  album?: string;
-  album_artist?: string;
-  title?: string;
-  track?: number;
-  disc?: number;
-  year?: string;
-  isrc?: string;
-  playlist?: string;
-}
-
-export function parseTemplate(template: string, data: TemplateData): string {
-  if (!template) return "";
-  
-  let result = template;
-  
-  // Replace each variable
-  result = result.replace(/\{title\}/g, data.title || "Unknown Title");
-  result = result.replace(/\{artist\}/g, data.artist || "Unknown Artist");
-  result = result.replace(/\{album\}/g, data.album || "Unknown Album");
-  result = result.replace(/\{album_artist\}/g, data.album_artist || data.artist || "Unknown Artist");
-  result = result.replace(/\{track\}/g, data.track ? String(data.track).padStart(2, "0") : "00");
-  result = result.replace(/\{disc\}/g, data.disc ? String(data.disc) : "1");
-  result = result.replace(/\{year\}/g, data.year || "0000");
-  result = result.replace(/\{isrc\}/g, data.isrc || "");
-  result = result.replace(/\{playlist\}/g, data.playlist || "");
-  
-  return result;
-}
-
 export async function getSettingsWithDefaults(): Promise<Settings> {
   const settings = getSettings();
   
@@ -24,6 +24,10 @@ export interface TrackMetadata {
   artist_id?: string;
   artist_url?: string;
   artists_data?: ArtistSimple[];
+  label?: string;
+  copyright?: string;
+  total_discs?: number;
+  genres?: string[];
 }
 
 export interface TrackResponse {
@@ -143,14 +147,26 @@ export interface DownloadRequest {
   session_token: string;
   track_name?: string;
   artist_name?: string;
+  artists?: string[]; // Individual track artists, tagged as separate values
+  join_artists?: boolean;
   album_name?: string;
   album_artist?: string;
   release_date?: string;
+  album_type?: string;
   cover_url?: string;
   album_track_number?: number;
   disc_number?: number;
   total_tracks?: number; // Total tracks in album from Spotify
+  total_discs?: number;
+  album_id?: string; // Spotify album ID
+  label?: string;
+  copyright?: string;
+  genres?: string[];
+  duration_ms?: number;
   output_dir?: string;
+  folder_template?: string; // Sub-folders below output_dir, rendered by the backend
+  playlist_name?: string;
+  filesystem?: string; // "windows", "fat" or "posix"
   audio_format?: string;
   filename_format?: string;
   track_number?: boolean;
@@ -160,6 +176,8 @@ export interface DownloadRequest {
   embed_lyrics?: boolean; // Whether to embed lyrics into the audio file
   embed_max_quality_cover?: boolean; // Whether to embed max quality cover art
   item_id?: string; // Optional queue item ID for tracking
+  provider_order?: string[]; // Download providers to try, in order
+  format_policy?: "flac-only" | "prefer-flac" | "mp3-only"; // Derived from audio_format when omitted
 }
 
 export interface DownloadResponse {
@@ -169,6 +187,7 @@ export interface DownloadResponse {
   error?: string;
   already_exists?: boolean;
   item_id?: string; // Queue item ID for tracking
+  format?: string; // Audio format actually received (flac or mp3)
 }
 
 export interface HealthResponse {
@@ -184,6 +203,9 @@ export interface LyricsDownloadRequest {
   album_artist?: string;
   release_date?: string;
   output_dir?: string;
+  folder_template?: string; // Sub-folders below output_dir, rendered by the backend
+  playlist_name?: string;
+  filesystem?: string; // "windows", "fat" or "posix"
   filename_format?: string;
   track_number?: boolean;
   position?: number;
@@ -227,6 +249,37 @@ export interface AnalysisResult {
   spectrum?: SpectrumData;
 }
 
+export interface FlacAvailabilityRequest {
+  session_token: string;
+  track_ids: string[]; // Spotify track IDs
+}
+
+export interface FlacAvailability {
+  track_id: string;
+  available: boolean;
+  error?: string;
+}
+
+export interface LoudnessScanRequest {
+  folder?: string; // Scanned recursively
+  files?: string[];
+  write_tags: boolean; // Write ReplayGain tags; otherwise only measure
+}
+
+export interface LoudnessResult {
+  path: string;
+  album?: string;
+  integrated_lufs: number;
+  true_peak_dbtp: number;
+  loudness_range_lu: number;
+  track_gain_db: number;
+  track_peak: number;
+  album_gain_db?: number;
+  album_peak?: number;
+  tagged: boolean;
+  error?: string;
+}
+
 export interface CoverDownloadRequest {
   cover_url: string;
   track_name: string;
@@ -235,6 +288,9 @@ export interface CoverDownloadRequest {
   album_artist?: string;
   release_date?: string;
   output_dir?: string;
+  folder_template?: string; // Sub-folders below output_dir, rendered by the backend
+  playlist_name?: string;
+  filesystem?: string; // "windows", "fat" or "posix"
   filename_format?: string;
   track_number?: boolean;
   position?: number;